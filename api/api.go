@@ -8,6 +8,10 @@ import (
 type ErrorResponse struct {
 	Op string
 	Err string
+	// http status of the response, 409 means that expected version of the key didn't match.
+	// Errors received over RESP get the status http api responds with: 400 for ERR and WRONGTYPE,
+	// 507 for OOM and 503 for MISCONF
+	Status int
 }
 
 func (e *ErrorResponse) Error() string {
@@ -15,10 +19,27 @@ func (e *ErrorResponse) Error() string {
 }
 
 
+// SetOptions correspond to options of redis SET
+type SetOptions struct {
+	// write only if key doesn't exist
+	NX bool
+	// write only if key exists
+	XX bool
+	// respond with SetResult containing previous value
+	Get bool
+	// retain ttl of existing key
+	KeepTTL bool
+	// write only if version of the key returned by GET is the same, 0 means key must not exist.
+	// SET with this option responds with SetResult containing new version
+	Version *uint64
+}
+
+// SetParams embed SetOptions, so they are specified at the top level of json
 type SetParams struct {
 	Key string
 	Value interface{}
 	Ttl time.Duration
+	SetOptions
 }
 
 func ValidateSetParams(p *SetParams) error {
@@ -29,14 +50,30 @@ func ValidateSetParams(p *SetParams) error {
 		return errors.New("value argument must be specified")
 	}
 	if p.Ttl < 0 {
-		return errors.New("ttl argument must be nonegative")
+		return errors.New("ttl argument must be nonnegative")
+	}
+	if p.NX && p.XX {
+		return errors.New("NX and XX options are mutually exclusive")
+	}
+	if p.KeepTTL && p.Ttl > 0 {
+		return errors.New("KeepTTL option can't be used with ttl")
 	}
 	return nil
 }
 
+// SetResult is a response to SET with Get option
+type SetResult struct {
+	Written bool
+	Previous interface{}
+	// version of the key after the write
+	Version uint64
+}
+
 
 type GetParams struct {
 	Key string
+	// respond with VersionedValue
+	WithVersion bool
 }
 
 func ValidateGetParams(p *GetParams) error {
@@ -47,14 +84,26 @@ func ValidateGetParams(p *GetParams) error {
 }
 
 
+// VersionedValue is a response to GET with WithVersion option
+type VersionedValue struct {
+	Value interface{}
+	Version uint64
+}
+
+
 type DelParams struct {
 	Keys []string
+	// delete only if version of the key is the same
+	Version *uint64
 }
 
 func ValidateDelParams(p *DelParams) error {
 	if p.Keys == nil || len(p.Keys) == 0 {
 		return errors.New("at least one key must be in keys argument")
 	}
+	if p.Version != nil && len(p.Keys) != 1 {
+		return errors.New("version argument can be used with one key only")
+	}
 	return nil
 }
 
@@ -68,4 +117,15 @@ func ValidateKeysParams(p *KeysParams) error {
 		return errors.New("pattern argument must be specified")
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+type TypeParams struct {
+	Key string
+}
+
+func ValidateTypeParams(p *TypeParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -16,6 +17,9 @@ import (
 type Client interface {
 	URL(ep string) *url.URL
 	Do(r *http.Request) (*http.Response, []byte, error)
+	// Stream sends request without timeout and returns response with unread body,
+	// it is used for responses which last long like SUBSCRIBE
+	Stream(r *http.Request) (*http.Response, error)
 }
 
 // non-positive timeout means no timeout
@@ -42,6 +46,7 @@ func NewClient(address string, timeout time.Duration) (Client, error) {
 type httpClient struct {
 	endpoint *url.URL
 	client http.Client
+	stream http.Client
 }
 
 func (c *httpClient) URL(ep string) *url.URL {
@@ -68,18 +73,156 @@ func (c *httpClient) Do(r *http.Request) (*http.Response, []byte, error) {
 	return resp, body, err
 }
 
+func (c *httpClient) Stream(r *http.Request) (*http.Response, error) {
+	return c.stream.Do(r)
+}
 
-//TODO: add more context to errors
 
+// ClientAPI is served by both http api and RESP, see HTTPAPI for methods served only by http api.
+// Values are mapped differently by transports: http api returns values decoded from json, so they keep
+// their types, while RESPAPI sends values which aren't strings encoded to json and returns all values
+// as strings. Both return nil for missing values and *api.ErrorResponse for errors of commands
 type ClientAPI interface {
 	// return value: "OK"
 	Set(key string, value interface{}, ttl time.Duration) (interface{}, error)
+	// return value tells whether the write happened, previous value is returned if opts.Get is set.
+	// opts.Version must be nil, writes conditional on version are done by SetIfVersion of HTTPAPI
+	SetWithOptions(key string, value interface{}, ttl time.Duration, opts api.SetOptions) (api.SetResult, error)
 	Get(key string) (interface{}, error)
 	Del(keys ...string) (int, error)
 	Keys(pattern string) ([]string, error)
+	// Scan iterates keys without blocking the server, zero cursor starts and ends iteration.
+	// See NewScanIterator for convenient iteration
+	Scan(cursor uint64, opts api.ScanOptions) (api.ScanResult, error)
+	// return value: nil in place of missing keys and keys of aggregate types
+	MGet(keys ...string) ([]interface{}, error)
+	// MSet writes all items atomically, each with its own ttl
+	MSet(items ...api.KeyValue) error
+	// return value: 1 if all items were written, 0 if any of the keys exists
+	MSetNX(items ...api.KeyValue) (int, error)
+	// return value: "none", "string", "hash", "list", "set" or "zset"
+	Type(key string) (string, error)
+
+	// return value: remaining time to live, -2 if key doesn't exist, -1 if key has no ttl
+	TTL(key string) (int64, error)
+	PTTL(key string) (int64, error)
+	// return value: 1 if ttl was changed, 0 otherwise
+	Expire(key string, seconds int64) (int, error)
+	PExpire(key string, milliseconds int64) (int, error)
+	ExpireAt(key string, timestamp int64) (int, error)
+	Persist(key string) (int, error)
+
+	// return value: value of the counter after the operation
+	Incr(key string) (int64, error)
+	Decr(key string) (int64, error)
+	IncrBy(key string, increment int64) (int64, error)
+	DecrBy(key string, decrement int64) (int64, error)
+	IncrByFloat(key string, increment float64) (float64, error)
+
+	// string commands fail if value is neither string nor number, lengths and offsets are in bytes
+	// return value: length of the string after the operation
+	Append(key string, value string) (int, error)
+	// negative offsets count from the end, end is inclusive
+	GetRange(key string, start, end int) (string, error)
+	SetRange(key string, offset int, value string) (int, error)
+	StrLen(key string) (int, error)
+	// return value: nil if key doesn't exist
+	GetDel(key string) (interface{}, error)
+	GetEx(key string, opts api.GetExOptions) (interface{}, error)
+
+	// commands of hashes fail with "WRONGTYPE" error if key holds value of different type
+	// return value: number of added fields
+	HSet(key string, fields map[string]interface{}) (int, error)
+	// return value: nil if field doesn't exist
+	HGet(key string, field string) (interface{}, error)
+	// return value: number of deleted fields
+	HDel(key string, fields ...string) (int, error)
+	HGetAll(key string) (map[string]interface{}, error)
+	HIncrBy(key string, field string, increment int64) (int64, error)
+	HKeys(key string) ([]string, error)
+	HLen(key string) (int, error)
+
+	// return value: length of the list after push
+	LPush(key string, values ...interface{}) (int, error)
+	RPush(key string, values ...interface{}) (int, error)
+	// return value: nil if list doesn't exist
+	LPop(key string) (interface{}, error)
+	RPop(key string) (interface{}, error)
+	// negative indices count from the end, stop is inclusive
+	LRange(key string, start, stop int) ([]interface{}, error)
+	LTrim(key string, start, stop int) error
+	LLen(key string) (int, error)
+	// return value: nil on timeout, zero timeout means waiting forever.
+	// Client timeout must be greater than timeout of blocking pop
+	BLPop(timeout time.Duration, keys ...string) (*api.BPopResult, error)
+	BRPop(timeout time.Duration, keys ...string) (*api.BPopResult, error)
+
+	// return value: number of added or removed members
+	SAdd(key string, members ...string) (int, error)
+	SRem(key string, members ...string) (int, error)
+	// return value: sorted members
+	SMembers(key string) ([]string, error)
+	// return value: 1 if member is in the set, 0 otherwise
+	SIsMember(key string, member string) (int, error)
+	SCard(key string) (int, error)
+	// missing keys are treated as empty sets
+	SInter(keys ...string) ([]string, error)
+	SUnion(keys ...string) ([]string, error)
+	SDiff(keys ...string) ([]string, error)
+	// return value: size of the result written to dst
+	SInterStore(dst string, keys ...string) (int, error)
+	SUnionStore(dst string, keys ...string) (int, error)
+	SDiffStore(dst string, keys ...string) (int, error)
+
+	// return value: number of added members, scores of existing ones are updated
+	ZAdd(key string, members ...api.ZMember) (int, error)
+	// return value: new score of the member
+	ZIncrBy(key string, member string, increment float64) (float64, error)
+	ZRem(key string, members ...string) (int, error)
+	// return value: nil if member doesn't exist
+	ZScore(key string, member string) (*float64, error)
+	ZCard(key string) (int, error)
+	// return value: 0-based rank, nil if member doesn't exist
+	ZRank(key string, member string, reverse bool) (*int, error)
+	ZRange(key string, start, stop int, reverse bool) ([]api.ZMember, error)
+	ZRangeByScore(params *api.ZRangeByScoreParams) ([]api.ZMember, error)
+
+	// return value: number of subscriptions the message was delivered to
+	Publish(channel string, message string) (int, error)
+	// Subscribe returns when subscription is active, messages are received until it's closed.
+	// Patterns are glob patterns like in KEYS
+	Subscribe(channels []string, patterns []string) (*Subscription, error)
+	// SubscribeKeyEvents receives keyspace notifications about keys matching glob pattern,
+	// it fails unless notifications are enabled on server
+	SubscribeKeyEvents(pattern string) (*KeyEventSubscription, error)
+}
+
+// HTTPAPI adds methods using versions of keys and pipelines of http api, which have no counterpart in RESP
+type HTTPAPI interface {
+	ClientAPI
+
+	// Pipeline executes commands one by one in a single round trip, see Pipeline.
+	// return value: results of commands in the same order, failed commands have errors in their results
+	Pipeline(cmds ...api.Command) ([]api.PipelineResult, error)
+
+	// return value: nil if key doesn't exist
+	GetWithVersion(key string) (*api.VersionedValue, error)
+	// SetIfVersion writes only if the key has the version, zero version means that key must not exist.
+	// Version mismatch is reported as *api.ErrorResponse with status 409.
+	// return value: Written is always true, Version is the new version of the key
+	SetIfVersion(key string, value interface{}, ttl time.Duration, version uint64) (api.SetResult, error)
+	// DelIfVersion fails with *api.ErrorResponse with status 409 if version of the key isn't the same.
+	// return value: 1 if key was deleted, 0 if it doesn't exist
+	DelIfVersion(key string, version uint64) (int, error)
+
+	// return value: versions of the keys to be passed to Exec
+	Watch(keys ...string) (map[string]uint64, error)
+	// Exec executes commands atomically if watched keys weren't modified, see Tx.
+	// return value: results of commands, nil if some of the watched keys was modified
+	Exec(watched map[string]uint64, cmds ...api.Command) ([]api.CommandResult, error)
 }
 
-func NewAPI(c Client) ClientAPI {
+func NewAPI(c Client) HTTPAPI {
 	return &httpAPI{
 		client: c,
 	}
@@ -89,104 +232,143 @@ type httpAPI struct {
 	client Client
 }
 
-func (h *httpAPI) Set(key string, value interface{}, ttl time.Duration) (interface{}, error) {
-	params := &api.SetParams {
-		Key: key,
-		Value: value,
-		Ttl: ttl,
+// call posts params to the api endpoint and decodes response into result,
+// errors reported by server are returned as *api.ErrorResponse
+func (h *httpAPI) call(ep string, params interface{}, result interface{}) error {
+	req, err := h.request(ep, params)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := h.client.Do(req)
+	if err != nil {
+		return err
 	}
-	reqBody, err := json.Marshal(params) 
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(ep, resp, body)
+	}
+	return json.Unmarshal(body, result)
+}
+
+func (h *httpAPI) request(ep string, params interface{}) (*http.Request, error) {
+	reqBody, err := json.Marshal(params)
 	if err != nil {
 		return nil, err
 	}
 
-	url := h.client.URL("/set")
+	url := h.client.URL(ep)
 	req, err := http.NewRequest(http.MethodPost, url.String(), bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, err
 	}
 	req.Header["Content-Type"] = []string{"application/json"}
+	return req, nil
+}
 
-	_, body, err := h.client.Do(req)
-	if err != nil {
-		return nil, err
+// responseError returns *api.ErrorResponse from body of failed response if it contains one
+func responseError(ep string, resp *http.Response, body []byte) error {
+	errResp := new(api.ErrorResponse)
+	if err := json.Unmarshal(body, errResp); err != nil || errResp.Err == "" {
+		return fmt.Errorf("%s: unexpected response status %s", ep, resp.Status)
+	}
+	errResp.Status = resp.StatusCode
+	return errResp
+}
+
+func (h *httpAPI) Set(key string, value interface{}, ttl time.Duration) (interface{}, error) {
+	params := &api.SetParams {
+		Key: key,
+		Value: value,
+		Ttl: ttl,
 	}
 
 	var result interface{}
-	return result, json.Unmarshal(body, &result)
+	err := h.call("/set", params, &result)
+	return result, err
 }
 
-func (h *httpAPI) Get(key string) (interface{}, error) {
-	params := &api.GetParams {
+func (h *httpAPI) SetWithOptions(key string, value interface{}, ttl time.Duration, opts api.SetOptions) (api.SetResult, error) {
+	params := &api.SetParams {
 		Key: key,
-	}
-	reqBody, err := json.Marshal(params) 
-	if err != nil {
-		return nil, err
+		Value: value,
+		Ttl: ttl,
+		SetOptions: opts,
 	}
 
-	url := h.client.URL("/get")
-	req, err := http.NewRequest(http.MethodPost, url.String(), bytes.NewReader(reqBody))
-	if err != nil {
-		return nil, err
+	if opts.Get || opts.Version != nil {
+		var result api.SetResult
+		err := h.call("/set", params, &result)
+		return result, err
 	}
-	req.Header["Content-Type"] = []string{"application/json"}
 
-	_, body, err := h.client.Do(req)
-	if err != nil {
-		return nil, err
+	var result interface{}
+	err := h.call("/set", params, &result)
+	return api.SetResult{Written: result != nil}, err
+}
+
+func (h *httpAPI) SetIfVersion(key string, value interface{}, ttl time.Duration, version uint64) (api.SetResult, error) {
+	return h.SetWithOptions(key, value, ttl, api.SetOptions{Version: &version})
+}
+
+func (h *httpAPI) Get(key string) (interface{}, error) {
+	params := &api.GetParams {
+		Key: key,
 	}
 
 	var result interface{}
-	return result, json.Unmarshal(body, &result)
+	err := h.call("/get", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) GetWithVersion(key string) (*api.VersionedValue, error) {
+	params := &api.GetParams {
+		Key: key,
+		WithVersion: true,
+	}
+
+	var result *api.VersionedValue
+	err := h.call("/get", params, &result)
+	return result, err
 }
 
 func (h *httpAPI) Del(keys ...string) (int, error) {
 	params := &api.DelParams {
 		Keys: keys,
 	}
-	reqBody, err := json.Marshal(params) 
-	if err != nil {
-		return 0, err
-	}
 
-	url := h.client.URL("/del")
-	req, err := http.NewRequest(http.MethodPost, url.String(), bytes.NewReader(reqBody))
-	if err != nil {
-		return 0, err
-	}
-	req.Header["Content-Type"] = []string{"application/json"}
+	var result int
+	err := h.call("/del", params, &result)
+	return result, err
+}
 
-	_, body, err := h.client.Do(req)
-	if err != nil {
-		return 0, err
+func (h *httpAPI) DelIfVersion(key string, version uint64) (int, error) {
+	params := &api.DelParams {
+		Keys: []string{key},
+		Version: &version,
 	}
 
 	var result int
-	return result, json.Unmarshal(body, &result)
+	err := h.call("/del", params, &result)
+	return result, err
 }
 
 func (h *httpAPI) Keys(pattern string) ([]string, error) {
 	params := &api.KeysParams {
 		Pattern: pattern,
 	}
-	reqBody, err := json.Marshal(params) 
-	if err != nil {
-		return nil, err
-	}
 
-	url := h.client.URL("/keys")
-	req, err := http.NewRequest(http.MethodPost, url.String(), bytes.NewReader(reqBody))
-	if err != nil {
-		return nil, err
-	}
-	req.Header["Content-Type"] = []string{"application/json"}
+	var result []string
+	err := h.call("/keys", params, &result)
+	return result, err
+}
 
-	_, body, err := h.client.Do(req)
-	if err != nil {
-		return nil, err
+func (h *httpAPI) Type(key string) (string, error) {
+	params := &api.TypeParams {
+		Key: key,
 	}
 
-	var result []string
-	return result, json.Unmarshal(body, &result)
-}
\ No newline at end of file
+	var result string
+	err := h.call("/type", params, &result)
+	return result, err
+}
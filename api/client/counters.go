@@ -0,0 +1,58 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) Incr(key string) (int64, error) {
+	params := &api.IncrParams {
+		Key: key,
+	}
+
+	var result int64
+	err := h.call("/incr", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) Decr(key string) (int64, error) {
+	params := &api.IncrParams {
+		Key: key,
+	}
+
+	var result int64
+	err := h.call("/decr", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) IncrBy(key string, increment int64) (int64, error) {
+	params := &api.IncrByParams {
+		Key: key,
+		Increment: increment,
+	}
+
+	var result int64
+	err := h.call("/incrby", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) DecrBy(key string, decrement int64) (int64, error) {
+	params := &api.DecrByParams {
+		Key: key,
+		Decrement: decrement,
+	}
+
+	var result int64
+	err := h.call("/decrby", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) IncrByFloat(key string, increment float64) (float64, error) {
+	params := &api.IncrByFloatParams {
+		Key: key,
+		Increment: increment,
+	}
+
+	var result float64
+	err := h.call("/incrbyfloat", params, &result)
+	return result, err
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) HSet(key string, fields map[string]interface{}) (int, error) {
+	params := &api.HSetParams {
+		Key: key,
+		Fields: fields,
+	}
+
+	var result int
+	err := h.call("/hset", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HGet(key string, field string) (interface{}, error) {
+	params := &api.HGetParams {
+		Key: key,
+		Field: field,
+	}
+
+	var result interface{}
+	err := h.call("/hget", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HDel(key string, fields ...string) (int, error) {
+	params := &api.HDelParams {
+		Key: key,
+		Fields: fields,
+	}
+
+	var result int
+	err := h.call("/hdel", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HGetAll(key string) (map[string]interface{}, error) {
+	params := &api.HashParams {
+		Key: key,
+	}
+
+	var result map[string]interface{}
+	err := h.call("/hgetall", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HIncrBy(key string, field string, increment int64) (int64, error) {
+	params := &api.HIncrByParams {
+		Key: key,
+		Field: field,
+		Increment: increment,
+	}
+
+	var result int64
+	err := h.call("/hincrby", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HKeys(key string) ([]string, error) {
+	params := &api.HashParams {
+		Key: key,
+	}
+
+	var result []string
+	err := h.call("/hkeys", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) HLen(key string) (int, error) {
+	params := &api.HashParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/hlen", params, &result)
+	return result, err
+}
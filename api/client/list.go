@@ -0,0 +1,104 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"time"
+)
+
+func (h *httpAPI) LPush(key string, values ...interface{}) (int, error) {
+	params := &api.PushParams {
+		Key: key,
+		Values: values,
+	}
+
+	var result int
+	err := h.call("/lpush", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) RPush(key string, values ...interface{}) (int, error) {
+	params := &api.PushParams {
+		Key: key,
+		Values: values,
+	}
+
+	var result int
+	err := h.call("/rpush", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) LPop(key string) (interface{}, error) {
+	params := &api.ListParams {
+		Key: key,
+	}
+
+	var result interface{}
+	err := h.call("/lpop", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) RPop(key string) (interface{}, error) {
+	params := &api.ListParams {
+		Key: key,
+	}
+
+	var result interface{}
+	err := h.call("/rpop", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) LRange(key string, start, stop int) ([]interface{}, error) {
+	params := &api.RangeParams {
+		Key: key,
+		Start: start,
+		Stop: stop,
+	}
+
+	var result []interface{}
+	err := h.call("/lrange", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) LTrim(key string, start, stop int) error {
+	params := &api.RangeParams {
+		Key: key,
+		Start: start,
+		Stop: stop,
+	}
+
+	var result interface{}
+	return h.call("/ltrim", params, &result)
+}
+
+func (h *httpAPI) LLen(key string) (int, error) {
+	params := &api.ListParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/llen", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) BLPop(timeout time.Duration, keys ...string) (*api.BPopResult, error) {
+	params := &api.BPopParams {
+		Keys: keys,
+		Timeout: timeout,
+	}
+
+	var result *api.BPopResult
+	err := h.call("/blpop", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) BRPop(timeout time.Duration, keys ...string) (*api.BPopResult, error) {
+	params := &api.BPopParams {
+		Keys: keys,
+		Timeout: timeout,
+	}
+
+	var result *api.BPopResult
+	err := h.call("/brpop", params, &result)
+	return result, err
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) MGet(keys ...string) ([]interface{}, error) {
+	params := &api.MGetParams {
+		Keys: keys,
+	}
+
+	var result []interface{}
+	err := h.call("/mget", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) MSet(items ...api.KeyValue) error {
+	params := &api.MSetParams {
+		Items: items,
+	}
+
+	var result interface{}
+	return h.call("/mset", params, &result)
+}
+
+func (h *httpAPI) MSetNX(items ...api.KeyValue) (int, error) {
+	params := &api.MSetParams {
+		Items: items,
+	}
+
+	var result int
+	err := h.call("/msetnx", params, &result)
+	return result, err
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var errUnexpectedResults = errors.New("pipeline: number of results differs from number of commands")
+
+func (h *httpAPI) Pipeline(cmds ...api.Command) ([]api.PipelineResult, error) {
+	params := &api.PipelineParams {
+		Commands: cmds,
+	}
+
+	var result []api.PipelineResult
+	err := h.call("/pipeline", params, &result)
+	return result, err
+}
+
+// Pipeline queues commands on client side and sends them in one request, results
+// are decoded into values passed along with commands:
+//
+//	p := client.NewPipeline(c)
+//	var value interface{}
+//	var deleted int
+//	p.Set("a", "1", 0)
+//	get := p.Get("a", &value)
+//	p.Del(&deleted, "b", "c")
+//	p.Queue("incr", &api.IncrParams{Key: "counter"}, nil)
+//	if err := p.Flush(); err != nil {
+//		...
+//	}
+//	if err := get.Err(); err != nil {
+//		...
+//	}
+type Pipeline struct {
+	c HTTPAPI
+	queued []api.Command
+	calls []*PipelinedCall
+}
+
+// PipelinedCall is a queued command, Flush decodes its result or sets its error
+type PipelinedCall struct {
+	result interface{}
+	err error
+}
+
+// Err returns *api.ErrorResponse if command failed, error of the whole pipeline if it wasn't sent
+// and error of decoding if result doesn't fit the value passed with the command
+func (call *PipelinedCall) Err() error {
+	return call.err
+}
+
+func NewPipeline(c HTTPAPI) *Pipeline {
+	return &Pipeline{
+		c: c,
+	}
+}
+
+// Queue adds command with params of its endpoint, result of the endpoint is decoded into result
+// unless it's nil. Error of params encoding is returned by Err of the call
+func (p *Pipeline) Queue(op string, params interface{}, result interface{}) *PipelinedCall {
+	cmd, err := api.NewCommand(op, params)
+	call := &PipelinedCall{
+		result: result,
+		err: err,
+	}
+	p.queued = append(p.queued, cmd)
+	p.calls = append(p.calls, call)
+	return call
+}
+
+func (p *Pipeline) Set(key string, value interface{}, ttl time.Duration) *PipelinedCall {
+	return p.Queue("set", &api.SetParams{Key: key, Value: value, Ttl: ttl}, nil)
+}
+
+// Get stores nil into value if key doesn't exist
+func (p *Pipeline) Get(key string, value *interface{}) *PipelinedCall {
+	return p.Queue("get", &api.GetParams{Key: key}, value)
+}
+
+func (p *Pipeline) Del(deleted *int, keys ...string) *PipelinedCall {
+	return p.Queue("del", &api.DelParams{Keys: keys}, deleted)
+}
+
+func (p *Pipeline) Keys(pattern string, keys *[]string) *PipelinedCall {
+	return p.Queue("keys", &api.KeysParams{Pattern: pattern}, keys)
+}
+
+// Len returns number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.queued)
+}
+
+// Discard forgets queued commands
+func (p *Pipeline) Discard() {
+	p.queued = nil
+	p.calls = nil
+}
+
+// Flush sends queued commands in one request, after that Pipeline can be reused like after Discard.
+// Returned error tells that request failed, errors of commands are returned by their calls.
+// Commands with params which failed to encode aren't sent
+func (p *Pipeline) Flush() error {
+	defer p.Discard()
+
+	sent := make([]api.Command, 0, len(p.queued))
+	calls := make([]*PipelinedCall, 0, len(p.calls))
+	for i, call := range p.calls {
+		if call.err == nil {
+			sent = append(sent, p.queued[i])
+			calls = append(calls, call)
+		}
+	}
+	if len(sent) == 0 {
+		return nil
+	}
+
+	results, err := p.c.Pipeline(sent...)
+	if err == nil && len(results) != len(sent) {
+		err = errUnexpectedResults
+	}
+	if err != nil {
+		for _, call := range calls {
+			call.err = err
+		}
+		return err
+	}
+
+	for i, call := range calls {
+		switch {
+		case results[i].Error != nil:
+			call.err = results[i].Error
+		case call.result != nil:
+			call.err = json.Unmarshal(results[i].Value, call.result)
+		}
+	}
+	return nil
+}
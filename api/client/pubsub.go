@@ -0,0 +1,229 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+func (h *httpAPI) Publish(channel string, message string) (int, error) {
+	params := &api.PublishParams {
+		Channel: channel,
+		Message: message,
+	}
+
+	var result int
+	err := h.call("/publish", params, &result)
+	return result, err
+}
+
+// Subscription receives messages from the stream of server-sent events or from RESP connection:
+//
+//	sub, err := c.Subscribe([]string{"invalidations"}, []string{"news.*"})
+//	if err != nil {
+//		...
+//	}
+//	defer sub.Close()
+//	for msg := range sub.Messages() {
+//		fmt.Println(msg.Channel, msg.Payload)
+//	}
+//	if err := sub.Err(); err != nil {
+//		...
+//	}
+type Subscription struct {
+	*stream
+	messages chan api.Message
+}
+
+func (h *httpAPI) Subscribe(channels []string, patterns []string) (*Subscription, error) {
+	params := &api.SubscribeParams {
+		Channels: channels,
+		Patterns: patterns,
+	}
+
+	st, r, err := h.openStream("/subscribe", params, "subscribe")
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		stream: st,
+		messages: make(chan api.Message),
+	}
+	go func() {
+		defer close(sub.messages)
+		st.receive(r, "message", func(data []byte) (bool, error) {
+			var msg api.Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return false, err
+			}
+			select {
+			case sub.messages <- msg:
+				return true, nil
+			case <-st.done:
+				return false, nil
+			}
+		})
+	}()
+	return sub, nil
+}
+
+// Messages returns channel of received messages, it's closed when subscription ends
+func (s *Subscription) Messages() <-chan api.Message {
+	return s.messages
+}
+
+// stream reads server-sent events from response body or messages from RESP connection
+type stream struct {
+	body io.ReadCloser
+	done chan struct{}
+	closeOnce sync.Once
+	err error
+}
+
+// openStream posts params to the endpoint and waits for the event confirming
+// that subscription is active
+func (h *httpAPI) openStream(ep string, params interface{}, confirmation string) (*stream, *bufio.Reader, error) {
+	req, err := h.request(ep, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := h.client.Stream(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, responseError(ep, resp, body)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if event, _, err := readEvent(r); err != nil || event != confirmation {
+		resp.Body.Close()
+		if err == nil {
+			err = fmt.Errorf("%s: unexpected event %q", ep, event)
+		}
+		return nil, nil, err
+	}
+
+	st := &stream{
+		body: resp.Body,
+		done: make(chan struct{}),
+	}
+	return st, r, nil
+}
+
+// readEvent reads server-sent event, lines of its data are joined
+func readEvent(r *bufio.Reader) (string, []byte, error) {
+	event := ""
+	var data []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0:
+			if event != "" || data != nil {
+				return event, data, nil
+			}
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" "))...)
+		}
+	}
+}
+
+// receive passes data of events with given name to deliver until it returns false or stream ends
+func (s *stream) receive(r *bufio.Reader, event string, deliver func(data []byte) (bool, error)) {
+	defer s.body.Close()
+
+	for {
+		name, data, err := readEvent(r)
+		if err != nil {
+			select {
+			case <-s.done:
+				// body was closed by Close
+			default:
+				s.err = err
+			}
+			return
+		}
+		if name != event {
+			continue
+		}
+
+		ok, err := deliver(data)
+		if !ok {
+			s.err = err
+			return
+		}
+	}
+}
+
+// Err returns error which ended subscription, it is valid after channel is closed.
+// Server ends subscription with io.EOF if client doesn't keep up with it
+func (s *stream) Err() error {
+	return s.err
+}
+
+func (s *stream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.body.Close()
+	})
+}
+
+// KeyEventSubscription receives keyspace notifications, it's used like Subscription
+type KeyEventSubscription struct {
+	*stream
+	events chan api.KeyEvent
+}
+
+func (h *httpAPI) SubscribeKeyEvents(pattern string) (*KeyEventSubscription, error) {
+	params := &api.KeyEventsParams {
+		Pattern: pattern,
+	}
+
+	st, r, err := h.openStream("/keyevents", params, "subscribe")
+	if err != nil {
+		return nil, err
+	}
+	sub := &KeyEventSubscription{
+		stream: st,
+		events: make(chan api.KeyEvent),
+	}
+	go func() {
+		defer close(sub.events)
+		st.receive(r, "keyevent", func(data []byte) (bool, error) {
+			var event api.KeyEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return false, err
+			}
+			select {
+			case sub.events <- event:
+				return true, nil
+			case <-st.done:
+				return false, nil
+			}
+		})
+	}()
+	return sub, nil
+}
+
+// Events returns channel of received notifications, it's closed when subscription ends
+func (s *KeyEventSubscription) Events() <-chan api.KeyEvent {
+	return s.events
+}
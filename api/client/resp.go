@@ -0,0 +1,415 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api/resp"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnsupported is wrapped by errors of methods which the transport can't serve,
+	// like SetWithOptions with version over RESP
+	ErrUnsupported = errors.New("not supported by this transport")
+	ErrClientClosed = errors.New("client is closed")
+	// ErrPoolTimeout is returned if all MaxActive connections stay busy for Timeout
+	ErrPoolTimeout = errors.New("timed out waiting for a free connection")
+)
+
+// RESPOptions configure RESP client, zero values are replaced by defaults
+type RESPOptions struct {
+	// maximum number of idle connections kept by the pool, 8 by default
+	MaxIdle int
+	// maximum number of open connections, calls wait for a free one up to Timeout when it's reached.
+	// Non-positive means no limit
+	MaxActive int
+	// timeout of connecting, 5 seconds by default
+	DialTimeout time.Duration
+	// timeout of a call, non-positive means no timeout. Blocking pops extend it by their timeout
+	Timeout time.Duration
+	// version of the protocol negotiated by HELLO, 2 by default
+	Protocol int
+}
+
+// RESPAPI implements ClientAPI over RESP with a pool of connections, it is safe for concurrent use.
+// Values which aren't strings are sent encoded to json and all values are returned as strings,
+// like by redis. Subscriptions use dedicated connections
+type RESPAPI struct {
+	address string
+	opts RESPOptions
+	pool *connPool
+}
+
+var _ ClientAPI = (*RESPAPI)(nil)
+
+// NewRESPAPI connects to the server to check that it's reachable, the connection is kept in the pool
+func NewRESPAPI(address string, opts RESPOptions) (*RESPAPI, error) {
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 8
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Protocol == 0 {
+		opts.Protocol = 2
+	}
+	if opts.Protocol != 2 && opts.Protocol != 3 {
+		return nil, fmt.Errorf("unknown protocol version %d", opts.Protocol)
+	}
+
+	r := &RESPAPI{
+		address: address,
+		opts: opts,
+	}
+	r.pool = newConnPool(r.dial, opts.MaxIdle, opts.MaxActive)
+
+	c, err := r.pool.get(r.deadline(0))
+	if err != nil {
+		r.pool.close()
+		return nil, err
+	}
+	r.pool.put(c, false)
+	return r, nil
+}
+
+// Close closes idle connections, connections in use are closed when their calls end
+func (r *RESPAPI) Close() error {
+	r.pool.close()
+	return nil
+}
+
+type respConn struct {
+	conn net.Conn
+	r *resp.Reader
+	w *resp.Writer
+}
+
+func (r *RESPAPI) dial() (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", r.address, r.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{
+		conn: conn,
+		r: resp.NewReader(conn),
+		w: resp.NewWriter(conn),
+	}
+	if r.opts.Protocol == 3 {
+		v, err := c.roundTrip(r.deadline(0), "HELLO", "3")
+		if err == nil {
+			err = v.Err()
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// deadline of a call blocking for extra time, zero time means no deadline
+func (r *RESPAPI) deadline(extra time.Duration) time.Time {
+	if r.opts.Timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(r.opts.Timeout + extra)
+}
+
+// roundTrip returns error only if connection can't be used anymore, error reply is returned as value
+func (c *respConn) roundTrip(deadline time.Time, args ...string) (resp.Value, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return resp.Value{}, err
+	}
+	c.w.WriteCommand(args...)
+	if err := c.w.Flush(); err != nil {
+		return resp.Value{}, err
+	}
+	return c.r.ReadValue()
+}
+
+// connPool keeps idle connections and limits number of open ones
+type connPool struct {
+	dial func() (*respConn, error)
+	maxIdle int
+	// slots has a token for every open connection if number of them is limited
+	slots chan struct{}
+
+	// done is closed by close to wake up calls waiting for a slot
+	done chan struct{}
+
+	mutex sync.Mutex
+	idle []*respConn
+	closed bool
+}
+
+func newConnPool(dial func() (*respConn, error), maxIdle int, maxActive int) *connPool {
+	p := &connPool{
+		dial: dial,
+		maxIdle: maxIdle,
+		done: make(chan struct{}),
+	}
+	if maxActive > 0 {
+		p.slots = make(chan struct{}, maxActive)
+	}
+	return p
+}
+
+// get waits for a free slot until deadline, zero deadline means waiting until the pool is closed
+func (p *connPool) get(deadline time.Time) (*respConn, error) {
+	if err := p.acquire(deadline); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		p.release()
+		return nil, ErrClientClosed
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n - 1]
+		p.idle = p.idle[:n - 1]
+		p.mutex.Unlock()
+		return c, nil
+	}
+	p.mutex.Unlock()
+
+	c, err := p.dial()
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns connection to the pool, broken connection is closed
+func (p *connPool) put(c *respConn, broken bool) {
+	defer p.release()
+
+	p.mutex.Lock()
+	if broken || p.closed || len(p.idle) >= p.maxIdle {
+		p.mutex.Unlock()
+		c.conn.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+	p.mutex.Unlock()
+}
+
+func (p *connPool) acquire(deadline time.Time) error {
+	if p.slots == nil {
+		return nil
+	}
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-expired:
+		return ErrPoolTimeout
+	case <-p.done:
+		return ErrClientClosed
+	}
+}
+
+func (p *connPool) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+func (p *connPool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.closed {
+		close(p.done)
+	}
+	p.closed = true
+	for _, c := range p.idle {
+		c.conn.Close()
+	}
+	p.idle = nil
+}
+
+// do sends command and waits for the reply, error replies are returned as *api.ErrorResponse
+// with Op set to the name of the command. Commands blocking on server pass their timeout as block,
+// negative block means that command may block forever
+func (r *RESPAPI) do(block time.Duration, args ...string) (resp.Value, error) {
+	c, err := r.pool.get(r.deadline(0))
+	if err != nil {
+		return resp.Value{}, err
+	}
+	deadline := r.deadline(block)
+	if block < 0 {
+		deadline = time.Time{}
+	}
+	v, err := c.roundTrip(deadline, args...)
+	r.pool.put(c, err != nil)
+	if err != nil {
+		return resp.Value{}, err
+	}
+
+	if err := v.Err(); err != nil {
+		return resp.Value{}, errorResponse(args[0], err)
+	}
+	return v, nil
+}
+
+// errorResponse converts error reply of the command, kind of error is kept only if it isn't generic,
+// so texts are the same as over http. Status is the one http api responds with to errors of this kind
+func errorResponse(cmd string, err error) *api.ErrorResponse {
+	msg := err.Error()
+	kind := msg
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		kind = msg[:i]
+	}
+
+	status := http.StatusInternalServerError
+	switch kind {
+	case "ERR", "WRONGTYPE":
+		status = http.StatusBadRequest
+	case "OOM":
+		status = http.StatusInsufficientStorage
+	case "MISCONF":
+		status = http.StatusServiceUnavailable
+	}
+	return &api.ErrorResponse{
+		Op: strings.ToUpper(cmd),
+		Err: strings.TrimPrefix(msg, "ERR "),
+		Status: status,
+	}
+}
+
+func (r *RESPAPI) call(args ...string) (resp.Value, error) {
+	return r.do(0, args...)
+}
+
+func unsupported(op string) error {
+	return fmt.Errorf("%s: %w", op, ErrUnsupported)
+}
+
+// argOf converts value to argument of command, values which aren't strings are encoded to json
+func argOf(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// milliseconds rounds duration up, so positive ttl doesn't become zero
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d + time.Millisecond - 1) / time.Millisecond), 10)
+}
+
+// replies are converted by the following functions, which fail if reply has unexpected type
+
+func replyError(v resp.Value, expected string) error {
+	return fmt.Errorf("%w: expected %s reply, got '%c'", resp.ErrProtocol, expected, v.Type)
+}
+
+func stringOf(v resp.Value, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v.Type {
+	case resp.TypeSimpleString, resp.TypeBulkString, resp.TypeVerbatim:
+		return v.Str, nil
+	}
+	return "", replyError(v, "string")
+}
+
+// optionalOf returns nil for null reply
+func optionalOf(v resp.Value, err error) (interface{}, error) {
+	if err != nil || v.IsNull() {
+		return nil, err
+	}
+	return stringOf(v, nil)
+}
+
+func int64Of(v resp.Value, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if v.Type != resp.TypeInteger {
+		return 0, replyError(v, "integer")
+	}
+	return v.Int, nil
+}
+
+func intOf(v resp.Value, err error) (int, error) {
+	n, err := int64Of(v, err)
+	return int(n), err
+}
+
+// floatOf accepts double of RESP3 and bulk string of RESP2
+func floatOf(v resp.Value, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if v.Type == resp.TypeDouble {
+		return v.Float, nil
+	}
+	s, err := stringOf(v, nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// elemsOf returns elements of array, set or map, null reply gives nil
+func elemsOf(v resp.Value, err error) ([]resp.Value, error) {
+	if err != nil || v.IsNull() {
+		return nil, err
+	}
+	switch v.Type {
+	case resp.TypeArray, resp.TypeSet, resp.TypeMap, resp.TypePush:
+		return v.Elems, nil
+	}
+	return nil, replyError(v, "array")
+}
+
+func stringsOf(v resp.Value, err error) ([]string, error) {
+	elems, err := elemsOf(v, err)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(elems))
+	for i, elem := range elems {
+		if result[i], err = stringOf(elem, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func optionalsOf(v resp.Value, err error) ([]interface{}, error) {
+	elems, err := elemsOf(v, err)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		if result[i], err = optionalOf(elem, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
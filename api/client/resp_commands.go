@@ -0,0 +1,664 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api/resp"
+
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (r *RESPAPI) Set(key string, value interface{}, ttl time.Duration) (interface{}, error) {
+	arg, err := argOf(value)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"SET", key, arg}
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+	return stringOf(r.call(args...))
+}
+
+// SetWithOptions tells whether the write happened by the previous value if opts.Get is set
+func (r *RESPAPI) SetWithOptions(key string, value interface{}, ttl time.Duration, opts api.SetOptions) (api.SetResult, error) {
+	if opts.Version != nil {
+		return api.SetResult{}, unsupported("SET")
+	}
+	arg, err := argOf(value)
+	if err != nil {
+		return api.SetResult{}, err
+	}
+	args := []string{"SET", key, arg}
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+	if opts.NX {
+		args = append(args, "NX")
+	}
+	if opts.XX {
+		args = append(args, "XX")
+	}
+	if opts.KeepTTL {
+		args = append(args, "KEEPTTL")
+	}
+	if opts.Get {
+		args = append(args, "GET")
+	}
+
+	v, err := r.call(args...)
+	if err != nil {
+		return api.SetResult{}, err
+	}
+	if !opts.Get {
+		return api.SetResult{Written: !v.IsNull()}, nil
+	}
+	previous, err := optionalOf(v, nil)
+	if err != nil {
+		return api.SetResult{}, err
+	}
+	written := true
+	if opts.NX {
+		written = previous == nil
+	} else if opts.XX {
+		written = previous != nil
+	}
+	return api.SetResult{Written: written, Previous: previous}, nil
+}
+
+func (r *RESPAPI) Get(key string) (interface{}, error) {
+	return optionalOf(r.call("GET", key))
+}
+
+func (r *RESPAPI) Del(keys ...string) (int, error) {
+	return intOf(r.call(append([]string{"DEL"}, keys...)...))
+}
+
+func (r *RESPAPI) Keys(pattern string) ([]string, error) {
+	return stringsOf(r.call("KEYS", pattern))
+}
+
+func (r *RESPAPI) Scan(cursor uint64, opts api.ScanOptions) (api.ScanResult, error) {
+	args := []string{"SCAN", strconv.FormatUint(cursor, 10)}
+	if opts.Match != "" {
+		args = append(args, "MATCH", opts.Match)
+	}
+	if opts.Count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(opts.Count))
+	}
+	if opts.Type != "" {
+		args = append(args, "TYPE", opts.Type)
+	}
+
+	elems, err := elemsOf(r.call(args...))
+	if err != nil {
+		return api.ScanResult{}, err
+	}
+	if len(elems) != 2 {
+		return api.ScanResult{}, replyError(resp.Value{Type: resp.TypeArray}, "cursor and keys")
+	}
+	next, err := stringOf(elems[0], nil)
+	if err != nil {
+		return api.ScanResult{}, err
+	}
+	result := api.ScanResult{}
+	if result.Cursor, err = strconv.ParseUint(next, 10, 64); err != nil {
+		return api.ScanResult{}, err
+	}
+	result.Keys, err = stringsOf(elems[1], nil)
+	return result, err
+}
+
+func (r *RESPAPI) MGet(keys ...string) ([]interface{}, error) {
+	return optionalsOf(r.call(append([]string{"MGET"}, keys...)...))
+}
+
+// msetArgs fails if some item has ttl, MSET of redis can't set it
+func msetArgs(op string, items []api.KeyValue) ([]string, error) {
+	args := []string{op}
+	for _, item := range items {
+		if item.Ttl != 0 {
+			return nil, unsupported(op + " with ttl")
+		}
+		arg, err := argOf(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, item.Key, arg)
+	}
+	return args, nil
+}
+
+func (r *RESPAPI) MSet(items ...api.KeyValue) error {
+	args, err := msetArgs("MSET", items)
+	if err != nil {
+		return err
+	}
+	_, err = r.call(args...)
+	return err
+}
+
+func (r *RESPAPI) MSetNX(items ...api.KeyValue) (int, error) {
+	args, err := msetArgs("MSETNX", items)
+	if err != nil {
+		return 0, err
+	}
+	return intOf(r.call(args...))
+}
+
+func (r *RESPAPI) Type(key string) (string, error) {
+	return stringOf(r.call("TYPE", key))
+}
+
+func (r *RESPAPI) TTL(key string) (int64, error) {
+	return int64Of(r.call("TTL", key))
+}
+
+func (r *RESPAPI) PTTL(key string) (int64, error) {
+	return int64Of(r.call("PTTL", key))
+}
+
+func (r *RESPAPI) Expire(key string, seconds int64) (int, error) {
+	return intOf(r.call("EXPIRE", key, strconv.FormatInt(seconds, 10)))
+}
+
+func (r *RESPAPI) PExpire(key string, milliseconds int64) (int, error) {
+	return intOf(r.call("PEXPIRE", key, strconv.FormatInt(milliseconds, 10)))
+}
+
+func (r *RESPAPI) ExpireAt(key string, timestamp int64) (int, error) {
+	return intOf(r.call("EXPIREAT", key, strconv.FormatInt(timestamp, 10)))
+}
+
+func (r *RESPAPI) Persist(key string) (int, error) {
+	return intOf(r.call("PERSIST", key))
+}
+
+func (r *RESPAPI) Incr(key string) (int64, error) {
+	return int64Of(r.call("INCR", key))
+}
+
+func (r *RESPAPI) Decr(key string) (int64, error) {
+	return int64Of(r.call("DECR", key))
+}
+
+func (r *RESPAPI) IncrBy(key string, increment int64) (int64, error) {
+	return int64Of(r.call("INCRBY", key, strconv.FormatInt(increment, 10)))
+}
+
+func (r *RESPAPI) DecrBy(key string, decrement int64) (int64, error) {
+	return int64Of(r.call("DECRBY", key, strconv.FormatInt(decrement, 10)))
+}
+
+func (r *RESPAPI) IncrByFloat(key string, increment float64) (float64, error) {
+	return floatOf(r.call("INCRBYFLOAT", key, resp.FormatDouble(increment)))
+}
+
+func (r *RESPAPI) Append(key string, value string) (int, error) {
+	return intOf(r.call("APPEND", key, value))
+}
+
+func (r *RESPAPI) GetRange(key string, start, end int) (string, error) {
+	return stringOf(r.call("GETRANGE", key, strconv.Itoa(start), strconv.Itoa(end)))
+}
+
+func (r *RESPAPI) SetRange(key string, offset int, value string) (int, error) {
+	return intOf(r.call("SETRANGE", key, strconv.Itoa(offset), value))
+}
+
+func (r *RESPAPI) StrLen(key string) (int, error) {
+	return intOf(r.call("STRLEN", key))
+}
+
+func (r *RESPAPI) GetDel(key string) (interface{}, error) {
+	return optionalOf(r.call("GETDEL", key))
+}
+
+func (r *RESPAPI) GetEx(key string, opts api.GetExOptions) (interface{}, error) {
+	args := []string{"GETEX", key}
+	switch {
+	case opts.Ttl > 0:
+		args = append(args, "PX", milliseconds(opts.Ttl))
+	case opts.Timestamp != 0:
+		args = append(args, "EXAT", strconv.FormatInt(opts.Timestamp, 10))
+	case opts.Persist:
+		args = append(args, "PERSIST")
+	}
+	return optionalOf(r.call(args...))
+}
+
+// HSet sends fields in sorted order
+func (r *RESPAPI) HSet(key string, fields map[string]interface{}) (int, error) {
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	args := []string{"HSET", key}
+	for _, field := range names {
+		arg, err := argOf(fields[field])
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, field, arg)
+	}
+	return intOf(r.call(args...))
+}
+
+func (r *RESPAPI) HGet(key string, field string) (interface{}, error) {
+	return optionalOf(r.call("HGET", key, field))
+}
+
+func (r *RESPAPI) HDel(key string, fields ...string) (int, error) {
+	return intOf(r.call(append([]string{"HDEL", key}, fields...)...))
+}
+
+// HGetAll accepts map of RESP3 as well as flat array of RESP2
+func (r *RESPAPI) HGetAll(key string) (map[string]interface{}, error) {
+	elems, err := elemsOf(r.call("HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(elems) / 2)
+	for i := 0; i + 1 < len(elems); i += 2 {
+		field, err := stringOf(elems[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		if result[field], err = optionalOf(elems[i + 1], nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (r *RESPAPI) HIncrBy(key string, field string, increment int64) (int64, error) {
+	return int64Of(r.call("HINCRBY", key, field, strconv.FormatInt(increment, 10)))
+}
+
+func (r *RESPAPI) HKeys(key string) ([]string, error) {
+	return stringsOf(r.call("HKEYS", key))
+}
+
+func (r *RESPAPI) HLen(key string) (int, error) {
+	return intOf(r.call("HLEN", key))
+}
+
+func (r *RESPAPI) push(op string, key string, values []interface{}) (int, error) {
+	args := []string{op, key}
+	for _, value := range values {
+		arg, err := argOf(value)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, arg)
+	}
+	return intOf(r.call(args...))
+}
+
+func (r *RESPAPI) LPush(key string, values ...interface{}) (int, error) {
+	return r.push("LPUSH", key, values)
+}
+
+func (r *RESPAPI) RPush(key string, values ...interface{}) (int, error) {
+	return r.push("RPUSH", key, values)
+}
+
+func (r *RESPAPI) LPop(key string) (interface{}, error) {
+	return optionalOf(r.call("LPOP", key))
+}
+
+func (r *RESPAPI) RPop(key string) (interface{}, error) {
+	return optionalOf(r.call("RPOP", key))
+}
+
+func (r *RESPAPI) LRange(key string, start, stop int) ([]interface{}, error) {
+	return optionalsOf(r.call("LRANGE", key, strconv.Itoa(start), strconv.Itoa(stop)))
+}
+
+func (r *RESPAPI) LTrim(key string, start, stop int) error {
+	_, err := r.call("LTRIM", key, strconv.Itoa(start), strconv.Itoa(stop))
+	return err
+}
+
+func (r *RESPAPI) LLen(key string) (int, error) {
+	return intOf(r.call("LLEN", key))
+}
+
+// bpop extends timeout of the call by timeout of the pop, unlike http client
+func (r *RESPAPI) bpop(op string, timeout time.Duration, keys []string) (*api.BPopResult, error) {
+	args := append([]string{op}, keys...)
+	args = append(args, resp.FormatDouble(timeout.Seconds()))
+	block := timeout
+	if timeout <= 0 {
+		block = -1
+	}
+
+	elems, err := elemsOf(r.do(block, args...))
+	if err != nil || elems == nil {
+		return nil, err
+	}
+	if len(elems) != 2 {
+		return nil, replyError(resp.Value{Type: resp.TypeArray}, "key and value")
+	}
+	key, err := stringOf(elems[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	value, err := optionalOf(elems[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	return &api.BPopResult{Key: key, Value: value}, nil
+}
+
+func (r *RESPAPI) BLPop(timeout time.Duration, keys ...string) (*api.BPopResult, error) {
+	return r.bpop("BLPOP", timeout, keys)
+}
+
+func (r *RESPAPI) BRPop(timeout time.Duration, keys ...string) (*api.BPopResult, error) {
+	return r.bpop("BRPOP", timeout, keys)
+}
+
+func (r *RESPAPI) SAdd(key string, members ...string) (int, error) {
+	return intOf(r.call(append([]string{"SADD", key}, members...)...))
+}
+
+func (r *RESPAPI) SRem(key string, members ...string) (int, error) {
+	return intOf(r.call(append([]string{"SREM", key}, members...)...))
+}
+
+// sorted sorts members of a set, server sends them sorted, but it isn't guaranteed by redis
+func sorted(members []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (r *RESPAPI) SMembers(key string) ([]string, error) {
+	return sorted(stringsOf(r.call("SMEMBERS", key)))
+}
+
+func (r *RESPAPI) SIsMember(key string, member string) (int, error) {
+	return intOf(r.call("SISMEMBER", key, member))
+}
+
+func (r *RESPAPI) SCard(key string) (int, error) {
+	return intOf(r.call("SCARD", key))
+}
+
+func (r *RESPAPI) SInter(keys ...string) ([]string, error) {
+	return sorted(stringsOf(r.call(append([]string{"SINTER"}, keys...)...)))
+}
+
+func (r *RESPAPI) SUnion(keys ...string) ([]string, error) {
+	return sorted(stringsOf(r.call(append([]string{"SUNION"}, keys...)...)))
+}
+
+func (r *RESPAPI) SDiff(keys ...string) ([]string, error) {
+	return sorted(stringsOf(r.call(append([]string{"SDIFF"}, keys...)...)))
+}
+
+func (r *RESPAPI) SInterStore(dst string, keys ...string) (int, error) {
+	return intOf(r.call(append([]string{"SINTERSTORE", dst}, keys...)...))
+}
+
+func (r *RESPAPI) SUnionStore(dst string, keys ...string) (int, error) {
+	return intOf(r.call(append([]string{"SUNIONSTORE", dst}, keys...)...))
+}
+
+func (r *RESPAPI) SDiffStore(dst string, keys ...string) (int, error) {
+	return intOf(r.call(append([]string{"SDIFFSTORE", dst}, keys...)...))
+}
+
+func (r *RESPAPI) ZAdd(key string, members ...api.ZMember) (int, error) {
+	args := []string{"ZADD", key}
+	for _, m := range members {
+		args = append(args, resp.FormatDouble(m.Score), m.Member)
+	}
+	return intOf(r.call(args...))
+}
+
+func (r *RESPAPI) ZIncrBy(key string, member string, increment float64) (float64, error) {
+	return floatOf(r.call("ZINCRBY", key, resp.FormatDouble(increment), member))
+}
+
+func (r *RESPAPI) ZRem(key string, members ...string) (int, error) {
+	return intOf(r.call(append([]string{"ZREM", key}, members...)...))
+}
+
+func (r *RESPAPI) ZScore(key string, member string) (*float64, error) {
+	v, err := r.call("ZSCORE", key, member)
+	if err != nil || v.IsNull() {
+		return nil, err
+	}
+	score, err := floatOf(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &score, nil
+}
+
+func (r *RESPAPI) ZCard(key string) (int, error) {
+	return intOf(r.call("ZCARD", key))
+}
+
+func (r *RESPAPI) ZRank(key string, member string, reverse bool) (*int, error) {
+	op := "ZRANK"
+	if reverse {
+		op = "ZREVRANK"
+	}
+	v, err := r.call(op, key, member)
+	if err != nil || v.IsNull() {
+		return nil, err
+	}
+	rank, err := intOf(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rank, nil
+}
+
+// zmembersOf accepts pairs of member and score of RESP3 as well as flat array of RESP2
+func zmembersOf(v resp.Value, err error) ([]api.ZMember, error) {
+	elems, err := elemsOf(v, err)
+	if err != nil {
+		return nil, err
+	}
+	pairs := elems
+	if len(elems) > 0 && elems[0].Type == resp.TypeArray {
+		pairs = make([]resp.Value, 0, 2 * len(elems))
+		for _, elem := range elems {
+			pairs = append(pairs, elem.Elems...)
+		}
+	}
+	if len(pairs) % 2 != 0 {
+		return nil, replyError(resp.Value{Type: resp.TypeArray}, "members with scores")
+	}
+
+	result := make([]api.ZMember, len(pairs) / 2)
+	for i := range result {
+		if result[i].Member, err = stringOf(pairs[2 * i], nil); err != nil {
+			return nil, err
+		}
+		if result[i].Score, err = floatOf(pairs[2 * i + 1], nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (r *RESPAPI) ZRange(key string, start, stop int, reverse bool) ([]api.ZMember, error) {
+	args := []string{"ZRANGE", key, strconv.Itoa(start), strconv.Itoa(stop), "WITHSCORES"}
+	if reverse {
+		args = append(args, "REV")
+	}
+	return zmembersOf(r.call(args...))
+}
+
+// ZRangeByScore treats non-positive Count as no limit like http api
+func (r *RESPAPI) ZRangeByScore(params *api.ZRangeByScoreParams) ([]api.ZMember, error) {
+	args := []string{"ZRANGEBYSCORE", params.Key, params.Min, params.Max, "WITHSCORES"}
+	if params.Reverse {
+		args = []string{"ZREVRANGEBYSCORE", params.Key, params.Max, params.Min, "WITHSCORES"}
+	}
+	if params.Offset != 0 || params.Count > 0 {
+		count := params.Count
+		if count <= 0 {
+			count = -1
+		}
+		args = append(args, "LIMIT", strconv.Itoa(params.Offset), strconv.Itoa(count))
+	}
+	return zmembersOf(r.call(args...))
+}
+
+func (r *RESPAPI) Publish(channel string, message string) (int, error) {
+	return intOf(r.call("PUBLISH", channel, message))
+}
+
+// subscribe sends commands over dedicated connection and waits for confirmation of every channel
+// and pattern, then the connection only receives messages. Commands without channels are skipped
+func (r *RESPAPI) subscribe(cmds ...[]string) (*stream, *resp.Reader, error) {
+	c, err := r.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.conn.SetDeadline(r.deadline(0)); err != nil {
+		c.conn.Close()
+		return nil, nil, err
+	}
+	for _, args := range cmds {
+		if len(args) > 1 {
+			c.w.WriteCommand(args...)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		c.conn.Close()
+		return nil, nil, err
+	}
+	for _, args := range cmds {
+		for range args[1:] {
+			v, err := c.r.ReadValue()
+			if err == nil && v.Err() != nil {
+				err = errorResponse(args[0], v.Err())
+			}
+			if err != nil {
+				c.conn.Close()
+				return nil, nil, err
+			}
+		}
+	}
+	if err := c.conn.SetDeadline(time.Time{}); err != nil {
+		c.conn.Close()
+		return nil, nil, err
+	}
+
+	st := &stream{
+		body: c.conn,
+		done: make(chan struct{}),
+	}
+	return st, c.r, nil
+}
+
+// messageOf converts pushed message, other replies give false
+func messageOf(v resp.Value) (api.Message, bool) {
+	elems, err := stringsOf(v, nil)
+	switch {
+	case err != nil:
+	case len(elems) == 3 && elems[0] == "message":
+		return api.Message{Channel: elems[1], Payload: elems[2]}, true
+	case len(elems) == 4 && elems[0] == "pmessage":
+		return api.Message{Pattern: elems[1], Channel: elems[2], Payload: elems[3]}, true
+	}
+	return api.Message{}, false
+}
+
+// receiveMessages passes pushed messages to deliver until it returns false or connection fails
+func (s *stream) receiveMessages(r *resp.Reader, deliver func(msg api.Message) (bool, error)) {
+	defer s.body.Close()
+
+	for {
+		v, err := r.ReadValue()
+		if err != nil {
+			select {
+			case <-s.done:
+				// connection was closed by Close
+			default:
+				s.err = err
+			}
+			return
+		}
+		msg, ok := messageOf(v)
+		if !ok {
+			continue
+		}
+
+		ok, err = deliver(msg)
+		if !ok {
+			s.err = err
+			return
+		}
+	}
+}
+
+func (r *RESPAPI) Subscribe(channels []string, patterns []string) (*Subscription, error) {
+	params := &api.SubscribeParams{Channels: channels, Patterns: patterns}
+	if err := api.ValidateSubscribeParams(params); err != nil {
+		return nil, errorResponse("SUBSCRIBE", err)
+	}
+
+	st, rd, err := r.subscribe(append([]string{"SUBSCRIBE"}, channels...), append([]string{"PSUBSCRIBE"}, patterns...))
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		stream: st,
+		messages: make(chan api.Message),
+	}
+	go func() {
+		defer close(sub.messages)
+		st.receiveMessages(rd, func(msg api.Message) (bool, error) {
+			select {
+			case sub.messages <- msg:
+				return true, nil
+			case <-st.done:
+				return false, nil
+			}
+		})
+	}()
+	return sub, nil
+}
+
+// SubscribeKeyEvents subscribes to api.KeyspaceChannel followed by the pattern
+func (r *RESPAPI) SubscribeKeyEvents(pattern string) (*KeyEventSubscription, error) {
+	if err := api.ValidateKeyEventsParams(&api.KeyEventsParams{Pattern: pattern}); err != nil {
+		return nil, errorResponse("PSUBSCRIBE", err)
+	}
+
+	st, rd, err := r.subscribe([]string{"PSUBSCRIBE", api.KeyspaceChannel + pattern})
+	if err != nil {
+		return nil, err
+	}
+	sub := &KeyEventSubscription{
+		stream: st,
+		events: make(chan api.KeyEvent),
+	}
+	go func() {
+		defer close(sub.events)
+		st.receiveMessages(rd, func(msg api.Message) (bool, error) {
+			event := api.KeyEvent{Event: msg.Payload, Key: strings.TrimPrefix(msg.Channel, api.KeyspaceChannel)}
+			select {
+			case sub.events <- event:
+				return true, nil
+			case <-st.done:
+				return false, nil
+			}
+		})
+	}()
+	return sub, nil
+}
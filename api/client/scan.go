@@ -0,0 +1,76 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) Scan(cursor uint64, opts api.ScanOptions) (api.ScanResult, error) {
+	params := &api.ScanParams {
+		Cursor: cursor,
+		ScanOptions: opts,
+	}
+
+	var result api.ScanResult
+	err := h.call("/scan", params, &result)
+	return result, err
+}
+
+// ScanIterator walks the whole keyspace with SCAN calls, the same key may be returned more than once:
+//
+//	it := client.NewScanIterator(c, api.ScanOptions{Match: "user:*"})
+//	for it.Next() {
+//		fmt.Println(it.Key())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ScanIterator struct {
+	c ClientAPI
+	opts api.ScanOptions
+
+	cursor uint64
+	keys []string
+	key string
+	started bool
+	err error
+}
+
+func NewScanIterator(c ClientAPI, opts api.ScanOptions) *ScanIterator {
+	return &ScanIterator{
+		c: c,
+		opts: opts,
+	}
+}
+
+// Next advances iterator to the next key, fetching keys if needed.
+// It returns false when iteration is over or failed
+func (it *ScanIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.err != nil || (it.started && it.cursor == 0) {
+			return false
+		}
+
+		result, err := it.c.Scan(it.cursor, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.started = true
+		it.cursor = result.Cursor
+		it.keys = result.Keys
+	}
+
+	it.key = it.keys[0]
+	it.keys = it.keys[1:]
+	return true
+}
+
+// Key returns the key Next advanced to
+func (it *ScanIterator) Key() string {
+	return it.key
+}
+
+// Err returns error of the failed SCAN call
+func (it *ScanIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) SAdd(key string, members ...string) (int, error) {
+	params := &api.MembersParams {
+		Key: key,
+		Members: members,
+	}
+
+	var result int
+	err := h.call("/sadd", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SRem(key string, members ...string) (int, error) {
+	params := &api.MembersParams {
+		Key: key,
+		Members: members,
+	}
+
+	var result int
+	err := h.call("/srem", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SMembers(key string) ([]string, error) {
+	params := &api.SMembersParams {
+		Key: key,
+	}
+
+	var result []string
+	err := h.call("/smembers", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SIsMember(key string, member string) (int, error) {
+	params := &api.SIsMemberParams {
+		Key: key,
+		Member: member,
+	}
+
+	var result int
+	err := h.call("/sismember", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SCard(key string) (int, error) {
+	params := &api.SMembersParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/scard", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) setAlgebra(ep string, keys []string) ([]string, error) {
+	params := &api.SetAlgebraParams {
+		Keys: keys,
+	}
+
+	var result []string
+	err := h.call(ep, params, &result)
+	return result, err
+}
+
+func (h *httpAPI) setAlgebraStore(ep string, dst string, keys []string) (int, error) {
+	params := &api.SetAlgebraStoreParams {
+		Destination: dst,
+		Keys: keys,
+	}
+
+	var result int
+	err := h.call(ep, params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SInter(keys ...string) ([]string, error) {
+	return h.setAlgebra("/sinter", keys)
+}
+
+func (h *httpAPI) SUnion(keys ...string) ([]string, error) {
+	return h.setAlgebra("/sunion", keys)
+}
+
+func (h *httpAPI) SDiff(keys ...string) ([]string, error) {
+	return h.setAlgebra("/sdiff", keys)
+}
+
+func (h *httpAPI) SInterStore(dst string, keys ...string) (int, error) {
+	return h.setAlgebraStore("/sinterstore", dst, keys)
+}
+
+func (h *httpAPI) SUnionStore(dst string, keys ...string) (int, error) {
+	return h.setAlgebraStore("/sunionstore", dst, keys)
+}
+
+func (h *httpAPI) SDiffStore(dst string, keys ...string) (int, error) {
+	return h.setAlgebraStore("/sdiffstore", dst, keys)
+}
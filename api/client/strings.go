@@ -0,0 +1,71 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) Append(key string, value string) (int, error) {
+	params := &api.AppendParams {
+		Key: key,
+		Value: value,
+	}
+
+	var result int
+	err := h.call("/append", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) GetRange(key string, start, end int) (string, error) {
+	params := &api.GetRangeParams {
+		Key: key,
+		Start: start,
+		End: end,
+	}
+
+	var result string
+	err := h.call("/getrange", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) SetRange(key string, offset int, value string) (int, error) {
+	params := &api.SetRangeParams {
+		Key: key,
+		Offset: offset,
+		Value: value,
+	}
+
+	var result int
+	err := h.call("/setrange", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) StrLen(key string) (int, error) {
+	params := &api.StrLenParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/strlen", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) GetDel(key string) (interface{}, error) {
+	params := &api.GetParams {
+		Key: key,
+	}
+
+	var result interface{}
+	err := h.call("/getdel", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) GetEx(key string, opts api.GetExOptions) (interface{}, error) {
+	params := &api.GetExParams {
+		Key: key,
+		GetExOptions: opts,
+	}
+
+	var result interface{}
+	err := h.call("/getex", params, &result)
+	return result, err
+}
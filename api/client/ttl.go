@@ -0,0 +1,69 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) TTL(key string) (int64, error) {
+	params := &api.TTLParams {
+		Key: key,
+	}
+
+	var result int64
+	err := h.call("/ttl", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) PTTL(key string) (int64, error) {
+	params := &api.TTLParams {
+		Key: key,
+	}
+
+	var result int64
+	err := h.call("/pttl", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) Expire(key string, seconds int64) (int, error) {
+	params := &api.ExpireParams {
+		Key: key,
+		Seconds: seconds,
+	}
+
+	var result int
+	err := h.call("/expire", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) PExpire(key string, milliseconds int64) (int, error) {
+	params := &api.PExpireParams {
+		Key: key,
+		Milliseconds: milliseconds,
+	}
+
+	var result int
+	err := h.call("/pexpire", params, &result)
+	return result, err
+}
+
+// timestamp is unix time in seconds
+func (h *httpAPI) ExpireAt(key string, timestamp int64) (int, error) {
+	params := &api.ExpireAtParams {
+		Key: key,
+		Timestamp: timestamp,
+	}
+
+	var result int
+	err := h.call("/expireat", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) Persist(key string) (int, error) {
+	params := &api.PersistParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/persist", params, &result)
+	return result, err
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) Watch(keys ...string) (map[string]uint64, error) {
+	params := &api.WatchParams {
+		Keys: keys,
+	}
+
+	var result map[string]uint64
+	err := h.call("/watch", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) Exec(watched map[string]uint64, cmds ...api.Command) ([]api.CommandResult, error) {
+	params := &api.ExecParams {
+		Watch: watched,
+		Commands: cmds,
+	}
+
+	var result []api.CommandResult
+	err := h.call("/exec", params, &result)
+	return result, err
+}
+
+// Tx queues commands on client side and sends them with versions of watched keys in one EXEC:
+//
+//	tx := client.NewTx(c)
+//	if err := tx.Watch("balance"); err != nil {
+//		...
+//	}
+//	balance, _ := c.Get("balance")
+//	tx.Queue("set", &api.SetParams{Key: "balance", Value: ...})
+//	results, err := tx.Exec()
+//	if err == nil && results == nil {
+//		// balance was modified, try again
+//	}
+type Tx struct {
+	c HTTPAPI
+	watched map[string]uint64
+	queued []api.Command
+	err error
+}
+
+func NewTx(c HTTPAPI) *Tx {
+	return &Tx{
+		c: c,
+		watched: make(map[string]uint64),
+	}
+}
+
+// Watch remembers versions of the keys, keys watched before keep their first versions
+func (tx *Tx) Watch(keys ...string) error {
+	versions, err := tx.c.Watch(keys...)
+	if err != nil {
+		return err
+	}
+	for key, version := range versions {
+		if _, exists := tx.watched[key]; !exists {
+			tx.watched[key] = version
+		}
+	}
+	return nil
+}
+
+// Queue adds command with params of its endpoint, error of params encoding is returned by Exec
+func (tx *Tx) Queue(op string, params interface{}) {
+	cmd, err := api.NewCommand(op, params)
+	if err != nil && tx.err == nil {
+		tx.err = err
+	}
+	tx.queued = append(tx.queued, cmd)
+}
+
+// Discard forgets queued commands and watched keys
+func (tx *Tx) Discard() {
+	tx.watched = make(map[string]uint64)
+	tx.queued = nil
+	tx.err = nil
+}
+
+// Exec sends queued commands, after that Tx can be reused like after Discard.
+// return value: nil if some of watched keys was modified
+func (tx *Tx) Exec() ([]api.CommandResult, error) {
+	defer tx.Discard()
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return tx.c.Exec(tx.watched, tx.queued...)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+)
+
+func (h *httpAPI) ZAdd(key string, members ...api.ZMember) (int, error) {
+	params := &api.ZAddParams {
+		Key: key,
+		Members: members,
+	}
+
+	var result int
+	err := h.call("/zadd", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) ZIncrBy(key string, member string, increment float64) (float64, error) {
+	params := &api.ZIncrByParams {
+		Key: key,
+		Member: member,
+		Increment: api.Score(increment),
+	}
+
+	var result api.Score
+	err := h.call("/zincrby", params, &result)
+	return float64(result), err
+}
+
+func (h *httpAPI) ZRem(key string, members ...string) (int, error) {
+	params := &api.MembersParams {
+		Key: key,
+		Members: members,
+	}
+
+	var result int
+	err := h.call("/zrem", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) ZScore(key string, member string) (*float64, error) {
+	params := &api.ZScoreParams {
+		Key: key,
+		Member: member,
+	}
+
+	var result *api.Score
+	if err := h.call("/zscore", params, &result); err != nil || result == nil {
+		return nil, err
+	}
+	score := float64(*result)
+	return &score, nil
+}
+
+func (h *httpAPI) ZCard(key string) (int, error) {
+	params := &api.ZCardParams {
+		Key: key,
+	}
+
+	var result int
+	err := h.call("/zcard", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) ZRank(key string, member string, reverse bool) (*int, error) {
+	params := &api.ZRankParams {
+		Key: key,
+		Member: member,
+		Reverse: reverse,
+	}
+
+	var result *int
+	err := h.call("/zrank", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) ZRange(key string, start, stop int, reverse bool) ([]api.ZMember, error) {
+	params := &api.ZRangeParams {
+		Key: key,
+		Start: start,
+		Stop: stop,
+		Reverse: reverse,
+	}
+
+	var result []api.ZMember
+	err := h.call("/zrange", params, &result)
+	return result, err
+}
+
+func (h *httpAPI) ZRangeByScore(params *api.ZRangeByScoreParams) ([]api.ZMember, error) {
+	var result []api.ZMember
+	err := h.call("/zrangebyscore", params, &result)
+	return result, err
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+)
+
+// IncrParams are used by both INCR and DECR
+type IncrParams struct {
+	Key string
+}
+
+func ValidateIncrParams(p *IncrParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type IncrByParams struct {
+	Key string
+	Increment int64
+}
+
+func ValidateIncrByParams(p *IncrByParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type DecrByParams struct {
+	Key string
+	Decrement int64
+}
+
+func ValidateDecrByParams(p *DecrByParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type IncrByFloatParams struct {
+	Key string
+	Increment float64
+}
+
+func ValidateIncrByFloatParams(p *IncrByFloatParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
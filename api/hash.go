@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+)
+
+type HSetParams struct {
+	Key string
+	Fields map[string]interface{}
+}
+
+func ValidateHSetParams(p *HSetParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if len(p.Fields) == 0 {
+		return errors.New("at least one field must be in fields argument")
+	}
+	for field, value := range p.Fields {
+		if value == nil {
+			return errors.New("value of field " + field + " must be specified")
+		}
+	}
+	return nil
+}
+
+
+type HGetParams struct {
+	Key string
+	Field string
+}
+
+func ValidateHGetParams(p *HGetParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type HDelParams struct {
+	Key string
+	Fields []string
+}
+
+func ValidateHDelParams(p *HDelParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if len(p.Fields) == 0 {
+		return errors.New("at least one field must be in fields argument")
+	}
+	return nil
+}
+
+
+// HashParams are used by HGETALL, HKEYS and HLEN
+type HashParams struct {
+	Key string
+}
+
+func ValidateHashParams(p *HashParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type HIncrByParams struct {
+	Key string
+	Field string
+	Increment int64
+}
+
+func ValidateHIncrByParams(p *HIncrByParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+// PushParams are used by both LPUSH and RPUSH
+type PushParams struct {
+	Key string
+	Values []interface{}
+}
+
+func ValidatePushParams(p *PushParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if len(p.Values) == 0 {
+		return errors.New("at least one value must be in values argument")
+	}
+	for _, value := range p.Values {
+		if value == nil {
+			return errors.New("values must not be null")
+		}
+	}
+	return nil
+}
+
+
+// ListParams are used by LPOP, RPOP and LLEN
+type ListParams struct {
+	Key string
+}
+
+func ValidateListParams(p *ListParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// RangeParams are used by both LRANGE and LTRIM, negative indices count from the end
+type RangeParams struct {
+	Key string
+	Start int
+	Stop int
+}
+
+func ValidateRangeParams(p *RangeParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// BPopParams are used by both BLPOP and BRPOP, zero timeout means waiting forever
+type BPopParams struct {
+	Keys []string
+	Timeout time.Duration
+}
+
+func ValidateBPopParams(p *BPopParams) error {
+	if len(p.Keys) == 0 {
+		return errors.New("at least one key must be in keys argument")
+	}
+	if p.Timeout < 0 {
+		return errors.New("timeout argument must be nonnegative")
+	}
+	return nil
+}
+
+// BPopResult is a response to BLPOP and BRPOP, null is returned on timeout
+type BPopResult struct {
+	Key string
+	Value interface{}
+}
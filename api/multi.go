@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+type MGetParams struct {
+	Keys []string
+}
+
+func ValidateMGetParams(p *MGetParams) error {
+	if len(p.Keys) == 0 {
+		return errors.New("at least one key must be in keys argument")
+	}
+	return nil
+}
+
+
+// KeyValue is an item of MSET, zero ttl means no ttl
+type KeyValue struct {
+	Key string
+	Value interface{}
+	Ttl time.Duration
+}
+
+// MSetParams are used by both MSET and MSETNX
+type MSetParams struct {
+	Items []KeyValue
+}
+
+func ValidateMSetParams(p *MSetParams) error {
+	if len(p.Items) == 0 {
+		return errors.New("at least one item must be in items argument")
+	}
+	for _, item := range p.Items {
+		if item.Key == "" {
+			return errors.New("key of every item must be specified")
+		}
+		if item.Value == nil {
+			return errors.New("value of every item must be specified")
+		}
+		if item.Ttl < 0 {
+			return errors.New("ttl of every item must be nonnegative")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// PipelineParams contain commands executed one by one. Unlike EXEC they aren't atomic
+// and failure of a command doesn't prevent execution of the following ones
+type PipelineParams struct {
+	Commands []Command
+}
+
+func ValidatePipelineParams(p *PipelineParams) error {
+	for _, cmd := range p.Commands {
+		if cmd.Op == "" {
+			return errors.New("op of every command must be specified")
+		}
+		if strings.ContainsAny(cmd.Op, "/?#") {
+			return errors.New("op must be a name of endpoint")
+		}
+	}
+	return nil
+}
+
+// PipelineResult is a result of command executed by PIPELINE, Value is the response
+// of its endpoint. Error is set instead if the endpoint failed
+type PipelineResult struct {
+	Value json.RawMessage
+	Error *ErrorResponse
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+)
+
+type PublishParams struct {
+	Channel string
+	Message string
+}
+
+func ValidatePublishParams(p *PublishParams) error {
+	if p.Channel == "" {
+		return errors.New("channel argument must be specified")
+	}
+	return nil
+}
+
+
+// SubscribeParams contain channels and glob patterns of channels, like in PSUBSCRIBE
+type SubscribeParams struct {
+	Channels []string
+	Patterns []string
+}
+
+func ValidateSubscribeParams(p *SubscribeParams) error {
+	if len(p.Channels) == 0 && len(p.Patterns) == 0 {
+		return errors.New("at least one channel or pattern must be specified")
+	}
+	for _, channel := range p.Channels {
+		if channel == "" {
+			return errors.New("channels must be nonempty")
+		}
+	}
+	return nil
+}
+
+// Message is a published message, Pattern is set if it was received by pattern subscription.
+// SUBSCRIBE responds with stream of server-sent events, data of "message" events are Messages
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+
+// KeyspaceChannel prefixes keys in channels of keyspace notifications over RESP like in redis:
+// PSUBSCRIBE of KeyspaceChannel + pattern receives messages with KeyspaceChannel + key as channel
+// and event as payload
+const KeyspaceChannel = "__keyspace@0__:"
+
+// KeyEventsParams contain glob pattern of keys, whose events are streamed by KEYEVENTS
+type KeyEventsParams struct {
+	Pattern string
+}
+
+func ValidateKeyEventsParams(p *KeyEventsParams) error {
+	if p.Pattern == "" {
+		return errors.New("pattern argument must be specified")
+	}
+	return nil
+}
+
+// KeyEvent is a keyspace notification, Event is the name of the command which changed the key like "set",
+// "del", "hset" or "lpop", or one of "expired" and "evicted".
+// KEYEVENTS responds with stream of server-sent events, data of "keyevent" events are KeyEvents
+type KeyEvent struct {
+	Event string
+	Key string
+}
@@ -0,0 +1,379 @@
+// Package resp implements RESP2 and RESP3, the protocols spoken by redis servers and clients
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrProtocol is wrapped by errors about malformed input, the connection can't be used after them
+var ErrProtocol = errors.New("Protocol error")
+
+// limits of the input like proto-max-bulk-len of redis
+var (
+	MaxBulkLen = 512 << 20
+	MaxArrayLen = 1 << 20
+	MaxInlineLen = 64 << 10
+)
+
+// types of values are named by their first byte
+const (
+	TypeSimpleString = '+'
+	TypeError = '-'
+	TypeInteger = ':'
+	TypeBulkString = '$'
+	TypeArray = '*'
+	TypeNull = '_'
+	TypeDouble = ','
+	TypeBoolean = '#'
+	TypeBigNumber = '('
+	TypeBulkError = '!'
+	TypeVerbatim = '='
+	TypeMap = '%'
+	TypeSet = '~'
+	TypeAttribute = '|'
+	TypePush = '>'
+)
+
+// Value is a reply of any type. Null bulk string and null array of RESP2
+// are read as TypeNull like null of RESP3
+type Value struct {
+	Type byte
+	// simple string, error, bulk string, big number and verbatim string without its format
+	Str string
+	Int int64
+	Float float64
+	Bool bool
+	// elements of array, set and push, keys and values of map are interleaved
+	Elems []Value
+}
+
+func (v Value) IsNull() bool {
+	return v.Type == TypeNull
+}
+
+// Err returns error reply as Error, nil for other types
+func (v Value) Err() error {
+	if v.Type == TypeError || v.Type == TypeBulkError {
+		return Error(v.Str)
+	}
+	return nil
+}
+
+// Error is an error reply, its first word is the kind of error like ERR or WRONGTYPE
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+func protocolError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrProtocol, fmt.Sprintf(format, args...))
+}
+
+type Reader struct {
+	rd *bufio.Reader
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{rd: bufio.NewReader(rd)}
+}
+
+// Buffered returns number of bytes read from connection but not parsed yet,
+// server flushes replies when it's zero, so pipelined commands are answered at once
+func (r *Reader) Buffered() int {
+	return r.rd.Buffered()
+}
+
+// Fill reads more input into the buffer without parsing it. It blocks until something is read
+// and fails with bufio.ErrBufferFull if the buffer has no room or with error of the connection
+func (r *Reader) Fill() error {
+	_, err := r.rd.Peek(r.rd.Buffered() + 1)
+	return err
+}
+
+// readLine returns line without its terminator, lone "\n" is accepted like by redis
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.rd.ReadSlice('\n')
+		if len(line) + len(chunk) > MaxInlineLen {
+			return nil, protocolError("too big inline request")
+		}
+		if err == bufio.ErrBufferFull {
+			line = append(line, chunk...)
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line) + len(chunk) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if line == nil {
+			line = chunk
+		} else {
+			line = append(line, chunk...)
+		}
+		break
+	}
+
+	line = line[:len(line) - 1]
+	if len(line) > 0 && line[len(line) - 1] == '\r' {
+		line = line[:len(line) - 1]
+	}
+	return line, nil
+}
+
+// readLength parses length of bulk string or aggregate, -1 means null
+func readLength(line []byte, limit int, what string) (int, error) {
+	n, err := strconv.Atoi(string(line))
+	if err != nil || n < -1 || n > limit {
+		return 0, protocolError("invalid %s length", what)
+	}
+	return n, nil
+}
+
+// readBulk reads n bytes of bulk string followed by "\r\n"
+func (r *Reader) readBulk(n int) (string, error) {
+	buf := make([]byte, n + 2)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if buf[n] != '\r' || buf[n + 1] != '\n' {
+		return "", protocolError("bulk string isn't terminated by CRLF")
+	}
+	return string(buf[:n]), nil
+}
+
+// ReadCommand reads array of bulk strings sent by client or inline command, which is
+// a line of arguments separated by spaces. Empty command is returned for blank line
+func (r *Reader) ReadCommand() ([]string, error) {
+	first, err := r.rd.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != TypeArray {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		return SplitArgs(string(line))
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, err := readLength(line[1:], MaxArrayLen, "multibulk")
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != TypeBulkString {
+			return nil, protocolError("expected '$', got '%s'", firstChar(line))
+		}
+		size, err := readLength(line[1:], MaxBulkLen, "bulk")
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, protocolError("invalid bulk length")
+		}
+		if args[i], err = r.readBulk(size); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func firstChar(line []byte) string {
+	if len(line) == 0 {
+		return ""
+	}
+	return string(line[:1])
+}
+
+// ReadValue reads reply of any type, attributes are skipped
+func (r *Reader) ReadValue() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, protocolError("empty line")
+	}
+
+	v := Value{Type: line[0]}
+	payload := line[1:]
+	switch v.Type {
+	case TypeSimpleString, TypeError, TypeBigNumber:
+		v.Str = string(payload)
+	case TypeInteger:
+		if v.Int, err = strconv.ParseInt(string(payload), 10, 64); err != nil {
+			return Value{}, protocolError("invalid integer")
+		}
+	case TypeDouble:
+		// strconv accepts "inf", "-inf" and "nan" used by RESP3
+		if v.Float, err = strconv.ParseFloat(string(payload), 64); err != nil {
+			return Value{}, protocolError("invalid double")
+		}
+	case TypeBoolean:
+		switch string(payload) {
+		case "t":
+			v.Bool = true
+		case "f":
+		default:
+			return Value{}, protocolError("invalid boolean")
+		}
+	case TypeNull:
+	case TypeBulkString, TypeBulkError, TypeVerbatim:
+		n, err := readLength(payload, MaxBulkLen, "bulk")
+		if err != nil {
+			return Value{}, err
+		}
+		if n < 0 {
+			return Value{Type: TypeNull}, nil
+		}
+		if v.Str, err = r.readBulk(n); err != nil {
+			return Value{}, err
+		}
+		if v.Type == TypeVerbatim {
+			// format like "txt:" precedes the contents
+			if len(v.Str) < 4 || v.Str[3] != ':' {
+				return Value{}, protocolError("invalid verbatim string")
+			}
+			v.Str = v.Str[4:]
+		}
+	case TypeArray, TypeSet, TypePush, TypeMap, TypeAttribute:
+		n, err := readLength(payload, MaxArrayLen, "multibulk")
+		if err != nil {
+			return Value{}, err
+		}
+		if n < 0 {
+			return Value{Type: TypeNull}, nil
+		}
+		if v.Type == TypeMap || v.Type == TypeAttribute {
+			n *= 2
+		}
+		v.Elems = make([]Value, n)
+		for i := range v.Elems {
+			if v.Elems[i], err = r.ReadValue(); err != nil {
+				return Value{}, err
+			}
+		}
+		if v.Type == TypeAttribute {
+			return r.ReadValue()
+		}
+	default:
+		return Value{}, protocolError("unknown type '%c'", v.Type)
+	}
+	return v, nil
+}
+
+// SplitArgs splits inline command like redis-cli does: arguments are separated by spaces and
+// may be quoted, double quotes support escapes like "\n" and "\x00", single quotes only "\'"
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i += 1
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		arg := []byte{}
+		inDouble, inSingle := false, false
+		for done := false; !done; {
+			switch {
+			case inDouble:
+				if i == len(line) {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				switch {
+				case line[i] == '\\' && i + 3 < len(line) && line[i + 1] == 'x' && isHex(line[i + 2]) && isHex(line[i + 3]):
+					b, _ := strconv.ParseUint(line[i + 2:i + 4], 16, 8)
+					arg = append(arg, byte(b))
+					i += 3
+				case line[i] == '\\' && i + 1 < len(line):
+					i += 1
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				case line[i] == '"':
+					// closing quote must be followed by a space or nothing
+					if i + 1 < len(line) && !isSpace(line[i + 1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg = append(arg, line[i])
+				}
+			case inSingle:
+				if i == len(line) {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				switch {
+				case line[i] == '\\' && i + 1 < len(line) && line[i + 1] == '\'':
+					i += 1
+					arg = append(arg, '\'')
+				case line[i] == '\'':
+					if i + 1 < len(line) && !isSpace(line[i + 1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg = append(arg, line[i])
+				}
+			default:
+				switch {
+				case i == len(line) || isSpace(line[i]):
+					done = true
+				case line[i] == '"':
+					inDouble = true
+				case line[i] == '\'':
+					inSingle = true
+				default:
+					arg = append(arg, line[i])
+				}
+			}
+			if i < len(line) {
+				i += 1
+			}
+		}
+		args = append(args, string(arg))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,114 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		line string
+		args []string
+	}{
+		{"", []string{}},
+		{"  set  key value ", []string{"set", "key", "value"}},
+		{`set "hello world" 'it\'s'`, []string{"set", "hello world", "it's"}},
+		{`set "a\r\n\x41\"" ""`, []string{"set", "a\r\nA\"", ""}},
+	}
+	for i, cs := range cases {
+		args, err := SplitArgs(cs.line)
+		if err != nil || !reflect.DeepEqual(args, cs.args) {
+			t.Fatalf("TestCase %d: expected %q, got %q, %v\n", i, cs.args, args, err)
+		}
+	}
+
+	for i, line := range []string{`set "unbalanced`, `set 'a'b`, `set "a"b`} {
+		if _, err := SplitArgs(line); !errors.Is(err, ErrProtocol) {
+			t.Fatalf("TestCase %d: expected protocol error for %q, got %v\n", i, line, err)
+		}
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	r := NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$4\r\na\r\nb\r\nPING\n*0\r\n*1\r\n:1\r\n"))
+
+	if args, err := r.ReadCommand(); err != nil || !reflect.DeepEqual(args, []string{"GET", "a\r\nb"}) {
+		t.Fatalf("Subtest 1: multibulk command: got %q, %v\n", args, err)
+	}
+	if args, err := r.ReadCommand(); err != nil || !reflect.DeepEqual(args, []string{"PING"}) {
+		t.Fatalf("Subtest 2: inline command: got %q, %v\n", args, err)
+	}
+	if args, err := r.ReadCommand(); err != nil || len(args) != 0 {
+		t.Fatalf("Subtest 3: empty multibulk: got %q, %v\n", args, err)
+	}
+	if _, err := r.ReadCommand(); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("Subtest 4: expected protocol error, got %v\n", err)
+	}
+
+	r = NewReader(strings.NewReader(strings.Repeat("a", MaxInlineLen + 1)))
+	if _, err := r.ReadCommand(); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("Subtest 5: too long inline command: expected protocol error, got %v\n", err)
+	}
+}
+
+func TestReadValue(t *testing.T) {
+	input := "+OK\r\n-ERR bad\r\n:-5\r\n$-1\r\n*-1\r\n_\r\n,inf\r\n#t\r\n(123\r\n=8\r\ntxt:text\r\n" +
+		"%1\r\n$1\r\nk\r\n~1\r\n,1.5\r\n|1\r\n+ttl\r\n:10\r\n>2\r\n+message\r\n$0\r\n\r\n"
+	expected := []Value{
+		{Type: TypeSimpleString, Str: "OK"},
+		{Type: TypeError, Str: "ERR bad"},
+		{Type: TypeInteger, Int: -5},
+		{Type: TypeNull},
+		{Type: TypeNull},
+		{Type: TypeNull},
+		{Type: TypeDouble, Float: math.Inf(1)},
+		{Type: TypeBoolean, Bool: true},
+		{Type: TypeBigNumber, Str: "123"},
+		{Type: TypeVerbatim, Str: "text"},
+		{Type: TypeMap, Elems: []Value{{Type: TypeBulkString, Str: "k"}, {Type: TypeSet, Elems: []Value{{Type: TypeDouble, Float: 1.5}}}}},
+		// attribute is skipped
+		{Type: TypePush, Elems: []Value{{Type: TypeSimpleString, Str: "message"}, {Type: TypeBulkString, Str: ""}}},
+	}
+
+	r := NewReader(strings.NewReader(input))
+	for i, exp := range expected {
+		v, err := r.ReadValue()
+		if err != nil || !reflect.DeepEqual(v, exp) {
+			t.Fatalf("Subtest %d: expected %+v, got %+v, %v\n", i + 1, exp, v, err)
+		}
+	}
+	if err := expected[1].Err(); err != Error("ERR bad") {
+		t.Fatalf("Subtest %d: Err: expected error reply, got %v\n", len(expected) + 1, err)
+	}
+}
+
+func TestWriterProtocols(t *testing.T) {
+	write := func(w *Writer) {
+		w.WriteMap(1)
+		w.WriteBulkString("k")
+		w.WriteDouble(1.5)
+		w.WriteBoolean(true)
+		w.WriteNull()
+		w.WriteNullArray()
+		w.WriteSet(0)
+		w.WriteError("ERR multi\r\nline")
+	}
+	expected := map[int]string{
+		2: "*2\r\n$1\r\nk\r\n$3\r\n1.5\r\n:1\r\n$-1\r\n*-1\r\n*0\r\n-ERR multi  line\r\n",
+		3: "%1\r\n$1\r\nk\r\n,1.5\r\n#t\r\n_\r\n_\r\n~0\r\n-ERR multi  line\r\n",
+	}
+
+	for proto, exp := range expected {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.Proto = proto
+		write(w)
+		if err := w.Flush(); err != nil || buf.String() != exp {
+			t.Fatalf("RESP%d: expected %q, got %q, %v\n", proto, exp, buf.String(), err)
+		}
+	}
+}
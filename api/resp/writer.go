@@ -0,0 +1,152 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Writer buffers values until Flush, errors of writing are returned by Flush.
+// Types added by RESP3 are written as the closest RESP2 types unless Proto is 3
+type Writer struct {
+	wr *bufio.Writer
+	Proto int
+}
+
+func NewWriter(wr io.Writer) *Writer {
+	return &Writer{
+		wr: bufio.NewWriter(wr),
+		Proto: 2,
+	}
+}
+
+func (w *Writer) Flush() error {
+	return w.wr.Flush()
+}
+
+func (w *Writer) writeLine(prefix byte, s string) {
+	w.wr.WriteByte(prefix)
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *Writer) writeHeader(prefix byte, n int) {
+	w.writeLine(prefix, strconv.Itoa(n))
+}
+
+// WriteSimpleString and WriteError replace line breaks with spaces, simple strings can't contain them
+func (w *Writer) WriteSimpleString(s string) {
+	w.writeLine(TypeSimpleString, strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
+
+func (w *Writer) WriteError(s string) {
+	w.writeLine(TypeError, strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
+
+func (w *Writer) WriteInteger(n int64) {
+	w.writeLine(TypeInteger, strconv.FormatInt(n, 10))
+}
+
+func (w *Writer) WriteBulkString(s string) {
+	w.writeHeader(TypeBulkString, len(s))
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+// WriteNull writes null bulk string for RESP2
+func (w *Writer) WriteNull() {
+	if w.Proto < 3 {
+		w.wr.WriteString("$-1\r\n")
+		return
+	}
+	w.wr.WriteString("_\r\n")
+}
+
+// WriteNullArray writes null array for RESP2, it's used instead of WriteNull
+// where redis replies with null array like by BLPOP on timeout
+func (w *Writer) WriteNullArray() {
+	if w.Proto < 3 {
+		w.wr.WriteString("*-1\r\n")
+		return
+	}
+	w.wr.WriteString("_\r\n")
+}
+
+// WriteArray, WriteMap, WriteSet and WritePush write headers of aggregates, n elements
+// (n keys and values for map) must follow. Map is written as flat array for RESP2
+func (w *Writer) WriteArray(n int) {
+	w.writeHeader(TypeArray, n)
+}
+
+func (w *Writer) WriteMap(n int) {
+	if w.Proto < 3 {
+		w.writeHeader(TypeArray, 2 * n)
+		return
+	}
+	w.writeHeader(TypeMap, n)
+}
+
+func (w *Writer) WriteSet(n int) {
+	if w.Proto < 3 {
+		w.writeHeader(TypeArray, n)
+		return
+	}
+	w.writeHeader(TypeSet, n)
+}
+
+func (w *Writer) WritePush(n int) {
+	if w.Proto < 3 {
+		w.writeHeader(TypeArray, n)
+		return
+	}
+	w.writeHeader(TypePush, n)
+}
+
+// WriteDouble writes bulk string for RESP2 like redis
+func (w *Writer) WriteDouble(f float64) {
+	if w.Proto < 3 {
+		w.WriteBulkString(FormatDouble(f))
+		return
+	}
+	w.writeLine(TypeDouble, FormatDouble(f))
+}
+
+// WriteBoolean writes integer 1 or 0 for RESP2
+func (w *Writer) WriteBoolean(b bool) {
+	if w.Proto < 3 {
+		if b {
+			w.WriteInteger(1)
+		} else {
+			w.WriteInteger(0)
+		}
+		return
+	}
+	if b {
+		w.writeLine(TypeBoolean, "t")
+	} else {
+		w.writeLine(TypeBoolean, "f")
+	}
+}
+
+// WriteCommand writes command the way clients send it, as array of bulk strings
+func (w *Writer) WriteCommand(args ...string) {
+	w.WriteArray(len(args))
+	for _, arg := range args {
+		w.WriteBulkString(arg)
+	}
+}
+
+// FormatDouble formats float the shortest way, infinities are written as "inf" and "-inf"
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
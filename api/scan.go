@@ -0,0 +1,35 @@
+package api
+
+import (
+	"errors"
+)
+
+// ScanOptions correspond to options of redis SCAN
+type ScanOptions struct {
+	// hint of number of keys examined by one call
+	Count int
+	// glob pattern, empty matches every key
+	Match string
+	// one of types returned by TYPE, empty means any type
+	Type string
+}
+
+// ScanParams embed ScanOptions, so they are specified at the top level of json.
+// Zero cursor starts iteration
+type ScanParams struct {
+	Cursor uint64
+	ScanOptions
+}
+
+func ValidateScanParams(p *ScanParams) error {
+	if p.Count < 0 {
+		return errors.New("count argument must be nonnegative")
+	}
+	return nil
+}
+
+// ScanResult contains cursor of the next call, which is zero when iteration is over
+type ScanResult struct {
+	Cursor uint64
+	Keys []string
+}
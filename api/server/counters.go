@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"math"
+	"net/http"
+)
+
+// incrBy responds with new value of the counter or with error of op
+func (srv *CacheServer) incrBy(w http.ResponseWriter, op string, key string, delta int64) {
+	result, err := srv.Data.IncrBy(key, delta)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), op, err.Error())
+		return
+	}
+	writeResult(w, result)
+}
+
+func (srv *CacheServer) HandleIncr(w http.ResponseWriter, r *http.Request) {
+	params := new(api.IncrParams)
+	if !parseRequest(w, r, "INCR", params, func() error { return api.ValidateIncrParams(params) }) {
+		return
+	}
+
+	srv.incrBy(w, "INCR", params.Key, 1)
+}
+
+func (srv *CacheServer) HandleDecr(w http.ResponseWriter, r *http.Request) {
+	params := new(api.IncrParams)
+	if !parseRequest(w, r, "DECR", params, func() error { return api.ValidateIncrParams(params) }) {
+		return
+	}
+
+	srv.incrBy(w, "DECR", params.Key, -1)
+}
+
+func (srv *CacheServer) HandleIncrBy(w http.ResponseWriter, r *http.Request) {
+	params := new(api.IncrByParams)
+	if !parseRequest(w, r, "INCRBY", params, func() error { return api.ValidateIncrByParams(params) }) {
+		return
+	}
+
+	srv.incrBy(w, "INCRBY", params.Key, params.Increment)
+}
+
+func (srv *CacheServer) HandleDecrBy(w http.ResponseWriter, r *http.Request) {
+	params := new(api.DecrByParams)
+	if !parseRequest(w, r, "DECRBY", params, func() error { return api.ValidateDecrByParams(params) }) {
+		return
+	}
+
+	// negation of the minimal value doesn't fit into int64
+	if params.Decrement == math.MinInt64 {
+		writeError(w, http.StatusBadRequest, "DECRBY", "decrement would overflow")
+		return
+	}
+	srv.incrBy(w, "DECRBY", params.Key, -params.Decrement)
+}
+
+func (srv *CacheServer) HandleIncrByFloat(w http.ResponseWriter, r *http.Request) {
+	params := new(api.IncrByFloatParams)
+	if !parseRequest(w, r, "INCRBYFLOAT", params, func() error { return api.ValidateIncrByFloatParams(params) }) {
+		return
+	}
+
+	result, err := srv.Data.IncrByFloat(params.Key, params.Increment)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "INCRBYFLOAT", err.Error())
+		return
+	}
+	writeResult(w, result)
+}
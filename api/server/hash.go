@@ -0,0 +1,106 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+)
+
+func (srv *CacheServer) HandleHSet(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HSetParams)
+	if !parseRequest(w, r, "HSET", params, func() error { return api.ValidateHSetParams(params) }) {
+		return
+	}
+
+	kAdded, err := srv.Data.HSet(params.Key, params.Fields)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HSET", err.Error())
+		return
+	}
+	writeResult(w, kAdded)
+}
+
+// responds with null for missing field
+func (srv *CacheServer) HandleHGet(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HGetParams)
+	if !parseRequest(w, r, "HGET", params, func() error { return api.ValidateHGetParams(params) }) {
+		return
+	}
+
+	value, _, err := srv.Data.HGet(params.Key, params.Field)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HGET", err.Error())
+		return
+	}
+	writeResult(w, value)
+}
+
+func (srv *CacheServer) HandleHDel(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HDelParams)
+	if !parseRequest(w, r, "HDEL", params, func() error { return api.ValidateHDelParams(params) }) {
+		return
+	}
+
+	kDeleted, err := srv.Data.HDel(params.Key, params.Fields...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HDEL", err.Error())
+		return
+	}
+	writeResult(w, kDeleted)
+}
+
+func (srv *CacheServer) HandleHGetAll(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HashParams)
+	if !parseRequest(w, r, "HGETALL", params, func() error { return api.ValidateHashParams(params) }) {
+		return
+	}
+
+	fields, err := srv.Data.HGetAll(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HGETALL", err.Error())
+		return
+	}
+	writeResult(w, fields)
+}
+
+func (srv *CacheServer) HandleHIncrBy(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HIncrByParams)
+	if !parseRequest(w, r, "HINCRBY", params, func() error { return api.ValidateHIncrByParams(params) }) {
+		return
+	}
+
+	result, err := srv.Data.HIncrBy(params.Key, params.Field, params.Increment)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HINCRBY", err.Error())
+		return
+	}
+	writeResult(w, result)
+}
+
+func (srv *CacheServer) HandleHKeys(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HashParams)
+	if !parseRequest(w, r, "HKEYS", params, func() error { return api.ValidateHashParams(params) }) {
+		return
+	}
+
+	fields, err := srv.Data.HKeys(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HKEYS", err.Error())
+		return
+	}
+	writeResult(w, fields)
+}
+
+func (srv *CacheServer) HandleHLen(w http.ResponseWriter, r *http.Request) {
+	params := new(api.HashParams)
+	if !parseRequest(w, r, "HLEN", params, func() error { return api.ValidateHashParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.HLen(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "HLEN", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"context"
+	"net/http"
+	"time"
+)
+
+func (srv *CacheServer) HandleLPush(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PushParams)
+	if !parseRequest(w, r, "LPUSH", params, func() error { return api.ValidatePushParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.LPush(params.Key, params.Values...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "LPUSH", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+func (srv *CacheServer) HandleRPush(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PushParams)
+	if !parseRequest(w, r, "RPUSH", params, func() error { return api.ValidatePushParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.RPush(params.Key, params.Values...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "RPUSH", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+// responds with null for missing list
+func (srv *CacheServer) HandleLPop(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ListParams)
+	if !parseRequest(w, r, "LPOP", params, func() error { return api.ValidateListParams(params) }) {
+		return
+	}
+
+	value, _, err := srv.Data.LPop(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "LPOP", err.Error())
+		return
+	}
+	writeResult(w, value)
+}
+
+func (srv *CacheServer) HandleRPop(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ListParams)
+	if !parseRequest(w, r, "RPOP", params, func() error { return api.ValidateListParams(params) }) {
+		return
+	}
+
+	value, _, err := srv.Data.RPop(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "RPOP", err.Error())
+		return
+	}
+	writeResult(w, value)
+}
+
+func (srv *CacheServer) HandleLRange(w http.ResponseWriter, r *http.Request) {
+	params := new(api.RangeParams)
+	if !parseRequest(w, r, "LRANGE", params, func() error { return api.ValidateRangeParams(params) }) {
+		return
+	}
+
+	items, err := srv.Data.LRange(params.Key, params.Start, params.Stop)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "LRANGE", err.Error())
+		return
+	}
+	writeResult(w, items)
+}
+
+func (srv *CacheServer) HandleLTrim(w http.ResponseWriter, r *http.Request) {
+	params := new(api.RangeParams)
+	if !parseRequest(w, r, "LTRIM", params, func() error { return api.ValidateRangeParams(params) }) {
+		return
+	}
+
+	if err := srv.Data.LTrim(params.Key, params.Start, params.Stop); err != nil {
+		writeError(w, storageErrorStatus(err), "LTRIM", err.Error())
+		return
+	}
+	w.Write([]byte(`"OK"`))
+}
+
+func (srv *CacheServer) HandleLLen(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ListParams)
+	if !parseRequest(w, r, "LLEN", params, func() error { return api.ValidateListParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.LLen(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "LLEN", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+type blockingPop func(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error)
+
+// handleBPop blocks request until item is popped, timeout passes or client goes away
+func handleBPop(w http.ResponseWriter, r *http.Request, op string, pop blockingPop) {
+	params := new(api.BPopParams)
+	if !parseRequest(w, r, op, params, func() error { return api.ValidateBPopParams(params) }) {
+		return
+	}
+
+	key, value, ok, err := pop(r.Context(), params.Timeout, params.Keys...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), op, err.Error())
+		return
+	}
+	if !ok {
+		w.Write([]byte("null"))
+		return
+	}
+	writeResult(w, api.BPopResult{Key: key, Value: value})
+}
+
+func (srv *CacheServer) HandleBLPop(w http.ResponseWriter, r *http.Request) {
+	handleBPop(w, r, "BLPOP", srv.Data.BLPop)
+}
+
+func (srv *CacheServer) HandleBRPop(w http.ResponseWriter, r *http.Request) {
+	handleBPop(w, r, "BRPOP", srv.Data.BRPop)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+)
+
+// responds with null in place of missing keys and keys of aggregate types
+func (srv *CacheServer) HandleMGet(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MGetParams)
+	if !parseRequest(w, r, "MGET", params, func() error { return api.ValidateMGetParams(params) }) {
+		return
+	}
+
+	writeResult(w, srv.Data.MGet(params.Keys...))
+}
+
+func toStorageItems(items []api.KeyValue) []storage.KeyValue {
+	result := make([]storage.KeyValue, len(items))
+	for i, item := range items {
+		result[i] = storage.KeyValue{Key: item.Key, Value: item.Value, TTL: item.Ttl}
+	}
+	return result
+}
+
+func (srv *CacheServer) HandleMSet(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MSetParams)
+	if !parseRequest(w, r, "MSET", params, func() error { return api.ValidateMSetParams(params) }) {
+		return
+	}
+
+	if err := srv.Data.MSet(toStorageItems(params.Items)...); err != nil {
+		writeError(w, storageErrorStatus(err), "MSET", err.Error())
+		return
+	}
+	w.Write([]byte(`"OK"`))
+}
+
+// responds with 1 if all items were written, 0 if any of the keys exists
+func (srv *CacheServer) HandleMSetNX(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MSetParams)
+	if !parseRequest(w, r, "MSETNX", params, func() error { return api.ValidateMSetParams(params) }) {
+		return
+	}
+
+	written, err := srv.Data.MSetNX(toStorageItems(params.Items)...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "MSETNX", err.Error())
+		return
+	}
+	writeResult(w, boolToInt(written))
+}
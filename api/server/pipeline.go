@@ -0,0 +1,95 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// endpoints which can't be pipelined: streams don't end, and pipelines aren't nested
+var unpipelined = map[string]bool{
+	"subscribe": true,
+	"keyevents": true,
+	"pipeline": true,
+}
+
+// responseRecorder keeps response of endpoint executed as command of pipeline
+type responseRecorder struct {
+	header http.Header
+	status int
+	body bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// runCommand executes command by the endpoint named by its op, so command behaves
+// exactly like a separate request
+func (srv *CacheServer) runCommand(r *http.Request, cmd api.Command) api.PipelineResult {
+	op := strings.ToLower(cmd.Op)
+	fail := func(status int, errString string) api.PipelineResult {
+		return api.PipelineResult{Error: &api.ErrorResponse{Op: strings.ToUpper(op), Err: errString, Status: status}}
+	}
+	if unpipelined[op] {
+		return fail(http.StatusBadRequest, "command can't be pipelined")
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/" + op, bytes.NewReader(cmd.Params))
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	handler, pattern := srv.Mux.Handler(req)
+	if pattern == "" {
+		return fail(http.StatusNotFound, "unknown command")
+	}
+
+	rec := &responseRecorder{header: make(http.Header)}
+	handler.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	body := rec.body.Bytes()
+	if rec.status != http.StatusOK {
+		errResp := new(api.ErrorResponse)
+		if err := json.Unmarshal(body, errResp); err != nil || errResp.Err == "" {
+			return fail(rec.status, strings.TrimSpace(string(body)))
+		}
+		errResp.Status = rec.status
+		return api.PipelineResult{Error: errResp}
+	}
+	if !json.Valid(body) {
+		return fail(http.StatusInternalServerError, "endpoint responded with invalid json")
+	}
+	return api.PipelineResult{Value: body}
+}
+
+// responds with results of commands in the same order, errors of commands are reported in their results
+func (srv *CacheServer) HandlePipeline(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PipelineParams)
+	if !parseRequest(w, r, "PIPELINE", params, func() error { return api.ValidatePipelineParams(params) }) {
+		return
+	}
+
+	results := make([]api.PipelineResult, len(params.Commands))
+	for i, cmd := range params.Commands {
+		results[i] = srv.runCommand(r, cmd)
+	}
+	writeResult(w, results)
+}
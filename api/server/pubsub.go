@@ -0,0 +1,335 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// subscriptionBuffer is the number of messages waiting for slow subscriber,
+// subscriber is disconnected when it's exceeded like by client-output-buffer-limit of redis
+var subscriptionBuffer = 1024
+
+// Hub delivers published messages to subscribers of the channel and of patterns matching it
+type Hub struct {
+	mutex sync.RWMutex
+	channels map[string]map[*Subscription]struct{}
+	patterns map[string]*patternSubscribers
+}
+
+type patternSubscribers struct {
+	pattern *storage.Pattern
+	subs map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[*Subscription]struct{}),
+		patterns: make(map[string]*patternSubscribers),
+	}
+}
+
+// Subscription receives messages until it's closed by Close or
+// because of overflow, then its channel of messages is closed
+type Subscription struct {
+	hub *Hub
+	// channels and patterns are guarded by mutex of the hub
+	channels []string
+	patterns []string
+	closed bool
+	messages chan api.Message
+	closeOnce sync.Once
+}
+
+// Subscribe fails with error wrapping storage.ErrPattern if some of the patterns is malformed
+func (h *Hub) Subscribe(channels []string, patterns []string) (*Subscription, error) {
+	sub := &Subscription{
+		hub: h,
+		messages: make(chan api.Message, subscriptionBuffer),
+	}
+	if _, err := sub.Add(channels, patterns); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func without(values []string, removed string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != removed {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Add subscribes to more channels and patterns, ones already subscribed are skipped. It returns number
+// of channels and patterns subscribed, closed subscription stays closed and receives nothing
+func (s *Subscription) Add(channels []string, patterns []string) (int, error) {
+	compiled := make([]*storage.Pattern, len(patterns))
+	for i, pattern := range patterns {
+		p, err := storage.CompilePattern(pattern)
+		if err != nil {
+			return 0, err
+		}
+		compiled[i] = p
+	}
+
+	h := s.hub
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s.closed {
+		return len(s.channels) + len(s.patterns), nil
+	}
+	for _, channel := range channels {
+		if contains(s.channels, channel) {
+			continue
+		}
+		s.channels = append(s.channels, channel)
+		if h.channels[channel] == nil {
+			h.channels[channel] = make(map[*Subscription]struct{})
+		}
+		h.channels[channel][s] = struct{}{}
+	}
+	for i, pattern := range patterns {
+		if contains(s.patterns, pattern) {
+			continue
+		}
+		s.patterns = append(s.patterns, pattern)
+		if h.patterns[pattern] == nil {
+			h.patterns[pattern] = &patternSubscribers{
+				pattern: compiled[i],
+				subs: make(map[*Subscription]struct{}),
+			}
+		}
+		h.patterns[pattern].subs[s] = struct{}{}
+	}
+	return len(s.channels) + len(s.patterns), nil
+}
+
+// Remove unsubscribes from the channels and patterns, it returns number of channels and patterns left
+func (s *Subscription) Remove(channels []string, patterns []string) int {
+	h := s.hub
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, channel := range channels {
+		s.channels = without(s.channels, channel)
+		h.unsubscribeChannel(s, channel)
+	}
+	for _, pattern := range patterns {
+		s.patterns = without(s.patterns, pattern)
+		h.unsubscribePattern(s, pattern)
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// Channels and Patterns return copies of subscribed channels and patterns in order of subscription
+
+func (s *Subscription) Channels() []string {
+	s.hub.mutex.RLock()
+	defer s.hub.mutex.RUnlock()
+	return append([]string(nil), s.channels...)
+}
+
+func (s *Subscription) Patterns() []string {
+	s.hub.mutex.RLock()
+	defer s.hub.mutex.RUnlock()
+	return append([]string(nil), s.patterns...)
+}
+
+// unsubscribeChannel and unsubscribePattern must be called with mutex held
+
+func (h *Hub) unsubscribeChannel(sub *Subscription, channel string) {
+	delete(h.channels[channel], sub)
+	if len(h.channels[channel]) == 0 {
+		delete(h.channels, channel)
+	}
+}
+
+func (h *Hub) unsubscribePattern(sub *Subscription, pattern string) {
+	if ps := h.patterns[pattern]; ps != nil {
+		delete(ps.subs, sub)
+		if len(ps.subs) == 0 {
+			delete(h.patterns, pattern)
+		}
+	}
+}
+
+// Publish returns number of subscriptions message was delivered to, subscription
+// matching the channel by several patterns receives the message several times
+func (h *Hub) Publish(channel string, payload string) int {
+	overflowed := []*Subscription{}
+	kReceived := 0
+	deliver := func(sub *Subscription, msg api.Message) {
+		select {
+		case sub.messages <- msg:
+			kReceived += 1
+		default:
+			overflowed = append(overflowed, sub)
+		}
+	}
+
+	h.mutex.RLock()
+	for sub := range h.channels[channel] {
+		deliver(sub, api.Message{Channel: channel, Payload: payload})
+	}
+	for pattern, ps := range h.patterns {
+		if !ps.pattern.Match(channel) {
+			continue
+		}
+		for sub := range ps.subs {
+			deliver(sub, api.Message{Channel: channel, Pattern: pattern, Payload: payload})
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, sub := range overflowed {
+		sub.Close()
+	}
+	return kReceived
+}
+
+// Messages returns channel of received messages
+func (s *Subscription) Messages() <-chan api.Message {
+	return s.messages
+}
+
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		h := s.hub
+		// messages are sent with read lock held, so channel can't be closed during sending
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		for _, channel := range s.channels {
+			h.unsubscribeChannel(s, channel)
+		}
+		for _, pattern := range s.patterns {
+			h.unsubscribePattern(s, pattern)
+		}
+		s.closed = true
+		close(s.messages)
+	})
+}
+
+func (srv *CacheServer) HandlePublish(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PublishParams)
+	if !parseRequest(w, r, "PUBLISH", params, func() error { return api.ValidatePublishParams(params) }) {
+		return
+	}
+
+	writeResult(w, srv.PubSub.Publish(params.Channel, params.Message))
+}
+
+// writeEvent writes server-sent event with data encoded to json and flushes it
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString("event: " + event + "\ndata: ")
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+	// encoder terminates data with newline, one more ends the event
+	buf.WriteString("\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// responds with stream of server-sent events: "subscribe" event with number of channels and patterns
+// once subscription is active, then "message" event for every received message.
+// Stream ends when client disconnects or doesn't keep up with messages
+func (srv *CacheServer) HandleSubscribe(w http.ResponseWriter, r *http.Request) {
+	params := new(api.SubscribeParams)
+	if !parseRequest(w, r, "SUBSCRIBE", params, func() error { return api.ValidateSubscribeParams(params) }) {
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		writeError(w, http.StatusInternalServerError, "SUBSCRIBE", "streaming isn't supported")
+		return
+	}
+
+	sub, err := srv.PubSub.Subscribe(params.Channels, params.Patterns)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SUBSCRIBE", err.Error())
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := writeEvent(w, "subscribe", len(sub.Channels()) + len(sub.Patterns())); err != nil {
+		return
+	}
+	for {
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, "message", msg); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// responds with stream of server-sent events: "subscribe" event once subscription is active,
+// then "keyevent" event for every keyspace notification about key matching the pattern.
+// Classes of notifications are chosen when storage is created
+func (srv *CacheServer) HandleKeyEvents(w http.ResponseWriter, r *http.Request) {
+	params := new(api.KeyEventsParams)
+	if !parseRequest(w, r, "KEYEVENTS", params, func() error { return api.ValidateKeyEventsParams(params) }) {
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		writeError(w, http.StatusInternalServerError, "KEYEVENTS", "streaming isn't supported")
+		return
+	}
+
+	sub, err := srv.Data.SubscribeEvents(params.Pattern)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "KEYEVENTS", err.Error())
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := writeEvent(w, "subscribe", 1); err != nil {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, "keyevent", api.KeyEvent{Event: event.Type, Key: event.Key}); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api/resp"
+
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrRESPServerClosed = errors.New("RESP server closed")
+
+// RESPServer serves the storage over RESP, the protocol of redis, so redis clients and tools
+// can be used alongside the http api. Connections start with RESP2, HELLO 3 switches to RESP3
+type RESPServer struct {
+	Data storage.Storage
+	PubSub *Hub
+
+	// ctx is done on Close, so blocking commands return
+	ctx context.Context
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns map[*respConn]struct{}
+	closed bool
+
+	lastID int64
+}
+
+// NewRESPServer shares storage and published messages with the http server
+func NewRESPServer(srv *CacheServer) *RESPServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RESPServer{
+		Data: srv.Data,
+		PubSub: srv.PubSub,
+		ctx: ctx,
+		cancel: cancel,
+		listeners: make(map[net.Listener]struct{}),
+		conns: make(map[*respConn]struct{}),
+	}
+}
+
+func (srv *RESPServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Serve accepts connections until the listener fails or server is closed,
+// then ErrRESPServerClosed is returned
+func (srv *RESPServer) Serve(l net.Listener) error {
+	srv.mutex.Lock()
+	if srv.closed {
+		srv.mutex.Unlock()
+		l.Close()
+		return ErrRESPServerClosed
+	}
+	srv.listeners[l] = struct{}{}
+	srv.mutex.Unlock()
+
+	defer func() {
+		srv.mutex.Lock()
+		delete(srv.listeners, l)
+		srv.mutex.Unlock()
+		l.Close()
+	}()
+
+	backoff := time.Duration(0)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			srv.mutex.Lock()
+			closed := srv.closed
+			srv.mutex.Unlock()
+			if closed {
+				return ErrRESPServerClosed
+			}
+			// like http.Server: retry temporary errors such as running out of file descriptors
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				if backoff == 0 {
+					backoff = 5 * time.Millisecond
+				} else if backoff *= 2; backoff > time.Second {
+					backoff = time.Second
+				}
+				time.Sleep(backoff)
+				continue
+			}
+			return err
+		}
+		backoff = 0
+
+		c := &respConn{
+			srv: srv,
+			conn: conn,
+			id: atomic.AddInt64(&srv.lastID, 1),
+			r: resp.NewReader(conn),
+			w: resp.NewWriter(conn),
+		}
+		srv.mutex.Lock()
+		if srv.closed {
+			srv.mutex.Unlock()
+			conn.Close()
+			return ErrRESPServerClosed
+		}
+		srv.conns[c] = struct{}{}
+		srv.mutex.Unlock()
+
+		go c.serve()
+	}
+}
+
+// Close stops listeners and closes connections, it doesn't close the storage
+func (srv *RESPServer) Close() error {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.closed {
+		return nil
+	}
+	srv.closed = true
+	srv.cancel()
+	for l := range srv.listeners {
+		l.Close()
+	}
+	for c := range srv.conns {
+		c.conn.Close()
+	}
+	return nil
+}
+
+type respConn struct {
+	srv *RESPServer
+	conn net.Conn
+	id int64
+	// name set by CLIENT SETNAME or HELLO
+	name string
+
+	r *resp.Reader
+	// wmutex guards w, replies are written by serve and messages of subscription by forwardMessages
+	wmutex sync.Mutex
+	w *resp.Writer
+
+	// sub is created by the first SUBSCRIBE or PSUBSCRIBE, keyEvents are patterns of api.KeyspaceChannel
+	// served by storage. subscriptions is the number of all channels and patterns, in RESP2 only pubsub
+	// commands are allowed while it's positive
+	sub *Subscription
+	keyEvents map[string]*keyEventsSubscription
+	subscriptions int
+
+	// tx keeps keys of WATCH and commands queued after MULTI until EXEC or DISCARD, queued are
+	// the same commands to write their results. multiFailed is set if some of the commands couldn't be queued
+	tx *storage.Tx
+	queued []storage.Command
+	multi bool
+	multiFailed bool
+}
+
+// serve executes commands one by one and flushes replies when there is no more buffered input,
+// so pipelined commands are answered with one write
+func (c *respConn) serve() {
+	defer func() {
+		c.srv.mutex.Lock()
+		delete(c.srv.conns, c)
+		c.srv.mutex.Unlock()
+		c.conn.Close()
+		if c.sub != nil {
+			c.sub.Close()
+		}
+		for _, ks := range c.keyEvents {
+			ks.close()
+		}
+	}()
+
+	for {
+		args, err := c.r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, resp.ErrProtocol) {
+				c.wmutex.Lock()
+				c.w.WriteError("ERR " + err.Error())
+				c.w.Flush()
+				c.wmutex.Unlock()
+			}
+			return
+		}
+
+		c.wmutex.Lock()
+		quit := false
+		if len(args) > 0 {
+			quit = c.execute(args)
+		}
+		if quit || c.r.Buffered() == 0 {
+			err = c.w.Flush()
+		}
+		c.wmutex.Unlock()
+		if quit || err != nil {
+			return
+		}
+	}
+}
+
+// respCommand is executed by the handler after number of arguments is checked,
+// arity counts the name of command too and is negated if it's a minimum like in redis
+type respCommand struct {
+	arity int
+	handler func(c *respConn, args []string)
+}
+
+// subscribedCommands are allowed in RESP2 while the connection is subscribed
+var subscribedCommands = map[string]bool{
+	"subscribe": true,
+	"psubscribe": true,
+	"unsubscribe": true,
+	"punsubscribe": true,
+	"ping": true,
+	"quit": true,
+}
+
+// multiCommands are executed at once after MULTI, other commands are queued
+var multiCommands = map[string]bool{
+	"multi": true,
+	"exec": true,
+	"discard": true,
+	"watch": true,
+	"quit": true,
+}
+
+// execute returns true if connection must be closed after the reply
+func (c *respConn) execute(args []string) bool {
+	name := strings.ToLower(args[0])
+	cmd, ok := respCommands[name]
+	if !ok {
+		c.w.WriteError(unknownCommandError(args))
+		c.multiFailed = c.multi
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.writeArityError(name)
+		c.multiFailed = c.multi
+		return false
+	}
+	if c.subscriptions > 0 && c.w.Proto < 3 && !subscribedCommands[name] {
+		c.w.WriteError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", name))
+		return false
+	}
+	if c.multi && !multiCommands[name] {
+		c.queue(name, args)
+		return false
+	}
+	cmd.handler(c, args)
+	return name == "quit"
+}
+
+// watchDisconnect returns context which is done when the client disconnects or server is closed,
+// so commands blocking the connection don't outlive it. Input is buffered meanwhile, stop must be called
+// before the next command is read
+func (c *respConn) watchDisconnect() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(c.srv.ctx)
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			err := c.r.Fill()
+			if err == nil {
+				continue
+			}
+			select {
+			case <-stopping:
+			default:
+				// full buffer means the client is alive and pipelines commands
+				if !errors.Is(err, bufio.ErrBufferFull) {
+					cancel()
+				}
+			}
+			return
+		}
+	}()
+
+	return ctx, func() {
+		close(stopping)
+		// deadline in the past interrupts Fill, the reader keeps input and clears the error
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+		cancel()
+	}
+}
+
+func unknownCommandError(args []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ERR unknown command '%s', with args beginning with: ", args[0])
+	for _, arg := range args[1:] {
+		if b.Len() > 128 {
+			break
+		}
+		fmt.Fprintf(&b, "'%s' ", arg)
+	}
+	return b.String()
+}
+
+func (c *respConn) writeArityError(name string) {
+	c.w.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
+
+func (c *respConn) writeSyntaxError() {
+	c.w.WriteError("ERR syntax error")
+}
+
+// writeStorageError keeps kind of error if storage already names it like WRONGTYPE, OOM and MISCONF
+func (c *respConn) writeStorageError(err error) {
+	switch {
+	case errors.Is(err, storage.ErrWrongType), errors.Is(err, storage.ErrOutOfMemory), errors.Is(err, storage.ErrAppendOnlyWrite):
+		c.w.WriteError(err.Error())
+	default:
+		c.w.WriteError("ERR " + err.Error())
+	}
+}
@@ -0,0 +1,1263 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// respVersion is reported by HELLO and INFO
+const respVersion = "1.0.0"
+
+var respCommands map[string]respCommand
+
+// initialized by init because COMMAND refers to the table
+func init() {
+	respCommands = map[string]respCommand{
+		"ping": {-1, respPing},
+		"echo": {2, respEcho},
+		"quit": {-1, respQuit},
+		"hello": {-1, respHello},
+		"auth": {-2, respAuth},
+		"select": {2, respSelect},
+		"client": {-2, respClient},
+		"command": {-2, respCommandInfo},
+		"info": {-1, respInfo},
+		"dbsize": {1, respDBSize},
+		"publish": {3, respPublish},
+		"subscribe": {-2, respSubscribe},
+		"psubscribe": {-2, respPSubscribe},
+		"unsubscribe": {-1, respUnsubscribe},
+		"punsubscribe": {-1, respPUnsubscribe},
+		"multi": {1, respMulti},
+		"exec": {1, respExec},
+		"discard": {1, respDiscard},
+		"watch": {-2, respWatch},
+		"unwatch": {1, respUnwatch},
+		"save": {1, respSave},
+		"bgsave": {-1, respBgSave},
+		"bgrewriteaof": {1, respBgRewriteAOF},
+
+		"set": {-3, respSet},
+		"get": {2, respGet},
+		"del": {-2, respDel},
+		"exists": {-2, respExists},
+		"keys": {2, respKeys},
+		"scan": {-2, respScan},
+		"mget": {-2, respMGet},
+		"mset": {-3, respMSet},
+		"msetnx": {-3, respMSetNX},
+		"type": {2, respType},
+		"ttl": {2, respTTL},
+		"pttl": {2, respPTTL},
+		"expire": {3, respExpire},
+		"pexpire": {3, respPExpire},
+		"expireat": {3, respExpireAt},
+		"pexpireat": {3, respPExpireAt},
+		"persist": {2, respPersist},
+
+		"incr": {2, respIncr},
+		"decr": {2, respDecr},
+		"incrby": {3, respIncrBy},
+		"decrby": {3, respDecrBy},
+		"incrbyfloat": {3, respIncrByFloat},
+		"append": {3, respAppend},
+		"getrange": {4, respGetRange},
+		"setrange": {4, respSetRange},
+		"strlen": {2, respStrLen},
+		"getdel": {2, respGetDel},
+		"getex": {-2, respGetEx},
+
+		"hset": {-4, respHSet},
+		"hget": {3, respHGet},
+		"hdel": {-3, respHDel},
+		"hgetall": {2, respHGetAll},
+		"hincrby": {4, respHIncrBy},
+		"hkeys": {2, respHKeys},
+		"hlen": {2, respHLen},
+
+		"lpush": {-3, respLPush},
+		"rpush": {-3, respRPush},
+		"lpop": {2, respLPop},
+		"rpop": {2, respRPop},
+		"lrange": {4, respLRange},
+		"ltrim": {4, respLTrim},
+		"llen": {2, respLLen},
+		"blpop": {-3, respBLPop},
+		"brpop": {-3, respBRPop},
+
+		"sadd": {-3, respSAdd},
+		"srem": {-3, respSRem},
+		"smembers": {2, respSMembers},
+		"sismember": {3, respSIsMember},
+		"scard": {2, respSCard},
+		"sinter": {-2, respSInter},
+		"sunion": {-2, respSUnion},
+		"sdiff": {-2, respSDiff},
+		"sinterstore": {-3, respSInterStore},
+		"sunionstore": {-3, respSUnionStore},
+		"sdiffstore": {-3, respSDiffStore},
+
+		"zadd": {-4, respZAdd},
+		"zincrby": {4, respZIncrBy},
+		"zrem": {-3, respZRem},
+		"zscore": {3, respZScore},
+		"zcard": {2, respZCard},
+		"zrank": {3, respZRank},
+		"zrevrank": {3, respZRevRank},
+		"zrange": {-4, respZRange},
+		"zrevrange": {-4, respZRevRange},
+		"zrangebyscore": {-4, respZRangeByScore},
+		"zrevrangebyscore": {-4, respZRevRangeByScore},
+	}
+}
+
+// parseInt and parseFloat reply with error and return false if argument isn't a number
+
+func (c *respConn) parseInt(arg string) (int64, bool) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		c.w.WriteError("ERR value is not an integer or out of range")
+		return 0, false
+	}
+	return n, true
+}
+
+func (c *respConn) parseFloat(arg string) (float64, bool) {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(f) {
+		c.w.WriteError("ERR value is not a valid float")
+		return 0, false
+	}
+	return f, true
+}
+
+// parseDuration parses positive number of units, expire times which would overflow are rejected
+func (c *respConn) parseDuration(arg string, unit time.Duration, cmd string) (time.Duration, bool) {
+	n, ok := c.parseInt(arg)
+	if !ok {
+		return 0, false
+	}
+	if n > math.MaxInt64 / int64(unit) || n < math.MinInt64 / int64(unit) {
+		c.w.WriteError(fmt.Sprintf("ERR invalid expire time in '%s' command", cmd))
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// isAggregate tells whether Get returned contents of hash, list, set or sorted set
+func isAggregate(value interface{}) bool {
+	switch value.(type) {
+	case storage.Hash, storage.List, storage.Members, storage.ZSet:
+		return true
+	}
+	return false
+}
+
+// writeStored writes stored value as bulk string, values which aren't strings or numbers,
+// like ones set by http api, are encoded to json
+func (c *respConn) writeStored(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		c.w.WriteNull()
+	case string:
+		c.w.WriteBulkString(v)
+	case float64:
+		c.w.WriteBulkString(strconv.FormatFloat(v, 'f', -1, 64))
+	case int64:
+		c.w.WriteBulkString(strconv.FormatInt(v, 10))
+	case int:
+		c.w.WriteBulkString(strconv.Itoa(v))
+	case json.Number:
+		c.w.WriteBulkString(string(v))
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			c.w.WriteError("ERR " + err.Error())
+			return
+		}
+		c.w.WriteBulkString(string(encoded))
+	}
+}
+
+func (c *respConn) writeStrings(values []string) {
+	c.w.WriteArray(len(values))
+	for _, v := range values {
+		c.w.WriteBulkString(v)
+	}
+}
+
+func (c *respConn) writeMembers(members []string) {
+	c.w.WriteSet(len(members))
+	for _, m := range members {
+		c.w.WriteBulkString(m)
+	}
+}
+
+func (c *respConn) writeValues(values []interface{}) {
+	c.w.WriteArray(len(values))
+	for _, v := range values {
+		c.writeStored(v)
+	}
+}
+
+// writeCount writes integer result or error of storage
+func (c *respConn) writeCount(n int, err error) {
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteInteger(int64(n))
+}
+
+func (c *respConn) writeBool(b bool) {
+	c.w.WriteInteger(int64(boolToInt(b)))
+}
+
+// connection and server commands
+
+// PING of subscribed RESP2 connection replies with array like messages do
+func respPing(c *respConn, args []string) {
+	if c.subscriptions > 0 && c.w.Proto < 3 && len(args) <= 2 {
+		c.w.WriteArray(2)
+		c.w.WriteBulkString("pong")
+		if len(args) == 2 {
+			c.w.WriteBulkString(args[1])
+		} else {
+			c.w.WriteBulkString("")
+		}
+		return
+	}
+	switch len(args) {
+	case 1:
+		c.w.WriteSimpleString("PONG")
+	case 2:
+		c.w.WriteBulkString(args[1])
+	default:
+		c.writeArityError("ping")
+	}
+}
+
+func respEcho(c *respConn, args []string) {
+	c.w.WriteBulkString(args[1])
+}
+
+func respQuit(c *respConn, args []string) {
+	c.w.WriteSimpleString("OK")
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]] switches protocol and replies
+// with information about the server. There are no passwords, so any credentials are accepted
+func respHello(c *respConn, args []string) {
+	proto := c.w.Proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.w.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			c.w.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+	}
+
+	name := c.name
+	for i := 2; i < len(args); i += 1 {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i + 2 >= len(args) {
+				c.writeSyntaxError()
+				return
+			}
+			i += 2
+		case "SETNAME":
+			if i + 1 >= len(args) {
+				c.writeSyntaxError()
+				return
+			}
+			if !validClientName(args[i + 1]) {
+				c.writeClientNameError()
+				return
+			}
+			name = args[i + 1]
+			i += 1
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	c.w.Proto = proto
+	c.name = name
+
+	c.w.WriteMap(7)
+	c.w.WriteBulkString("server")
+	c.w.WriteBulkString("tiny-redis-cache")
+	c.w.WriteBulkString("version")
+	c.w.WriteBulkString(respVersion)
+	c.w.WriteBulkString("proto")
+	c.w.WriteInteger(int64(proto))
+	c.w.WriteBulkString("id")
+	c.w.WriteInteger(c.id)
+	c.w.WriteBulkString("mode")
+	c.w.WriteBulkString("standalone")
+	c.w.WriteBulkString("role")
+	c.w.WriteBulkString("master")
+	c.w.WriteBulkString("modules")
+	c.w.WriteArray(0)
+}
+
+func respAuth(c *respConn, args []string) {
+	if len(args) > 3 {
+		c.writeSyntaxError()
+		return
+	}
+	c.w.WriteError("ERR AUTH <password> called without any password configured for the default user. " +
+		"Are you sure your configuration is correct?")
+}
+
+// SELECT only accepts the single database
+func respSelect(c *respConn, args []string) {
+	index, ok := c.parseInt(args[1])
+	if !ok {
+		return
+	}
+	if index != 0 {
+		c.w.WriteError("ERR DB index is out of range")
+		return
+	}
+	c.w.WriteSimpleString("OK")
+}
+
+func validClientName(name string) bool {
+	for _, ch := range name {
+		if ch <= ' ' || ch > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *respConn) writeClientNameError() {
+	c.w.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+}
+
+// CLIENT ID | GETNAME | SETNAME name | SETINFO attr value
+func respClient(c *respConn, args []string) {
+	sub := strings.ToUpper(args[1])
+	switch {
+	case sub == "ID" && len(args) == 2:
+		c.w.WriteInteger(c.id)
+	case sub == "GETNAME" && len(args) == 2:
+		if c.name == "" {
+			c.w.WriteNull()
+			return
+		}
+		c.w.WriteBulkString(c.name)
+	case sub == "SETNAME" && len(args) == 3:
+		if !validClientName(args[2]) {
+			c.writeClientNameError()
+			return
+		}
+		c.name = args[2]
+		c.w.WriteSimpleString("OK")
+	case sub == "SETINFO" && len(args) == 4:
+		// library name and version sent by clients are accepted, but not kept
+		c.w.WriteSimpleString("OK")
+	case sub == "ID" || sub == "GETNAME" || sub == "SETNAME" || sub == "SETINFO":
+		c.w.WriteError(fmt.Sprintf("ERR wrong number of arguments for 'client|%s' command", strings.ToLower(sub)))
+	default:
+		c.w.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", args[1]))
+	}
+}
+
+// COMMAND COUNT | LIST | DOCS, the last one replies with empty docs which is enough for redis-cli
+func respCommandInfo(c *respConn, args []string) {
+	switch strings.ToUpper(args[1]) {
+	case "COUNT":
+		c.w.WriteInteger(int64(len(respCommands)))
+	case "LIST":
+		names := make([]string, 0, len(respCommands))
+		for name := range respCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.writeStrings(names)
+	case "DOCS":
+		c.w.WriteMap(0)
+	default:
+		c.w.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'. Try COMMAND HELP.", args[1]))
+	}
+}
+
+// INFO replies with all sections regardless of arguments
+func respInfo(c *respConn, args []string) {
+	stats := c.srv.Data.Stats()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\nredis_version:%s\r\nredis_mode:standalone\r\n\r\n", respVersion)
+	fmt.Fprintf(&b, "# Memory\r\nused_memory:%d\r\n\r\n", stats.UsedMemory)
+	aofStatus := "ok"
+	if stats.AOFError != "" {
+		aofStatus = "err"
+	}
+	fmt.Fprintf(&b, "# Persistence\r\naof_last_write_status:%s\r\n\r\n", aofStatus)
+	fmt.Fprintf(&b, "# Stats\r\nexpired_keys:%d\r\nevicted_keys:%d\r\n\r\n",
+		stats.ExpiredActive + stats.ExpiredLazy, stats.Evicted)
+	fmt.Fprintf(&b, "# Keyspace\r\n")
+	if stats.Keys > 0 {
+		fmt.Fprintf(&b, "db0:keys=%d,expires=%d\r\n", stats.Keys, stats.VolatileKeys)
+	}
+	c.w.WriteBulkString(b.String())
+}
+
+func respDBSize(c *respConn, args []string) {
+	c.w.WriteInteger(int64(c.srv.Data.Stats().Keys))
+}
+
+func respPublish(c *respConn, args []string) {
+	c.w.WriteInteger(int64(c.srv.PubSub.Publish(args[1], args[2])))
+}
+
+func respSave(c *respConn, args []string) {
+	if err := c.srv.Data.Save(); err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteSimpleString("OK")
+}
+
+func respBgSave(c *respConn, args []string) {
+	if len(args) > 2 {
+		c.writeSyntaxError()
+		return
+	}
+	if err := c.srv.Data.BgSave(); err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteSimpleString("Background saving started")
+}
+
+func respBgRewriteAOF(c *respConn, args []string) {
+	if err := c.srv.Data.BgRewriteAOF(); err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteSimpleString("Background append only file rewriting started")
+}
+
+// keys
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT timestamp | PXAT timestamp | KEEPTTL]
+func respSet(c *respConn, args []string) {
+	opts := storage.SetOptions{}
+	ttl := time.Duration(0)
+	expires := false
+	for i := 3; i < len(args); i += 1 {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GET":
+			opts.Get = true
+		case "KEEPTTL":
+			opts.KeepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expires || i + 1 == len(args) {
+				c.writeSyntaxError()
+				return
+			}
+			unit := time.Second
+			if option == "PX" || option == "PXAT" {
+				unit = time.Millisecond
+			}
+			d, ok := c.parseDuration(args[i + 1], unit, "set")
+			if !ok {
+				return
+			}
+			if d <= 0 {
+				c.w.WriteError("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = d
+			if option == "EXAT" || option == "PXAT" {
+				// timestamp in the past expires the key at once
+				if ttl = time.Until(time.Unix(0, 0).Add(d)); ttl <= 0 {
+					ttl = time.Nanosecond
+				}
+			}
+			expires = true
+			i += 1
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	if (opts.NX && opts.XX) || (opts.KeepTTL && expires) {
+		c.writeSyntaxError()
+		return
+	}
+
+	result, err := c.srv.Data.SetWithOptions(args[1], args[2], ttl, opts)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	switch {
+	case opts.Get && result.Existed:
+		c.writeStored(result.Previous)
+	case opts.Get:
+		c.w.WriteNull()
+	case result.Written:
+		c.w.WriteSimpleString("OK")
+	default:
+		c.w.WriteNull()
+	}
+}
+
+func respGet(c *respConn, args []string) {
+	value, ok := c.srv.Data.Get(args[1])
+	switch {
+	case !ok:
+		c.w.WriteNull()
+	case isAggregate(value):
+		c.writeStorageError(storage.ErrWrongType)
+	default:
+		c.writeStored(value)
+	}
+}
+
+func respDel(c *respConn, args []string) {
+	c.w.WriteInteger(int64(c.srv.Data.Delete(args[1:]...)))
+}
+
+// EXISTS counts repeated keys several times like redis
+func respExists(c *respConn, args []string) {
+	n := 0
+	for _, key := range args[1:] {
+		if c.srv.Data.Type(key) != "none" {
+			n += 1
+		}
+	}
+	c.w.WriteInteger(int64(n))
+}
+
+func respKeys(c *respConn, args []string) {
+	keys, err := c.srv.Data.Keys(args[1])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeStrings(keys)
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func respScan(c *respConn, args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.writeStorageError(storage.ErrInvalidCursor)
+		return
+	}
+	opts := storage.ScanOptions{}
+	for i := 2; i < len(args); i += 2 {
+		if i + 1 == len(args) {
+			c.writeSyntaxError()
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			opts.Match = args[i + 1]
+		case "COUNT":
+			count, ok := c.parseInt(args[i + 1])
+			if !ok {
+				return
+			}
+			if count < 1 || count > math.MaxInt32 {
+				c.writeSyntaxError()
+				return
+			}
+			opts.Count = int(count)
+		case "TYPE":
+			opts.Type = args[i + 1]
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+
+	keys, next, err := c.srv.Data.Scan(cursor, opts)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteArray(2)
+	c.w.WriteBulkString(strconv.FormatUint(next, 10))
+	c.writeStrings(keys)
+}
+
+func respMGet(c *respConn, args []string) {
+	c.writeValues(c.srv.Data.MGet(args[1:]...))
+}
+
+// keyValues converts arguments of MSET, it replies with error if some key lacks value
+func (c *respConn) keyValues(name string, args []string) ([]storage.KeyValue, bool) {
+	if len(args) % 2 != 0 {
+		c.writeArityError(name)
+		return nil, false
+	}
+	items := make([]storage.KeyValue, len(args) / 2)
+	for i := range items {
+		items[i] = storage.KeyValue{Key: args[2 * i], Value: args[2 * i + 1]}
+	}
+	return items, true
+}
+
+func respMSet(c *respConn, args []string) {
+	items, ok := c.keyValues("mset", args[1:])
+	if !ok {
+		return
+	}
+	if err := c.srv.Data.MSet(items...); err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteSimpleString("OK")
+}
+
+func respMSetNX(c *respConn, args []string) {
+	items, ok := c.keyValues("msetnx", args[1:])
+	if !ok {
+		return
+	}
+	written, err := c.srv.Data.MSetNX(items...)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeBool(written)
+}
+
+func respType(c *respConn, args []string) {
+	c.w.WriteSimpleString(c.srv.Data.Type(args[1]))
+}
+
+func respTTL(c *respConn, args []string) {
+	c.w.WriteInteger(ttlIn(c.srv.Data.TTL(args[1]), time.Second))
+}
+
+func respPTTL(c *respConn, args []string) {
+	c.w.WriteInteger(ttlIn(c.srv.Data.TTL(args[1]), time.Millisecond))
+}
+
+func respExpire(c *respConn, args []string) {
+	ttl, ok := c.parseDuration(args[2], time.Second, "expire")
+	if ok {
+		c.writeBool(c.srv.Data.Expire(args[1], ttl))
+	}
+}
+
+func respPExpire(c *respConn, args []string) {
+	ttl, ok := c.parseDuration(args[2], time.Millisecond, "pexpire")
+	if ok {
+		c.writeBool(c.srv.Data.Expire(args[1], ttl))
+	}
+}
+
+func respExpireAt(c *respConn, args []string) {
+	at, ok := c.parseDuration(args[2], time.Second, "expireat")
+	if ok {
+		c.writeBool(c.srv.Data.ExpireAt(args[1], time.Unix(0, 0).Add(at)))
+	}
+}
+
+func respPExpireAt(c *respConn, args []string) {
+	at, ok := c.parseDuration(args[2], time.Millisecond, "pexpireat")
+	if ok {
+		c.writeBool(c.srv.Data.ExpireAt(args[1], time.Unix(0, 0).Add(at)))
+	}
+}
+
+func respPersist(c *respConn, args []string) {
+	c.writeBool(c.srv.Data.Persist(args[1]))
+}
+
+// strings and counters
+
+func (c *respConn) incrBy(key string, delta int64) {
+	n, err := c.srv.Data.IncrBy(key, delta)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteInteger(n)
+}
+
+func respIncr(c *respConn, args []string) {
+	c.incrBy(args[1], 1)
+}
+
+func respDecr(c *respConn, args []string) {
+	c.incrBy(args[1], -1)
+}
+
+func respIncrBy(c *respConn, args []string) {
+	if delta, ok := c.parseInt(args[2]); ok {
+		c.incrBy(args[1], delta)
+	}
+}
+
+func respDecrBy(c *respConn, args []string) {
+	delta, ok := c.parseInt(args[2])
+	if !ok {
+		return
+	}
+	if delta == math.MinInt64 {
+		c.w.WriteError("ERR decrement would overflow")
+		return
+	}
+	c.incrBy(args[1], -delta)
+}
+
+// INCRBYFLOAT replies with bulk string like redis, not with double
+func respIncrByFloat(c *respConn, args []string) {
+	delta, ok := c.parseFloat(args[2])
+	if !ok {
+		return
+	}
+	f, err := c.srv.Data.IncrByFloat(args[1], delta)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteBulkString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func respAppend(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.Append(args[1], args[2]))
+}
+
+func respGetRange(c *respConn, args []string) {
+	start, ok := c.parseInt(args[2])
+	if !ok {
+		return
+	}
+	stop, ok := c.parseInt(args[3])
+	if !ok {
+		return
+	}
+	s, err := c.srv.Data.GetRange(args[1], int(start), int(stop))
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteBulkString(s)
+}
+
+func respSetRange(c *respConn, args []string) {
+	offset, ok := c.parseInt(args[2])
+	if !ok {
+		return
+	}
+	if offset < 0 || offset > math.MaxInt32 {
+		c.writeStorageError(storage.ErrOffset)
+		return
+	}
+	c.writeCount(c.srv.Data.SetRange(args[1], int(offset), args[3]))
+}
+
+func respStrLen(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.StrLen(args[1]))
+}
+
+func (c *respConn) writeOptional(value interface{}, ok bool, err error) {
+	switch {
+	case err != nil:
+		c.writeStorageError(err)
+	case !ok:
+		c.w.WriteNull()
+	default:
+		c.writeStored(value)
+	}
+}
+
+func respGetDel(c *respConn, args []string) {
+	c.writeOptional(c.srv.Data.GetDel(args[1]))
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT timestamp | PXAT timestamp | PERSIST]
+func respGetEx(c *respConn, args []string) {
+	opts := storage.GetExOptions{}
+	switch {
+	case len(args) == 3 && strings.ToUpper(args[2]) == "PERSIST":
+		opts.Persist = true
+	case len(args) == 4:
+		option := strings.ToUpper(args[2])
+		unit := time.Second
+		if option == "PX" || option == "PXAT" {
+			unit = time.Millisecond
+		}
+		d, ok := c.parseDuration(args[3], unit, "getex")
+		if !ok {
+			return
+		}
+		if d <= 0 {
+			c.w.WriteError("ERR invalid expire time in 'getex' command")
+			return
+		}
+		switch option {
+		case "EX", "PX":
+			opts.TTL = d
+		case "EXAT", "PXAT":
+			opts.At = time.Unix(0, 0).Add(d)
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	case len(args) != 2:
+		c.writeSyntaxError()
+		return
+	}
+	c.writeOptional(c.srv.Data.GetEx(args[1], opts))
+}
+
+// hashes
+
+func respHSet(c *respConn, args []string) {
+	if len(args) % 2 != 0 {
+		c.writeArityError("hset")
+		return
+	}
+	fields := make(map[string]interface{}, (len(args) - 2) / 2)
+	for i := 2; i < len(args); i += 2 {
+		fields[args[i]] = args[i + 1]
+	}
+	c.writeCount(c.srv.Data.HSet(args[1], fields))
+}
+
+func respHGet(c *respConn, args []string) {
+	c.writeOptional(c.srv.Data.HGet(args[1], args[2]))
+}
+
+func respHDel(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.HDel(args[1], args[2:]...))
+}
+
+// HGETALL replies with map ordered by fields
+func respHGetAll(c *respConn, args []string) {
+	hash, err := c.srv.Data.HGetAll(args[1])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	c.w.WriteMap(len(fields))
+	for _, field := range fields {
+		c.w.WriteBulkString(field)
+		c.writeStored(hash[field])
+	}
+}
+
+func respHIncrBy(c *respConn, args []string) {
+	delta, ok := c.parseInt(args[3])
+	if !ok {
+		return
+	}
+	n, err := c.srv.Data.HIncrBy(args[1], args[2], delta)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteInteger(n)
+}
+
+func respHKeys(c *respConn, args []string) {
+	fields, err := c.srv.Data.HKeys(args[1])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeStrings(fields)
+}
+
+func respHLen(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.HLen(args[1]))
+}
+
+// lists
+
+func stringValues(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+func respLPush(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.LPush(args[1], stringValues(args[2:])...))
+}
+
+func respRPush(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.RPush(args[1], stringValues(args[2:])...))
+}
+
+func respLPop(c *respConn, args []string) {
+	c.writeOptional(c.srv.Data.LPop(args[1]))
+}
+
+func respRPop(c *respConn, args []string) {
+	c.writeOptional(c.srv.Data.RPop(args[1]))
+}
+
+// parseRange parses start and stop indices of LRANGE, LTRIM and ZRANGE
+func (c *respConn) parseRange(startArg, stopArg string) (int, int, bool) {
+	start, ok := c.parseInt(startArg)
+	if !ok {
+		return 0, 0, false
+	}
+	stop, ok := c.parseInt(stopArg)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(start), int(stop), true
+}
+
+func respLRange(c *respConn, args []string) {
+	start, stop, ok := c.parseRange(args[2], args[3])
+	if !ok {
+		return
+	}
+	values, err := c.srv.Data.LRange(args[1], start, stop)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeValues(values)
+}
+
+func respLTrim(c *respConn, args []string) {
+	start, stop, ok := c.parseRange(args[2], args[3])
+	if !ok {
+		return
+	}
+	if err := c.srv.Data.LTrim(args[1], start, stop); err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteSimpleString("OK")
+}
+
+func respLLen(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.LLen(args[1]))
+}
+
+// bpop replies with key and value or null array on timeout. Timeout is in seconds, zero blocks
+// until a value is pushed, the client disconnects or the server is closed
+func (c *respConn) bpop(args []string, pop blockingPop) {
+	seconds, err := strconv.ParseFloat(args[len(args) - 1], 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds > math.MaxInt64 / float64(time.Second) {
+		c.w.WriteError("ERR timeout is not a float or out of range")
+		return
+	}
+	if seconds < 0 {
+		c.w.WriteError("ERR timeout is negative")
+		return
+	}
+
+	ctx, stop := c.watchDisconnect()
+	// messages of subscription are written while the command blocks
+	c.wmutex.Unlock()
+	key, value, ok, err := pop(ctx, time.Duration(seconds * float64(time.Second)), args[1:len(args) - 1]...)
+	c.wmutex.Lock()
+	stop()
+	switch {
+	case err != nil:
+		c.writeStorageError(err)
+	case !ok:
+		c.w.WriteNullArray()
+	default:
+		c.w.WriteArray(2)
+		c.w.WriteBulkString(key)
+		c.writeStored(value)
+	}
+}
+
+func respBLPop(c *respConn, args []string) {
+	c.bpop(args, c.srv.Data.BLPop)
+}
+
+func respBRPop(c *respConn, args []string) {
+	c.bpop(args, c.srv.Data.BRPop)
+}
+
+// sets
+
+func respSAdd(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SAdd(args[1], args[2:]...))
+}
+
+func respSRem(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SRem(args[1], args[2:]...))
+}
+
+func (c *respConn) writeSet(members []string, err error) {
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeMembers(members)
+}
+
+func respSMembers(c *respConn, args []string) {
+	c.writeSet(c.srv.Data.SMembers(args[1]))
+}
+
+func respSIsMember(c *respConn, args []string) {
+	isMember, err := c.srv.Data.SIsMember(args[1], args[2])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeBool(isMember)
+}
+
+func respSCard(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SCard(args[1]))
+}
+
+func respSInter(c *respConn, args []string) {
+	c.writeSet(c.srv.Data.SInter(args[1:]...))
+}
+
+func respSUnion(c *respConn, args []string) {
+	c.writeSet(c.srv.Data.SUnion(args[1:]...))
+}
+
+func respSDiff(c *respConn, args []string) {
+	c.writeSet(c.srv.Data.SDiff(args[1:]...))
+}
+
+func respSInterStore(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SInterStore(args[1], args[2:]...))
+}
+
+func respSUnionStore(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SUnionStore(args[1], args[2:]...))
+}
+
+func respSDiffStore(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.SDiffStore(args[1], args[2:]...))
+}
+
+// sorted sets
+
+// parseZMembers parses score and member pairs of ZADD
+func (c *respConn) parseZMembers(args []string) ([]storage.ZMember, bool) {
+	if len(args) % 2 != 0 {
+		c.writeSyntaxError()
+		return nil, false
+	}
+	members := make([]storage.ZMember, 0, len(args) / 2)
+	for i := 0; i < len(args); i += 2 {
+		score, ok := c.parseFloat(args[i])
+		if !ok {
+			return nil, false
+		}
+		members = append(members, storage.ZMember{Member: args[i + 1], Score: score})
+	}
+	return members, true
+}
+
+// ZADD key score member [score member ...], flags of redis aren't supported
+func respZAdd(c *respConn, args []string) {
+	if members, ok := c.parseZMembers(args[2:]); ok {
+		c.writeCount(c.srv.Data.ZAdd(args[1], members...))
+	}
+}
+
+func respZIncrBy(c *respConn, args []string) {
+	delta, ok := c.parseFloat(args[2])
+	if !ok {
+		return
+	}
+	score, err := c.srv.Data.ZIncrBy(args[1], args[3], delta)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteDouble(score)
+}
+
+func respZRem(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.ZRem(args[1], args[2:]...))
+}
+
+func respZScore(c *respConn, args []string) {
+	score, ok, err := c.srv.Data.ZScore(args[1], args[2])
+	switch {
+	case err != nil:
+		c.writeStorageError(err)
+	case !ok:
+		c.w.WriteNull()
+	default:
+		c.w.WriteDouble(score)
+	}
+}
+
+func respZCard(c *respConn, args []string) {
+	c.writeCount(c.srv.Data.ZCard(args[1]))
+}
+
+func (c *respConn) zrank(args []string, reverse bool) {
+	rank, ok, err := c.srv.Data.ZRank(args[1], args[2], reverse)
+	switch {
+	case err != nil:
+		c.writeStorageError(err)
+	case !ok:
+		c.w.WriteNull()
+	default:
+		c.w.WriteInteger(int64(rank))
+	}
+}
+
+func respZRank(c *respConn, args []string) {
+	c.zrank(args, false)
+}
+
+func respZRevRank(c *respConn, args []string) {
+	c.zrank(args, true)
+}
+
+// writeZMembers writes members with scores as pairs for RESP3 and as flat array for RESP2 like redis
+func (c *respConn) writeZMembers(members []storage.ZMember, withScores bool) {
+	switch {
+	case !withScores:
+		c.w.WriteArray(len(members))
+		for _, m := range members {
+			c.w.WriteBulkString(m.Member)
+		}
+	case c.w.Proto >= 3:
+		c.w.WriteArray(len(members))
+		for _, m := range members {
+			c.w.WriteArray(2)
+			c.w.WriteBulkString(m.Member)
+			c.w.WriteDouble(m.Score)
+		}
+	default:
+		c.w.WriteArray(2 * len(members))
+		for _, m := range members {
+			c.w.WriteBulkString(m.Member)
+			c.w.WriteDouble(m.Score)
+		}
+	}
+}
+
+// ZRANGE key start stop [REV] [WITHSCORES], ranges by score are served by ZRANGEBYSCORE
+func (c *respConn) zrange(args []string, reverse bool) {
+	start, stop, ok := c.parseRange(args[2], args[3])
+	if !ok {
+		return
+	}
+	withScores := false
+	for _, arg := range args[4:] {
+		switch strings.ToUpper(arg) {
+		case "WITHSCORES":
+			withScores = true
+		case "REV":
+			reverse = true
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+
+	members, err := c.srv.Data.ZRange(args[1], start, stop, reverse)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeZMembers(members, withScores)
+}
+
+func respZRange(c *respConn, args []string) {
+	c.zrange(args, false)
+}
+
+func respZRevRange(c *respConn, args []string) {
+	c.zrange(args, true)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count], ZREVRANGEBYSCORE takes max first
+func (c *respConn) zrangeByScore(args []string, reverse bool) {
+	first, err := storage.ParseScoreBound(args[2])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	second, err := storage.ParseScoreBound(args[3])
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	scores := storage.ScoreRange{Min: first, Max: second}
+	if reverse {
+		scores = storage.ScoreRange{Min: second, Max: first}
+	}
+
+	opts := storage.RangeOptions{Reverse: reverse}
+	withScores, empty := false, false
+	for i := 4; i < len(args); i += 1 {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i + 2 >= len(args) {
+				c.writeSyntaxError()
+				return
+			}
+			offset, count, ok := c.parseRange(args[i + 1], args[i + 2])
+			if !ok {
+				return
+			}
+			// negative count means no limit, but zero count and negative offset give nothing
+			empty = offset < 0 || count == 0
+			opts.Offset, opts.Count = offset, count
+			i += 2
+		default:
+			c.writeSyntaxError()
+			return
+		}
+	}
+	if empty {
+		c.w.WriteArray(0)
+		return
+	}
+
+	members, err := c.srv.Data.ZRangeByScore(args[1], scores, opts)
+	if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.writeZMembers(members, withScores)
+}
+
+func respZRangeByScore(c *respConn, args []string) {
+	c.zrangeByScore(args, false)
+}
+
+func respZRevRangeByScore(c *respConn, args []string) {
+	c.zrangeByScore(args, true)
+}
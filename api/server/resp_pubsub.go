@@ -0,0 +1,185 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"sort"
+	"strings"
+)
+
+// writeMessage writes message as push, it's array in RESP2
+func (c *respConn) writeMessage(msg api.Message) {
+	if msg.Pattern != "" {
+		c.w.WritePush(4)
+		c.w.WriteBulkString("pmessage")
+		c.w.WriteBulkString(msg.Pattern)
+	} else {
+		c.w.WritePush(3)
+		c.w.WriteBulkString("message")
+	}
+	c.w.WriteBulkString(msg.Channel)
+	c.w.WriteBulkString(msg.Payload)
+}
+
+// forwardMessages writes received messages until the subscription is closed, subscriber
+// which doesn't keep up is disconnected when hub closes its subscription
+func (c *respConn) forwardMessages(sub *Subscription) {
+	defer c.conn.Close()
+
+	for msg := range sub.Messages() {
+		c.wmutex.Lock()
+		c.writeMessage(msg)
+		err := c.w.Flush()
+		c.wmutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// keyEventsSubscription forwards keyspace notifications of the storage as messages of pattern subscription
+type keyEventsSubscription struct {
+	sub *storage.EventSubscription
+	// removed is closed by PUNSUBSCRIBE, otherwise end of events means that subscriber didn't keep up
+	removed chan struct{}
+}
+
+func (ks *keyEventsSubscription) close() {
+	close(ks.removed)
+	ks.sub.Close()
+}
+
+func (c *respConn) forwardKeyEvents(pattern string, ks *keyEventsSubscription) {
+	for event := range ks.sub.Events() {
+		c.wmutex.Lock()
+		c.writeMessage(api.Message{Channel: api.KeyspaceChannel + event.Key, Pattern: pattern, Payload: event.Type})
+		err := c.w.Flush()
+		c.wmutex.Unlock()
+		if err != nil {
+			break
+		}
+	}
+	select {
+	case <-ks.removed:
+	default:
+		c.conn.Close()
+	}
+}
+
+// writeSubscription writes confirmation of SUBSCRIBE, UNSUBSCRIBE and their pattern variants
+// for every channel or pattern, it's followed by number of subscriptions left
+func (c *respConn) writeSubscription(kind string, name string) {
+	c.w.WritePush(3)
+	c.w.WriteBulkString(kind)
+	c.w.WriteBulkString(name)
+	c.w.WriteInteger(int64(c.subscriptions))
+}
+
+// subscribePattern subscribes to published messages or, if pattern starts with api.KeyspaceChannel,
+// to keyspace notifications about keys matching the rest of pattern
+func (c *respConn) subscribePattern(pattern string) (int, error) {
+	if !strings.HasPrefix(pattern, api.KeyspaceChannel) {
+		n, err := c.sub.Add(nil, []string{pattern})
+		return n + len(c.keyEvents), err
+	}
+	hubCount := c.subscriptions - len(c.keyEvents)
+	if _, exists := c.keyEvents[pattern]; !exists {
+		sub, err := c.srv.Data.SubscribeEvents(strings.TrimPrefix(pattern, api.KeyspaceChannel))
+		if err != nil {
+			return c.subscriptions, err
+		}
+		if c.keyEvents == nil {
+			c.keyEvents = make(map[string]*keyEventsSubscription)
+		}
+		ks := &keyEventsSubscription{sub: sub, removed: make(chan struct{})}
+		c.keyEvents[pattern] = ks
+		go c.forwardKeyEvents(pattern, ks)
+	}
+	return hubCount + len(c.keyEvents), nil
+}
+
+// subscribe adds channels or patterns if isPattern is set to subscriptions of the connection
+func (c *respConn) subscribe(kind string, names []string, isPattern bool) {
+	if c.sub == nil {
+		c.sub, _ = c.srv.PubSub.Subscribe(nil, nil)
+		go c.forwardMessages(c.sub)
+	}
+	for _, name := range names {
+		var n int
+		var err error
+		if isPattern {
+			n, err = c.subscribePattern(name)
+		} else {
+			n, err = c.sub.Add([]string{name}, nil)
+			n += len(c.keyEvents)
+		}
+		if err != nil {
+			c.writeStorageError(err)
+			continue
+		}
+		c.subscriptions = n
+		c.writeSubscription(kind, name)
+	}
+}
+
+// patterns returns patterns of published messages and keyspace notifications
+func (c *respConn) patterns() []string {
+	var patterns []string
+	if c.sub != nil {
+		patterns = c.sub.Patterns()
+	}
+	keyPatterns := make([]string, 0, len(c.keyEvents))
+	for pattern := range c.keyEvents {
+		keyPatterns = append(keyPatterns, pattern)
+	}
+	sort.Strings(keyPatterns)
+	return append(patterns, keyPatterns...)
+}
+
+// unsubscribe removes channels or patterns if isPattern is set, all of them are removed if names are empty
+func (c *respConn) unsubscribe(kind string, names []string, isPattern bool) {
+	if len(names) == 0 {
+		if isPattern {
+			names = c.patterns()
+		} else if c.sub != nil {
+			names = c.sub.Channels()
+		}
+	}
+	if len(names) == 0 {
+		c.w.WritePush(3)
+		c.w.WriteBulkString(kind)
+		c.w.WriteNull()
+		c.w.WriteInteger(int64(c.subscriptions))
+		return
+	}
+	for _, name := range names {
+		if ks, exists := c.keyEvents[name]; exists && isPattern {
+			ks.close()
+			delete(c.keyEvents, name)
+			c.subscriptions -= 1
+		} else if c.sub != nil && isPattern {
+			c.subscriptions = c.sub.Remove(nil, []string{name}) + len(c.keyEvents)
+		} else if c.sub != nil {
+			c.subscriptions = c.sub.Remove([]string{name}, nil) + len(c.keyEvents)
+		}
+		c.writeSubscription(kind, name)
+	}
+}
+
+func respSubscribe(c *respConn, args []string) {
+	c.subscribe("subscribe", args[1:], false)
+}
+
+// PSUBSCRIBE of api.KeyspaceChannel followed by glob pattern of keys receives keyspace notifications
+func respPSubscribe(c *respConn, args []string) {
+	c.subscribe("psubscribe", args[1:], true)
+}
+
+func respUnsubscribe(c *respConn, args []string) {
+	c.unsubscribe("unsubscribe", args[1:], false)
+}
+
+func respPUnsubscribe(c *respConn, args []string) {
+	c.unsubscribe("punsubscribe", args[1:], true)
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// txCommand converts arguments of command queued after MULTI to command of storage transaction,
+// it replies with error and returns false if they are invalid like handler of the command does
+type txCommand func(c *respConn, args []string) (storage.Command, bool)
+
+// respTxCommands can be queued after MULTI, number of arguments is already checked by respCommands
+var respTxCommands = map[string]txCommand{
+	"set": txSet,
+	"get": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.GetCommand(args[1]), true
+	},
+	"del": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.DelCommand(args[1:]...), true
+	},
+	"expire": func(c *respConn, args []string) (storage.Command, bool) {
+		ttl, ok := c.parseDuration(args[2], time.Second, "expire")
+		return storage.ExpireCommand(args[1], ttl), ok
+	},
+	"pexpire": func(c *respConn, args []string) (storage.Command, bool) {
+		ttl, ok := c.parseDuration(args[2], time.Millisecond, "pexpire")
+		return storage.ExpireCommand(args[1], ttl), ok
+	},
+	"persist": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.PersistCommand(args[1]), true
+	},
+
+	"incr": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.IncrByCommand(args[1], 1), true
+	},
+	"decr": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.IncrByCommand(args[1], -1), true
+	},
+	"incrby": func(c *respConn, args []string) (storage.Command, bool) {
+		delta, ok := c.parseInt(args[2])
+		return storage.IncrByCommand(args[1], delta), ok
+	},
+	"decrby": func(c *respConn, args []string) (storage.Command, bool) {
+		delta, ok := c.parseInt(args[2])
+		if ok && delta == math.MinInt64 {
+			c.w.WriteError("ERR decrement would overflow")
+			return storage.Command{}, false
+		}
+		return storage.IncrByCommand(args[1], -delta), ok
+	},
+	"incrbyfloat": func(c *respConn, args []string) (storage.Command, bool) {
+		delta, ok := c.parseFloat(args[2])
+		return storage.IncrByFloatCommand(args[1], delta), ok
+	},
+	"append": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.AppendCommand(args[1], args[2]), true
+	},
+
+	"hset": func(c *respConn, args []string) (storage.Command, bool) {
+		if len(args) % 2 != 0 {
+			c.writeArityError("hset")
+			return storage.Command{}, false
+		}
+		fields := make(map[string]interface{}, (len(args) - 2) / 2)
+		for i := 2; i < len(args); i += 2 {
+			fields[args[i]] = args[i + 1]
+		}
+		return storage.HSetCommand(args[1], fields), true
+	},
+	"hget": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.HGetCommand(args[1], args[2]), true
+	},
+	"hdel": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.HDelCommand(args[1], args[2:]...), true
+	},
+	"hincrby": func(c *respConn, args []string) (storage.Command, bool) {
+		delta, ok := c.parseInt(args[3])
+		return storage.HIncrByCommand(args[1], args[2], delta), ok
+	},
+
+	"lpush": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.LPushCommand(args[1], stringValues(args[2:])...), true
+	},
+	"rpush": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.RPushCommand(args[1], stringValues(args[2:])...), true
+	},
+	"lpop": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.LPopCommand(args[1]), true
+	},
+	"rpop": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.RPopCommand(args[1]), true
+	},
+
+	"sadd": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.SAddCommand(args[1], args[2:]...), true
+	},
+	"srem": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.SRemCommand(args[1], args[2:]...), true
+	},
+
+	"zadd": func(c *respConn, args []string) (storage.Command, bool) {
+		members, ok := c.parseZMembers(args[2:])
+		return storage.ZAddCommand(args[1], members...), ok
+	},
+	"zincrby": func(c *respConn, args []string) (storage.Command, bool) {
+		delta, ok := c.parseFloat(args[2])
+		return storage.ZIncrByCommand(args[1], args[3], delta), ok
+	},
+	"zrem": func(c *respConn, args []string) (storage.Command, bool) {
+		return storage.ZRemCommand(args[1], args[2:]...), true
+	},
+}
+
+// SET key value [EX seconds | PX milliseconds], other options can't be used in transaction
+func txSet(c *respConn, args []string) (storage.Command, bool) {
+	ttl := time.Duration(0)
+	if len(args) > 3 {
+		option := strings.ToUpper(args[3])
+		if len(args) != 5 || (option != "EX" && option != "PX") {
+			c.w.WriteError("ERR options of SET other than EX and PX can't be used in transaction")
+			return storage.Command{}, false
+		}
+		unit := time.Second
+		if option == "PX" {
+			unit = time.Millisecond
+		}
+		d, ok := c.parseDuration(args[4], unit, "set")
+		if !ok {
+			return storage.Command{}, false
+		}
+		if d <= 0 {
+			c.w.WriteError("ERR invalid expire time in 'set' command")
+			return storage.Command{}, false
+		}
+		ttl = d
+	}
+	return storage.SetCommand(args[1], args[2], ttl), true
+}
+
+// queue replies with QUEUED or with error, then EXEC discards the transaction
+func (c *respConn) queue(name string, args []string) {
+	convert, ok := respTxCommands[name]
+	if !ok {
+		c.w.WriteError("ERR command can't be used in transaction")
+		c.multiFailed = true
+		return
+	}
+	cmd, ok := convert(c, args)
+	if !ok {
+		c.multiFailed = true
+		return
+	}
+	c.tx.Queue(cmd)
+	c.queued = append(c.queued, cmd)
+	c.w.WriteSimpleString("QUEUED")
+}
+
+// writeTxResult writes result of queued command the same way as the handler of the command
+func (c *respConn) writeTxResult(cmd storage.Command, result storage.CommandResult) {
+	if result.Err != nil {
+		c.writeStorageError(result.Err)
+		return
+	}
+	switch cmd.Name() {
+	case "set":
+		c.w.WriteSimpleString("OK")
+		return
+	case "get", "hget", "lpop", "rpop", "incrbyfloat":
+		c.writeStored(result.Value)
+		return
+	case "zincrby":
+		c.w.WriteDouble(result.Value.(float64))
+		return
+	}
+	switch v := result.Value.(type) {
+	case bool:
+		c.writeBool(v)
+	case int:
+		c.w.WriteInteger(int64(v))
+	case int64:
+		c.w.WriteInteger(v)
+	default:
+		c.writeStored(v)
+	}
+}
+
+// resetMulti leaves MULTI state, keys stay watched
+func (c *respConn) resetMulti() {
+	c.multi = false
+	c.multiFailed = false
+	c.queued = nil
+}
+
+func respMulti(c *respConn, args []string) {
+	if c.multi {
+		c.w.WriteError("ERR MULTI calls can not be nested")
+		return
+	}
+	if c.tx == nil {
+		c.tx = storage.NewTx(c.srv.Data)
+	}
+	c.multi = true
+	c.w.WriteSimpleString("OK")
+}
+
+// EXEC replies with results of queued commands or null array if some of the watched keys was modified
+func respExec(c *respConn, args []string) {
+	if !c.multi {
+		c.w.WriteError("ERR EXEC without MULTI")
+		return
+	}
+	failed, cmds := c.multiFailed, c.queued
+	c.resetMulti()
+	if failed {
+		c.tx.Discard()
+		c.w.WriteError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	results, err := c.tx.Exec()
+	if errors.Is(err, storage.ErrTxAborted) {
+		c.w.WriteNullArray()
+		return
+	} else if err != nil {
+		c.writeStorageError(err)
+		return
+	}
+	c.w.WriteArray(len(results))
+	for i, result := range results {
+		c.writeTxResult(cmds[i], result)
+	}
+}
+
+func respDiscard(c *respConn, args []string) {
+	if !c.multi {
+		c.w.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	c.resetMulti()
+	c.tx.Discard()
+	c.w.WriteSimpleString("OK")
+}
+
+func respWatch(c *respConn, args []string) {
+	if c.multi {
+		c.w.WriteError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+	if c.tx == nil {
+		c.tx = storage.NewTx(c.srv.Data)
+	}
+	c.tx.Watch(args[1:]...)
+	c.w.WriteSimpleString("OK")
+}
+
+func respUnwatch(c *respConn, args []string) {
+	if c.tx != nil {
+		c.tx.Discard()
+	}
+	c.w.WriteSimpleString("OK")
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTLHeader passes ttl of PUT /keys/{key} like the ttl query parameter,
+// both accept seconds or duration like "1m30s"
+const TTLHeader = "X-Ttl"
+
+// HandleKeyResource serves keys as resources of /keys/{key}: GET and HEAD respond with the value encoded
+// to json and its ETag, PUT writes the value of request body, DELETE deletes the key.
+// Missing keys are answered with 404, GET of hash, list, set or sorted set fails with WRONGTYPE
+// like /get does. Key is the rest of escaped path, so keys containing "/" may be sent
+// with it escaped as %2F, any key can be sent escaped by url.PathEscape
+func (srv *CacheServer) HandleKeyResource(w http.ResponseWriter, r *http.Request) {
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/keys/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, r.Method, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		srv.handleGetKey(w, r, key)
+	case http.MethodPut:
+		srv.handlePutKey(w, r, key)
+	case http.MethodDelete:
+		srv.handleDeleteKey(w, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, r.Method, "method not allowed")
+	}
+}
+
+func (srv *CacheServer) handleGetKey(w http.ResponseWriter, r *http.Request, key string) {
+	val, exists := srv.Data.Get(key)
+	if !exists {
+		writeError(w, http.StatusNotFound, "GET", "key not found")
+		return
+	}
+	if storage.TypeOf(val) != "string" {
+		writeError(w, storageErrorStatus(storage.ErrWrongType), "GET", storage.ErrWrongType.Error())
+		return
+	}
+	encoded, err := encodeResult(val)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	etag := etagOf(encoded)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(encoded)))
+	w.Write(encoded)
+}
+
+// handlePutKey stores body as json value if it's sent with json content type, otherwise as string.
+// It responds with 201 if key is created and 204 if it's replaced, "If-None-Match: *" writes only a new key
+func (srv *CacheServer) handlePutKey(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "SET", "key argument must be specified")
+		return
+	}
+	ttl, err := requestTTL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "SET", err.Error())
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "SET", err.Error())
+		return
+	}
+
+	var value interface{} = string(body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.Unmarshal(body, &value); err != nil {
+			writeError(w, http.StatusBadRequest, "SET", err.Error())
+			return
+		}
+		if value == nil {
+			writeError(w, http.StatusBadRequest, "SET", "value argument must be specified")
+			return
+		}
+	}
+
+	opts := storage.SetOptions{NX: strings.TrimSpace(r.Header.Get("If-None-Match")) == "*"}
+	result, err := srv.Data.SetWithOptions(key, value, ttl, opts)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SET", err.Error())
+		return
+	}
+	if !result.Written {
+		writeError(w, http.StatusPreconditionFailed, "SET", "key already exists")
+		return
+	}
+
+	if encoded, err := encodeResult(value); err == nil {
+		w.Header().Set("ETag", etagOf(encoded))
+	}
+	if result.Existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (srv *CacheServer) handleDeleteKey(w http.ResponseWriter, key string) {
+	if srv.Data.Delete(key) == 0 {
+		writeError(w, http.StatusNotFound, "DEL", "key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListKeys serves GET /keys?pattern=, empty pattern matches all keys
+func (srv *CacheServer) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+	val, err := srv.Data.Keys(pattern)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "KEYS", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeResult(w, val)
+}
+
+// requestTTL takes ttl from query or, if it's absent, from TTLHeader. Zero ttl means no expiration
+func requestTTL(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		s = r.Header.Get(TTLHeader)
+	}
+	if s == "" {
+		return 0, nil
+	}
+
+	var ttl time.Duration
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, errors.New("ttl argument must be nonnegative")
+		}
+		if seconds > int64(time.Duration(1 << 63 - 1) / time.Second) {
+			return 0, errors.New("ttl is out of range")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	} else if ttl, err = time.ParseDuration(s); err != nil {
+		return 0, errors.New("ttl must be seconds or duration like 1m30s")
+	}
+	if ttl < 0 {
+		return 0, errors.New("ttl argument must be nonnegative")
+	}
+	return ttl, nil
+}
+
+// etagOf is a strong ETag of the encoded value, so equal values have equal tags regardless of versions
+func etagOf(encoded []byte) string {
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches compares the tag with the list of If-None-Match header weakly, as RFC 7232 requires
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
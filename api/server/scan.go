@@ -0,0 +1,27 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+)
+
+func (srv *CacheServer) HandleScan(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ScanParams)
+	if !parseRequest(w, r, "SCAN", params, func() error { return api.ValidateScanParams(params) }) {
+		return
+	}
+
+	opts := storage.ScanOptions{
+		Count: params.Count,
+		Match: params.Match,
+		Type: params.Type,
+	}
+	keys, cursor, err := srv.Data.Scan(params.Cursor, opts)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SCAN", err.Error())
+		return
+	}
+	writeResult(w, api.ScanResult{Cursor: cursor, Keys: keys})
+}
@@ -4,29 +4,160 @@ import (
 	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
 	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
 	
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 )
 
 type CacheServer struct {
 	Data storage.Storage
+	PubSub *Hub
 	Mux *http.ServeMux
 }
 
 func New() *CacheServer {
+	return NewWithStorage(storage.New(0))
+}
+
+func NewWithStorage(data storage.Storage) *CacheServer {
 	srv := &CacheServer{
-		Data: storage.New(0),
+		Data: data,
+		PubSub: NewHub(),
 		Mux: http.NewServeMux(),
 	}
 	srv.Mux.HandleFunc("/set", srv.HandleSet)
 	srv.Mux.HandleFunc("/get", srv.HandleGet)
 	srv.Mux.HandleFunc("/del", srv.HandleDel)
 	srv.Mux.HandleFunc("/keys", srv.HandleKeys)
+	srv.Mux.HandleFunc("/keys/", srv.HandleKeyResource)
+	srv.Mux.HandleFunc("/scan", srv.HandleScan)
+	srv.Mux.HandleFunc("/mget", srv.HandleMGet)
+	srv.Mux.HandleFunc("/mset", srv.HandleMSet)
+	srv.Mux.HandleFunc("/msetnx", srv.HandleMSetNX)
+	srv.Mux.HandleFunc("/watch", srv.HandleWatch)
+	srv.Mux.HandleFunc("/exec", srv.HandleExec)
+	srv.Mux.HandleFunc("/pipeline", srv.HandlePipeline)
+	srv.Mux.HandleFunc("/publish", srv.HandlePublish)
+	srv.Mux.HandleFunc("/subscribe", srv.HandleSubscribe)
+	srv.Mux.HandleFunc("/keyevents", srv.HandleKeyEvents)
+	srv.Mux.HandleFunc("/type", srv.HandleType)
+	srv.Mux.HandleFunc("/ttl", srv.HandleTTL)
+	srv.Mux.HandleFunc("/pttl", srv.HandlePTTL)
+	srv.Mux.HandleFunc("/expire", srv.HandleExpire)
+	srv.Mux.HandleFunc("/pexpire", srv.HandlePExpire)
+	srv.Mux.HandleFunc("/expireat", srv.HandleExpireAt)
+	srv.Mux.HandleFunc("/persist", srv.HandlePersist)
+	srv.Mux.HandleFunc("/incr", srv.HandleIncr)
+	srv.Mux.HandleFunc("/decr", srv.HandleDecr)
+	srv.Mux.HandleFunc("/incrby", srv.HandleIncrBy)
+	srv.Mux.HandleFunc("/decrby", srv.HandleDecrBy)
+	srv.Mux.HandleFunc("/incrbyfloat", srv.HandleIncrByFloat)
+	srv.Mux.HandleFunc("/append", srv.HandleAppend)
+	srv.Mux.HandleFunc("/getrange", srv.HandleGetRange)
+	srv.Mux.HandleFunc("/setrange", srv.HandleSetRange)
+	srv.Mux.HandleFunc("/strlen", srv.HandleStrLen)
+	srv.Mux.HandleFunc("/getdel", srv.HandleGetDel)
+	srv.Mux.HandleFunc("/getex", srv.HandleGetEx)
+	srv.Mux.HandleFunc("/hset", srv.HandleHSet)
+	srv.Mux.HandleFunc("/hget", srv.HandleHGet)
+	srv.Mux.HandleFunc("/hdel", srv.HandleHDel)
+	srv.Mux.HandleFunc("/hgetall", srv.HandleHGetAll)
+	srv.Mux.HandleFunc("/hincrby", srv.HandleHIncrBy)
+	srv.Mux.HandleFunc("/hkeys", srv.HandleHKeys)
+	srv.Mux.HandleFunc("/hlen", srv.HandleHLen)
+	srv.Mux.HandleFunc("/lpush", srv.HandleLPush)
+	srv.Mux.HandleFunc("/rpush", srv.HandleRPush)
+	srv.Mux.HandleFunc("/lpop", srv.HandleLPop)
+	srv.Mux.HandleFunc("/rpop", srv.HandleRPop)
+	srv.Mux.HandleFunc("/lrange", srv.HandleLRange)
+	srv.Mux.HandleFunc("/ltrim", srv.HandleLTrim)
+	srv.Mux.HandleFunc("/llen", srv.HandleLLen)
+	srv.Mux.HandleFunc("/blpop", srv.HandleBLPop)
+	srv.Mux.HandleFunc("/brpop", srv.HandleBRPop)
+	srv.Mux.HandleFunc("/sadd", srv.HandleSAdd)
+	srv.Mux.HandleFunc("/srem", srv.HandleSRem)
+	srv.Mux.HandleFunc("/smembers", srv.HandleSMembers)
+	srv.Mux.HandleFunc("/sismember", srv.HandleSIsMember)
+	srv.Mux.HandleFunc("/scard", srv.HandleSCard)
+	srv.Mux.HandleFunc("/sinter", srv.HandleSInter)
+	srv.Mux.HandleFunc("/sunion", srv.HandleSUnion)
+	srv.Mux.HandleFunc("/sdiff", srv.HandleSDiff)
+	srv.Mux.HandleFunc("/sinterstore", srv.HandleSInterStore)
+	srv.Mux.HandleFunc("/sunionstore", srv.HandleSUnionStore)
+	srv.Mux.HandleFunc("/sdiffstore", srv.HandleSDiffStore)
+	srv.Mux.HandleFunc("/zadd", srv.HandleZAdd)
+	srv.Mux.HandleFunc("/zincrby", srv.HandleZIncrBy)
+	srv.Mux.HandleFunc("/zrem", srv.HandleZRem)
+	srv.Mux.HandleFunc("/zscore", srv.HandleZScore)
+	srv.Mux.HandleFunc("/zcard", srv.HandleZCard)
+	srv.Mux.HandleFunc("/zrank", srv.HandleZRank)
+	srv.Mux.HandleFunc("/zrange", srv.HandleZRange)
+	srv.Mux.HandleFunc("/zrangebyscore", srv.HandleZRangeByScore)
+	srv.Mux.HandleFunc("/save", srv.HandleSave)
+	srv.Mux.HandleFunc("/bgsave", srv.HandleBgSave)
+	srv.Mux.HandleFunc("/bgrewriteaof", srv.HandleBgRewriteAOF)
+	srv.Mux.HandleFunc("/info", srv.HandleInfo)
 
 	return srv
 }
 
+func writeError(w http.ResponseWriter, status int, op string, errString string) {
+	w.WriteHeader(status)
+	resp, _ := json.Marshal(api.ErrorResponse{Op: op, Err: errString, Status: status})
+	w.Write(resp)
+}
+
+// parseRequest decodes and validates params of op, on failure it responds with error and returns false
+func parseRequest(w http.ResponseWriter, r *http.Request, op string, params interface{}, validate func() error) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	errString := ""
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		errString = err.Error()
+	} else if err := validate(); err != nil {
+		errString = err.Error()
+	}
+	if errString != "" {
+		writeError(w, http.StatusBadRequest, op, errString)
+		return false
+	}
+	return true
+}
+
+// writeResult responds with result encoded to json. Unlike json.Marshal it doesn't escape
+// <, > and &, so stored strings are written exactly as they were set
+func writeResult(w http.ResponseWriter, result interface{}) {
+	encoded, err := encodeResult(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(encoded)
+}
+
+// encodeResult encodes result to json without escaping of html characters and trailing newline
+func encodeResult(result interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(result); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ServeHTTP passes key resources to HandleKeyResource directly, since Mux would redirect
+// paths of keys containing "//" or segments like ".." to cleaned ones
 func (srv *CacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/keys/") {
+		srv.HandleKeyResource(w, r)
+		return
+	}
 	srv.Mux.ServeHTTP(w, r)
 }
 
@@ -47,15 +178,32 @@ func (srv *CacheServer) HandleSet(w http.ResponseWriter, r *http.Request) {
 		errString = err.Error()
 	}
 	if errString != "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := api.ErrorResponse{"SET", errString}
-		resp, _ := json.Marshal(err)
-		w.Write(resp)
+		writeError(w, http.StatusBadRequest, "SET", errString)
 		return
 	}
 
-	srv.Data.Set(params.Key, params.Value, params.Ttl)
-	w.Write([]byte(`"OK"`))
+	opts := storage.SetOptions{
+		NX: params.NX,
+		XX: params.XX,
+		KeepTTL: params.KeepTTL,
+		Get: params.Get,
+		IfVersion: params.Version,
+	}
+	result, err := srv.Data.SetWithOptions(params.Key, params.Value, params.Ttl, opts)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SET", err.Error())
+		return
+	}
+
+	// like redis: previous value with Get option, otherwise "OK" or null if nothing was written
+	switch {
+	case params.Get || params.Version != nil:
+		writeResult(w, api.SetResult{Written: result.Written, Previous: result.Previous, Version: result.Version})
+	case result.Written:
+		w.Write([]byte(`"OK"`))
+	default:
+		w.Write([]byte("null"))
+	}
 }
 
 func (srv *CacheServer) HandleGet(w http.ResponseWriter, r *http.Request) {
@@ -75,25 +223,24 @@ func (srv *CacheServer) HandleGet(w http.ResponseWriter, r *http.Request) {
 		errString = err.Error()
 	}
 	if errString != "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := api.ErrorResponse{"GET", errString}
-		resp, _ := json.Marshal(err)
-		w.Write(resp)
+		writeError(w, http.StatusBadRequest, "GET", errString)
 		return
 	}
 	
-	val, exists := srv.Data.Get(params.Key)
+	val, version, exists := srv.Data.GetWithVersion(params.Key)
 	if !exists {
 		w.Write([]byte("null"))
 		return
 	}
-
-	resp, err := json.Marshal(val)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if storage.TypeOf(val) != "string" {
+		writeError(w, storageErrorStatus(storage.ErrWrongType), "GET", storage.ErrWrongType.Error())
 		return
 	}
-	w.Write(resp)
+	if params.WithVersion {
+		writeResult(w, api.VersionedValue{Value: val, Version: version})
+		return
+	}
+	writeResult(w, val)
 }
 
 func (srv *CacheServer) HandleDel(w http.ResponseWriter, r *http.Request) {
@@ -113,14 +260,21 @@ func (srv *CacheServer) HandleDel(w http.ResponseWriter, r *http.Request) {
 		errString = err.Error()
 	}
 	if errString != "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := api.ErrorResponse{"DEL", errString}
-		resp, _ := json.Marshal(err)
-		w.Write(resp)
+		writeError(w, http.StatusBadRequest, "DEL", errString)
 		return
 	}
 	
-	deleted := srv.Data.Delete(params.Keys...)
+	var deleted int
+	if params.Version != nil {
+		ok, err := srv.Data.DeleteIfVersion(params.Keys[0], *params.Version)
+		if err != nil {
+			writeError(w, storageErrorStatus(err), "DEL", err.Error())
+			return
+		}
+		deleted = boolToInt(ok)
+	} else {
+		deleted = srv.Data.Delete(params.Keys...)
+	}
 
 	resp, err := json.Marshal(deleted)
 	if err != nil {
@@ -131,6 +285,10 @@ func (srv *CacheServer) HandleDel(w http.ResponseWriter, r *http.Request) {
 }
 
 func (srv *CacheServer) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		srv.handleListKeys(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
 		return
@@ -147,23 +305,113 @@ func (srv *CacheServer) HandleKeys(w http.ResponseWriter, r *http.Request) {
 		errString = err.Error()
 	}
 	if errString != "" {
-		w.WriteHeader(http.StatusBadRequest)
-		err := api.ErrorResponse{"KEYS", errString}
-		resp, _ := json.Marshal(err)
-		w.Write(resp)
+		writeError(w, http.StatusBadRequest, "KEYS", errString)
 		return
 	}
 	
 	val, err := srv.Data.Keys(params.Pattern)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, storageErrorStatus(err), "KEYS", err.Error())
 		return
 	}
+	writeResult(w, val)
+}
+
+func (srv *CacheServer) HandleType(w http.ResponseWriter, r *http.Request) {
+	params := new(api.TypeParams)
+	if !parseRequest(w, r, "TYPE", params, func() error { return api.ValidateTypeParams(params) }) {
+		return
+	}
+
+	writeResult(w, srv.Data.Type(params.Key))
+}
+
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrOutOfMemory):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, storage.ErrSetOptions):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNotInteger), errors.Is(err, storage.ErrNotFloat), errors.Is(err, storage.ErrOverflow),
+		errors.Is(err, storage.ErrScoreNaN):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrWrongType), errors.Is(err, storage.ErrNotString):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrOffset), errors.Is(err, storage.ErrGetExOptions):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrInvalidCursor), errors.Is(err, storage.ErrPattern), errors.Is(err, storage.ErrNoKeys):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNotificationsDisabled):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrClosed), errors.Is(err, storage.ErrAppendOnlyWrite):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func saveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrSnapshotDisabled), errors.Is(err, storage.ErrAppendOnlyDisabled):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrSaveInProgress), errors.Is(err, storage.ErrRewriteInProgress):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrAppendOnlyWrite):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (srv *CacheServer) HandleSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := srv.Data.Save(); err != nil {
+		writeError(w, saveErrorStatus(err), "SAVE", err.Error())
+		return
+	}
+	w.Write([]byte(`"OK"`))
+}
+
+func (srv *CacheServer) HandleBgSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := srv.Data.BgSave(); err != nil {
+		writeError(w, saveErrorStatus(err), "BGSAVE", err.Error())
+		return
+	}
+	w.Write([]byte(`"Background saving started"`))
+}
 
-	resp, err := json.Marshal(val)
+func (srv *CacheServer) HandleBgRewriteAOF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := srv.Data.BgRewriteAOF(); err != nil {
+		writeError(w, saveErrorStatus(err), "BGREWRITEAOF", err.Error())
+		return
+	}
+	w.Write([]byte(`"Background append only file rewriting started"`))
+}
+
+func (srv *CacheServer) HandleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST method to access api", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := json.Marshal(srv.Data.Stats())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Write(resp)
-}
\ No newline at end of file
+}
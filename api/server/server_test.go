@@ -1,11 +1,21 @@
 package server
 
 import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api/client"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api/resp"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+
 	"encoding/json"
+	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"testing"
@@ -145,4 +155,1459 @@ func TestCorrectScenario(t *testing.T) {
 		t.Fatalf("Expected response: 1, got %d\n", resInt)
 	}
 
-}
\ No newline at end of file
+}
+
+func TestSaveWithoutSnapshots(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+
+	for _, ep := range []string{"/save", "/bgsave"} {
+		resp, _ := c.Post(srv.URL + ep, "application/json", nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected StatusBadRequest, got %d StatusCode\n", ep, resp.StatusCode)
+		}
+	}
+}
+
+func TestOutOfMemory(t *testing.T) {
+	srv := httptest.NewServer(NewWithStorage(storage.New(0, storage.WithMaxMemory(1, storage.NoEviction))))
+	c := http.Client{}
+
+	resp, _ := c.Post(srv.URL + "/set", "application/json", strings.NewReader(`{"Key": "K1", "Value": "V"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("First SET: expected StatusOK, got %d StatusCode\n", resp.StatusCode)
+	}
+
+	resp, _ = c.Post(srv.URL + "/set", "application/json", strings.NewReader(`{"Key": "K2", "Value": "V"}`))
+	if resp.StatusCode != http.StatusInsufficientStorage {
+		t.Fatalf("Second SET: expected StatusInsufficientStorage, got %d StatusCode\n", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	errResp := api.ErrorResponse{}
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Op != "SET" {
+		t.Fatalf("Expected ErrorResponse of SET, got:\n%s", string(body))
+	}
+}
+
+func TestTTLScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) int64 {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var result int64
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			t.Fatalf("%s: expected int in JSON, got:\n%s", ep, string(respBody))
+		}
+		return result
+	}
+
+	if res := post("/ttl", `{"Key": "K"}`); res != -2 {
+		t.Fatalf("TTL of missing key: expected -2, got %d\n", res)
+	}
+	c.Post(srv.URL + "/set", h, strings.NewReader(`{"Key": "K", "Value": "V"}`))
+	if res := post("/pttl", `{"Key": "K"}`); res != -1 {
+		t.Fatalf("PTTL of key without ttl: expected -1, got %d\n", res)
+	}
+	if res := post("/expire", `{"Key": "K", "Seconds": 100}`); res != 1 {
+		t.Fatalf("EXPIRE: expected 1, got %d\n", res)
+	}
+	if res := post("/ttl", `{"Key": "K"}`); res != 100 {
+		t.Fatalf("TTL: expected 100, got %d\n", res)
+	}
+	if res := post("/persist", `{"Key": "K"}`); res != 1 {
+		t.Fatalf("PERSIST: expected 1, got %d\n", res)
+	}
+	if res := post("/pexpire", `{"Key": "K", "Milliseconds": 5000}`); res != 1 {
+		t.Fatalf("PEXPIRE: expected 1, got %d\n", res)
+	}
+	if res := post("/pttl", `{"Key": "K"}`); res <= 4000 || res > 5000 {
+		t.Fatalf("PTTL: expected value in (4000, 5000], got %d\n", res)
+	}
+	if res := post("/expireat", `{"Key": "K", "Timestamp": 1}`); res != 1 {
+		t.Fatalf("EXPIREAT: expected 1, got %d\n", res)
+	}
+	if res := post("/ttl", `{"Key": "K"}`); res != -2 {
+		t.Fatalf("TTL after EXPIREAT in the past: expected -2, got %d\n", res)
+	}
+
+	resp, _ := c.Post(srv.URL + "/expire", h, strings.NewReader(`{"Seconds": 100}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("EXPIRE without key: expected StatusBadRequest, got %d StatusCode\n", resp.StatusCode)
+	}
+
+	// ttl out of range of time.Duration must not wrap around to negative one deleting the key
+	c.Post(srv.URL + "/set", h, strings.NewReader(`{"Key": "K", "Value": "V"}`))
+	for _, body := range []string{`{"Key": "K", "Seconds": 10000000000}`, `{"Key": "K", "Seconds": -10000000000}`} {
+		resp, _ = c.Post(srv.URL + "/expire", h, strings.NewReader(body))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("EXPIRE %s: expected StatusBadRequest, got %d StatusCode\n", body, resp.StatusCode)
+		}
+	}
+	resp, _ = c.Post(srv.URL + "/pexpire", h, strings.NewReader(`{"Key": "K", "Milliseconds": 9223372036854776}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PEXPIRE out of range: expected StatusBadRequest, got %d StatusCode\n", resp.StatusCode)
+	}
+	if res := post("/ttl", `{"Key": "K"}`); res != -1 {
+		t.Fatalf("TTL after rejected EXPIRE: expected -1, got %d\n", res)
+	}
+}
+
+func TestConditionalSet(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(body string) string {
+		resp, _ := c.Post(srv.URL + "/set", h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(respBody)
+	}
+
+	if res := post(`{"Key": "K", "Value": "V1", "XX": true}`); res != "null" {
+		t.Fatalf("SET XX over missing key: expected null, got %s\n", res)
+	}
+	if res := post(`{"Key": "K", "Value": "V1", "NX": true}`); res != `"OK"` {
+		t.Fatalf("SET NX over missing key: expected \"OK\", got %s\n", res)
+	}
+	res := post(`{"Key": "K", "Value": "V2", "NX": true, "Get": true}`)
+	result := api.SetResult{}
+	if err := json.Unmarshal([]byte(res), &result); err != nil {
+		t.Fatalf("SET NX GET: expected SetResult in JSON, got:\n%s", res)
+	}
+	if result.Written || result.Previous != "V1" {
+		t.Fatalf("SET NX GET over existing key: expected no write and previous value, got %+v\n", result)
+	}
+
+	resp, _ := c.Post(srv.URL + "/set", h, strings.NewReader(`{"Key": "K", "Value": "V", "NX": true, "XX": true}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("SET NX XX: expected StatusBadRequest, got %d StatusCode\n", resp.StatusCode)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	if _, res := post("/incr", `{"Key": "K"}`); res != "1" {
+		t.Fatalf("INCR of missing key: expected 1, got %s\n", res)
+	}
+	if _, res := post("/incrby", `{"Key": "K", "Increment": 10}`); res != "11" {
+		t.Fatalf("INCRBY: expected 11, got %s\n", res)
+	}
+	if _, res := post("/decrby", `{"Key": "K", "Decrement": 5}`); res != "6" {
+		t.Fatalf("DECRBY: expected 6, got %s\n", res)
+	}
+	if _, res := post("/decr", `{"Key": "K"}`); res != "5" {
+		t.Fatalf("DECR: expected 5, got %s\n", res)
+	}
+	if _, res := post("/incrbyfloat", `{"Key": "K", "Increment": 0.5}`); res != "5.5" {
+		t.Fatalf("INCRBYFLOAT: expected 5.5, got %s\n", res)
+	}
+
+	// counter can be set as json number or numeric string
+	post("/set", `{"Key": "S", "Value": "100"}`)
+	if _, res := post("/incr", `{"Key": "S"}`); res != "101" {
+		t.Fatalf("INCR of numeric string: expected 101, got %s\n", res)
+	}
+
+	post("/set", `{"Key": "S", "Value": "abc"}`)
+	status, res := post("/incr", `{"Key": "S"}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("INCR of non-numeric value: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	errResp := api.ErrorResponse{}
+	if err := json.Unmarshal([]byte(res), &errResp); err != nil || errResp.Op != "INCR" || errResp.Err != storage.ErrNotInteger.Error() {
+		t.Fatalf("INCR of non-numeric value: expected ErrorResponse, got:\n%s", res)
+	}
+}
+
+func TestHashScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	if _, res := post("/hset", `{"Key": "H", "Fields": {"name": "Bob", "visits": 1}}`); res != "2" {
+		t.Fatalf("HSET: expected 2, got %s\n", res)
+	}
+	if _, res := post("/hget", `{"Key": "H", "Field": "name"}`); res != `"Bob"` {
+		t.Fatalf("HGET: expected \"Bob\", got %s\n", res)
+	}
+	if _, res := post("/hget", `{"Key": "H", "Field": "missing"}`); res != "null" {
+		t.Fatalf("HGET of missing field: expected null, got %s\n", res)
+	}
+	if _, res := post("/hincrby", `{"Key": "H", "Field": "visits", "Increment": 2}`); res != "3" {
+		t.Fatalf("HINCRBY: expected 3, got %s\n", res)
+	}
+	if _, res := post("/hlen", `{"Key": "H"}`); res != "2" {
+		t.Fatalf("HLEN: expected 2, got %s\n", res)
+	}
+	_, res := post("/hgetall", `{"Key": "H"}`)
+	all := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(res), &all); err != nil || all["name"] != "Bob" || all["visits"] != float64(3) {
+		t.Fatalf("HGETALL: unexpected result %s\n", res)
+	}
+	if _, res := post("/type", `{"Key": "H"}`); res != `"hash"` {
+		t.Fatalf("TYPE: expected \"hash\", got %s\n", res)
+	}
+
+	if status, _ := post("/get", `{"Key": "H"}`); status != http.StatusBadRequest {
+		t.Fatalf("GET of hash: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	post("/set", `{"Key": "S", "Value": "V"}`)
+	status, res := post("/hget", `{"Key": "S", "Field": "name"}`)
+	errResp := api.ErrorResponse{}
+	if status != http.StatusBadRequest || json.Unmarshal([]byte(res), &errResp) != nil || errResp.Err != storage.ErrWrongType.Error() {
+		t.Fatalf("HGET of string: expected WRONGTYPE error, got %d StatusCode:\n%s", status, res)
+	}
+
+	if _, res := post("/hdel", `{"Key": "H", "Fields": ["name", "visits"]}`); res != "2" {
+		t.Fatalf("HDEL: expected 2, got %s\n", res)
+	}
+	if _, res := post("/hgetall", `{"Key": "H"}`); res != "{}" {
+		t.Fatalf("HGETALL of deleted hash: expected {}, got %s\n", res)
+	}
+}
+
+func TestListScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) string {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(respBody)
+	}
+
+	if res := post("/rpush", `{"Key": "L", "Values": ["b", "c"]}`); res != "2" {
+		t.Fatalf("RPUSH: expected 2, got %s\n", res)
+	}
+	if res := post("/lpush", `{"Key": "L", "Values": ["a"]}`); res != "3" {
+		t.Fatalf("LPUSH: expected 3, got %s\n", res)
+	}
+	if res := post("/lrange", `{"Key": "L", "Start": 0, "Stop": -1}`); res != `["a","b","c"]` {
+		t.Fatalf("LRANGE: expected [\"a\",\"b\",\"c\"], got %s\n", res)
+	}
+	if res := post("/ltrim", `{"Key": "L", "Start": 0, "Stop": 1}`); res != `"OK"` {
+		t.Fatalf("LTRIM: expected \"OK\", got %s\n", res)
+	}
+	if res := post("/rpop", `{"Key": "L"}`); res != `"b"` {
+		t.Fatalf("RPOP: expected \"b\", got %s\n", res)
+	}
+	if res := post("/llen", `{"Key": "L"}`); res != "1" {
+		t.Fatalf("LLEN: expected 1, got %s\n", res)
+	}
+	post("/lpop", `{"Key": "L"}`)
+	if res := post("/lpop", `{"Key": "L"}`); res != "null" {
+		t.Fatalf("LPOP of missing list: expected null, got %s\n", res)
+	}
+
+	if res := post("/blpop", `{"Keys": ["Q"], "Timeout": 10000000}`); res != "null" {
+		t.Fatalf("BLPOP timeout: expected null, got %s\n", res)
+	}
+	results := make(chan string)
+	go func() {
+		results <- post("/brpop", `{"Keys": ["Q"]}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	post("/rpush", `{"Key": "Q", "Values": ["job"]}`)
+	if res := <-results; res != `{"Key":"Q","Value":"job"}` {
+		t.Fatalf("BRPOP: expected {\"Key\":\"Q\",\"Value\":\"job\"}, got %s\n", res)
+	}
+}
+
+func TestSetScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) string {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(respBody)
+	}
+
+	if res := post("/sadd", `{"Key": "A", "Members": ["x", "y", "z"]}`); res != "3" {
+		t.Fatalf("SADD: expected 3, got %s\n", res)
+	}
+	post("/sadd", `{"Key": "B", "Members": ["y", "z", "w"]}`)
+	if res := post("/sismember", `{"Key": "A", "Member": "x"}`); res != "1" {
+		t.Fatalf("SISMEMBER: expected 1, got %s\n", res)
+	}
+	if res := post("/sinter", `{"Keys": ["A", "B"]}`); res != `["y","z"]` {
+		t.Fatalf("SINTER: expected [\"y\",\"z\"], got %s\n", res)
+	}
+	if res := post("/sunion", `{"Keys": ["A", "B"]}`); res != `["w","x","y","z"]` {
+		t.Fatalf("SUNION: expected [\"w\",\"x\",\"y\",\"z\"], got %s\n", res)
+	}
+	if res := post("/sdiffstore", `{"Destination": "D", "Keys": ["A", "B"]}`); res != "1" {
+		t.Fatalf("SDIFFSTORE: expected 1, got %s\n", res)
+	}
+	if res := post("/smembers", `{"Key": "D"}`); res != `["x"]` {
+		t.Fatalf("SMEMBERS: expected [\"x\"], got %s\n", res)
+	}
+	if res := post("/srem", `{"Key": "A", "Members": ["x", "missing"]}`); res != "1" {
+		t.Fatalf("SREM: expected 1, got %s\n", res)
+	}
+	if res := post("/scard", `{"Key": "A"}`); res != "2" {
+		t.Fatalf("SCARD: expected 2, got %s\n", res)
+	}
+}
+
+func TestZSetScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	body := `{"Key": "Z", "Members": [{"Member": "a", "Score": 1}, {"Member": "b", "Score": 2}, {"Member": "c", "Score": 3}]}`
+	if _, res := post("/zadd", body); res != "3" {
+		t.Fatalf("ZADD: expected 3, got %s\n", res)
+	}
+	if _, res := post("/zincrby", `{"Key": "Z", "Member": "a", "Increment": 2.5}`); res != "3.5" {
+		t.Fatalf("ZINCRBY: expected 3.5, got %s\n", res)
+	}
+	if _, res := post("/zrank", `{"Key": "Z", "Member": "a", "Reverse": true}`); res != "0" {
+		t.Fatalf("ZRANK reverse: expected 0, got %s\n", res)
+	}
+	if _, res := post("/zrank", `{"Key": "Z", "Member": "missing"}`); res != "null" {
+		t.Fatalf("ZRANK of missing member: expected null, got %s\n", res)
+	}
+	if _, res := post("/zrange", `{"Key": "Z", "Start": 0, "Stop": 1}`); res != `[{"Member":"b","Score":2},{"Member":"c","Score":3}]` {
+		t.Fatalf("ZRANGE: unexpected result %s\n", res)
+	}
+	_, res := post("/zrangebyscore", `{"Key": "Z", "Min": "(2", "Max": "+inf", "Reverse": true, "Count": 1}`)
+	if res != `[{"Member":"a","Score":3.5}]` {
+		t.Fatalf("ZRANGEBYSCORE: unexpected result %s\n", res)
+	}
+	if status, _ := post("/zrangebyscore", `{"Key": "Z", "Min": "x", "Max": "1"}`); status != http.StatusBadRequest {
+		t.Fatalf("ZRANGEBYSCORE with wrong bound: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	if _, res := post("/zscore", `{"Key": "Z", "Member": "c"}`); res != "3" {
+		t.Fatalf("ZSCORE: expected 3, got %s\n", res)
+	}
+	post("/zrem", `{"Key": "Z", "Members": ["c"]}`)
+	if _, res := post("/zcard", `{"Key": "Z"}`); res != "2" {
+		t.Fatalf("ZCARD: expected 2, got %s\n", res)
+	}
+}
+
+func TestStringScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	// html special characters are not escaped
+	if _, res := post("/append", `{"Key": "html", "Value": "<b>"}`); res != "3" {
+		t.Fatalf("APPEND: expected 3, got %s\n", res)
+	}
+	post("/append", `{"Key": "html", "Value": "a & b</b>"}`)
+	if _, res := post("/get", `{"Key": "html"}`); res != `"<b>a & b</b>"` {
+		t.Fatalf("GET: expected raw string, got %s\n", res)
+	}
+	if _, res := post("/getrange", `{"Key": "html", "Start": 3, "End": -5}`); res != `"a & b"` {
+		t.Fatalf("GETRANGE: expected \"a & b\", got %s\n", res)
+	}
+	if _, res := post("/setrange", `{"Key": "html", "Offset": 1, "Value": "i"}`); res != "12" {
+		t.Fatalf("SETRANGE: expected 12, got %s\n", res)
+	}
+	if _, res := post("/strlen", `{"Key": "html"}`); res != "12" {
+		t.Fatalf("STRLEN: expected 12, got %s\n", res)
+	}
+	if status, _ := post("/setrange", `{"Key": "html", "Offset": -1, "Value": "i"}`); status != http.StatusBadRequest {
+		t.Fatalf("SETRANGE with negative offset: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+
+	if _, res := post("/getex", `{"Key": "html", "Ttl": 3600000000000}`); res != `"<i>a & b</b>"` {
+		t.Fatalf("GETEX: unexpected result %s\n", res)
+	}
+	if _, res := post("/ttl", `{"Key": "html"}`); res != "3600" {
+		t.Fatalf("TTL after GETEX: expected 3600, got %s\n", res)
+	}
+	if status, _ := post("/getex", `{"Key": "html", "Ttl": 1, "Persist": true}`); status != http.StatusBadRequest {
+		t.Fatalf("GETEX with conflicting options: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	if _, res := post("/getdel", `{"Key": "html"}`); res != `"<i>a & b</b>"` {
+		t.Fatalf("GETDEL: unexpected result %s\n", res)
+	}
+	if _, res := post("/getdel", `{"Key": "html"}`); res != "null" {
+		t.Fatalf("GETDEL of deleted key: expected null, got %s\n", res)
+	}
+
+	post("/set", `{"Key": "object", "Value": {"a": 1}}`)
+	if status, _ := post("/append", `{"Key": "object", "Value": "x"}`); status != http.StatusBadRequest {
+		t.Fatalf("APPEND to json object: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+}
+
+func TestMultiKeyScenario(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	body := `{"Items": [{"Key": "a", "Value": 1}, {"Key": "b", "Value": "two", "Ttl": 3600000000000}]}`
+	if _, res := post("/mset", body); res != `"OK"` {
+		t.Fatalf("MSET: expected \"OK\", got %s\n", res)
+	}
+	if _, res := post("/ttl", `{"Key": "b"}`); res != "3600" {
+		t.Fatalf("TTL after MSET: expected 3600, got %s\n", res)
+	}
+	post("/lpush", `{"Key": "list", "Values": [1]}`)
+	if _, res := post("/mget", `{"Keys": ["a", "missing", "b", "list"]}`); res != `[1,null,"two",null]` {
+		t.Fatalf("MGET: unexpected result %s\n", res)
+	}
+	if _, res := post("/msetnx", `{"Items": [{"Key": "c", "Value": 3}, {"Key": "a", "Value": 3}]}`); res != "0" {
+		t.Fatalf("MSETNX with existing key: expected 0, got %s\n", res)
+	}
+	if _, res := post("/get", `{"Key": "c"}`); res != "null" {
+		t.Fatalf("GET after failed MSETNX: expected null, got %s\n", res)
+	}
+	if status, _ := post("/mset", `{"Items": [{"Key": "c"}]}`); status != http.StatusBadRequest {
+		t.Fatalf("MSET without value: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+}
+
+func TestScanScenario(t *testing.T) {
+	srv := httptest.NewServer(NewWithStorage(storage.New(0, storage.WithShards(4))))
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	kKeys := 100
+	for i := 0; i < kKeys; i += 1 {
+		post("/set", `{"Key": "key` + strconv.Itoa(i) + `", "Value": 1}`)
+	}
+	post("/sadd", `{"Key": "set", "Members": ["a"]}`)
+
+	var result api.ScanResult
+	_, res := post("/scan", `{"Cursor": 0, "Count": 1000}`)
+	if err := json.Unmarshal([]byte(res), &result); err != nil || result.Cursor == 0 {
+		t.Fatalf("SCAN over sharded storage: expected cursor of the next shard, got %s\n", res)
+	}
+	if status, _ := post("/scan", `{"Cursor": 1099511627776}`); status != http.StatusBadRequest {
+		t.Fatalf("SCAN with wrong cursor: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	it := client.NewScanIterator(client.NewAPI(cl), api.ScanOptions{Match: "key*", Count: 7})
+	seen := make(map[string]bool)
+	for it.Next() {
+		seen[it.Key()] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("ScanIterator: unexpected error %v\n", err)
+	}
+	if len(seen) != kKeys {
+		t.Fatalf("ScanIterator: expected %d keys, got %d\n", kKeys, len(seen))
+	}
+
+	it = client.NewScanIterator(client.NewAPI(cl), api.ScanOptions{Type: "set"})
+	if !it.Next() || it.Key() != "set" || it.Next() {
+		t.Fatalf("ScanIterator with type: expected only set key\n")
+	}
+}
+
+func TestKeysBadPattern(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+
+	resp, _ := c.Post(srv.URL + "/keys", "application/json", strings.NewReader(`{"Pattern": "[abc"}`))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("KEYS with malformed pattern: expected StatusBadRequest, got %d StatusCode\n", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "missing closing ']'") {
+		t.Fatalf("KEYS with malformed pattern: expected descriptive error, got %s\n", body)
+	}
+}
+
+func TestTxScenario(t *testing.T) {
+	srv := httptest.NewServer(NewWithStorage(storage.New(0, storage.WithShards(4))))
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	post("/set", `{"Key": "counter", "Value": "1"}`)
+	body := `{"Commands": [
+		{"Op": "incr", "Params": {"Key": "counter"}},
+		{"Op": "set", "Params": {"Key": "other", "Value": "val"}},
+		{"Op": "hset", "Params": {"Key": "other", "Fields": {"f": 1}}},
+		{"Op": "expire", "Params": {"Key": "counter", "Seconds": 100}}
+	]}`
+	expected := `[{"Value":2,"Err":""},{"Value":"OK","Err":""},{"Value":null,"Err":"WRONGTYPE Operation against a key holding the wrong kind of value"},{"Value":1,"Err":""}]`
+	if _, res := post("/exec", body); res != expected {
+		t.Fatalf("EXEC: expected %s, got %s\n", expected, res)
+	}
+
+	status, res := post("/exec", `{"Commands": [{"Op": "set", "Params": {"Key": "a", "Value": 1}}, {"Op": "blpop", "Params": {}}]}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("EXEC with unsupported command: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	if !strings.Contains(res, "command 1 (blpop)") {
+		t.Fatalf("EXEC with unsupported command: expected index of the command in error, got %s\n", res)
+	}
+	if _, res := post("/get", `{"Key": "a"}`); res != "null" {
+		t.Fatalf("GET after invalid EXEC: expected null, got %s\n", res)
+	}
+	status, _ = post("/exec", `{"Commands": [{"Op": "expire", "Params": {"Key": "counter", "Seconds": 10000000000}}]}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("EXEC with EXPIRE out of range: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+	if _, res := post("/ttl", `{"Key": "counter"}`); res != "100" {
+		t.Fatalf("TTL after invalid EXEC: expected 100, got %s\n", res)
+	}
+
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	capi := client.NewAPI(cl)
+	tx := client.NewTx(capi)
+	if err := tx.Watch("counter", "missing"); err != nil {
+		t.Fatalf("Watch: unexpected error %v\n", err)
+	}
+	tx.Queue("incrby", &api.IncrByParams{Key: "counter", Increment: 10})
+	tx.Queue("get", &api.GetParams{Key: "counter"})
+	results, err := tx.Exec()
+	if err != nil || len(results) != 2 || results[1].Value != "12" {
+		t.Fatalf("Tx.Exec: unexpected result %v, %v\n", results, err)
+	}
+
+	tx.Watch("counter")
+	capi.Incr("counter")
+	tx.Queue("set", &api.SetParams{Key: "counter", Value: "0"})
+	if results, err := tx.Exec(); err != nil || results != nil {
+		t.Fatalf("Tx.Exec after modification of watched key: expected nil, got %v, %v\n", results, err)
+	}
+	if res, _ := capi.Get("counter"); res != "13" {
+		t.Fatalf("GET after aborted EXEC: expected 13, got %v\n", res)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	srv := httptest.NewServer(New())
+	c := http.Client{}
+	h := "application/json"
+
+	post := func(ep string, body string) (int, string) {
+		resp, _ := c.Post(srv.URL + ep, h, strings.NewReader(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(respBody)
+	}
+
+	var result api.SetResult
+	_, res := post("/set", `{"Key": "config", "Value": "v1", "Version": 0}`)
+	if err := json.Unmarshal([]byte(res), &result); err != nil || !result.Written || result.Version == 0 {
+		t.Fatalf("SET with version 0 of missing key: unexpected result %s\n", res)
+	}
+	if status, _ := post("/set", `{"Key": "config", "Value": "v2", "Version": 0}`); status != http.StatusConflict {
+		t.Fatalf("SET with version 0 of existing key: expected StatusConflict, got %d StatusCode\n", status)
+	}
+	expected := `{"Value":"v1","Version":` + strconv.FormatUint(result.Version, 10) + `}`
+	if _, res := post("/get", `{"Key": "config", "WithVersion": true}`); res != expected {
+		t.Fatalf("GET with version: expected %s, got %s\n", expected, res)
+	}
+
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	capi := client.NewAPI(cl)
+	current, err := capi.GetWithVersion("config")
+	if err != nil || current == nil || current.Value != "v1" {
+		t.Fatalf("GetWithVersion: unexpected result %v, %v\n", current, err)
+	}
+	next, err := capi.SetIfVersion("config", "v2", 0, current.Version)
+	if err != nil || !next.Written || next.Version <= current.Version {
+		t.Fatalf("SetIfVersion with current version: unexpected result %+v, %v\n", next, err)
+	}
+	_, err = capi.SetWithOptions("config", "v3", 0, api.SetOptions{Version: &current.Version})
+	if errResp, ok := err.(*api.ErrorResponse); !ok || errResp.Status != http.StatusConflict {
+		t.Fatalf("SetWithOptions with stale version: expected conflict, got %v\n", err)
+	}
+	if _, err := capi.DelIfVersion("config", current.Version); err == nil {
+		t.Fatalf("DelIfVersion with stale version: expected conflict\n")
+	}
+	if res, err := capi.DelIfVersion("config", next.Version); err != nil || res != 1 {
+		t.Fatalf("DelIfVersion with current version: expected 1, got %d, %v\n", res, err)
+	}
+	if res, err := capi.GetWithVersion("config"); err != nil || res != nil {
+		t.Fatalf("GetWithVersion of deleted key: expected nil, got %v, %v\n", res, err)
+	}
+	if status, _ := post("/del", `{"Keys": ["a", "b"], "Version": 1}`); status != http.StatusBadRequest {
+		t.Fatalf("DEL of several keys with version: expected StatusBadRequest, got %d StatusCode\n", status)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	srv := httptest.NewServer(New())
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	capi := client.NewAPI(cl)
+
+	sub, err := capi.Subscribe([]string{"news"}, []string{"news.*", "[a-c]*"})
+	if err != nil {
+		t.Fatalf("Subtest 1: Subscribe: unexpected error %v\n", err)
+	}
+	defer sub.Close()
+
+	if res, err := capi.Publish("news", "first"); err != nil || res != 1 {
+		t.Fatalf("Subtest 2: Publish to channel: expected 1, got %d, %v\n", res, err)
+	}
+	if res, _ := capi.Publish("news.sport", "second"); res != 1 {
+		t.Fatalf("Subtest 3: Publish to channel matching pattern: expected 1, got %d\n", res)
+	}
+	if res, _ := capi.Publish("other", "ignored"); res != 0 {
+		t.Fatalf("Subtest 4: Publish without subscribers: expected 0, got %d\n", res)
+	}
+	capi.Publish("bank", "<&>")
+
+	expected := []api.Message{
+		{Channel: "news", Payload: "first"},
+		{Channel: "news.sport", Pattern: "news.*", Payload: "second"},
+		{Channel: "bank", Pattern: "[a-c]*", Payload: "<&>"},
+	}
+	for i, msg := range expected {
+		select {
+		case res := <-sub.Messages():
+			if res != msg {
+				t.Fatalf("Subtest %d: expected message %+v, got %+v\n", i + 5, msg, res)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subtest %d: message %+v wasn't received\n", i + 5, msg)
+		}
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Messages(); ok {
+		t.Fatalf("Subtest 8: channel of messages must be closed by Close\n")
+	}
+	// server notices disconnection and removes subscription
+	deadline := time.Now().Add(time.Second)
+	for res, _ := capi.Publish("news", "after close"); res != 0; res, _ = capi.Publish("news", "after close") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Subtest 9: subscription must be removed after disconnection\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = capi.Subscribe(nil, []string{"[abc"})
+	if errResp, ok := err.(*api.ErrorResponse); !ok || errResp.Status != http.StatusBadRequest {
+		t.Fatalf("Subtest 10: Subscribe with malformed pattern: expected StatusBadRequest, got %v\n", err)
+	}
+}
+
+func TestSubscribeCount(t *testing.T) {
+	srv := httptest.NewServer(New())
+	defer srv.Close()
+
+	// repeated channels and patterns are subscribed once
+	body := `{"Channels": ["a", "a", "b"], "Patterns": ["p*", "p*"]}`
+	resp, err := http.Post(srv.URL + "/subscribe", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Subscribe: unexpected error %v\n", err)
+	}
+	defer resp.Body.Close()
+
+	expected := "event: subscribe\ndata: 3\n\n"
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != expected {
+		t.Fatalf("Subscribe: expected event %q, got %q, %v\n", expected, buf, err)
+	}
+}
+
+func TestHubOverflow(t *testing.T) {
+	hub := NewHub()
+	slow, _ := hub.Subscribe([]string{"ch"}, nil)
+	fast, _ := hub.Subscribe([]string{"ch"}, nil)
+
+	for i := 0; i <= subscriptionBuffer; i += 1 {
+		hub.Publish("ch", strconv.Itoa(i))
+		<-fast.Messages()
+	}
+	received := 0
+	for range slow.Messages() {
+		received += 1
+	}
+	if received != subscriptionBuffer {
+		t.Fatalf("slow subscriber: expected %d messages before disconnection, got %d\n", subscriptionBuffer, received)
+	}
+	if res := hub.Publish("ch", "next"); res != 1 {
+		t.Fatalf("Publish after overflow: expected 1 subscriber, got %d\n", res)
+	}
+	fast.Close()
+}
+
+func TestKeyEvents(t *testing.T) {
+	srv := httptest.NewServer(NewWithStorage(storage.New(time.Hour, storage.WithNotifications(storage.EventsAll))))
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	capi := client.NewAPI(cl)
+
+	sub, err := capi.SubscribeKeyEvents("user:*")
+	if err != nil {
+		t.Fatalf("Subtest 1: SubscribeKeyEvents: unexpected error %v\n", err)
+	}
+	defer sub.Close()
+
+	capi.Set("user:1", "a", 0)
+	capi.Set("other", "b", 0)
+	capi.Del("user:1", "other")
+	expected := []api.KeyEvent{
+		{Event: "set", Key: "user:1"},
+		{Event: "del", Key: "user:1"},
+	}
+	for i, event := range expected {
+		select {
+		case res := <-sub.Events():
+			if res != event {
+				t.Fatalf("Subtest %d: expected event %+v, got %+v\n", i + 2, event, res)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subtest %d: event %+v wasn't received\n", i + 2, event)
+		}
+	}
+
+	disabled := httptest.NewServer(New())
+	cl, _ = client.NewClient(disabled.URL, time.Second)
+	_, err = client.NewAPI(cl).SubscribeKeyEvents("*")
+	if errResp, ok := err.(*api.ErrorResponse); !ok || errResp.Status != http.StatusBadRequest {
+		t.Fatalf("Subtest 4: SubscribeKeyEvents with disabled notifications: expected StatusBadRequest, got %v\n", err)
+	}
+}
+
+// dialRESP starts RESP server sharing storage with srv and connects to it
+func dialRESP(t *testing.T, srv *CacheServer) (net.Conn, *resp.Reader, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v\n", err)
+	}
+	rs := NewRESPServer(srv)
+	go rs.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v\n", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, resp.NewReader(conn), func() {
+		conn.Close()
+		rs.Close()
+	}
+}
+
+func TestRESPScenario(t *testing.T) {
+	srv := New()
+	conn, r, stop := dialRESP(t, srv)
+	defer stop()
+
+	// inline and multibulk commands are pipelined in one write
+	conn.Write([]byte("PING\r\nSET a \"hello world\"\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"HSET h f 1\r\nGET h\r\nINCR a\r\nFOO bar\r\nGET\r\nMGET a missing\r\n\r\nDEL a h\r\n"))
+
+	expected := []resp.Value{
+		{Type: resp.TypeSimpleString, Str: "PONG"},
+		{Type: resp.TypeSimpleString, Str: "OK"},
+		{Type: resp.TypeBulkString, Str: "hello world"},
+		{Type: resp.TypeInteger, Int: 1},
+		{Type: resp.TypeError, Str: storage.ErrWrongType.Error()},
+		{Type: resp.TypeError, Str: "ERR value is not an integer or out of range"},
+		{Type: resp.TypeError, Str: "ERR unknown command 'FOO', with args beginning with: 'bar' "},
+		{Type: resp.TypeError, Str: "ERR wrong number of arguments for 'get' command"},
+		{Type: resp.TypeArray, Elems: []resp.Value{{Type: resp.TypeBulkString, Str: "hello world"}, {Type: resp.TypeNull}}},
+		{Type: resp.TypeInteger, Int: 2},
+	}
+	for i, exp := range expected {
+		res, err := r.ReadValue()
+		if err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest %d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+
+	// storage is shared with http api
+	srv.Data.Set("shared", 1.5, 0)
+	conn.Write([]byte("GET shared\r\n"))
+	if res, _ := r.ReadValue(); res.Str != "1.5" {
+		t.Fatalf("Subtest 11: GET of value set by http api: expected 1.5, got %+v\n", res)
+	}
+}
+
+func TestRESPHello(t *testing.T) {
+	conn, r, stop := dialRESP(t, New())
+	defer stop()
+
+	conn.Write([]byte("HELLO 4\r\nZADD z 1.5 a\r\nZSCORE z a\r\nHGETALL missing\r\n"))
+	if res, _ := r.ReadValue(); res.Type != resp.TypeError || !strings.HasPrefix(res.Str, "NOPROTO") {
+		t.Fatalf("Subtest 1: HELLO 4: expected NOPROTO error, got %+v\n", res)
+	}
+	r.ReadValue()
+	if res, _ := r.ReadValue(); res.Type != resp.TypeBulkString || res.Str != "1.5" {
+		t.Fatalf("Subtest 2: ZSCORE over RESP2: expected bulk string, got %+v\n", res)
+	}
+	if res, _ := r.ReadValue(); res.Type != resp.TypeArray {
+		t.Fatalf("Subtest 3: HGETALL over RESP2: expected array, got %+v\n", res)
+	}
+
+	conn.Write([]byte("HELLO 3 SETNAME app\r\nZSCORE z a\r\nHGETALL missing\r\nGET missing\r\nCLIENT GETNAME\r\n"))
+	hello, err := r.ReadValue()
+	if err != nil || hello.Type != resp.TypeMap {
+		t.Fatalf("Subtest 4: HELLO 3: expected map, got %+v, %v\n", hello, err)
+	}
+	for i := 0; i < len(hello.Elems); i += 2 {
+		if hello.Elems[i].Str == "proto" && hello.Elems[i + 1].Int != 3 {
+			t.Fatalf("Subtest 5: HELLO 3: expected proto 3, got %+v\n", hello.Elems[i + 1])
+		}
+	}
+	if res, _ := r.ReadValue(); res.Type != resp.TypeDouble || res.Float != 1.5 {
+		t.Fatalf("Subtest 6: ZSCORE over RESP3: expected double, got %+v\n", res)
+	}
+	if res, _ := r.ReadValue(); res.Type != resp.TypeMap {
+		t.Fatalf("Subtest 7: HGETALL over RESP3: expected map, got %+v\n", res)
+	}
+	if res, _ := r.ReadValue(); !res.IsNull() {
+		t.Fatalf("Subtest 8: GET of missing key: expected null, got %+v\n", res)
+	}
+	if res, _ := r.ReadValue(); res.Str != "app" {
+		t.Fatalf("Subtest 9: CLIENT GETNAME: expected app, got %+v\n", res)
+	}
+}
+
+func TestRESPProtocolError(t *testing.T) {
+	conn, r, stop := dialRESP(t, New())
+	defer stop()
+
+	conn.Write([]byte("*1\r\n$abc\r\n"))
+	if res, _ := r.ReadValue(); res.Type != resp.TypeError || res.Str != "ERR Protocol error: invalid bulk length" {
+		t.Fatalf("Subtest 1: expected protocol error, got %+v\n", res)
+	}
+	if _, err := r.ReadValue(); err != io.EOF {
+		t.Fatalf("Subtest 2: connection must be closed after protocol error, got %v\n", err)
+	}
+}
+
+func TestRESPTransaction(t *testing.T) {
+	srv := New()
+	conn, r, stop := dialRESP(t, srv)
+	defer stop()
+
+	conn.Write([]byte("MULTI\r\nSET a 1\r\nINCR a\r\nGET a\r\nHSET h f 1\r\nGET h\r\nEXPIRE a 100\r\nEXEC\r\n"))
+	queued := resp.Value{Type: resp.TypeSimpleString, Str: "QUEUED"}
+	expected := []resp.Value{
+		{Type: resp.TypeSimpleString, Str: "OK"},
+		queued, queued, queued, queued, queued, queued,
+		{Type: resp.TypeArray, Elems: []resp.Value{
+			{Type: resp.TypeSimpleString, Str: "OK"},
+			{Type: resp.TypeInteger, Int: 2},
+			{Type: resp.TypeBulkString, Str: "2"},
+			{Type: resp.TypeInteger, Int: 1},
+			{Type: resp.TypeError, Str: storage.ErrWrongType.Error()},
+			{Type: resp.TypeInteger, Int: 1},
+		}},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest 1.%d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+
+	// invalid command discards the whole transaction
+	conn.Write([]byte("MULTI\r\nINCR a\r\nINCRBY a x\r\nKEYS *\r\nEXEC\r\nGET a\r\n"))
+	expected = []resp.Value{
+		{Type: resp.TypeSimpleString, Str: "OK"},
+		queued,
+		{Type: resp.TypeError, Str: "ERR value is not an integer or out of range"},
+		{Type: resp.TypeError, Str: "ERR command can't be used in transaction"},
+		{Type: resp.TypeError, Str: "EXECABORT Transaction discarded because of previous errors."},
+		{Type: resp.TypeBulkString, Str: "2"},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest 2.%d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+
+	// modification of watched key aborts EXEC
+	conn.Write([]byte("WATCH a\r\n"))
+	r.ReadValue()
+	srv.Data.Set("a", "other", 0)
+	conn.Write([]byte("MULTI\r\nINCR a\r\nEXEC\r\nDISCARD\r\nEXEC\r\n"))
+	expected = []resp.Value{
+		{Type: resp.TypeSimpleString, Str: "OK"},
+		queued,
+		{Type: resp.TypeNull},
+		{Type: resp.TypeError, Str: "ERR DISCARD without MULTI"},
+		{Type: resp.TypeError, Str: "ERR EXEC without MULTI"},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest 3.%d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+}
+
+func TestRESPSubscribe(t *testing.T) {
+	srv := New()
+	conn, r, stop := dialRESP(t, srv)
+	defer stop()
+
+	conn.Write([]byte("SUBSCRIBE news sport\r\nPSUBSCRIBE n*\r\nGET a\r\nPING\r\n"))
+	subscription := func(kind, name string, n int64) resp.Value {
+		return resp.Value{Type: resp.TypeArray, Elems: []resp.Value{
+			{Type: resp.TypeBulkString, Str: kind}, {Type: resp.TypeBulkString, Str: name}, {Type: resp.TypeInteger, Int: n},
+		}}
+	}
+	expected := []resp.Value{
+		subscription("subscribe", "news", 1),
+		subscription("subscribe", "sport", 2),
+		subscription("psubscribe", "n*", 3),
+		{Type: resp.TypeError, Str: "ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"},
+		{Type: resp.TypeArray, Elems: []resp.Value{{Type: resp.TypeBulkString, Str: "pong"}, {Type: resp.TypeBulkString, Str: ""}}},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest 1.%d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+
+	// message published over http api is received by channel and by pattern
+	if n := srv.PubSub.Publish("news", "hello"); n != 2 {
+		t.Fatalf("Subtest 2: Publish: expected 2 receivers, got %d\n", n)
+	}
+	expected = []resp.Value{
+		{Type: resp.TypeArray, Elems: []resp.Value{
+			{Type: resp.TypeBulkString, Str: "message"}, {Type: resp.TypeBulkString, Str: "news"}, {Type: resp.TypeBulkString, Str: "hello"},
+		}},
+		{Type: resp.TypeArray, Elems: []resp.Value{
+			{Type: resp.TypeBulkString, Str: "pmessage"}, {Type: resp.TypeBulkString, Str: "n*"},
+			{Type: resp.TypeBulkString, Str: "news"}, {Type: resp.TypeBulkString, Str: "hello"},
+		}},
+	}
+	received := []resp.Value{}
+	for range expected {
+		res, err := r.ReadValue()
+		if err != nil {
+			t.Fatalf("Subtest 3: message: unexpected error %v\n", err)
+		}
+		received = append(received, res)
+	}
+	// channel and pattern subscribers are served in no particular order
+	if !reflect.DeepEqual(received, expected) && !reflect.DeepEqual(received, []resp.Value{expected[1], expected[0]}) {
+		t.Fatalf("Subtest 3: expected messages %+v, got %+v\n", expected, received)
+	}
+
+	conn.Write([]byte("UNSUBSCRIBE\r\nPUNSUBSCRIBE\r\nPUNSUBSCRIBE\r\nGET a\r\n"))
+	expected = []resp.Value{
+		subscription("unsubscribe", "news", 2),
+		subscription("unsubscribe", "sport", 1),
+		subscription("punsubscribe", "n*", 0),
+		{Type: resp.TypeArray, Elems: []resp.Value{
+			{Type: resp.TypeBulkString, Str: "punsubscribe"}, {Type: resp.TypeNull}, {Type: resp.TypeInteger, Int: 0},
+		}},
+		{Type: resp.TypeNull},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest 4.%d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+	if n := srv.PubSub.Publish("news", "hello"); n != 0 {
+		t.Fatalf("Subtest 5: Publish after UNSUBSCRIBE: expected 0 receivers, got %d\n", n)
+	}
+
+	// RESP3 connection receives push frames and can run other commands
+	conn.Write([]byte("HELLO 3\r\nSUBSCRIBE news\r\nGET a\r\n"))
+	r.ReadValue()
+	if res, _ := r.ReadValue(); res.Type != resp.TypePush {
+		t.Fatalf("Subtest 6: SUBSCRIBE over RESP3: expected push, got %+v\n", res)
+	}
+	if res, _ := r.ReadValue(); !res.IsNull() {
+		t.Fatalf("Subtest 7: GET while subscribed over RESP3: expected null, got %+v\n", res)
+	}
+	srv.PubSub.Publish("news", "again")
+	if res, _ := r.ReadValue(); res.Type != resp.TypePush || len(res.Elems) != 3 || res.Elems[2].Str != "again" {
+		t.Fatalf("Subtest 8: message over RESP3: expected push, got %+v\n", res)
+	}
+}
+
+func TestRESPBlockingPop(t *testing.T) {
+	srv := New()
+	conn, r, stop := dialRESP(t, srv)
+	defer stop()
+
+	// command pipelined after blocking one is answered after it
+	conn.Write([]byte("BLPOP q 0\r\nPING\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	srv.Data.RPush("q", "a")
+	expected := []resp.Value{
+		{Type: resp.TypeArray, Elems: []resp.Value{{Type: resp.TypeBulkString, Str: "q"}, {Type: resp.TypeBulkString, Str: "a"}}},
+		{Type: resp.TypeSimpleString, Str: "PONG"},
+	}
+	for i, exp := range expected {
+		if res, err := r.ReadValue(); err != nil || !reflect.DeepEqual(res, exp) {
+			t.Fatalf("Subtest %d: expected %+v, got %+v, %v\n", i + 1, exp, res, err)
+		}
+	}
+
+	// disconnected client doesn't take the value pushed later
+	conn.Write([]byte("BLPOP q 0\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	srv.Data.RPush("q", "b")
+	if n, _ := srv.Data.LLen("q"); n != 1 {
+		t.Fatalf("Subtest 3: value pushed after disconnection of blocked client must stay in list, got length %d\n", n)
+	}
+}
+
+// TestTransports runs the same scenario over http and RESP clients
+func TestTransports(t *testing.T) {
+	srv := New()
+	httpSrv := httptest.NewServer(srv)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v\n", err)
+	}
+	rs := NewRESPServer(srv)
+	go rs.Serve(l)
+	defer rs.Close()
+
+	cl, _ := client.NewClient(httpSrv.URL, time.Second)
+	resp2, err := client.NewRESPAPI(l.Addr().String(), client.RESPOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRESPAPI: %v\n", err)
+	}
+	defer resp2.Close()
+	resp3, err := client.NewRESPAPI(l.Addr().String(), client.RESPOptions{Timeout: time.Second, Protocol: 3})
+	if err != nil {
+		t.Fatalf("NewRESPAPI: %v\n", err)
+	}
+	defer resp3.Close()
+
+	transports := map[string]client.ClientAPI{
+		"http": client.NewAPI(cl),
+		"resp2": resp2,
+		"resp3": resp3,
+	}
+	for name, capi := range transports {
+		check := func(i int, what string, expected, res interface{}, err error) {
+			if err != nil || !reflect.DeepEqual(expected, res) {
+				t.Fatalf("%s: Subtest %d: %s: expected %v, got %v, %v\n", name, i, what, expected, res, err)
+			}
+		}
+		k := func(key string) string {
+			return name + ":" + key
+		}
+
+		res, err := capi.Set(k("str"), "v", time.Minute)
+		check(1, "Set", "OK", res, err)
+		res, err = capi.Get(k("str"))
+		check(2, "Get", "v", res, err)
+		res, err = capi.Get(k("missing"))
+		check(3, "Get missing", nil, res, err)
+		setRes, err := capi.SetWithOptions(k("str"), "w", 0, api.SetOptions{NX: true, Get: true})
+		check(4, "SetWithOptions", api.SetResult{Written: false, Previous: "v"}, setRes, err)
+
+		n, err := capi.IncrBy(k("n"), 10)
+		check(5, "IncrBy", int64(10), n, err)
+		f, err := capi.IncrByFloat(k("n"), 0.5)
+		check(6, "IncrByFloat", 10.5, f, err)
+		_, err = capi.Incr(k("str"))
+		if e, ok := err.(*api.ErrorResponse); !ok || e.Op != "INCR" || e.Err != storage.ErrNotInteger.Error() || e.Status != http.StatusBadRequest {
+			t.Fatalf("%s: Subtest 7: Incr of string: expected error response, got %v\n", name, err)
+		}
+
+		count, err := capi.HSet(k("hash"), map[string]interface{}{"a": "1", "b": "2"})
+		check(8, "HSet", 2, count, err)
+		hash, err := capi.HGetAll(k("hash"))
+		check(9, "HGetAll", map[string]interface{}{"a": "1", "b": "2"}, hash, err)
+		_, err = capi.SetWithOptions(k("hash"), "v", 0, api.SetOptions{Get: true})
+		if e, ok := err.(*api.ErrorResponse); !ok || e.Op != "SET" || e.Err != storage.ErrWrongType.Error() {
+			t.Fatalf("%s: Subtest 9: SetWithOptions with Get over hash: expected error response, got %v\n", name, err)
+		}
+
+		count, err = capi.RPush(k("list"), "a", "b")
+		check(10, "RPush", 2, count, err)
+		values, err := capi.LRange(k("list"), 0, -1)
+		check(11, "LRange", []interface{}{"a", "b"}, values, err)
+		popped, err := capi.BLPop(100 * time.Millisecond, k("empty"), k("list"))
+		check(12, "BLPop", &api.BPopResult{Key: k("list"), Value: "a"}, popped, err)
+		popped, err = capi.BLPop(50 * time.Millisecond, k("empty"))
+		check(13, "BLPop timeout", (*api.BPopResult)(nil), popped, err)
+
+		count, err = capi.SAdd(k("set"), "b", "a")
+		check(14, "SAdd", 2, count, err)
+		members, err := capi.SMembers(k("set"))
+		check(15, "SMembers", []string{"a", "b"}, members, err)
+
+		count, err = capi.ZAdd(k("zset"), api.ZMember{Member: "a", Score: 1.5}, api.ZMember{Member: "b", Score: 2})
+		check(16, "ZAdd", 2, count, err)
+		zmembers, err := capi.ZRange(k("zset"), 0, -1, true)
+		check(17, "ZRange", []api.ZMember{{Member: "b", Score: 2}, {Member: "a", Score: 1.5}}, zmembers, err)
+		zmembers, err = capi.ZRangeByScore(&api.ZRangeByScoreParams{Key: k("zset"), Min: "(1.5", Max: "+inf"})
+		check(18, "ZRangeByScore", []api.ZMember{{Member: "b", Score: 2}}, zmembers, err)
+		score, err := capi.ZScore(k("zset"), "a")
+		if err != nil || score == nil || *score != 1.5 {
+			t.Fatalf("%s: Subtest 19: ZScore: expected 1.5, got %v, %v\n", name, score, err)
+		}
+		rank, err := capi.ZRank(k("zset"), "missing", false)
+		check(20, "ZRank", (*int)(nil), rank, err)
+		count, err = capi.ZAdd(k("zset"), api.ZMember{Member: "top", Score: math.Inf(1)})
+		check(20, "ZAdd infinite score", 1, count, err)
+		zmembers, err = capi.ZRangeByScore(&api.ZRangeByScoreParams{Key: k("zset"), Min: "(2", Max: "+inf"})
+		check(20, "ZRangeByScore of infinite score", []api.ZMember{{Member: "top", Score: math.Inf(1)}}, zmembers, err)
+		f, err = capi.ZIncrBy(k("zset"), "a", math.Inf(-1))
+		check(20, "ZIncrBy by infinity", math.Inf(-1), f, err)
+
+		keys, err := capi.Keys(name + ":*")
+		sort.Strings(keys)
+		check(21, "Keys", []string{k("hash"), k("list"), k("n"), k("set"), k("str"), k("zset")}, keys, err)
+		count, err = capi.Del(keys...)
+		check(22, "Del", 6, count, err)
+	}
+}
+
+func TestRESPClientSubscriptions(t *testing.T) {
+	srv := NewWithStorage(storage.New(0, storage.WithNotifications(storage.EventsAll)))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v\n", err)
+	}
+	rs := NewRESPServer(srv)
+	go rs.Serve(l)
+	defer rs.Close()
+
+	for _, proto := range []int{2, 3} {
+		capi, err := client.NewRESPAPI(l.Addr().String(), client.RESPOptions{Timeout: time.Second, Protocol: proto})
+		if err != nil {
+			t.Fatalf("NewRESPAPI: %v\n", err)
+		}
+
+		sub, err := capi.Subscribe([]string{"news"}, []string{"sport.*"})
+		if err != nil {
+			t.Fatalf("RESP%d: Subtest 1: Subscribe: unexpected error %v\n", proto, err)
+		}
+		if n, err := capi.Publish("sport.tennis", "score"); err != nil || n != 1 {
+			t.Fatalf("RESP%d: Subtest 2: Publish: expected 1 receiver, got %d, %v\n", proto, n, err)
+		}
+		select {
+		case msg := <-sub.Messages():
+			if msg != (api.Message{Channel: "sport.tennis", Pattern: "sport.*", Payload: "score"}) {
+				t.Fatalf("RESP%d: Subtest 3: unexpected message %+v\n", proto, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("RESP%d: Subtest 3: message wasn't received\n", proto)
+		}
+		sub.Close()
+		if _, ok := <-sub.Messages(); ok || sub.Err() != nil {
+			t.Fatalf("RESP%d: Subtest 4: subscription must end without error after Close, got %v\n", proto, sub.Err())
+		}
+
+		events, err := capi.SubscribeKeyEvents("user:*")
+		if err != nil {
+			t.Fatalf("RESP%d: Subtest 5: SubscribeKeyEvents: unexpected error %v\n", proto, err)
+		}
+		capi.Set("other", "a", 0)
+		capi.HSet("user:1", map[string]interface{}{"f": "v"})
+		select {
+		case event := <-events.Events():
+			if event != (api.KeyEvent{Event: "hset", Key: "user:1"}) {
+				t.Fatalf("RESP%d: Subtest 6: unexpected event %+v\n", proto, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("RESP%d: Subtest 6: event wasn't received\n", proto)
+		}
+		events.Close()
+		capi.Close()
+	}
+
+	// notifications are disabled
+	disabled := NewRESPServer(New())
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v\n", err)
+	}
+	go disabled.Serve(l)
+	defer disabled.Close()
+	capi, _ := client.NewRESPAPI(l.Addr().String(), client.RESPOptions{Timeout: time.Second})
+	defer capi.Close()
+	_, err = capi.SubscribeKeyEvents("*")
+	if e, ok := err.(*api.ErrorResponse); !ok || e.Err != storage.ErrNotificationsDisabled.Error() {
+		t.Fatalf("Subtest 7: SubscribeKeyEvents with disabled notifications: expected error response, got %v\n", err)
+	}
+}
+
+func TestRESPPool(t *testing.T) {
+	srv := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v\n", err)
+	}
+	rs := NewRESPServer(srv)
+	go rs.Serve(l)
+	defer rs.Close()
+
+	capi, err := client.NewRESPAPI(l.Addr().String(), client.RESPOptions{MaxIdle: 1, MaxActive: 2, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRESPAPI: %v\n", err)
+	}
+
+	const kCalls = 50
+	done := make(chan error)
+	for i := 0; i < kCalls; i += 1 {
+		go func() {
+			_, err := capi.Incr("counter")
+			done <- err
+		}()
+	}
+	for i := 0; i < kCalls; i += 1 {
+		if err := <-done; err != nil {
+			t.Fatalf("Subtest 1: Incr: unexpected error %v\n", err)
+		}
+	}
+	if res, err := capi.Get("counter"); err != nil || res != strconv.Itoa(kCalls) {
+		t.Fatalf("Subtest 2: expected %d, got %v, %v\n", kCalls, res, err)
+	}
+
+	capi.Close()
+	if _, err := capi.Get("counter"); !errors.Is(err, client.ErrClientClosed) {
+		t.Fatalf("Subtest 3: call after Close: expected ErrClientClosed, got %v\n", err)
+	}
+
+	// the only connection is taken by blocking pop, so waiting for it is limited by Timeout
+	capi, _ = client.NewRESPAPI(l.Addr().String(), client.RESPOptions{MaxActive: 1, Timeout: 100 * time.Millisecond})
+	go capi.BLPop(time.Second, "empty")
+	time.Sleep(20 * time.Millisecond)
+	if _, err := capi.Get("counter"); !errors.Is(err, client.ErrPoolTimeout) {
+		t.Fatalf("Subtest 4: call waiting for busy pool: expected ErrPoolTimeout, got %v\n", err)
+	}
+	capi.Close()
+
+	// without Timeout waiting call is woken up by Close
+	capi, _ = client.NewRESPAPI(l.Addr().String(), client.RESPOptions{MaxActive: 1})
+	go capi.BLPop(0, "empty")
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		capi.Close()
+	}()
+	if _, err := capi.Get("counter"); !errors.Is(err, client.ErrClientClosed) {
+		t.Fatalf("Subtest 5: call waiting for busy pool: expected ErrClientClosed after Close, got %v\n", err)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	srv := httptest.NewServer(New())
+	cl, _ := client.NewClient(srv.URL, time.Second)
+	capi := client.NewAPI(cl)
+
+	p := client.NewPipeline(capi)
+	var (
+		value, missing interface{}
+		deleted int
+		keys []string
+		counter int64
+	)
+	set := p.Set("a", "1", 0)
+	get := p.Get("a", &value)
+	getMissing := p.Get("b", &missing)
+	incr := p.Queue("incr", &api.IncrParams{Key: "a"}, &counter)
+	wrongType := p.Queue("hset", &api.HSetParams{Key: "a", Fields: map[string]interface{}{"f": 1}}, nil)
+	unknown := p.Queue("foo", &api.KeysParams{Pattern: "*"}, nil)
+	stream := p.Queue("subscribe", &api.SubscribeParams{Channels: []string{"c"}}, nil)
+	invalid := p.Queue("get", &api.GetParams{}, nil)
+	p.Keys("*", &keys)
+	del := p.Del(&deleted, "a", "b")
+	if p.Len() != 10 {
+		t.Fatalf("Subtest 1: expected 10 queued commands, got %d\n", p.Len())
+	}
+
+	if err := p.Flush(); err != nil {
+		t.Fatalf("Subtest 2: Flush: unexpected error %v\n", err)
+	}
+	if p.Len() != 0 {
+		t.Fatalf("Subtest 3: pipeline must be empty after Flush, got %d commands\n", p.Len())
+	}
+	for i, call := range []*client.PipelinedCall{set, get, getMissing, incr, del} {
+		if err := call.Err(); err != nil {
+			t.Fatalf("Subtest 4: call %d: unexpected error %v\n", i, err)
+		}
+	}
+	if value != "1" || missing != nil || counter != 2 || deleted != 1 || !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatalf("Subtest 5: unexpected results %v, %v, %d, %d, %v\n", value, missing, counter, deleted, keys)
+	}
+
+	statuses := map[*client.PipelinedCall]int{
+		wrongType: http.StatusBadRequest,
+		unknown: http.StatusNotFound,
+		stream: http.StatusBadRequest,
+		invalid: http.StatusBadRequest,
+	}
+	for call, status := range statuses {
+		e, ok := call.Err().(*api.ErrorResponse)
+		if !ok || e.Status != status {
+			t.Fatalf("Subtest 6: expected error response with status %d, got %v\n", status, call.Err())
+		}
+	}
+	if e := wrongType.Err().(*api.ErrorResponse); e.Op != "HSET" || e.Err != storage.ErrWrongType.Error() {
+		t.Fatalf("Subtest 7: expected WRONGTYPE error of HSET, got %+v\n", e)
+	}
+
+	if err := p.Flush(); err != nil {
+		t.Fatalf("Subtest 8: Flush of empty pipeline: unexpected error %v\n", err)
+	}
+}
+
+func TestRESTRoutes(t *testing.T) {
+	cache := New()
+	srv := httptest.NewServer(cache)
+	defer srv.Close()
+
+	do := func(method string, path string, body string, header map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, srv.URL + path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error %v\n", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	jsonType := map[string]string{"Content-Type": "application/json"}
+	if resp, _ := do(http.MethodPut, "/keys/a?ttl=100", `{"x": [1, 2]}`, jsonType); resp.StatusCode != http.StatusCreated || resp.Header.Get("ETag") == "" {
+		t.Fatalf("Subtest 1: PUT new key: got %d, ETag %q\n", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp, _ := do(http.MethodPut, "/keys/b%2Fc", "plain text", map[string]string{TTLHeader: "1m30s"}); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Subtest 2: PUT key with ttl header: got %d\n", resp.StatusCode)
+	}
+	if ttlA, ttlB := cache.Data.TTL("a"), cache.Data.TTL("b/c"); ttlA <= 99 * time.Second || ttlA > 100 * time.Second || ttlB <= 89 * time.Second || ttlB > 90 * time.Second {
+		t.Fatalf("Subtest 2: ttl of PUT keys: got %v and %v\n", ttlA, ttlB)
+	}
+	resp, body := do(http.MethodGet, "/keys/a", "", nil)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || body != `{"x":[1,2]}` || etag == "" {
+		t.Fatalf("Subtest 3: GET: got %d, %q, ETag %q\n", resp.StatusCode, body, etag)
+	}
+	if resp, body := do(http.MethodGet, "/keys/b%2Fc", "", nil); resp.StatusCode != http.StatusOK || body != `"plain text"` {
+		t.Fatalf("Subtest 4: GET escaped key: got %d, %q\n", resp.StatusCode, body)
+	}
+
+	if resp, body := do(http.MethodGet, "/keys/a", "", map[string]string{"If-None-Match": `"other", W/` + etag}); resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("Subtest 5: GET with matching If-None-Match: got %d, %q\n", resp.StatusCode, body)
+	}
+	if resp, _ := do(http.MethodGet, "/keys/a", "", map[string]string{"If-None-Match": `"other"`}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Subtest 6: GET with other If-None-Match: got %d\n", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodPut, "/keys/a", `{"x":[1,2]}`, jsonType); resp.StatusCode != http.StatusNoContent || resp.Header.Get("ETag") != etag {
+		t.Fatalf("Subtest 7: PUT equal value must keep ETag: got %d, %q instead of %q\n", resp.StatusCode, resp.Header.Get("ETag"), etag)
+	}
+	if resp, _ := do(http.MethodPut, "/keys/a", "2", map[string]string{"If-None-Match": "*"}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("Subtest 8: PUT existing key with If-None-Match *: got %d\n", resp.StatusCode)
+	}
+
+	if resp, body := do(http.MethodHead, "/keys/a", "", nil); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag || body != "" {
+		t.Fatalf("Subtest 9: HEAD: got %d, ETag %q, %q\n", resp.StatusCode, resp.Header.Get("ETag"), body)
+	}
+	if resp, _ := do(http.MethodHead, "/keys/missing", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Subtest 10: HEAD missing key: got %d\n", resp.StatusCode)
+	}
+	resp, body = do(http.MethodGet, "/keys/missing", "", nil)
+	var apiErr api.ErrorResponse
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil || resp.StatusCode != http.StatusNotFound || apiErr.Status != http.StatusNotFound {
+		t.Fatalf("Subtest 11: GET missing key: got %d, %q\n", resp.StatusCode, body)
+	}
+
+	if resp, body := do(http.MethodGet, "/keys?pattern=b*", "", nil); resp.StatusCode != http.StatusOK || body != `["b/c"]` {
+		t.Fatalf("Subtest 12: GET /keys with pattern: got %d, %q\n", resp.StatusCode, body)
+	}
+	if resp, body := do(http.MethodGet, "/keys", "", nil); resp.StatusCode != http.StatusOK || (body != `["a","b/c"]` && body != `["b/c","a"]`) {
+		t.Fatalf("Subtest 13: GET /keys: got %d, %q\n", resp.StatusCode, body)
+	}
+	if resp, _ := do(http.MethodPut, "/keys/a?ttl=-1", "1", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Subtest 14: PUT with negative ttl: got %d\n", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodPut, "/keys/a?ttl=-9223372037", "1", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Subtest 14: PUT with negative ttl which overflows duration: got %d\n", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodPost, "/keys/a", "", nil); resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") == "" {
+		t.Fatalf("Subtest 15: POST to key resource: got %d\n", resp.StatusCode)
+	}
+
+	if resp, _ := do(http.MethodDelete, "/keys/a", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Subtest 16: DELETE: got %d\n", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodDelete, "/keys/a", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Subtest 17: DELETE missing key: got %d\n", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodGet, "/keys/a", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Subtest 18: GET deleted key: got %d\n", resp.StatusCode)
+	}
+
+	if resp, _ := do(http.MethodPut, "/keys/x//y/../z", "1", nil); resp.StatusCode != http.StatusCreated || cache.Data.TTL("x//y/../z") != -1 {
+		t.Fatalf("Subtest 19: PUT key which isn't clean path: got %d\n", resp.StatusCode)
+	}
+	if resp, body := do(http.MethodGet, "/keys/x%2F%2Fy%2F..%2Fz", "", nil); resp.StatusCode != http.StatusOK || body != `"1"` {
+		t.Fatalf("Subtest 20: GET escaped key which isn't clean path: got %d, %q\n", resp.StatusCode, body)
+	}
+	if resp, body := do(http.MethodGet, "/keys/%2E%2E", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Subtest 21: GET key '..': got %d, %q\n", resp.StatusCode, body)
+	}
+
+	cache.Data.HSet("h", map[string]interface{}{"f": "v"})
+	resp, body = do(http.MethodGet, "/keys/h", "", nil)
+	if err := json.Unmarshal([]byte(body), &apiErr); err != nil || resp.StatusCode != http.StatusBadRequest || !strings.HasPrefix(apiErr.Err, "WRONGTYPE") {
+		t.Fatalf("Subtest 22: GET hash key: got %d, %q\n", resp.StatusCode, body)
+	}
+}
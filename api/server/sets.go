@@ -0,0 +1,133 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+)
+
+func (srv *CacheServer) HandleSAdd(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MembersParams)
+	if !parseRequest(w, r, "SADD", params, func() error { return api.ValidateMembersParams(params) }) {
+		return
+	}
+
+	kAdded, err := srv.Data.SAdd(params.Key, params.Members...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SADD", err.Error())
+		return
+	}
+	writeResult(w, kAdded)
+}
+
+func (srv *CacheServer) HandleSRem(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MembersParams)
+	if !parseRequest(w, r, "SREM", params, func() error { return api.ValidateMembersParams(params) }) {
+		return
+	}
+
+	kRemoved, err := srv.Data.SRem(params.Key, params.Members...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SREM", err.Error())
+		return
+	}
+	writeResult(w, kRemoved)
+}
+
+func (srv *CacheServer) HandleSMembers(w http.ResponseWriter, r *http.Request) {
+	params := new(api.SMembersParams)
+	if !parseRequest(w, r, "SMEMBERS", params, func() error { return api.ValidateSMembersParams(params) }) {
+		return
+	}
+
+	members, err := srv.Data.SMembers(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SMEMBERS", err.Error())
+		return
+	}
+	writeResult(w, members)
+}
+
+func (srv *CacheServer) HandleSIsMember(w http.ResponseWriter, r *http.Request) {
+	params := new(api.SIsMemberParams)
+	if !parseRequest(w, r, "SISMEMBER", params, func() error { return api.ValidateSIsMemberParams(params) }) {
+		return
+	}
+
+	isMember, err := srv.Data.SIsMember(params.Key, params.Member)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SISMEMBER", err.Error())
+		return
+	}
+	writeResult(w, boolToInt(isMember))
+}
+
+func (srv *CacheServer) HandleSCard(w http.ResponseWriter, r *http.Request) {
+	params := new(api.SMembersParams)
+	if !parseRequest(w, r, "SCARD", params, func() error { return api.ValidateSMembersParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.SCard(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SCARD", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+type setAlgebra func(keys ...string) ([]string, error)
+
+func handleSetAlgebra(w http.ResponseWriter, r *http.Request, op string, algebra setAlgebra) {
+	params := new(api.SetAlgebraParams)
+	if !parseRequest(w, r, op, params, func() error { return api.ValidateSetAlgebraParams(params) }) {
+		return
+	}
+
+	members, err := algebra(params.Keys...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), op, err.Error())
+		return
+	}
+	writeResult(w, members)
+}
+
+type setAlgebraStore func(dst string, keys ...string) (int, error)
+
+func handleSetAlgebraStore(w http.ResponseWriter, r *http.Request, op string, algebra setAlgebraStore) {
+	params := new(api.SetAlgebraStoreParams)
+	if !parseRequest(w, r, op, params, func() error { return api.ValidateSetAlgebraStoreParams(params) }) {
+		return
+	}
+
+	n, err := algebra(params.Destination, params.Keys...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), op, err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+func (srv *CacheServer) HandleSInter(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebra(w, r, "SINTER", srv.Data.SInter)
+}
+
+func (srv *CacheServer) HandleSUnion(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebra(w, r, "SUNION", srv.Data.SUnion)
+}
+
+func (srv *CacheServer) HandleSDiff(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebra(w, r, "SDIFF", srv.Data.SDiff)
+}
+
+func (srv *CacheServer) HandleSInterStore(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebraStore(w, r, "SINTERSTORE", srv.Data.SInterStore)
+}
+
+func (srv *CacheServer) HandleSUnionStore(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebraStore(w, r, "SUNIONSTORE", srv.Data.SUnionStore)
+}
+
+func (srv *CacheServer) HandleSDiffStore(w http.ResponseWriter, r *http.Request) {
+	handleSetAlgebraStore(w, r, "SDIFFSTORE", srv.Data.SDiffStore)
+}
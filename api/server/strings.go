@@ -0,0 +1,110 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+	"time"
+)
+
+func (srv *CacheServer) HandleAppend(w http.ResponseWriter, r *http.Request) {
+	params := new(api.AppendParams)
+	if !parseRequest(w, r, "APPEND", params, func() error { return api.ValidateAppendParams(params) }) {
+		return
+	}
+
+	length, err := srv.Data.Append(params.Key, params.Value)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "APPEND", err.Error())
+		return
+	}
+	writeResult(w, length)
+}
+
+func (srv *CacheServer) HandleGetRange(w http.ResponseWriter, r *http.Request) {
+	params := new(api.GetRangeParams)
+	if !parseRequest(w, r, "GETRANGE", params, func() error { return api.ValidateGetRangeParams(params) }) {
+		return
+	}
+
+	substr, err := srv.Data.GetRange(params.Key, params.Start, params.End)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "GETRANGE", err.Error())
+		return
+	}
+	writeResult(w, substr)
+}
+
+func (srv *CacheServer) HandleSetRange(w http.ResponseWriter, r *http.Request) {
+	params := new(api.SetRangeParams)
+	if !parseRequest(w, r, "SETRANGE", params, func() error { return api.ValidateSetRangeParams(params) }) {
+		return
+	}
+
+	length, err := srv.Data.SetRange(params.Key, params.Offset, params.Value)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "SETRANGE", err.Error())
+		return
+	}
+	writeResult(w, length)
+}
+
+func (srv *CacheServer) HandleStrLen(w http.ResponseWriter, r *http.Request) {
+	params := new(api.StrLenParams)
+	if !parseRequest(w, r, "STRLEN", params, func() error { return api.ValidateStrLenParams(params) }) {
+		return
+	}
+
+	length, err := srv.Data.StrLen(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "STRLEN", err.Error())
+		return
+	}
+	writeResult(w, length)
+}
+
+// responds with null for missing key
+func (srv *CacheServer) HandleGetDel(w http.ResponseWriter, r *http.Request) {
+	params := new(api.GetParams)
+	if !parseRequest(w, r, "GETDEL", params, func() error { return api.ValidateGetParams(params) }) {
+		return
+	}
+
+	val, exists, err := srv.Data.GetDel(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "GETDEL", err.Error())
+		return
+	}
+	if !exists {
+		w.Write([]byte("null"))
+		return
+	}
+	writeResult(w, val)
+}
+
+// responds with null for missing key
+func (srv *CacheServer) HandleGetEx(w http.ResponseWriter, r *http.Request) {
+	params := new(api.GetExParams)
+	if !parseRequest(w, r, "GETEX", params, func() error { return api.ValidateGetExParams(params) }) {
+		return
+	}
+
+	opts := storage.GetExOptions{
+		TTL: params.Ttl,
+		Persist: params.Persist,
+	}
+	if params.Timestamp != 0 {
+		opts.At = time.Unix(params.Timestamp, 0)
+	}
+	val, exists, err := srv.Data.GetEx(params.Key, opts)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "GETEX", err.Error())
+		return
+	}
+	if !exists {
+		w.Write([]byte("null"))
+		return
+	}
+	writeResult(w, val)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// ttlIn converts ttl to units keeping special negative values
+func ttlIn(ttl time.Duration, unit time.Duration) int64 {
+	if ttl == storage.TTLNoKey || ttl == storage.TTLNoExpire {
+		return int64(ttl)
+	}
+	return int64((ttl + unit / 2) / unit)
+}
+
+// expireDuration converts n units to duration, failing instead of wrapping around
+// when it's out of range of time.Duration like redis does
+func expireDuration(n int64, unit time.Duration, op string) (time.Duration, error) {
+	if n > math.MaxInt64 / int64(unit) || n < math.MinInt64 / int64(unit) {
+		return 0, fmt.Errorf("invalid expire time in '%s' command", op)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (srv *CacheServer) HandleTTL(w http.ResponseWriter, r *http.Request) {
+	params := new(api.TTLParams)
+	if !parseRequest(w, r, "TTL", params, func() error { return api.ValidateTTLParams(params) }) {
+		return
+	}
+
+	writeResult(w, ttlIn(srv.Data.TTL(params.Key), time.Second))
+}
+
+func (srv *CacheServer) HandlePTTL(w http.ResponseWriter, r *http.Request) {
+	params := new(api.TTLParams)
+	if !parseRequest(w, r, "PTTL", params, func() error { return api.ValidateTTLParams(params) }) {
+		return
+	}
+
+	writeResult(w, ttlIn(srv.Data.TTL(params.Key), time.Millisecond))
+}
+
+func (srv *CacheServer) HandleExpire(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ExpireParams)
+	if !parseRequest(w, r, "EXPIRE", params, func() error { return api.ValidateExpireParams(params) }) {
+		return
+	}
+
+	ttl, err := expireDuration(params.Seconds, time.Second, "expire")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "EXPIRE", err.Error())
+		return
+	}
+	writeResult(w, boolToInt(srv.Data.Expire(params.Key, ttl)))
+}
+
+func (srv *CacheServer) HandlePExpire(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PExpireParams)
+	if !parseRequest(w, r, "PEXPIRE", params, func() error { return api.ValidatePExpireParams(params) }) {
+		return
+	}
+
+	ttl, err := expireDuration(params.Milliseconds, time.Millisecond, "pexpire")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "PEXPIRE", err.Error())
+		return
+	}
+	writeResult(w, boolToInt(srv.Data.Expire(params.Key, ttl)))
+}
+
+func (srv *CacheServer) HandleExpireAt(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ExpireAtParams)
+	if !parseRequest(w, r, "EXPIREAT", params, func() error { return api.ValidateExpireAtParams(params) }) {
+		return
+	}
+
+	updated := srv.Data.ExpireAt(params.Key, time.Unix(params.Timestamp, 0))
+	writeResult(w, boolToInt(updated))
+}
+
+func (srv *CacheServer) HandlePersist(w http.ResponseWriter, r *http.Request) {
+	params := new(api.PersistParams)
+	if !parseRequest(w, r, "PERSIST", params, func() error { return api.ValidatePersistParams(params) }) {
+		return
+	}
+
+	writeResult(w, boolToInt(srv.Data.Persist(params.Key)))
+}
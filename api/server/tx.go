@@ -0,0 +1,245 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// decodeCommand converts command of EXEC to storage command, params are decoded
+// and validated the same way as by the endpoint of the command
+func decodeCommand(cmd api.Command) (storage.Command, error) {
+	decode := func(params interface{}, validate func() error) error {
+		if err := json.Unmarshal(cmd.Params, params); err != nil {
+			return err
+		}
+		return validate()
+	}
+
+	switch strings.ToUpper(cmd.Op) {
+	case "SET":
+		params := new(api.SetParams)
+		if err := decode(params, func() error { return api.ValidateSetParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if params.SetOptions != (api.SetOptions{}) {
+			return storage.Command{}, errors.New("options of SET can't be used in transaction")
+		}
+		return storage.SetCommand(params.Key, params.Value, params.Ttl), nil
+	case "GET":
+		params := new(api.GetParams)
+		if err := decode(params, func() error { return api.ValidateGetParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if params.WithVersion {
+			return storage.Command{}, errors.New("WithVersion option of GET can't be used in transaction")
+		}
+		return storage.GetCommand(params.Key), nil
+	case "DEL":
+		params := new(api.DelParams)
+		if err := decode(params, func() error { return api.ValidateDelParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if params.Version != nil {
+			return storage.Command{}, errors.New("version argument of DEL can't be used in transaction, use WATCH instead")
+		}
+		return storage.DelCommand(params.Keys...), nil
+	case "EXPIRE":
+		params := new(api.ExpireParams)
+		if err := decode(params, func() error { return api.ValidateExpireParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		ttl, err := expireDuration(params.Seconds, time.Second, "expire")
+		if err != nil {
+			return storage.Command{}, err
+		}
+		return storage.ExpireCommand(params.Key, ttl), nil
+	case "PEXPIRE":
+		params := new(api.PExpireParams)
+		if err := decode(params, func() error { return api.ValidatePExpireParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		ttl, err := expireDuration(params.Milliseconds, time.Millisecond, "pexpire")
+		if err != nil {
+			return storage.Command{}, err
+		}
+		return storage.ExpireCommand(params.Key, ttl), nil
+	case "PERSIST":
+		params := new(api.PersistParams)
+		if err := decode(params, func() error { return api.ValidatePersistParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.PersistCommand(params.Key), nil
+	case "INCR", "DECR":
+		params := new(api.IncrParams)
+		if err := decode(params, func() error { return api.ValidateIncrParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if strings.ToUpper(cmd.Op) == "DECR" {
+			return storage.IncrByCommand(params.Key, -1), nil
+		}
+		return storage.IncrByCommand(params.Key, 1), nil
+	case "INCRBY":
+		params := new(api.IncrByParams)
+		if err := decode(params, func() error { return api.ValidateIncrByParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.IncrByCommand(params.Key, params.Increment), nil
+	case "DECRBY":
+		params := new(api.DecrByParams)
+		if err := decode(params, func() error { return api.ValidateDecrByParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if params.Decrement == math.MinInt64 {
+			return storage.Command{}, errors.New("decrement would overflow")
+		}
+		return storage.IncrByCommand(params.Key, -params.Decrement), nil
+	case "INCRBYFLOAT":
+		params := new(api.IncrByFloatParams)
+		if err := decode(params, func() error { return api.ValidateIncrByFloatParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.IncrByFloatCommand(params.Key, params.Increment), nil
+	case "APPEND":
+		params := new(api.AppendParams)
+		if err := decode(params, func() error { return api.ValidateAppendParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.AppendCommand(params.Key, params.Value), nil
+	case "HSET":
+		params := new(api.HSetParams)
+		if err := decode(params, func() error { return api.ValidateHSetParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.HSetCommand(params.Key, params.Fields), nil
+	case "HGET":
+		params := new(api.HGetParams)
+		if err := decode(params, func() error { return api.ValidateHGetParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.HGetCommand(params.Key, params.Field), nil
+	case "HDEL":
+		params := new(api.HDelParams)
+		if err := decode(params, func() error { return api.ValidateHDelParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.HDelCommand(params.Key, params.Fields...), nil
+	case "HINCRBY":
+		params := new(api.HIncrByParams)
+		if err := decode(params, func() error { return api.ValidateHIncrByParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.HIncrByCommand(params.Key, params.Field, params.Increment), nil
+	case "LPUSH", "RPUSH":
+		params := new(api.PushParams)
+		if err := decode(params, func() error { return api.ValidatePushParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if strings.ToUpper(cmd.Op) == "LPUSH" {
+			return storage.LPushCommand(params.Key, params.Values...), nil
+		}
+		return storage.RPushCommand(params.Key, params.Values...), nil
+	case "LPOP", "RPOP":
+		params := new(api.ListParams)
+		if err := decode(params, func() error { return api.ValidateListParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		if strings.ToUpper(cmd.Op) == "LPOP" {
+			return storage.LPopCommand(params.Key), nil
+		}
+		return storage.RPopCommand(params.Key), nil
+	case "SADD", "SREM", "ZREM":
+		params := new(api.MembersParams)
+		if err := decode(params, func() error { return api.ValidateMembersParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		switch strings.ToUpper(cmd.Op) {
+		case "SADD":
+			return storage.SAddCommand(params.Key, params.Members...), nil
+		case "SREM":
+			return storage.SRemCommand(params.Key, params.Members...), nil
+		}
+		return storage.ZRemCommand(params.Key, params.Members...), nil
+	case "ZADD":
+		params := new(api.ZAddParams)
+		if err := decode(params, func() error { return api.ValidateZAddParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		members := make([]storage.ZMember, len(params.Members))
+		for i, m := range params.Members {
+			members[i] = storage.ZMember{Member: m.Member, Score: m.Score}
+		}
+		return storage.ZAddCommand(params.Key, members...), nil
+	case "ZINCRBY":
+		params := new(api.ZIncrByParams)
+		if err := decode(params, func() error { return api.ValidateZIncrByParams(params) }); err != nil {
+			return storage.Command{}, err
+		}
+		return storage.ZIncrByCommand(params.Key, params.Member, float64(params.Increment)), nil
+	}
+	return storage.Command{}, errors.New("command can't be used in transaction")
+}
+
+func (srv *CacheServer) HandleWatch(w http.ResponseWriter, r *http.Request) {
+	params := new(api.WatchParams)
+	if !parseRequest(w, r, "WATCH", params, func() error { return api.ValidateWatchParams(params) }) {
+		return
+	}
+
+	writeResult(w, srv.Data.Watch(params.Keys...))
+}
+
+// responds with results of commands or null if some of the watched keys was modified.
+// If any command is invalid, nothing is executed like in redis
+func (srv *CacheServer) HandleExec(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ExecParams)
+	if !parseRequest(w, r, "EXEC", params, func() error { return api.ValidateExecParams(params) }) {
+		return
+	}
+
+	cmds := make([]storage.Command, len(params.Commands))
+	for i, cmd := range params.Commands {
+		var err error
+		if cmds[i], err = decodeCommand(cmd); err != nil {
+			writeError(w, http.StatusBadRequest, "EXEC", fmt.Sprintf("command %d (%s): %s", i, cmd.Op, err.Error()))
+			return
+		}
+	}
+
+	results, err := srv.Data.Exec(params.Watch, cmds...)
+	if errors.Is(err, storage.ErrTxAborted) {
+		w.Write([]byte("null"))
+		return
+	} else if err != nil {
+		writeError(w, storageErrorStatus(err), "EXEC", err.Error())
+		return
+	}
+
+	resp := make([]api.CommandResult, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			resp[i].Err = result.Err.Error()
+			continue
+		}
+		switch v := result.Value.(type) {
+		case bool:
+			resp[i].Value = boolToInt(v)
+		case float64:
+			resp[i].Value = api.Score(v)
+		case nil:
+			if cmds[i].Name() == "set" {
+				resp[i].Value = "OK"
+			}
+		default:
+			resp[i].Value = v
+		}
+	}
+	writeResult(w, resp)
+}
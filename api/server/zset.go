@@ -0,0 +1,159 @@
+package server
+
+import (
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/api"
+
+	"net/http"
+)
+
+func toAPIMembers(members []storage.ZMember) []api.ZMember {
+	result := make([]api.ZMember, len(members))
+	for i, m := range members {
+		result[i] = api.ZMember{Member: m.Member, Score: m.Score}
+	}
+	return result
+}
+
+func (srv *CacheServer) HandleZAdd(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZAddParams)
+	if !parseRequest(w, r, "ZADD", params, func() error { return api.ValidateZAddParams(params) }) {
+		return
+	}
+
+	members := make([]storage.ZMember, len(params.Members))
+	for i, m := range params.Members {
+		members[i] = storage.ZMember{Member: m.Member, Score: m.Score}
+	}
+	kAdded, err := srv.Data.ZAdd(params.Key, members...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZADD", err.Error())
+		return
+	}
+	writeResult(w, kAdded)
+}
+
+func (srv *CacheServer) HandleZIncrBy(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZIncrByParams)
+	if !parseRequest(w, r, "ZINCRBY", params, func() error { return api.ValidateZIncrByParams(params) }) {
+		return
+	}
+
+	score, err := srv.Data.ZIncrBy(params.Key, params.Member, float64(params.Increment))
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZINCRBY", err.Error())
+		return
+	}
+	writeResult(w, api.Score(score))
+}
+
+func (srv *CacheServer) HandleZRem(w http.ResponseWriter, r *http.Request) {
+	params := new(api.MembersParams)
+	if !parseRequest(w, r, "ZREM", params, func() error { return api.ValidateMembersParams(params) }) {
+		return
+	}
+
+	kRemoved, err := srv.Data.ZRem(params.Key, params.Members...)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZREM", err.Error())
+		return
+	}
+	writeResult(w, kRemoved)
+}
+
+// responds with null for missing member
+func (srv *CacheServer) HandleZScore(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZScoreParams)
+	if !parseRequest(w, r, "ZSCORE", params, func() error { return api.ValidateZScoreParams(params) }) {
+		return
+	}
+
+	score, exists, err := srv.Data.ZScore(params.Key, params.Member)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZSCORE", err.Error())
+		return
+	}
+	if !exists {
+		w.Write([]byte("null"))
+		return
+	}
+	writeResult(w, api.Score(score))
+}
+
+func (srv *CacheServer) HandleZCard(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZCardParams)
+	if !parseRequest(w, r, "ZCARD", params, func() error { return api.ValidateZCardParams(params) }) {
+		return
+	}
+
+	n, err := srv.Data.ZCard(params.Key)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZCARD", err.Error())
+		return
+	}
+	writeResult(w, n)
+}
+
+// responds with null for missing member
+func (srv *CacheServer) HandleZRank(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZRankParams)
+	if !parseRequest(w, r, "ZRANK", params, func() error { return api.ValidateZRankParams(params) }) {
+		return
+	}
+
+	rank, exists, err := srv.Data.ZRank(params.Key, params.Member, params.Reverse)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZRANK", err.Error())
+		return
+	}
+	if !exists {
+		w.Write([]byte("null"))
+		return
+	}
+	writeResult(w, rank)
+}
+
+func (srv *CacheServer) HandleZRange(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZRangeParams)
+	if !parseRequest(w, r, "ZRANGE", params, func() error { return api.ValidateZRangeParams(params) }) {
+		return
+	}
+
+	members, err := srv.Data.ZRange(params.Key, params.Start, params.Stop, params.Reverse)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZRANGE", err.Error())
+		return
+	}
+	writeResult(w, toAPIMembers(members))
+}
+
+func (srv *CacheServer) HandleZRangeByScore(w http.ResponseWriter, r *http.Request) {
+	params := new(api.ZRangeByScoreParams)
+	scores := storage.ScoreRange{}
+	validate := func() error {
+		if err := api.ValidateZRangeByScoreParams(params); err != nil {
+			return err
+		}
+		var err error
+		if scores.Min, err = storage.ParseScoreBound(params.Min); err != nil {
+			return err
+		}
+		scores.Max, err = storage.ParseScoreBound(params.Max)
+		return err
+	}
+	if !parseRequest(w, r, "ZRANGEBYSCORE", params, validate) {
+		return
+	}
+
+	opts := storage.RangeOptions{
+		Reverse: params.Reverse,
+		Offset: params.Offset,
+		Count: params.Count,
+	}
+	members, err := srv.Data.ZRangeByScore(params.Key, scores, opts)
+	if err != nil {
+		writeError(w, storageErrorStatus(err), "ZRANGEBYSCORE", err.Error())
+		return
+	}
+	writeResult(w, toAPIMembers(members))
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+)
+
+// MembersParams are used by SADD, SREM and ZREM
+type MembersParams struct {
+	Key string
+	Members []string
+}
+
+func ValidateMembersParams(p *MembersParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if len(p.Members) == 0 {
+		return errors.New("at least one member must be in members argument")
+	}
+	return nil
+}
+
+
+// SMembersParams are used by both SMEMBERS and SCARD
+type SMembersParams struct {
+	Key string
+}
+
+func ValidateSMembersParams(p *SMembersParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type SIsMemberParams struct {
+	Key string
+	Member string
+}
+
+func ValidateSIsMemberParams(p *SIsMemberParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// SetAlgebraParams are used by SINTER, SUNION and SDIFF
+type SetAlgebraParams struct {
+	Keys []string
+}
+
+func ValidateSetAlgebraParams(p *SetAlgebraParams) error {
+	if len(p.Keys) == 0 {
+		return errors.New("at least one key must be in keys argument")
+	}
+	return nil
+}
+
+
+// SetAlgebraStoreParams are used by SINTERSTORE, SUNIONSTORE and SDIFFSTORE
+type SetAlgebraStoreParams struct {
+	Destination string
+	Keys []string
+}
+
+func ValidateSetAlgebraStoreParams(p *SetAlgebraStoreParams) error {
+	if p.Destination == "" {
+		return errors.New("destination argument must be specified")
+	}
+	if len(p.Keys) == 0 {
+		return errors.New("at least one key must be in keys argument")
+	}
+	return nil
+}
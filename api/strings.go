@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+// lengths and offsets of string commands are in bytes
+
+type AppendParams struct {
+	Key string
+	Value string
+}
+
+func ValidateAppendParams(p *AppendParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// negative offsets count from the end, End is inclusive
+type GetRangeParams struct {
+	Key string
+	Start int
+	End int
+}
+
+func ValidateGetRangeParams(p *GetRangeParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// string is zero-padded if Offset is past its end
+type SetRangeParams struct {
+	Key string
+	Offset int
+	Value string
+}
+
+func ValidateSetRangeParams(p *SetRangeParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if p.Offset < 0 {
+		return errors.New("offset argument must be nonnegative")
+	}
+	return nil
+}
+
+
+type StrLenParams struct {
+	Key string
+}
+
+func ValidateStrLenParams(p *StrLenParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// GetExOptions correspond to options of redis GETEX, at most one of them can be set
+type GetExOptions struct {
+	// relative ttl
+	Ttl time.Duration
+	// unix time in seconds, timestamp in the past deletes the key
+	Timestamp int64
+	// remove ttl
+	Persist bool
+}
+
+// GetExParams embed GetExOptions, so they are specified at the top level of json
+type GetExParams struct {
+	Key string
+	GetExOptions
+}
+
+func ValidateGetExParams(p *GetExParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if p.Ttl < 0 {
+		return errors.New("ttl argument must be nonnegative")
+	}
+	set := 0
+	for _, isSet := range []bool{p.Ttl > 0, p.Timestamp != 0, p.Persist} {
+		if isSet {
+			set += 1
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of ttl, timestamp and Persist option can be specified")
+	}
+	return nil
+}
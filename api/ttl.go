@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+)
+
+// TTLParams are used by both TTL and PTTL
+type TTLParams struct {
+	Key string
+}
+
+func ValidateTTLParams(p *TTLParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// non-positive ttl deletes the key
+type ExpireParams struct {
+	Key string
+	Seconds int64
+}
+
+func ValidateExpireParams(p *ExpireParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type PExpireParams struct {
+	Key string
+	Milliseconds int64
+}
+
+func ValidatePExpireParams(p *PExpireParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// Timestamp is unix time in seconds, timestamp in the past deletes the key
+type ExpireAtParams struct {
+	Key string
+	Timestamp int64
+}
+
+func ValidateExpireAtParams(p *ExpireAtParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type PersistParams struct {
+	Key string
+}
+
+func ValidatePersistParams(p *PersistParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
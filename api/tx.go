@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type WatchParams struct {
+	Keys []string
+}
+
+func ValidateWatchParams(p *WatchParams) error {
+	if len(p.Keys) == 0 {
+		return errors.New("at least one key must be in keys argument")
+	}
+	return nil
+}
+
+
+// Command is a command queued in transaction, Op is the name of its endpoint
+// and Params are the same as params of the endpoint
+type Command struct {
+	Op string
+	Params json.RawMessage
+}
+
+func NewCommand(op string, params interface{}) (Command, error) {
+	raw, err := json.Marshal(params)
+	return Command{Op: op, Params: raw}, err
+}
+
+// ExecParams contain versions of watched keys returned by WATCH and commands to execute
+type ExecParams struct {
+	Watch map[string]uint64
+	Commands []Command
+}
+
+func ValidateExecParams(p *ExecParams) error {
+	for _, cmd := range p.Commands {
+		if cmd.Op == "" {
+			return errors.New("op of every command must be specified")
+		}
+	}
+	return nil
+}
+
+// CommandResult is a result of command executed by EXEC, Err is empty if command succeeded
+type CommandResult struct {
+	Value interface{}
+	Err string
+}
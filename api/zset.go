@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Score is encoded to json as a number, except for infinite scores which json has no numbers for.
+// They are encoded as strings "inf" and "-inf" like in RESP
+type Score float64
+
+func (s Score) MarshalJSON() ([]byte, error) {
+	switch {
+	case math.IsInf(float64(s), 1):
+		return []byte(`"inf"`), nil
+	case math.IsInf(float64(s), -1):
+		return []byte(`"-inf"`), nil
+	}
+	return json.Marshal(float64(s))
+}
+
+func (s *Score) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return json.Unmarshal(data, (*float64)(s))
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || !math.IsInf(f, 0) {
+		return errors.New("score must be a number, \"inf\" or \"-inf\"")
+	}
+	*s = Score(f)
+	return nil
+}
+
+type ZMember struct {
+	Member string
+	Score float64
+}
+
+// zmemberJSON is ZMember encoded with infinite scores
+type zmemberJSON struct {
+	Member string
+	Score Score
+}
+
+func (m ZMember) MarshalJSON() ([]byte, error) {
+	return json.Marshal(zmemberJSON{Member: m.Member, Score: Score(m.Score)})
+}
+
+func (m *ZMember) UnmarshalJSON(data []byte) error {
+	var decoded zmemberJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*m = ZMember{Member: decoded.Member, Score: float64(decoded.Score)}
+	return nil
+}
+
+type ZAddParams struct {
+	Key string
+	Members []ZMember
+}
+
+func ValidateZAddParams(p *ZAddParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if len(p.Members) == 0 {
+		return errors.New("at least one member must be in members argument")
+	}
+	return nil
+}
+
+
+type ZIncrByParams struct {
+	Key string
+	Member string
+	Increment Score
+}
+
+func ValidateZIncrByParams(p *ZIncrByParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type ZScoreParams struct {
+	Key string
+	Member string
+}
+
+func ValidateZScoreParams(p *ZScoreParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+type ZCardParams struct {
+	Key string
+}
+
+func ValidateZCardParams(p *ZCardParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// Reverse ranks members from the highest score
+type ZRankParams struct {
+	Key string
+	Member string
+	Reverse bool
+}
+
+func ValidateZRankParams(p *ZRankParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// negative ranks count from the end, stop is inclusive
+type ZRangeParams struct {
+	Key string
+	Start int
+	Stop int
+	Reverse bool
+}
+
+func ValidateZRangeParams(p *ZRangeParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	return nil
+}
+
+
+// Min and Max are numbers, "-inf" or "+inf", "(" prefix makes bound exclusive.
+// Positive Count limits number of members returned after skipping Offset ones
+type ZRangeByScoreParams struct {
+	Key string
+	Min string
+	Max string
+	Reverse bool
+	Offset int
+	Count int
+}
+
+func ValidateZRangeByScoreParams(p *ZRangeByScoreParams) error {
+	if p.Key == "" {
+		return errors.New("key argument must be specified")
+	}
+	if p.Min == "" || p.Max == "" {
+		return errors.New("min and max arguments must be specified")
+	}
+	if p.Offset < 0 {
+		return errors.New("offset argument must be nonnegative")
+	}
+	return nil
+}
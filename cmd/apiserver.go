@@ -2,27 +2,125 @@ package main
 
 import (
 	"github.com/dmitrygulevich2000/tiny-redis-cache/api/server"
+	"github.com/dmitrygulevich2000/tiny-redis-cache/storage"
 
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
+var (
+	snapshotPath = flag.String("snapshot", "", "path to the snapshot file, empty disables persistence")
+	snapshotInterval = flag.Duration("snapshot-interval", time.Minute, "how often changed data is saved to the snapshot file")
+	aofPath = flag.String("appendonly", "", "path to the append-only file, empty disables write logging")
+	aofFsync = flag.String("appendfsync", "everysec", "append-only file fsync policy: always, everysec or no")
+	maxMemory = flag.Int64("maxmemory", 0, "approximate memory limit for data in bytes, 0 means no limit")
+	maxMemoryPolicy = flag.String("maxmemory-policy", "noeviction",
+		"eviction policy: noeviction, allkeys-lru, allkeys-lfu, volatile-lru or volatile-ttl")
+	shards = flag.Int("shards", 1, "number of independently locked storage shards")
+	expiration = flag.String("expiration", "sampling", "background expiration engine: sampling or deadline")
+	notifyEvents = flag.String("notify-keyspace-events", "",
+		"classes of keyspace events streamed by /keyevents: g (generic), $ (string), l (list), s (set), h (hash), z (zset), x (expired), e (evicted) or A (all)")
+	respPort = flag.Int("resp-port", 0, "port of RESP server for redis clients, 0 disables it")
+)
+
+var fsyncPolicies = map[string]storage.FsyncPolicy{
+	"always": storage.FsyncAlways,
+	"everysec": storage.FsyncEverySec,
+	"no": storage.FsyncNever,
+}
+
+var expirationEngines = map[string]storage.ExpirationEngine{
+	"sampling": storage.ExpireBySampling,
+	"deadline": storage.ExpireByDeadline,
+}
+
+var evictionPolicies = map[string]storage.EvictionPolicy{
+	"noeviction": storage.NoEviction,
+	"allkeys-lru": storage.AllKeysLRU,
+	"allkeys-lfu": storage.AllKeysLFU,
+	"volatile-lru": storage.VolatileLRU,
+	"volatile-ttl": storage.VolatileTTL,
+}
+
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		log.Fatalln("Expected server port in first arg")
 	}
-	port, err := strconv.Atoi(os.Args[1]) 
+	port, err := strconv.Atoi(flag.Arg(0))
 	if err != nil {
 		log.Fatalln("Expected server port in first arg")
 	}
-	
-	srv := server.New()
+
+	opts := []storage.Option{}
+	if *snapshotPath != "" {
+		opts = append(opts, storage.WithSnapshot(*snapshotPath, *snapshotInterval))
+	}
+	if *aofPath != "" {
+		policy, ok := fsyncPolicies[*aofFsync]
+		if !ok {
+			log.Fatalln("Unknown appendfsync policy:", *aofFsync)
+		}
+		opts = append(opts, storage.WithAppendOnly(*aofPath, policy))
+	}
+	if *maxMemory > 0 {
+		policy, ok := evictionPolicies[*maxMemoryPolicy]
+		if !ok {
+			log.Fatalln("Unknown maxmemory policy:", *maxMemoryPolicy)
+		}
+		opts = append(opts, storage.WithMaxMemory(*maxMemory, policy))
+	}
+	if *shards > 1 {
+		opts = append(opts, storage.WithShards(*shards))
+	}
+	engine, ok := expirationEngines[*expiration]
+	if !ok {
+		log.Fatalln("Unknown expiration engine:", *expiration)
+	}
+	opts = append(opts, storage.WithExpiration(engine))
+	classes, err := storage.ParseEventClasses(*notifyEvents)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	opts = append(opts, storage.WithNotifications(classes))
+	data, err := storage.Open(0, opts...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	srv := server.NewWithStorage(data)
+	if *respPort > 0 {
+		respSrv := server.NewRESPServer(srv)
+		go func() {
+			log.Fatalln(respSrv.ListenAndServe(":" + strconv.Itoa(*respPort)))
+		}()
+	}
+
 	server := http.Server {
 		Addr: ":" + strconv.Itoa(port),
 		Handler: srv,
 	}
 
+	go shutdownOnSignal(data)
 	panic(server.ListenAndServe())
-}
\ No newline at end of file
+}
+
+// shutdownOnSignal saves data before exit
+func shutdownOnSignal(data storage.Storage) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	if err := data.Save(); err != nil && !errors.Is(err, storage.ErrSnapshotDisabled) {
+		log.Println("Failed to save snapshot:", err)
+	}
+	data.Close()
+	os.Exit(0)
+}
@@ -0,0 +1,815 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy tells how often append-only file is flushed to disk
+type FsyncPolicy int
+
+const (
+	// FsyncEverySec syncs the file once a second, up to a second of writes may be lost
+	FsyncEverySec FsyncPolicy = iota
+	// FsyncAlways syncs the file after every write
+	FsyncAlways
+	// FsyncNever leaves syncing to operating system
+	FsyncNever
+)
+
+var (
+	ErrAppendOnlyDisabled = errors.New("append-only file is not configured")
+	ErrRewriteInProgress = errors.New("append-only file rewrite already in progress")
+	// ErrAppendOnlyWrite is wrapped by errors of writes adding data while records can't be written to the log,
+	// like MISCONF of redis. Writes are accepted again once pending records are written or the log is rewritten
+	ErrAppendOnlyWrite = errors.New("MISCONF errors writing to the append-only file")
+)
+
+// Append-only file layout:
+//   "TAOF" magic, format version byte,
+//   records: uvarint payload length, payload, big-endian crc32 of payload.
+// Payload starts with operation code followed by its arguments,
+// deadlines are absolute so that replay doesn't extend ttl and are encoded like in snapshots.
+const (
+	aofMagic = "TAOF"
+	aofVersion = 2
+
+	// key, deadline, value
+	aofSet byte = 0x01
+	// uvarint count, keys
+	aofDel byte = 0x02
+	// key, deadline (zero removes ttl)
+	aofExpireAt byte = 0x03
+	// key, uvarint count, field and value pairs
+	aofHSet byte = 0x04
+	// key, uvarint count, fields
+	aofHDel byte = 0x05
+	// key, side (1 is left), uvarint count, values
+	aofPush byte = 0x06
+	// key, side
+	aofPop byte = 0x07
+	// key, varint start, varint stop
+	aofLTrim byte = 0x08
+	// key, uvarint count, members
+	aofSAdd byte = 0x09
+	aofSRem byte = 0x0A
+	// key, uvarint count, member and score pairs
+	aofZAdd byte = 0x0B
+	// key, uvarint count, members
+	aofZRem byte = 0x0C
+	// key, value
+	aofAppend byte = 0x0D
+	// key, varint offset, value
+	aofSetRange byte = 0x0E
+)
+
+var (
+	aofSyncPeriod = time.Second
+	aofMaxRecord uint64 = 512 << 20
+	// file is rewritten automatically when it grew twice since last rewrite
+	// and is not smaller than aofRewriteMinSize
+	aofRewriteMinSize int64 = 64 << 20
+	aofRewriteGrowth = 2
+)
+
+type aofWriter struct {
+	path string
+	policy FsyncPolicy
+
+	mutex sync.Mutex
+	f *os.File
+	size int64
+	// size right after last rewrite
+	baseSize int64
+	// collects records appended while rewrite is in progress, nil otherwise
+	rewriteBuf *bytes.Buffer
+	// records not written yet because of error, retried by the next append or sync.
+	// Partially written record stays here too, so the log is never left with a hole in the middle
+	pending []byte
+	// error of the last write or sync, nil once they succeed again
+	err error
+	// error of the last background rewrite, reported and reset by the next startRewrite
+	rewriteErr error
+	closed bool
+}
+
+func openAOF(path string, policy FsyncPolicy) (*aofWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	a := &aofWriter{
+		path: path,
+		policy: policy,
+		f: f,
+		size: info.Size(),
+		baseSize: info.Size(),
+	}
+	if a.size == 0 {
+		n, err := f.Write(aofHeader())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		a.size = int64(n)
+		a.baseSize = a.size
+	}
+	return a, nil
+}
+
+func aofHeader() []byte {
+	return append([]byte(aofMagic), aofVersion)
+}
+
+// encodeRecord frames payload produced by fill
+func encodeRecord(fill func(enc *encoder)) ([]byte, error) {
+	payload := new(bytes.Buffer)
+	enc := newEncoder(payload)
+	fill(enc)
+	if enc.err != nil {
+		return nil, enc.err
+	}
+
+	record := new(bytes.Buffer)
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], uint64(payload.Len()))
+	record.Write(scratch[:n])
+	record.Write(payload.Bytes())
+	binary.BigEndian.PutUint32(scratch[:4], crc32.ChecksumIEEE(payload.Bytes()))
+	record.Write(scratch[:4])
+
+	return record.Bytes(), nil
+}
+
+func (a *aofWriter) append(fill func(enc *encoder)) {
+	record, err := encodeRecord(fill)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return
+	}
+	if err != nil {
+		a.err = err
+		return
+	}
+
+	if a.rewriteBuf != nil {
+		a.rewriteBuf.Write(record)
+	}
+	a.pending = append(a.pending, record...)
+	a.flush(a.policy == FsyncAlways)
+}
+
+// flush writes pending records and syncs the file if asked, must be called with mutex held
+func (a *aofWriter) flush(sync bool) {
+	if len(a.pending) > 0 {
+		n, err := a.f.Write(a.pending)
+		a.size += int64(n)
+		a.pending = a.pending[n:]
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.pending = nil
+	}
+	if sync {
+		if err := a.f.Sync(); err != nil {
+			a.err = err
+			return
+		}
+	}
+	a.err = nil
+}
+
+// sync syncs the file if policy is FsyncEverySec and retries pending records after errors
+func (a *aofWriter) sync() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed || (a.policy != FsyncEverySec && a.err == nil) {
+		return
+	}
+	a.flush(a.policy != FsyncNever)
+}
+
+// failure returns error wrapping ErrAppendOnlyWrite if the last write or sync failed
+func (a *aofWriter) failure() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrAppendOnlyWrite, a.err)
+}
+
+func (a *aofWriter) needsRewrite() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.rewriteBuf == nil && a.size >= aofRewriteMinSize &&
+		a.size >= int64(aofRewriteGrowth) * a.baseSize
+}
+
+// startRewrite makes appended records also go into rewrite buffer,
+// storage must be locked so that no records are appended concurrently
+func (a *aofWriter) startRewrite() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.rewriteBuf != nil {
+		return ErrRewriteInProgress
+	}
+	if err := a.rewriteErr; err != nil {
+		a.rewriteErr = nil
+		return fmt.Errorf("previous append-only file rewrite failed: %w", err)
+	}
+	a.rewriteBuf = new(bytes.Buffer)
+	return nil
+}
+
+// rewrite writes minimal set of records producing entries into temporary file,
+// then appends records collected since startRewrite and replaces the log with it.
+// Pending records are collected too, so successful rewrite also recovers from write errors
+func (a *aofWriter) rewrite(entries []snapshotEntry) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path) + ".tmp*")
+	if err != nil {
+		a.abortRewrite(err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	header := aofHeader()
+	w.Write(header)
+	size := int64(len(header))
+	for _, e := range entries {
+		record, err := encodeRecord(setRecord(e.key, e.value, e.expires))
+		if err != nil {
+			a.abortRewrite(err)
+			return err
+		}
+		w.Write(record)
+		size += int64(len(record))
+	}
+	if err = w.Flush(); err != nil {
+		a.abortRewrite(err)
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	tail := a.rewriteBuf
+	a.rewriteBuf = nil
+	if _, err = f.Write(tail.Bytes()); err != nil {
+		a.rewriteErr = err
+		return err
+	}
+	size += int64(tail.Len())
+	if err = f.Sync(); err != nil {
+		a.rewriteErr = err
+		return err
+	}
+	if err = os.Rename(f.Name(), a.path); err != nil {
+		a.rewriteErr = err
+		return err
+	}
+	a.pending = nil
+	a.err = nil
+
+	if a.closed {
+		return f.Close()
+	}
+	a.f.Close()
+	a.f = f
+	a.size = size
+	a.baseSize = size
+	return nil
+}
+
+func (a *aofWriter) abortRewrite(err error) {
+	a.mutex.Lock()
+	a.rewriteBuf = nil
+	a.rewriteErr = err
+	a.mutex.Unlock()
+}
+
+func (a *aofWriter) close() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return
+	}
+	a.closed = true
+	a.flush(false)
+	if a.policy != FsyncNever {
+		a.f.Sync()
+	}
+	a.f.Close()
+}
+
+func setRecord(key string, value interface{}, expires time.Time) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofSet)
+		enc.string(key)
+		enc.deadline(expires)
+		enc.value(value)
+	}
+}
+
+func expireAtRecord(key string, expires time.Time) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofExpireAt)
+		enc.string(key)
+		enc.deadline(expires)
+	}
+}
+
+func delRecord(keys []string) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofDel)
+		enc.uvarint(uint64(len(keys)))
+		for _, key := range keys {
+			enc.string(key)
+		}
+	}
+}
+
+func hsetRecord(key string, fields map[string]interface{}) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofHSet)
+		enc.string(key)
+		enc.uvarint(uint64(len(fields)))
+		for field, value := range fields {
+			enc.string(field)
+			enc.value(value)
+		}
+	}
+}
+
+func hdelRecord(key string, fields []string) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofHDel)
+		enc.string(key)
+		enc.strings(fields)
+	}
+}
+
+func pushRecord(key string, left bool, values []interface{}) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofPush)
+		enc.string(key)
+		enc.bool(left)
+		enc.uvarint(uint64(len(values)))
+		for _, value := range values {
+			enc.value(value)
+		}
+	}
+}
+
+func popRecord(key string, left bool) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofPop)
+		enc.string(key)
+		enc.bool(left)
+	}
+}
+
+func ltrimRecord(key string, start, stop int) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofLTrim)
+		enc.string(key)
+		enc.varint(int64(start))
+		enc.varint(int64(stop))
+	}
+}
+
+func membersRecord(op byte, key string, members []string) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(op)
+		enc.string(key)
+		enc.strings(members)
+	}
+}
+
+func zaddRecord(key string, members []ZMember) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofZAdd)
+		enc.string(key)
+		enc.zmembers(members)
+	}
+}
+
+func appendRecord(key string, value string) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofAppend)
+		enc.string(key)
+		enc.string(value)
+	}
+}
+
+func setRangeRecord(key string, offset int, value string) func(enc *encoder) {
+	return func(enc *encoder) {
+		enc.byte(aofSetRange)
+		enc.string(key)
+		enc.varint(int64(offset))
+		enc.string(value)
+	}
+}
+
+// readAOF calls fn for payload of every record. Incomplete last record
+// (e.g. left by crash in the middle of write) is cut off the file
+func readAOF(path string, fn func(dec *decoder)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = decodeAOF(f, fn)
+	var truncated *truncatedError
+	if errors.As(err, &truncated) {
+		err = os.Truncate(path, truncated.offset)
+	}
+	if err != nil {
+		return fmt.Errorf("append-only file %s: %w", path, err)
+	}
+	return nil
+}
+
+type truncatedError struct {
+	offset int64
+}
+
+func (e *truncatedError) Error() string {
+	return fmt.Sprintf("unexpected end of file after offset %d", e.offset)
+}
+
+func decodeAOF(r io.Reader, fn func(dec *decoder)) error {
+	br := bufio.NewReader(r)
+
+	header := aofHeader()
+	if _, err := io.ReadFull(br, header); err != nil {
+		return &truncatedError{0}
+	}
+	if string(header[:len(aofMagic)]) != aofMagic {
+		return errors.New("not an append-only file")
+	}
+	if version := header[len(aofMagic)]; version != aofVersion {
+		return fmt.Errorf("unsupported format version %d", version)
+	}
+
+	offset := int64(len(header))
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return &truncatedError{offset}
+		}
+		if err != nil || n > aofMaxRecord {
+			return fmt.Errorf("bad record length at offset %d", offset)
+		}
+
+		payload := make([]byte, n + 4)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return &truncatedError{offset}
+		}
+		sum := binary.BigEndian.Uint32(payload[n:])
+		payload = payload[:n]
+		if crc32.ChecksumIEEE(payload) != sum {
+			return fmt.Errorf("checksum mismatch at offset %d", offset)
+		}
+
+		dec := newDecoder(bytes.NewReader(payload))
+		fn(dec)
+		if dec.err != nil {
+			return fmt.Errorf("bad record at offset %d: %w", offset, dec.err)
+		}
+		offset += int64(uvarintLen(n)) + int64(n) + 4
+	}
+}
+
+func uvarintLen(x uint64) int {
+	var scratch [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(scratch[:], x)
+}
+
+func (p *persistence) bgRewriteAOF() error {
+	if p.aof == nil {
+		return ErrAppendOnlyDisabled
+	}
+
+	p.parts.rlock()
+	for _, s := range p.parts {
+		if s.closed() {
+			p.parts.runlock()
+			return nil
+		}
+	}
+	if err := p.aof.startRewrite(); err != nil {
+		p.parts.runlock()
+		return err
+	}
+	entries := []snapshotEntry{}
+	for _, s := range p.parts {
+		entries = append(entries, s.entries()...)
+	}
+	p.parts.runlock()
+
+	go p.aof.rewrite(entries)
+	return nil
+}
+
+// openAOF replays existing log, or creates it from data loaded from snapshot
+func (p *persistence) openAOF(path string, policy FsyncPolicy) error {
+	_, err := os.Stat(path)
+	exists := err == nil
+
+	if exists {
+		if err := p.parts.replayAOF(path); err != nil {
+			return err
+		}
+	} else if p.snapshot != nil {
+		if err := p.parts.loadSnapshot(p.snapshot.path); err != nil {
+			return err
+		}
+	}
+
+	p.aof, err = openAOF(path, policy)
+	if err != nil {
+		return err
+	}
+	for _, s := range p.parts {
+		s.aof = p.aof
+		if !exists {
+			for _, e := range s.entries() {
+				s.logSet(e.key, e.value, e.expires)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *persistence) aofChecker() {
+	ticker := time.NewTicker(aofSyncPeriod)
+
+	for {
+		select {
+		case <- ticker.C:
+			p.aof.sync()
+			if p.aof.needsRewrite() {
+				p.bgRewriteAOF()
+			}
+		case _, ok := <- p.done:
+			if !ok {
+				ticker.Stop()
+				return
+			}
+		}
+	}
+}
+
+// replayAOF applies all records first and drops expired keys only then,
+// because later records may change ttl of the key
+func (p partitions) replayAOF(path string) error {
+	err := readAOF(path, func(dec *decoder) {
+		switch dec.byte() {
+		case aofSet:
+			key := dec.string()
+			expires := dec.deadline()
+			value := dec.value()
+			if dec.err == nil {
+				p.shardOf(key).store(key, value, expires)
+			}
+		case aofDel:
+			n := dec.uvarint()
+			for i := uint64(0); i < n && dec.err == nil; i += 1 {
+				key := dec.string()
+				if dec.err == nil {
+					p.shardOf(key).unlink(key)
+				}
+			}
+		case aofExpireAt:
+			key := dec.string()
+			expires := dec.deadline()
+			shard := p.shardOf(key)
+			if _, exists := shard.data[key]; exists && dec.err == nil {
+				shard.setDeadline(key, expires)
+			}
+		case aofHSet:
+			key := dec.string()
+			n := dec.length()
+			fields := make(map[string]interface{}, minInt(n, 1024))
+			for i := 0; i < n && dec.err == nil; i += 1 {
+				field := dec.string()
+				fields[field] = dec.value()
+			}
+			if dec.err == nil {
+				p.shardOf(key).hset(key, fields, time.Time{})
+			}
+		case aofHDel:
+			key := dec.string()
+			fields := dec.strings()
+			if dec.err == nil {
+				p.shardOf(key).hdel(key, fields, time.Time{})
+			}
+		case aofPush:
+			key := dec.string()
+			left := dec.bool()
+			n := dec.length()
+			values := make([]interface{}, 0, minInt(n, 1024))
+			for i := 0; i < n && dec.err == nil; i += 1 {
+				values = append(values, dec.value())
+			}
+			if dec.err == nil {
+				p.shardOf(key).push(key, left, values, time.Time{})
+			}
+		case aofPop:
+			key := dec.string()
+			left := dec.bool()
+			if dec.err == nil {
+				p.shardOf(key).pop(key, left, time.Time{})
+			}
+		case aofLTrim:
+			key := dec.string()
+			start := dec.varint()
+			stop := dec.varint()
+			if dec.err == nil {
+				p.shardOf(key).ltrim(key, int(start), int(stop), time.Time{})
+			}
+		case aofSAdd:
+			key := dec.string()
+			members := dec.strings()
+			if dec.err == nil {
+				p.shardOf(key).sadd(key, members, time.Time{})
+			}
+		case aofSRem:
+			key := dec.string()
+			members := dec.strings()
+			if dec.err == nil {
+				p.shardOf(key).srem(key, members, time.Time{})
+			}
+		case aofZAdd:
+			key := dec.string()
+			members := dec.zmembers()
+			if dec.err == nil {
+				p.shardOf(key).zadd(key, members, time.Time{})
+			}
+		case aofZRem:
+			key := dec.string()
+			members := dec.strings()
+			if dec.err == nil {
+				p.shardOf(key).zrem(key, members, time.Time{})
+			}
+		case aofAppend:
+			key := dec.string()
+			value := dec.string()
+			if dec.err == nil {
+				p.shardOf(key).appendString(key, value, time.Time{})
+			}
+		case aofSetRange:
+			key := dec.string()
+			offset := dec.varint()
+			value := dec.string()
+			if dec.err == nil {
+				p.shardOf(key).setRange(key, int(offset), value, time.Time{})
+			}
+		default:
+			dec.fail(errCorrupted)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range p {
+		for key, expires := range s.expires {
+			if now.After(expires) {
+				s.unlink(key)
+			}
+		}
+	}
+	return nil
+}
+
+// admitWrite must be called with mutex held before writes which may add data,
+// they fail while append-only file can't be written or memory limit can't be kept
+func (s *kvStorage) admitWrite() error {
+	if s.aof != nil {
+		if err := s.aof.failure(); err != nil {
+			return err
+		}
+	}
+	return s.freeMemory()
+}
+
+func (s *kvStorage) logSet(key string, value interface{}, expires time.Time) {
+	if s.aof != nil {
+		s.aof.append(setRecord(key, value, expires))
+	}
+}
+
+func (s *kvStorage) logExpireAt(key string, expires time.Time) {
+	if s.aof != nil {
+		s.aof.append(expireAtRecord(key, expires))
+	}
+}
+
+func (s *kvStorage) logHSet(key string, fields map[string]interface{}) {
+	if s.aof != nil {
+		s.aof.append(hsetRecord(key, fields))
+	}
+}
+
+func (s *kvStorage) logHDel(key string, fields []string) {
+	if s.aof != nil {
+		s.aof.append(hdelRecord(key, fields))
+	}
+}
+
+func (s *kvStorage) logPush(key string, left bool, values []interface{}) {
+	if s.aof != nil {
+		s.aof.append(pushRecord(key, left, values))
+	}
+}
+
+func (s *kvStorage) logPop(key string, left bool) {
+	if s.aof != nil {
+		s.aof.append(popRecord(key, left))
+	}
+}
+
+func (s *kvStorage) logLTrim(key string, start, stop int) {
+	if s.aof != nil {
+		s.aof.append(ltrimRecord(key, start, stop))
+	}
+}
+
+func (s *kvStorage) logSAdd(key string, members []string) {
+	if s.aof != nil {
+		s.aof.append(membersRecord(aofSAdd, key, members))
+	}
+}
+
+func (s *kvStorage) logSRem(key string, members []string) {
+	if s.aof != nil {
+		s.aof.append(membersRecord(aofSRem, key, members))
+	}
+}
+
+func (s *kvStorage) logZAdd(key string, members []ZMember) {
+	if s.aof != nil {
+		s.aof.append(zaddRecord(key, members))
+	}
+}
+
+func (s *kvStorage) logZRem(key string, members []string) {
+	if s.aof != nil {
+		s.aof.append(membersRecord(aofZRem, key, members))
+	}
+}
+
+func (s *kvStorage) logAppend(key string, value string) {
+	if s.aof != nil {
+		s.aof.append(appendRecord(key, value))
+	}
+}
+
+func (s *kvStorage) logSetRange(key string, offset int, value string) {
+	if s.aof != nil {
+		s.aof.append(setRangeRecord(key, offset, value))
+	}
+}
+
+func (s *kvStorage) logDel(keys ...string) {
+	if s.aof != nil && len(keys) > 0 {
+		s.aof.append(delRecord(keys))
+	}
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncAlways))
+	data.Set("key1", "val1", zeroDuration)
+	data.Set("key2", "val2", zeroDuration)
+	data.Set("key1", "val3", zeroDuration)
+	data.Set("volatile", "val", time.Hour)
+	data.Set("expiring", "val", defaultTTL)
+	data.Delete("key2", "missing")
+	data.Close()
+
+	time.Sleep(defaultSleep)
+	data = New(0, WithAppendOnly(path, FsyncAlways))
+	defer data.Close()
+
+	if val, _ := data.Get("key1"); val != "val3" {
+		t.Errorf("Get key1: expected %s, got %v\n", "val3", val)
+	}
+	if val, exists := data.Get("key2"); exists {
+		t.Errorf("Get key2: expected nothing, got %v\n", val)
+	}
+	if val, _ := data.Get("volatile"); val != "val" {
+		t.Errorf("Get volatile: expected %s, got %v\n", "val", val)
+	}
+	// replay must not extend ttl
+	if val, exists := data.Get("expiring"); exists {
+		t.Errorf("Get expiring: expected nothing, got %v\n", val)
+	}
+}
+
+func TestAOFTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	data.Set("key1", "val1", zeroDuration)
+	data.Set("key2", "val2", zeroDuration)
+	data.Close()
+
+	content, _ := os.ReadFile(path)
+	os.WriteFile(path, content[:len(content) - 3], 0644)
+
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	if val, _ := data.Get("key1"); val != "val1" {
+		t.Errorf("Get key1: expected %s, got %v\n", "val1", val)
+	}
+	if val, exists := data.Get("key2"); exists {
+		t.Errorf("Get key2: expected nothing, got %v\n", val)
+	}
+	data.Set("key3", "val3", zeroDuration)
+	data.Close()
+
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	defer data.Close()
+	if val, _ := data.Get("key3"); val != "val3" {
+		t.Errorf("Get key3 after truncation: expected %s, got %v\n", "val3", val)
+	}
+}
+
+func TestAOFCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	data.Set("key1", "val1", zeroDuration)
+	data.Set("key2", "val2", zeroDuration)
+	data.Close()
+
+	content, _ := os.ReadFile(path)
+	content[len(aofMagic) + 4] ^= 0xFF
+	os.WriteFile(path, content, 0644)
+
+	if _, err := Open(0, WithAppendOnly(path, FsyncNever)); err == nil {
+		t.Fatalf("Open: expected error on corrupted append-only file\n")
+	}
+}
+
+func TestAOFRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	for i := 0; i < 100; i += 1 {
+		data.Set("key", i, zeroDuration)
+	}
+	data.Set("deleted", "val", zeroDuration)
+	data.Delete("deleted")
+
+	before, _ := os.Stat(path)
+	kvs := data.(*kvStorage)
+	if err := data.BgRewriteAOF(); err != nil {
+		t.Fatalf("BgRewriteAOF: unexpected error %s\n", err)
+	}
+	// written while rewrite may still be in progress
+	data.Set("late", "val", zeroDuration)
+	for i := 0; i < 100; i += 1 {
+		kvs.aof.mutex.Lock()
+		done := kvs.aof.rewriteBuf == nil
+		kvs.aof.mutex.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	data.Close()
+
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Expected rewritten file to be smaller: %d before, %d after\n", before.Size(), after.Size())
+	}
+
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	defer data.Close()
+	if val, _ := data.Get("key"); val != int64(99) {
+		t.Errorf("Get key: expected %d, got %#v\n", 99, val)
+	}
+	if val, _ := data.Get("late"); val != "val" {
+		t.Errorf("Get late: expected %s, got %v\n", "val", val)
+	}
+	if val, exists := data.Get("deleted"); exists {
+		t.Errorf("Get deleted: expected nothing, got %v\n", val)
+	}
+}
+
+func TestAOFWriteError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncAlways), WithSnapshot(filepath.Join(dir, "dump.trdb"), 0))
+	data.Set("key1", "val1", zeroDuration)
+	data.Set("key2", "val2", zeroDuration)
+
+	// writes to file opened only for reading fail, like on full disk
+	kvs := data.(*kvStorage)
+	readOnly, _ := os.Open(path)
+	kvs.aof.mutex.Lock()
+	file := kvs.aof.f
+	kvs.aof.f = readOnly
+	kvs.aof.mutex.Unlock()
+
+	data.Delete("key1")
+	if err := data.Set("key3", "val3", zeroDuration); !errors.Is(err, ErrAppendOnlyWrite) {
+		t.Fatalf("Set: expected ErrAppendOnlyWrite, got %v\n", err)
+	}
+	if _, exists := data.Get("key3"); exists {
+		t.Fatalf("Get key3: rejected write must not be applied\n")
+	}
+	if stats := data.Stats(); stats.AOFError == "" {
+		t.Fatalf("Stats: expected error of append-only file to be reported\n")
+	}
+	if err := data.Save(); !errors.Is(err, ErrAppendOnlyWrite) {
+		t.Fatalf("Save: expected ErrAppendOnlyWrite, got %v\n", err)
+	}
+
+	// pending record of deletion is written once the file is writable again
+	kvs.aof.mutex.Lock()
+	kvs.aof.f = file
+	kvs.aof.mutex.Unlock()
+	readOnly.Close()
+	kvs.aof.sync()
+	if err := data.Set("key3", "val3", zeroDuration); err != nil {
+		t.Fatalf("Set after recovery: unexpected error %v\n", err)
+	}
+	if stats := data.Stats(); stats.AOFError != "" {
+		t.Fatalf("Stats after recovery: unexpected error %s\n", stats.AOFError)
+	}
+	data.Close()
+
+	data = New(0, WithAppendOnly(path, FsyncAlways))
+	defer data.Close()
+	if val, exists := data.Get("key1"); exists {
+		t.Errorf("Get key1: expected nothing, got %v\n", val)
+	}
+	if val, _ := data.Get("key3"); val != "val3" {
+		t.Errorf("Get key3: expected %s, got %v\n", "val3", val)
+	}
+}
+
+func TestAOFFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "dump.trdb")
+	aof := filepath.Join(dir, "appendonly.taof")
+
+	data := New(0, WithSnapshot(snapshot, 0))
+	data.Set("key", "val", zeroDuration)
+	data.Save()
+	data.Close()
+
+	data = New(0, WithSnapshot(snapshot, 0), WithAppendOnly(aof, FsyncNever))
+	data.Close()
+
+	data = New(0, WithAppendOnly(aof, FsyncNever))
+	defer data.Close()
+	if val, _ := data.Get("key"); val != "val" {
+		t.Errorf("Get key: expected %s, got %v\n", "val", val)
+	}
+}
+
+func TestAOFActiveExpiration(t *testing.T) {
+	for _, engine := range []ExpirationEngine{ExpireBySampling, ExpireByDeadline} {
+		path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+		data := New(time.Millisecond, WithAppendOnly(path, FsyncAlways), WithExpiration(engine)).(*kvStorage)
+		data.Set("key", "val", defaultTTL)
+		for deadline := time.Now().Add(time.Second); ; {
+			data.mutex.RLock()
+			_, exists := data.data["key"]
+			data.mutex.RUnlock()
+			if !exists {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Engine %d: key wasn't expired actively\n", engine)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		// reclaimed key must not be revived by replay under the write
+		data.HSet("key", map[string]interface{}{"field": "val"})
+		data.Close()
+
+		data = New(0, WithAppendOnly(path, FsyncAlways)).(*kvStorage)
+		if val, _, err := data.HGet("key", "field"); err != nil || val != "val" {
+			t.Errorf("Engine %d: HGet after restart: expected %s, got %v, %v\n", engine, "val", val, err)
+		}
+		data.Close()
+	}
+}
+
+func TestAOFFarDeadline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	// deadline after 2262 is out of range of int64 nanoseconds
+	data := New(0, WithAppendOnly(path, FsyncAlways))
+	data.Set("key", "val", zeroDuration)
+	data.Expire("key", 9000000000 * time.Second)
+	data.Close()
+
+	data = New(0, WithAppendOnly(path, FsyncAlways))
+	defer data.Close()
+	if ttl := data.TTL("key"); ttl < 2499999 * time.Hour {
+		t.Fatalf("TTL after restart: expected about %v, got %v\n", 2500000 * time.Hour, ttl)
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClosed = errors.New("storage is closed")
+
+// states of waiter, it leaves waiterBlocked exactly once
+const (
+	waiterBlocked int32 = iota
+	waiterServed
+	waiterCancelled
+)
+
+// waiter is a client blocked in BLPOP or BRPOP. It is queued on all its keys,
+// possibly in different shards, and is served by the first push to any of them
+type waiter struct {
+	state int32
+	left bool
+	// buffered, so that serving never blocks
+	result chan poppedItem
+}
+
+type poppedItem struct {
+	key string
+	value interface{}
+}
+
+func (w *waiter) claim(state int32) bool {
+	return atomic.CompareAndSwapInt32(&w.state, waiterBlocked, state)
+}
+
+// block and unblock maintain FIFO queues of waiters, must be called with mutex held
+
+func (s *kvStorage) block(key string, w *waiter) {
+	s.blocked[key] = append(s.blocked[key], w)
+}
+
+func (s *kvStorage) unblock(key string, w *waiter) {
+	queue := s.blocked[key]
+	for i, other := range queue {
+		if other == w {
+			queue = append(queue[:i], queue[i + 1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(s.blocked, key)
+	} else {
+		s.blocked[key] = queue
+	}
+}
+
+// serveBlocked hands items of the list to clients blocked on the key in order they were blocked.
+// Must be called with mutex held
+func (s *kvStorage) serveBlocked(key string, now time.Time) {
+	for len(s.blocked[key]) > 0 {
+		if l, _, _ := s.listAt(key, now, false); l == nil {
+			return
+		}
+
+		w := s.blocked[key][0]
+		s.unblock(key, w)
+		// waiter may be already served by another key or timed out
+		if !w.claim(waiterServed) {
+			continue
+		}
+		value, _, _ := s.pop(key, w.left, now)
+		s.dirty += 1
+		s.logPop(key, w.left)
+		s.emitChange(EventsList, popEvent(w.left), key)
+		w.result <- poppedItem{key, value}
+	}
+}
+
+// blockingPop pops from the first non-empty list among keys, or waits until item is pushed to any
+// of them. Non-positive timeout means waiting until ctx is done. Returns false on timeout
+func (p partitions) blockingPop(ctx context.Context, left bool, timeout time.Duration, keys []string) (string, interface{}, bool, error) {
+	w := &waiter{
+		left: left,
+		result: make(chan poppedItem, 1),
+	}
+	defer func() {
+		for _, key := range keys {
+			shard := p.shardOf(key)
+			shard.mutex.Lock()
+			shard.unblock(key, w)
+			shard.mutex.Unlock()
+		}
+	}()
+
+	// keys are checked one by one, waiter is queued on a key before the next one is checked,
+	// so push to already checked key serves it and no item is missed
+	for _, key := range keys {
+		shard := p.shardOf(key)
+		shard.mutex.Lock()
+		l, _, err := shard.listAt(key, time.Now(), false)
+		if err != nil || l != nil {
+			if !w.claim(waiterCancelled) {
+				// served by one of previous keys
+				shard.mutex.Unlock()
+				break
+			}
+			if err != nil {
+				shard.mutex.Unlock()
+				return "", nil, false, err
+			}
+			value, _, _ := shard.pop(key, left, time.Now())
+			shard.dirty += 1
+			shard.logPop(key, left)
+			shard.emitChange(EventsList, popEvent(left), key)
+			shard.mutex.Unlock()
+			return key, value, true, nil
+		}
+		shard.block(key, w)
+		shard.mutex.Unlock()
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case item := <-w.result:
+		return item.key, item.value, true, nil
+	case <-expired:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-p[0].done:
+		err = ErrClosed
+	}
+	if !w.claim(waiterCancelled) {
+		// served concurrently with timeout
+		item := <-w.result
+		return item.key, item.value, true, nil
+	}
+	return "", nil, false, err
+}
+
+// BLPop is blocking LPop over several keys, it returns the key item was popped from.
+// Blocked clients are served in FIFO order, Close releases them with ErrClosed
+func (s *kvStorage) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error) {
+	if s.closed() {
+		panic("BLPop over closed storage")
+	}
+	return partitions{s}.blockingPop(ctx, true, timeout, keys)
+}
+
+func (s *kvStorage) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error) {
+	if s.closed() {
+		panic("BRPop over closed storage")
+	}
+	return partitions{s}.blockingPop(ctx, false, timeout, keys)
+}
+
+func (s *shardedStorage) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error) {
+	if s.closed() {
+		panic("BLPop over closed storage")
+	}
+	return s.shards.blockingPop(ctx, true, timeout, keys)
+}
+
+func (s *shardedStorage) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error) {
+	if s.closed() {
+		panic("BRPop over closed storage")
+	}
+	return s.shards.blockingPop(ctx, false, timeout, keys)
+}
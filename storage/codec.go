@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+)
+
+// binary encoding of keys and values shared by snapshots and append-only file
+
+const (
+	valueNil byte = iota
+	valueString
+	valueInt
+	valueFloat
+	valueBool
+	valueJSON
+	valueHash
+	valueList
+	valueSet
+	valueZSet
+)
+
+var errCorrupted = errors.New("corrupted data")
+
+// encoder writes primitives into w, first error sticks
+type encoder struct {
+	w io.Writer
+	crc hash.Hash32
+	err error
+
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func newEncoder(w io.Writer) *encoder {
+	crc := crc32.NewIEEE()
+	return &encoder{
+		w: io.MultiWriter(w, crc),
+		crc: crc,
+	}
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(p)
+}
+
+func (e *encoder) byte(b byte) {
+	e.scratch[0] = b
+	e.write(e.scratch[:1])
+}
+
+func (e *encoder) uvarint(x uint64) {
+	n := binary.PutUvarint(e.scratch[:], x)
+	e.write(e.scratch[:n])
+}
+
+func (e *encoder) varint(x int64) {
+	n := binary.PutVarint(e.scratch[:], x)
+	e.write(e.scratch[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, s)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.byte(1)
+	} else {
+		e.byte(0)
+	}
+}
+
+func (e *encoder) float(f float64) {
+	binary.BigEndian.PutUint64(e.scratch[:8], math.Float64bits(f))
+	e.write(e.scratch[:8])
+}
+
+func (e *encoder) zmembers(members []ZMember) {
+	e.uvarint(uint64(len(members)))
+	for _, m := range members {
+		e.string(m.Member)
+		e.float(m.Score)
+	}
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// deadline is encoded as unix seconds and nanoseconds plus one, so that zero time, which means
+// no deadline, is told apart and deadlines after 2262 don't overflow int64 nanoseconds
+func (e *encoder) deadline(t time.Time) {
+	if t.IsZero() {
+		e.varint(0)
+		e.uvarint(0)
+		return
+	}
+	e.varint(t.Unix())
+	e.uvarint(uint64(t.Nanosecond()) + 1)
+}
+
+func (e *encoder) value(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.byte(valueNil)
+	case string:
+		e.byte(valueString)
+		e.string(v)
+	case int:
+		e.byte(valueInt)
+		e.varint(int64(v))
+	case int64:
+		e.byte(valueInt)
+		e.varint(v)
+	case float64:
+		e.byte(valueFloat)
+		e.float(v)
+	case bool:
+		e.byte(valueBool)
+		e.bool(v)
+	case Hash:
+		e.byte(valueHash)
+		e.uvarint(uint64(len(v)))
+		for field, value := range v {
+			e.string(field)
+			e.value(value)
+		}
+	case List:
+		e.byte(valueList)
+		e.uvarint(uint64(len(v)))
+		for _, value := range v {
+			e.value(value)
+		}
+	case Members:
+		e.byte(valueSet)
+		e.strings(v)
+	case ZSet:
+		e.byte(valueZSet)
+		e.zmembers(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			if e.err == nil {
+				e.err = err
+			}
+			return
+		}
+		e.byte(valueJSON)
+		e.string(string(data))
+	}
+}
+
+// checksum writes crc32 of everything written so far, it is not hashed itself
+func (e *encoder) checksum() {
+	sum := e.crc.Sum32()
+	binary.BigEndian.PutUint32(e.scratch[:4], sum)
+	e.write(e.scratch[:4])
+}
+
+// decoder reads primitives written by encoder, first error sticks
+type decoder struct {
+	r *bufio.Reader
+	crc hash.Hash32
+	err error
+
+	scratch [8]byte
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{
+		r: bufio.NewReader(r),
+		crc: crc32.NewIEEE(),
+	}
+}
+
+func (d *decoder) fail(err error) {
+	if d.err != nil {
+		return
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = err
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err != nil {
+		return
+	}
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		d.fail(err)
+		return
+	}
+	d.crc.Write(p)
+}
+
+// ReadByte makes decoder an io.ByteReader for binary.ReadUvarint
+func (d *decoder) ReadByte() (byte, error) {
+	d.read(d.scratch[:1])
+	return d.scratch[0], d.err
+}
+
+func (d *decoder) byte() byte {
+	b, _ := d.ReadByte()
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(d)
+	if err != nil {
+		d.fail(errCorrupted)
+	}
+	return x
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	x, err := binary.ReadVarint(d)
+	if err != nil {
+		d.fail(errCorrupted)
+	}
+	return x
+}
+
+// length reads number of items, bounded so that corrupted data can't cause huge allocation
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > math.MaxInt32 {
+		d.fail(errCorrupted)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	p := make([]byte, n)
+	d.read(p)
+	return string(p)
+}
+
+func (d *decoder) float() float64 {
+	d.read(d.scratch[:8])
+	return math.Float64frombits(binary.BigEndian.Uint64(d.scratch[:8]))
+}
+
+func (d *decoder) zmembers() []ZMember {
+	n := d.length()
+	result := make([]ZMember, 0, minInt(n, 1024))
+	for i := 0; i < n && d.err == nil; i += 1 {
+		member := d.string()
+		result = append(result, ZMember{member, d.float()})
+	}
+	return result
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	result := make([]string, 0, minInt(n, 1024))
+	for i := 0; i < n && d.err == nil; i += 1 {
+		result = append(result, d.string())
+	}
+	return result
+}
+
+func (d *decoder) deadline() time.Time {
+	sec := d.varint()
+	nsec := d.uvarint()
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, int64(nsec - 1))
+}
+
+func (d *decoder) value() interface{} {
+	switch d.byte() {
+	case valueNil:
+		return nil
+	case valueString:
+		return d.string()
+	case valueInt:
+		return d.varint()
+	case valueFloat:
+		return d.float()
+	case valueBool:
+		return d.bool()
+	case valueJSON:
+		data := d.string()
+		if d.err != nil {
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			d.fail(err)
+		}
+		return v
+	case valueHash:
+		n := d.length()
+		h := make(Hash, minInt(n, 1024))
+		for i := 0; i < n && d.err == nil; i += 1 {
+			field := d.string()
+			h[field] = d.value()
+		}
+		return h
+	case valueList:
+		n := d.length()
+		l := make(List, 0, minInt(n, 1024))
+		for i := 0; i < n && d.err == nil; i += 1 {
+			l = append(l, d.value())
+		}
+		return l
+	case valueSet:
+		return Members(d.strings())
+	case valueZSet:
+		return ZSet(d.zmembers())
+	}
+	d.fail(errCorrupted)
+	return nil
+}
+
+// checksum reads crc32 written by encoder.checksum and compares it
+// with the hash of everything read so far
+func (d *decoder) checksum() {
+	if d.err != nil {
+		return
+	}
+	sum := d.crc.Sum32()
+	if _, err := io.ReadFull(d.r, d.scratch[:4]); err != nil {
+		d.fail(err)
+		return
+	}
+	if binary.BigEndian.Uint32(d.scratch[:4]) != sum {
+		d.fail(errors.New("checksum mismatch"))
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat = errors.New("value is not a valid float")
+	ErrOverflow = errors.New("increment or decrement would overflow")
+)
+
+// modify stores value returned by fn for the current value of the key, keeping its ttl.
+// Missing key is passed to fn as nil value with exists set to false. Must be called with mutex held
+func (s *kvStorage) modify(key string, now time.Time, fn func(value interface{}, exists bool) (interface{}, error)) error {
+	if err := s.admitWrite(); err != nil {
+		return err
+	}
+
+	var current interface{}
+	e, exists := s.lookup(key, now)
+	if exists {
+		current = e.value
+		if c, ok := e.value.(container); ok {
+			if c.typeName() != "string" {
+				return ErrWrongType
+			}
+			current = c.export()
+		}
+	}
+	value, err := fn(current, exists)
+	if err != nil {
+		return err
+	}
+
+	var expires time.Time
+	if exists {
+		expires = s.expires[key]
+	}
+	s.store(key, value, expires)
+	s.dirty += 1
+	s.logSet(key, value, expires)
+	return nil
+}
+
+// toInt64 accepts integral json numbers and numeric strings
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return f, true
+	}
+	return 0, false
+}
+
+// IncrBy adds delta to integer value of the key, missing key is treated as zero.
+// Numeric strings stay strings
+func (s *kvStorage) IncrBy(key string, delta int64) (int64, error) {
+	if s.closed() {
+		panic("IncrBy over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.incrByLocked(key, delta, time.Now())
+}
+
+// incrByLocked must be called with mutex held
+func (s *kvStorage) incrByLocked(key string, delta int64, now time.Time) (int64, error) {
+	var result int64
+	err := s.modify(key, now, func(value interface{}, exists bool) (interface{}, error) {
+		var updated interface{}
+		var err error
+		updated, result, err = addInt(value, exists, delta)
+		return updated, err
+	})
+	if err == nil {
+		s.events.emit(EventsString, EventIncrBy, key)
+	}
+	return result, err
+}
+
+// addInt adds delta to integer value, missing value is treated as zero.
+// Returns value to store, which is string for numeric strings, and the sum
+func addInt(value interface{}, exists bool, delta int64) (interface{}, int64, error) {
+	current := int64(0)
+	if exists {
+		var ok bool
+		if current, ok = toInt64(value); !ok {
+			return nil, 0, ErrNotInteger
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64 - delta) || (delta < 0 && current < math.MinInt64 - delta) {
+		return nil, 0, ErrOverflow
+	}
+
+	result := current + delta
+	if _, isString := value.(string); isString {
+		return strconv.FormatInt(result, 10), result, nil
+	}
+	return result, result, nil
+}
+
+// IncrByFloat adds delta to numeric value of the key, missing key is treated as zero.
+// Numeric strings stay strings
+func (s *kvStorage) IncrByFloat(key string, delta float64) (float64, error) {
+	if s.closed() {
+		panic("IncrByFloat over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.incrByFloatLocked(key, delta, time.Now())
+}
+
+// incrByFloatLocked must be called with mutex held
+func (s *kvStorage) incrByFloatLocked(key string, delta float64, now time.Time) (float64, error) {
+	var result float64
+	err := s.modify(key, now, func(value interface{}, exists bool) (interface{}, error) {
+		current := 0.0
+		if exists {
+			var ok bool
+			if current, ok = toFloat64(value); !ok {
+				return nil, ErrNotFloat
+			}
+		}
+
+		result = current + delta
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, ErrOverflow
+		}
+		if _, isString := value.(string); isString {
+			return strconv.FormatFloat(result, 'f', -1, 64), nil
+		}
+		return result, nil
+	})
+	if err == nil {
+		s.events.emit(EventsString, EventIncrByFloat, key)
+	}
+	return result, err
+}
+
+func (s *shardedStorage) IncrBy(key string, delta int64) (int64, error) {
+	return s.shards.shardOf(key).IncrBy(key, delta)
+}
+
+func (s *shardedStorage) IncrByFloat(key string, delta float64) (float64, error) {
+	return s.shards.shardOf(key).IncrByFloat(key, delta)
+}
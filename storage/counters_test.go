@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if res, err := data.IncrBy("missing", 5); err != nil || res != 5 {
+		t.Fatalf("Subtest 1: IncrBy missing key: expected 5, got %d, %v\n", res, err)
+	}
+
+	// values decoded from json are float64
+	data.Set("number", float64(10), zeroDuration)
+	if res, err := data.IncrBy("number", -3); err != nil || res != 7 {
+		t.Fatalf("Subtest 2: IncrBy number: expected 7, got %d, %v\n", res, err)
+	}
+
+	// numeric strings stay strings
+	data.Set("string", "41", zeroDuration)
+	if res, err := data.IncrBy("string", 1); err != nil || res != 42 {
+		t.Fatalf("Subtest 3: IncrBy numeric string: expected 42, got %d, %v\n", res, err)
+	}
+	if val, _ := data.Get("string"); val != "42" {
+		t.Fatalf("Subtest 3: Get string: expected %q, got %#v\n", "42", val)
+	}
+
+	for _, val := range []interface{}{"abc", 1.5, []interface{}{1}, "1e3"} {
+		data.Set("wrong", val, zeroDuration)
+		if _, err := data.IncrBy("wrong", 1); err != ErrNotInteger {
+			t.Fatalf("Subtest 4: IncrBy %#v: expected %v, got %v\n", val, ErrNotInteger, err)
+		}
+	}
+	if val, _ := data.Get("wrong"); val != "1e3" {
+		t.Fatalf("Subtest 4: failed IncrBy must not change value, got %#v\n", val)
+	}
+
+	data.Set("max", int64(math.MaxInt64), zeroDuration)
+	if _, err := data.IncrBy("max", 1); err != ErrOverflow {
+		t.Fatalf("Subtest 5: IncrBy over max int64: expected %v, got %v\n", ErrOverflow, err)
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if res, err := data.IncrByFloat("key", 0.5); err != nil || res != 0.5 {
+		t.Fatalf("Subtest 1: IncrByFloat missing key: expected 0.5, got %v, %v\n", res, err)
+	}
+	if res, _ := data.IncrByFloat("key", 2); res != 2.5 {
+		t.Fatalf("Subtest 2: IncrByFloat: expected 2.5, got %v\n", res)
+	}
+
+	data.Set("string", "10.5", zeroDuration)
+	data.IncrByFloat("string", 0.1)
+	if val, _ := data.Get("string"); val != "10.6" {
+		t.Fatalf("Subtest 3: Get string: expected %q, got %#v\n", "10.6", val)
+	}
+
+	data.Set("wrong", "NaN", zeroDuration)
+	if _, err := data.IncrByFloat("wrong", 1); err != ErrNotFloat {
+		t.Fatalf("Subtest 4: IncrByFloat NaN: expected %v, got %v\n", ErrNotFloat, err)
+	}
+	if _, err := data.IncrByFloat("key", math.Inf(1)); err != ErrOverflow {
+		t.Fatalf("Subtest 5: IncrByFloat to infinity: expected %v, got %v\n", ErrOverflow, err)
+	}
+}
+
+func TestIncrKeepsTTL(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("key", float64(1), time.Hour)
+	data.IncrBy("key", 1)
+	if ttl := data.TTL("key"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL after IncrBy: expected (0, 1h], got %v\n", ttl)
+	}
+
+	// expired counter starts from zero without ttl
+	data.Set("volatile", float64(10), defaultTTL)
+	time.Sleep(defaultSleep)
+	if res, _ := data.IncrBy("volatile", 1); res != 1 {
+		t.Fatalf("IncrBy expired key: expected 1, got %d\n", res)
+	}
+	if ttl := data.TTL("volatile"); ttl != TTLNoExpire {
+		t.Fatalf("TTL of recreated key: expected %v, got %v\n", TTLNoExpire, ttl)
+	}
+}
+
+func TestIncrConcurrent(t *testing.T) {
+	kWorkers, kIncrements := 8, 1000
+
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		wg := sync.WaitGroup{}
+		for i := 0; i < kWorkers; i += 1 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < kIncrements; j += 1 {
+					data.IncrBy("counter", 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if val, _ := data.Get("counter"); val != int64(kWorkers * kIncrements) {
+			t.Errorf("Get counter: expected %d, got %#v\n", kWorkers * kIncrements, val)
+		}
+		data.Close()
+	}
+}
+
+func TestIncrReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	data.IncrBy("int", 10)
+	data.IncrBy("int", -3)
+	data.IncrByFloat("float", 0.25)
+	data.Expire("int", time.Hour)
+	data.IncrBy("int", 1)
+	data.Close()
+
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	defer data.Close()
+	if val, _ := data.Get("int"); val != int64(8) {
+		t.Errorf("Get int: expected %d, got %#v\n", 8, val)
+	}
+	if val, _ := data.Get("float"); val != 0.25 {
+		t.Errorf("Get float: expected %v, got %#v\n", 0.25, val)
+	}
+	if ttl := data.TTL("int"); ttl <= 0 {
+		t.Errorf("TTL int: expected positive ttl after replay, got %v\n", ttl)
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"container/heap"
+	"time"
+)
+
+var (
+	// maximum number of keys reclaimed under one lock acquisition
+	deadlineBatch = 100
+	// how long deadlineChecker sleeps if there are no keys with ttl
+	deadlineIdle = time.Hour
+)
+
+type deadlineItem struct {
+	key string
+	deadline time.Time
+	// position in the heap, maintained by deadlineQueue
+	index int
+}
+
+// deadlineQueue implements heap.Interface
+type deadlineQueue []*deadlineItem
+
+func (q deadlineQueue) Len() int {
+	return len(q)
+}
+
+func (q deadlineQueue) Less(i, j int) bool {
+	return q[i].deadline.Before(q[j].deadline)
+}
+
+func (q deadlineQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *deadlineQueue) Push(x interface{}) {
+	item := x.(*deadlineItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *deadlineQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old) - 1]
+	old[len(old) - 1] = nil
+	*q = old[:len(old) - 1]
+	return item
+}
+
+// deadlineHeap is min-heap of keys with ttl ordered by expiration time
+type deadlineHeap struct {
+	queue deadlineQueue
+	items map[string]*deadlineItem
+}
+
+func newDeadlineHeap() *deadlineHeap {
+	return &deadlineHeap{
+		items: make(map[string]*deadlineItem, initialSize),
+	}
+}
+
+// set updates deadline of the key, zero deadline removes the key.
+// Returns true if the nearest deadline became earlier
+func (h *deadlineHeap) set(key string, deadline time.Time) bool {
+	item, exists := h.items[key]
+	if deadline.IsZero() {
+		if exists {
+			heap.Remove(&h.queue, item.index)
+			delete(h.items, key)
+		}
+		return false
+	}
+
+	if exists {
+		item.deadline = deadline
+		heap.Fix(&h.queue, item.index)
+	} else {
+		item = &deadlineItem{key: key, deadline: deadline}
+		heap.Push(&h.queue, item)
+		h.items[key] = item
+	}
+	return item.index == 0
+}
+
+// next returns the nearest deadline
+func (h *deadlineHeap) next() (time.Time, bool) {
+	if len(h.queue) == 0 {
+		return time.Time{}, false
+	}
+	return h.queue[0].deadline, true
+}
+
+// expireDue reclaims at most deadlineBatch keys which are due and returns true
+// if there are more of them. Touches only expired keys
+func (s *kvStorage) expireDue() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed() {
+		return false
+	}
+
+	now := time.Now()
+	for i := 0; i < deadlineBatch; i += 1 {
+		deadline, exists := s.deadlines.next()
+		if !exists || deadline.After(now) {
+			return false
+		}
+
+		key := s.deadlines.queue[0].key
+		s.reclaim(key)
+		s.expiredActive += 1
+	}
+	return true
+}
+
+func (s *kvStorage) nextDeadline() (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.deadlines.next()
+}
+
+// deadlineChecker sleeps until the nearest deadline, it is woken up
+// when key with earlier deadline is set
+func (s *kvStorage) deadlineChecker() {
+	timer := time.NewTimer(deadlineIdle)
+
+	for {
+		for s.expireDue() {
+		}
+
+		wait := deadlineIdle
+		if deadline, exists := s.nextDeadline(); exists {
+			wait = time.Until(deadline)
+		}
+		if !timer.Stop() {
+			select {
+			case <- timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <- timer.C:
+		case <- s.wakeup:
+		case _, ok := <- s.done:
+			if !ok {
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
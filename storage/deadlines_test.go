@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeadlineExpiration(t *testing.T) {
+	data := New(time.Hour, WithExpiration(ExpireByDeadline)).(*kvStorage)
+	defer data.Close()
+
+	kKeys := 300
+	for i := 0; i < kKeys; i += 1 {
+		data.Set("key" + strconv.Itoa(i), "val", defaultTTL)
+	}
+	data.Set("long", "val", time.Hour)
+	time.Sleep(10 * defaultSleep)
+
+	stats := data.Stats()
+	if stats.Keys != 1 || stats.ExpiredActive != int64(kKeys) {
+		t.Fatalf("Expected all expired keys to be reclaimed at deadline, stats: %+v\n", stats)
+	}
+}
+
+func TestDeadlineUpdates(t *testing.T) {
+	data := New(time.Hour, WithExpiration(ExpireByDeadline)).(*kvStorage)
+	defer data.Close()
+
+	// overwrite without ttl
+	data.Set("persisted", "val", defaultTTL)
+	data.Set("persisted", "val", zeroDuration)
+	// overwrite with earlier deadline wakes checker up
+	data.Set("shortened", "val", time.Hour)
+	data.Set("shortened", "val", defaultTTL)
+	// deleted before deadline
+	data.Set("deleted", "val", time.Hour)
+	data.Delete("deleted")
+	time.Sleep(10 * defaultSleep)
+
+	if _, exists := data.Get("persisted"); !exists {
+		t.Fatalf("Expected key overwritten without ttl to stay\n")
+	}
+	data.mutex.RLock()
+	_, shortened := data.data["shortened"]
+	kDeadlines := len(data.deadlines.items)
+	data.mutex.RUnlock()
+	if shortened {
+		t.Fatalf("Expected key with shortened ttl to be reclaimed\n")
+	}
+	if kDeadlines != 0 {
+		t.Fatalf("Expected no deadlines left, got %d\n", kDeadlines)
+	}
+}
+
+func TestDeadlineHeapOrder(t *testing.T) {
+	h := newDeadlineHeap()
+	now := time.Now()
+
+	for _, i := range []int{5, 3, 8, 1, 9, 2} {
+		h.set(strconv.Itoa(i), now.Add(time.Duration(i) * time.Second))
+	}
+	h.set("8", now)
+	h.set("1", time.Time{})
+
+	expected := []string{"8", "2", "3", "5", "9"}
+	for _, key := range expected {
+		if h.queue[0].key != key {
+			t.Fatalf("Expected %s to be the nearest deadline, got %s\n", key, h.queue[0].key)
+		}
+		h.set(key, time.Time{})
+	}
+	if _, exists := h.next(); exists {
+		t.Fatalf("Expected heap to be empty\n")
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrNotificationsDisabled = errors.New("keyspace notifications are disabled")
+
+// EventClass is a set of keyspace events delivered to subscribers,
+// classes are named by the same characters as in notify-keyspace-events of redis
+type EventClass uint
+
+const (
+	// "g": del, expire, persist. Hash, list, set or sorted set emptied by a command is deleted with del
+	EventsGeneric EventClass = 1 << iota
+	// "$": set, incrby, incrbyfloat, append, setrange
+	EventsString
+	// "x": expired
+	EventsExpired
+	// "e": evicted
+	EventsEvicted
+	// "l": lpush, rpush, lpop, rpop, ltrim
+	EventsList
+	// "s": sadd, srem, sinterstore, sunionstore, sdiffstore
+	EventsSet
+	// "h": hset, hdel, hincrby
+	EventsHash
+	// "z": zadd, zincr, zrem
+	EventsZSet
+
+	// "A": all of the above
+	EventsAll = EventsGeneric | EventsString | EventsExpired | EventsEvicted |
+		EventsList | EventsSet | EventsHash | EventsZSet
+)
+
+// names of events
+const (
+	EventSet = "set"
+	EventDel = "del"
+	EventExpired = "expired"
+	EventEvicted = "evicted"
+	EventExpire = "expire"
+	EventPersist = "persist"
+
+	EventIncrBy = "incrby"
+	EventIncrByFloat = "incrbyfloat"
+	EventAppend = "append"
+	EventSetRange = "setrange"
+
+	EventLPush = "lpush"
+	EventRPush = "rpush"
+	EventLPop = "lpop"
+	EventRPop = "rpop"
+	EventLTrim = "ltrim"
+
+	EventSAdd = "sadd"
+	EventSRem = "srem"
+	EventSInterStore = "sinterstore"
+	EventSUnionStore = "sunionstore"
+	EventSDiffStore = "sdiffstore"
+
+	EventHSet = "hset"
+	EventHDel = "hdel"
+	EventHIncrBy = "hincrby"
+
+	EventZAdd = "zadd"
+	EventZIncr = "zincr"
+	EventZRem = "zrem"
+)
+
+var eventClassChars = map[rune]EventClass{
+	'g': EventsGeneric,
+	'$': EventsString,
+	'x': EventsExpired,
+	'e': EventsEvicted,
+	'l': EventsList,
+	's': EventsSet,
+	'h': EventsHash,
+	'z': EventsZSet,
+	'A': EventsAll,
+}
+
+// ParseEventClasses parses classes written like notify-keyspace-events, e.g. "g$x".
+// Empty string disables notifications
+func ParseEventClasses(classes string) (EventClass, error) {
+	result := EventClass(0)
+	for _, c := range classes {
+		class, ok := eventClassChars[c]
+		if !ok {
+			return 0, fmt.Errorf("unknown class of keyspace events %q", c)
+		}
+		result |= class
+	}
+	return result, nil
+}
+
+func (c EventClass) String() string {
+	result := ""
+	for _, ch := range "g$lshzxe" {
+		if c & eventClassChars[ch] != 0 {
+			result += string(ch)
+		}
+	}
+	return result
+}
+
+// Event tells that key was changed
+type Event struct {
+	Type string
+	Key string
+}
+
+// eventsBuffer is the number of events waiting for slow subscriber,
+// subscription is closed when it's exceeded
+var eventsBuffer = 4096
+
+// eventBus delivers keyspace events to subscribers, it is shared by shards
+type eventBus struct {
+	classes EventClass
+
+	mutex sync.RWMutex
+	subs map[*EventSubscription]struct{}
+}
+
+func newEventBus(classes EventClass) *eventBus {
+	return &eventBus{
+		classes: classes,
+		subs: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// EventSubscription receives events of keys matching its pattern until it's closed
+// by Close or because of overflow, then its channel of events is closed
+type EventSubscription struct {
+	bus *eventBus
+	pattern *Pattern
+	events chan Event
+	closeOnce sync.Once
+}
+
+// Events returns channel of received events
+func (sub *EventSubscription) Events() <-chan Event {
+	return sub.events
+}
+
+func (sub *EventSubscription) Close() {
+	sub.closeOnce.Do(func() {
+		b := sub.bus
+		// events are sent with read lock held, so channel can't be closed during sending
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		delete(b.subs, sub)
+		close(sub.events)
+	})
+}
+
+func (b *eventBus) subscribe(pattern string) (*EventSubscription, error) {
+	if b.classes == 0 {
+		return nil, ErrNotificationsDisabled
+	}
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &EventSubscription{
+		bus: b,
+		pattern: p,
+		events: make(chan Event, eventsBuffer),
+	}
+	b.mutex.Lock()
+	b.subs[sub] = struct{}{}
+	b.mutex.Unlock()
+	return sub, nil
+}
+
+// closeAll closes all subscriptions, so subscribers see their channels closed when storage is closed
+func (b *eventBus) closeAll() {
+	b.mutex.RLock()
+	subs := make([]*EventSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// emit never blocks, so it can be called with mutex of the shard held
+func (b *eventBus) emit(class EventClass, event string, key string) {
+	if b.classes & class == 0 {
+		return
+	}
+
+	var overflowed []*EventSubscription
+	b.mutex.RLock()
+	for sub := range b.subs {
+		if !sub.pattern.Match(key) {
+			continue
+		}
+		select {
+		case sub.events <- Event{Type: event, Key: key}:
+		default:
+			overflowed = append(overflowed, sub)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range overflowed {
+		sub.Close()
+	}
+}
+
+// emitChange notifies about command which changed container at the key, then about deletion
+// of the key if the container became empty. Must be called with mutex held
+func (s *kvStorage) emitChange(class EventClass, event string, key string) {
+	s.events.emit(class, event, key)
+	if _, exists := s.data[key]; !exists {
+		s.events.emit(EventsGeneric, EventDel, key)
+	}
+}
+
+func (s *kvStorage) SubscribeEvents(pattern string) (*EventSubscription, error) {
+	if s.closed() {
+		panic("SubscribeEvents over closed storage")
+	}
+	return s.events.subscribe(pattern)
+}
+
+func (s *shardedStorage) SubscribeEvents(pattern string) (*EventSubscription, error) {
+	if s.closed() {
+		panic("SubscribeEvents over closed storage")
+	}
+	return s.shards[0].events.subscribe(pattern)
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseEventClasses(t *testing.T) {
+	cases := []struct{
+		classes string
+		expected EventClass
+	}{
+		{"", 0},
+		{"g$", EventsGeneric | EventsString},
+		{"xe", EventsExpired | EventsEvicted},
+		{"A", EventsAll},
+	}
+	for i, c := range cases {
+		if res, err := ParseEventClasses(c.classes); err != nil || res != c.expected {
+			t.Fatalf("Subtest %d: ParseEventClasses(%q): expected %v, got %v, %v\n", i + 1, c.classes, c.expected, res, err)
+		}
+	}
+	if _, err := ParseEventClasses("gK"); err == nil {
+		t.Fatalf("Subtest 5: ParseEventClasses with unknown class: expected error\n")
+	}
+	if res := EventsAll.String(); res != "g$lshzxe" {
+		t.Fatalf("Subtest 6: String: expected g$lshzxe, got %s\n", res)
+	}
+	if res, err := ParseEventClasses("lshz"); err != nil || res != EventsList | EventsSet | EventsHash | EventsZSet {
+		t.Fatalf("Subtest 7: ParseEventClasses(\"lshz\"): unexpected result %v, %v\n", res, err)
+	}
+}
+
+// expectEvents checks that exactly expected events are received
+func expectEvents(t *testing.T, subtest int, sub *EventSubscription, expected ...Event) {
+	for _, event := range expected {
+		select {
+		case res := <-sub.Events():
+			if res != event {
+				t.Fatalf("Subtest %d: expected event %v, got %v\n", subtest, event, res)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subtest %d: event %v wasn't received\n", subtest, event)
+		}
+	}
+	select {
+	case res := <-sub.Events():
+		t.Fatalf("Subtest %d: unexpected event %v\n", subtest, res)
+	default:
+	}
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	for _, data := range []Storage{New(time.Hour, WithNotifications(EventsAll)), New(time.Hour, WithNotifications(EventsAll), WithShards(4))} {
+		sub, err := data.SubscribeEvents("user:*")
+		if err != nil {
+			t.Fatalf("Subtest 1: SubscribeEvents: unexpected error %v\n", err)
+		}
+
+		data.Set("user:1", "a", zeroDuration)
+		data.Set("other", "b", zeroDuration)
+		data.MSet(KeyValue{Key: "user:2", Value: "c"})
+		expectEvents(t, 2, sub, Event{EventSet, "user:1"}, Event{EventSet, "user:2"})
+
+		data.Delete("user:1", "user:missing", "other")
+		data.GetDel("user:2")
+		expectEvents(t, 3, sub, Event{EventDel, "user:1"}, Event{EventDel, "user:2"})
+
+		data.Set("user:3", "a", 10 * time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		data.Get("user:3")
+		expectEvents(t, 4, sub, Event{EventSet, "user:3"}, Event{EventExpired, "user:3"})
+
+		sub.Close()
+		if _, ok := <-sub.Events(); ok {
+			t.Fatalf("Subtest 5: channel of events must be closed by Close\n")
+		}
+		data.Close()
+	}
+}
+
+func TestWriteEvents(t *testing.T) {
+	for _, data := range []Storage{New(time.Hour, WithNotifications(EventsAll)), New(time.Hour, WithNotifications(EventsAll), WithShards(4))} {
+		sub, _ := data.SubscribeEvents("*")
+
+		data.IncrBy("counter", 1)
+		data.Append("str", "abc")
+		data.SetRange("str", 1, "x")
+		data.Expire("str", time.Minute)
+		data.Persist("str")
+		expectEvents(t, 1, sub, Event{EventIncrBy, "counter"}, Event{EventAppend, "str"}, Event{EventSetRange, "str"},
+			Event{EventExpire, "str"}, Event{EventPersist, "str"})
+
+		data.HSet("hash", map[string]interface{}{"f": "v"})
+		data.HIncrBy("hash", "n", 1)
+		data.HDel("hash", "f", "n")
+		expectEvents(t, 2, sub, Event{EventHSet, "hash"}, Event{EventHIncrBy, "hash"}, Event{EventHDel, "hash"}, Event{EventDel, "hash"})
+
+		data.RPush("list", "a", "b", "c")
+		data.LPop("list")
+		data.LTrim("list", 0, 0)
+		data.BRPop(context.Background(), 0, "list")
+		data.LTrim("list", 1, 0)
+		expectEvents(t, 3, sub, Event{EventRPush, "list"}, Event{EventLPop, "list"}, Event{EventLTrim, "list"},
+			Event{EventRPop, "list"}, Event{EventDel, "list"})
+
+		data.SAdd("set", "a", "b")
+		data.SRem("set", "c")
+		data.SInterStore("inter", "set")
+		data.SRem("set", "a", "b")
+		data.SInterStore("inter", "set")
+		expectEvents(t, 4, sub, Event{EventSAdd, "set"}, Event{EventSInterStore, "inter"},
+			Event{EventSRem, "set"}, Event{EventDel, "set"}, Event{EventDel, "inter"})
+
+		data.ZAdd("zset", ZMember{Member: "a", Score: 1})
+		data.ZRem("zset", "a")
+		expectEvents(t, 5, sub, Event{EventZAdd, "zset"}, Event{EventZRem, "zset"}, Event{EventDel, "zset"})
+
+		data.Close()
+		if _, ok := <-sub.Events(); ok {
+			t.Fatalf("Subtest 6: channel of events must be closed by Close of storage\n")
+		}
+	}
+}
+
+func TestEvictionEvents(t *testing.T) {
+	data := New(0, WithMaxMemory(2 * entryOverhead, AllKeysLRU), WithNotifications(EventsEvicted))
+	defer data.Close()
+
+	sub, _ := data.SubscribeEvents("*")
+	defer sub.Close()
+	data.Set("key1", "val", zeroDuration)
+	data.Set("key2", "val", zeroDuration)
+	data.Set("key3", "val", zeroDuration)
+	select {
+	case res := <-sub.Events():
+		if res.Type != EventEvicted {
+			t.Fatalf("expected evicted event, got %v\n", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("evicted event wasn't received\n")
+	}
+}
+
+func TestEventsDisabled(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if _, err := data.SubscribeEvents("*"); err != ErrNotificationsDisabled {
+		t.Fatalf("Subtest 1: SubscribeEvents: expected %v, got %v\n", ErrNotificationsDisabled, err)
+	}
+
+	data = New(0, WithNotifications(EventsGeneric))
+	defer data.Close()
+	if _, err := data.SubscribeEvents("[abc"); err == nil {
+		t.Fatalf("Subtest 2: SubscribeEvents with malformed pattern: expected error\n")
+	}
+	sub, _ := data.SubscribeEvents("*")
+	data.Set("key", "val", zeroDuration)
+	data.Delete("key")
+	// set events are disabled
+	expectEvents(t, 3, sub, Event{EventDel, "key"})
+}
+
+func TestEventsOverflow(t *testing.T) {
+	data := New(0, WithNotifications(EventsString))
+	defer data.Close()
+
+	sub, _ := data.SubscribeEvents("*")
+	for i := 0; i <= eventsBuffer; i += 1 {
+		data.Set("key", i, zeroDuration)
+	}
+	received := 0
+	for range sub.Events() {
+		received += 1
+	}
+	if received != eventsBuffer {
+		t.Fatalf("slow subscriber: expected %d events before closing, got %d\n", eventsBuffer, received)
+	}
+}
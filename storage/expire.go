@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"time"
+)
+
+// ExpirationEngine tells how expired keys are reclaimed in background
+type ExpirationEngine int
+
+const (
+	// ExpireBySampling periodically checks random samples of keys with ttl
+	ExpireBySampling ExpirationEngine = iota
+	// ExpireByDeadline keeps keys with ttl ordered by expiration time and
+	// reclaims them exactly when they are due
+	ExpireByDeadline
+)
+
+var (
+	// number of keys with ttl checked at once by active expiration
+	expireSamplesPerLoop = 20
+	// sampling is repeated while more than this part of sample was expired
+	expireStaleRatio = 0.25
+	// part of resolution active expiration may spend in one cycle
+	expireCycleCPU = 0.25
+)
+
+func (s *kvStorage) startExpiration() {
+	if s.deadlines != nil {
+		go s.deadlineChecker()
+	} else {
+		go s.expirationChecker()
+	}
+}
+
+// activeExpireCycle reclaims expired keys without scanning all of them, the same
+// way redis does: it checks small random sample of keys with ttl and repeats while
+// a big part of the sample turns out expired and time limit is not exceeded.
+// Lock is released between samples so that other operations are not stalled
+func (s *kvStorage) activeExpireCycle() {
+	start := time.Now()
+	limit := time.Duration(float64(s.resolution) * expireCycleCPU)
+
+	for {
+		sampled, expired := s.expireSample()
+		if sampled == 0 || float64(expired) <= expireStaleRatio * float64(sampled) {
+			return
+		}
+		if time.Since(start) > limit {
+			return
+		}
+	}
+}
+
+// reclaim deletes expired key and logs the deletion like redis does, otherwise append-only file
+// replay would revive the stale value under the writes which follow. Must be called with mutex held
+func (s *kvStorage) reclaim(key string) {
+	s.unlink(key)
+	s.dirty += 1
+	s.logDel(key)
+	s.events.emit(EventsExpired, EventExpired, key)
+}
+
+// expireSample relies on randomized map iteration order to pick the sample
+func (s *kvStorage) expireSample() (sampled int, expired int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for key, expires := range s.expires {
+		if now.After(expires) {
+			s.reclaim(key)
+			expired += 1
+		}
+
+		sampled += 1
+		if sampled == expireSamplesPerLoop {
+			break
+		}
+	}
+
+	s.expiredActive += int64(expired)
+	return sampled, expired
+}
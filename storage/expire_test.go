@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestActiveExpirationSampling(t *testing.T) {
+	kKeys := 1000
+	data := New(10 * time.Millisecond).(*kvStorage)
+	defer data.Close()
+
+	for i := 0; i < kKeys; i += 1 {
+		data.Set("volatile" + strconv.Itoa(i), "val", defaultTTL)
+		data.Set("persistent" + strconv.Itoa(i), "val", zeroDuration)
+	}
+	data.Set("long", "val", time.Hour)
+	time.Sleep(20 * data.resolution)
+
+	stats := data.Stats()
+	// sampling stops when at most quarter of sample is expired
+	if stats.VolatileKeys > kKeys / 4 + expireSamplesPerLoop {
+		t.Fatalf("Expected most of expired keys to be reclaimed, %d keys with ttl left\n", stats.VolatileKeys)
+	}
+	if stats.ExpiredActive == 0 {
+		t.Fatalf("Expected keys to be reclaimed actively\n")
+	}
+	if stats.Keys - stats.VolatileKeys != kKeys {
+		t.Fatalf("Expected %d keys without ttl, got %d\n", kKeys, stats.Keys - stats.VolatileKeys)
+	}
+}
+
+func TestLazyExpirationStats(t *testing.T) {
+	data := New(time.Hour)
+	defer data.Close()
+
+	data.Set("key", "val", defaultTTL)
+	time.Sleep(defaultSleep)
+	data.Get("key")
+
+	for i := 0; i < 100; i += 1 {
+		if data.Stats().ExpiredLazy == 1 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected key to be reclaimed lazily, stats: %+v\n", data.Stats())
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+var ErrPattern = errors.New("invalid pattern")
+
+// glob patterns are the same as in redis KEYS:
+//   ? matches any character, * matches any sequence of characters,
+//   [abc], [a-z] match one of characters, [^abc] any character except them,
+//   \ makes next character (inside brackets too) match literally.
+// Characters are unicode code points, not bytes
+
+type tokenKind int
+
+const (
+	tokenLiteral tokenKind = iota
+	tokenAny
+	tokenStar
+	tokenClass
+)
+
+type runeRange struct {
+	lo, hi rune
+}
+
+type token struct {
+	kind tokenKind
+	// literal rune
+	r rune
+	// character class
+	ranges []runeRange
+	negate bool
+}
+
+func (t *token) matches(r rune) bool {
+	switch t.kind {
+	case tokenLiteral:
+		return t.r == r
+	case tokenClass:
+		in := false
+		for _, rr := range t.ranges {
+			if rr.lo <= r && r <= rr.hi {
+				in = true
+				break
+			}
+		}
+		return in != t.negate
+	}
+	return true
+}
+
+// Pattern is a compiled glob pattern, it is safe for concurrent use.
+// It is matched by bit-parallel simulation of automaton whose state i means that
+// the first i tokens match the read part of the string
+type Pattern struct {
+	source string
+	tokens []token
+	// pattern consists of stars only
+	matchAll bool
+
+	// number of uint64 words in a set of states
+	words int
+	// states after stars, they stay set on any character
+	afterStar []uint64
+	// states before stars, they set the next state without reading a character
+	beforeStar []uint64
+	// masks of states entered by the character: ascii ones are indexed by rune,
+	// other runes are split into ranges with equal masks starting at spanStarts
+	ascii []uint64
+	spanStarts []rune
+	spanMasks []uint64
+}
+
+// CompilePattern parses glob pattern, malformed pattern gives error wrapping ErrPattern
+func CompilePattern(pattern string) (*Pattern, error) {
+	p := &Pattern{
+		source: pattern,
+		tokens: make([]token, 0, len(pattern)),
+	}
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i += 1 {
+		t := token{kind: tokenLiteral, r: runes[i]}
+		switch runes[i] {
+		case '?':
+			t.kind = tokenAny
+		case '*':
+			// consecutive stars are the same as one
+			if n := len(p.tokens); n > 0 && p.tokens[n - 1].kind == tokenStar {
+				continue
+			}
+			t.kind = tokenStar
+		case '\\':
+			if i + 1 == len(runes) {
+				return nil, fmt.Errorf("%w %q: trailing backslash", ErrPattern, pattern)
+			}
+			i += 1
+			t.r = runes[i]
+		case '[':
+			end, err := parseClass(runes, i, &t)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q: %s", ErrPattern, pattern, err.Error())
+			}
+			i = end
+		}
+		p.tokens = append(p.tokens, t)
+	}
+	p.matchAll = len(p.tokens) == 1 && p.tokens[0].kind == tokenStar
+	p.compileStates()
+	return p, nil
+}
+
+// compileStates precomputes masks, so a character is matched against the whole pattern
+// in O(len(pattern) / 64) without looking at tokens
+func (p *Pattern) compileStates() {
+	p.words = (len(p.tokens) + 1 + 63) / 64
+	p.afterStar = make([]uint64, p.words)
+	p.beforeStar = make([]uint64, p.words)
+	for i, t := range p.tokens {
+		if t.kind == tokenStar {
+			setBit(p.beforeStar, i)
+			setBit(p.afterStar, i + 1)
+		}
+	}
+
+	p.ascii = make([]uint64, utf8.RuneSelf * p.words)
+	for r := rune(0); r < utf8.RuneSelf; r += 1 {
+		p.fillMask(p.ascii[int(r) * p.words:][:p.words], r)
+	}
+
+	// mask changes only at bounds of literals and ranges
+	bounds := map[rune]bool{utf8.RuneSelf: true}
+	addRange := func(lo, hi rune) {
+		if hi < utf8.RuneSelf {
+			return
+		}
+		if lo < utf8.RuneSelf {
+			lo = utf8.RuneSelf
+		}
+		bounds[lo] = true
+		bounds[hi + 1] = true
+	}
+	for _, t := range p.tokens {
+		switch t.kind {
+		case tokenLiteral:
+			addRange(t.r, t.r)
+		case tokenClass:
+			for _, rr := range t.ranges {
+				addRange(rr.lo, rr.hi)
+			}
+		}
+	}
+	for r := range bounds {
+		p.spanStarts = append(p.spanStarts, r)
+	}
+	sort.Slice(p.spanStarts, func(i, j int) bool { return p.spanStarts[i] < p.spanStarts[j] })
+	p.spanMasks = make([]uint64, len(p.spanStarts) * p.words)
+	for i, r := range p.spanStarts {
+		p.fillMask(p.spanMasks[i * p.words:][:p.words], r)
+	}
+}
+
+// fillMask sets states which are entered from the previous one by reading r
+func (p *Pattern) fillMask(mask []uint64, r rune) {
+	for i := range p.tokens {
+		if t := &p.tokens[i]; t.kind != tokenStar && t.matches(r) {
+			setBit(mask, i + 1)
+		}
+	}
+}
+
+func (p *Pattern) maskOf(r rune) []uint64 {
+	if r >= 0 && r < utf8.RuneSelf {
+		return p.ascii[int(r) * p.words:][:p.words]
+	}
+	i := sort.Search(len(p.spanStarts), func(i int) bool { return p.spanStarts[i] > r }) - 1
+	if i < 0 {
+		// invalid negative rune can't be decoded from string, but it matches only ? and *
+		i = 0
+	}
+	return p.spanMasks[i * p.words:][:p.words]
+}
+
+func setBit(set []uint64, i int) {
+	set[i / 64] |= 1 << (i % 64)
+}
+
+// parseClass fills t with character class starting at runes[start],
+// returns position of closing bracket
+func parseClass(runes []rune, start int, t *token) (int, error) {
+	t.kind = tokenClass
+	i := start + 1
+	if i < len(runes) && runes[i] == '^' {
+		t.negate = true
+		i += 1
+	}
+
+	// next returns character at i taking escaping into account
+	next := func() (rune, error) {
+		if runes[i] == '\\' {
+			i += 1
+			if i == len(runes) {
+				return 0, errors.New("trailing backslash")
+			}
+		}
+		r := runes[i]
+		i += 1
+		return r, nil
+	}
+
+	for i < len(runes) && runes[i] != ']' {
+		lo, err := next()
+		if err != nil {
+			return 0, err
+		}
+		hi := lo
+		// dash before closing bracket is literal
+		if i + 1 < len(runes) && runes[i] == '-' && runes[i + 1] != ']' {
+			i += 1
+			if hi, err = next(); err != nil {
+				return 0, err
+			}
+			// like redis, reversed range matches the same characters
+			if hi < lo {
+				lo, hi = hi, lo
+			}
+		}
+		t.ranges = append(t.ranges, runeRange{lo: lo, hi: hi})
+	}
+
+	if i >= len(runes) {
+		return 0, fmt.Errorf("missing closing ']' for '[' at %d", start)
+	}
+	if len(t.ranges) == 0 {
+		return 0, fmt.Errorf("empty character class at %d", start)
+	}
+	return i, nil
+}
+
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Match reports whether the whole str matches the pattern. All states are advanced by a character
+// at once, so the time is O(len(str) * (len(pattern) / 64 + 1)), linear in len(str) for patterns
+// up to 63 tokens. Ranges of non-ascii runes are found by binary search among bounds of the pattern
+func (p *Pattern) Match(str string) bool {
+	if p.matchAll {
+		return true
+	}
+
+	states := make([]uint64, 2 * p.words)
+	cur, next := states[:p.words], states[p.words:]
+	cur[0] = 1
+	p.closure(cur)
+	for _, r := range str {
+		mask := p.maskOf(r)
+		// shift by one state moves to the next token
+		var carry uint64
+		for w := range cur {
+			next[w] = (cur[w] << 1 | carry) & mask[w] | cur[w] & p.afterStar[w]
+			carry = cur[w] >> 63
+		}
+		p.closure(next)
+		cur, next = next, cur
+	}
+
+	last := len(p.tokens)
+	return cur[last / 64] & (1 << (last % 64)) != 0
+}
+
+// closure enters states after stars without reading a character. Consecutive stars are
+// compiled into one, so a single shift is enough
+func (p *Pattern) closure(set []uint64) {
+	var carry uint64
+	for w := range set {
+		skipped := set[w] & p.beforeStar[w]
+		set[w] |= skipped << 1 | carry
+		carry = skipped >> 63
+	}
+}
+
+// Match reports whether str matches glob pattern, malformed pattern matches nothing.
+// Use CompilePattern to match many strings against one pattern or to report errors
+func Match(str, pattern string) bool {
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return p.Match(str)
+}
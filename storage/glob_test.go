@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPatternMatch(t *testing.T) {
+	cases := []struct{
+		pattern string
+		str string
+		expected bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*", "a", true},
+		{"*a", "ba", true},
+		{"*a", "ab", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXcYb", false},
+		{"a**b", "ab", true},
+		{"?", "ы", true},
+		{"??", "ы", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[^a-c]llo", "hbllo", false},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[c-a]llo", "hdllo", false},
+		{"[-a]", "-", true},
+		{"[a-]", "-", true},
+		{`[\-]`, "-", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`[\]]`, "]", true},
+		{"[а-я]*", "ключ", true},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:name:x", false},
+		{"[^я]", "ы", true},
+		{"[^я]", "я", false},
+		{"ы*[я-ю]", "ыabю", true},
+		// states of patterns longer than 63 tokens take several words
+		{strings.Repeat("?", 70), strings.Repeat("a", 70), true},
+		{strings.Repeat("?", 70), strings.Repeat("a", 69), false},
+		{strings.Repeat("a", 63) + "*b", strings.Repeat("a", 63) + "xxb", true},
+		{strings.Repeat("a", 63) + "*b", strings.Repeat("a", 62) + "xxb", false},
+	}
+	for i, c := range cases {
+		p, err := CompilePattern(c.pattern)
+		if err != nil {
+			t.Fatalf("Subtest %d: CompilePattern %q: unexpected error %v\n", i + 1, c.pattern, err)
+		}
+		if res := p.Match(c.str); res != c.expected {
+			t.Fatalf("Subtest %d: %q matches %q: expected %v, got %v\n", i + 1, c.pattern, c.str, c.expected, res)
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	for _, pattern := range []string{"[abc", "[", "[^", "abc\\", "[a\\", "[]"} {
+		if _, err := CompilePattern(pattern); !errors.Is(err, ErrPattern) {
+			t.Fatalf("CompilePattern %q: expected %v, got %v\n", pattern, ErrPattern, err)
+		}
+		if Match("abc", pattern) {
+			t.Fatalf("Match %q: malformed pattern must match nothing\n", pattern)
+		}
+	}
+
+	data := New(0, WithShards(2))
+	defer data.Close()
+	if _, err := data.Keys("[abc"); !errors.Is(err, ErrPattern) {
+		t.Fatalf("Keys: expected %v, got %v\n", ErrPattern, err)
+	}
+	if _, _, err := data.Scan(0, ScanOptions{Match: "[abc"}); !errors.Is(err, ErrPattern) {
+		t.Fatalf("Scan: expected %v, got %v\n", ErrPattern, err)
+	}
+}
+
+func TestPatternManyStars(t *testing.T) {
+	p, _ := CompilePattern(strings.Repeat("a*", 30) + "b")
+	str := strings.Repeat("a", 10000)
+
+	start := time.Now()
+	if p.Match(str) {
+		t.Fatalf("Expected no match\n")
+	}
+	// recursive matching takes exponential time here
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Match took %v\n", elapsed)
+	}
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"time"
+)
+
+// Hash is a copy of hash value returned by Get, passing it to Set stores a hash
+type Hash map[string]interface{}
+
+// hashValue maps fields to plain values
+type hashValue struct {
+	fields map[string]interface{}
+	used int64
+}
+
+func newHashValue() *hashValue {
+	return &hashValue{
+		fields: make(map[string]interface{}),
+		used: 48,
+	}
+}
+
+func hashValueOf(h Hash) *hashValue {
+	result := newHashValue()
+	for field, value := range h {
+		result.set(field, value)
+	}
+	return result
+}
+
+func fieldSize(field string, value interface{}) int64 {
+	return 32 + int64(len(field)) + sizeOf(value)
+}
+
+// set returns true if field is new
+func (h *hashValue) set(field string, value interface{}) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.used -= fieldSize(field, old)
+	}
+	h.fields[field] = value
+	h.used += fieldSize(field, value)
+	return !exists
+}
+
+func (h *hashValue) del(field string) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.used -= fieldSize(field, old)
+		delete(h.fields, field)
+	}
+	return exists
+}
+
+func (h *hashValue) typeName() string {
+	return "hash"
+}
+
+func (h *hashValue) export() interface{} {
+	result := make(Hash, len(h.fields))
+	for field, value := range h.fields {
+		result[field] = value
+	}
+	return result
+}
+
+func (h *hashValue) size() int64 {
+	return h.used
+}
+
+func (h *hashValue) len() int {
+	return len(h.fields)
+}
+
+// hashAt returns hash stored at the key, missing key gives nil hash unless create is set.
+// Zero now disables expiration check. Must be called with mutex held
+func (s *kvStorage) hashAt(key string, now time.Time, create bool) (*hashValue, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		if !create {
+			return nil, nil, nil
+		}
+		e = s.create(key, newHashValue())
+	}
+
+	h, ok := e.value.(*hashValue)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	return h, e, nil
+}
+
+// hset and hdel are shared by commands and append-only file replay, must be called with mutex held
+
+func (s *kvStorage) hset(key string, fields map[string]interface{}, now time.Time) (int, error) {
+	h, e, err := s.hashAt(key, now, true)
+	if err != nil {
+		return 0, err
+	}
+
+	kAdded := 0
+	for field, value := range fields {
+		if h.set(field, value) {
+			kAdded += 1
+		}
+	}
+	s.resize(key, e)
+	return kAdded, nil
+}
+
+func (s *kvStorage) hdel(key string, fields []string, now time.Time) (int, error) {
+	h, e, err := s.hashAt(key, now, false)
+	if h == nil {
+		return 0, err
+	}
+
+	kDeleted := 0
+	for _, field := range fields {
+		if h.del(field) {
+			kDeleted += 1
+		}
+	}
+	if kDeleted > 0 {
+		s.resize(key, e)
+	}
+	return kDeleted, nil
+}
+
+// HSet sets fields of the hash creating it if needed, returns number of added fields
+func (s *kvStorage) HSet(key string, fields map[string]interface{}) (int, error) {
+	if s.closed() {
+		panic("HSet over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hsetLocked(key, fields, time.Now())
+}
+
+// hsetLocked must be called with mutex held
+func (s *kvStorage) hsetLocked(key string, fields map[string]interface{}, now time.Time) (int, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	kAdded, err := s.hset(key, fields, now)
+	if err != nil {
+		return 0, err
+	}
+	s.dirty += 1
+	s.logHSet(key, fields)
+	s.events.emit(EventsHash, EventHSet, key)
+	return kAdded, nil
+}
+
+func (s *kvStorage) HGet(key string, field string) (interface{}, bool, error) {
+	if s.closed() {
+		panic("HGet over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.hgetLocked(key, field, time.Now())
+}
+
+// hgetLocked must be called with mutex held
+func (s *kvStorage) hgetLocked(key string, field string, now time.Time) (interface{}, bool, error) {
+	h, e, err := s.hashAt(key, now, false)
+	if h == nil {
+		return nil, false, err
+	}
+	s.touch(e, now)
+	value, exists := h.fields[field]
+	return value, exists, nil
+}
+
+// HDel returns number of deleted fields, hash without fields is deleted
+func (s *kvStorage) HDel(key string, fields ...string) (int, error) {
+	if s.closed() {
+		panic("HDel over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hdelLocked(key, fields, time.Now())
+}
+
+// hdelLocked must be called with mutex held
+func (s *kvStorage) hdelLocked(key string, fields []string, now time.Time) (int, error) {
+	kDeleted, err := s.hdel(key, fields, now)
+	if kDeleted > 0 {
+		s.dirty += 1
+		s.logHDel(key, fields)
+		s.emitChange(EventsHash, EventHDel, key)
+	}
+	return kDeleted, err
+}
+
+// HGetAll returns copy of the hash, empty for missing key
+func (s *kvStorage) HGetAll(key string) (map[string]interface{}, error) {
+	if s.closed() {
+		panic("HGetAll over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	h, e, err := s.hashAt(key, now, false)
+	if h == nil {
+		return map[string]interface{}{}, err
+	}
+	s.touch(e, now)
+	return h.export().(Hash), nil
+}
+
+// HIncrBy adds delta to integer value of the field, missing field is treated as zero
+func (s *kvStorage) HIncrBy(key string, field string, delta int64) (int64, error) {
+	if s.closed() {
+		panic("HIncrBy over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hincrByLocked(key, field, delta, time.Now())
+}
+
+// hincrByLocked must be called with mutex held
+func (s *kvStorage) hincrByLocked(key string, field string, delta int64, now time.Time) (int64, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	h, _, err := s.hashAt(key, now, false)
+	if err != nil {
+		return 0, err
+	}
+	var current interface{}
+	exists := false
+	if h != nil {
+		current, exists = h.fields[field]
+	}
+	updated, result, err := addInt(current, exists, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := map[string]interface{}{field: updated}
+	s.hset(key, fields, now)
+	s.dirty += 1
+	s.logHSet(key, fields)
+	s.events.emit(EventsHash, EventHIncrBy, key)
+	return result, nil
+}
+
+func (s *kvStorage) HKeys(key string) ([]string, error) {
+	if s.closed() {
+		panic("HKeys over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	h, e, err := s.hashAt(key, now, false)
+	if h == nil {
+		return []string{}, err
+	}
+	s.touch(e, now)
+	result := make([]string, 0, len(h.fields))
+	for field := range h.fields {
+		result = append(result, field)
+	}
+	return result, nil
+}
+
+func (s *kvStorage) HLen(key string) (int, error) {
+	if s.closed() {
+		panic("HLen over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	h, _, err := s.hashAt(key, time.Now(), false)
+	if h == nil {
+		return 0, err
+	}
+	return h.len(), nil
+}
+
+func (s *shardedStorage) HSet(key string, fields map[string]interface{}) (int, error) {
+	return s.shards.shardOf(key).HSet(key, fields)
+}
+
+func (s *shardedStorage) HGet(key string, field string) (interface{}, bool, error) {
+	return s.shards.shardOf(key).HGet(key, field)
+}
+
+func (s *shardedStorage) HDel(key string, fields ...string) (int, error) {
+	return s.shards.shardOf(key).HDel(key, fields...)
+}
+
+func (s *shardedStorage) HGetAll(key string) (map[string]interface{}, error) {
+	return s.shards.shardOf(key).HGetAll(key)
+}
+
+func (s *shardedStorage) HIncrBy(key string, field string, delta int64) (int64, error) {
+	return s.shards.shardOf(key).HIncrBy(key, field, delta)
+}
+
+func (s *shardedStorage) HKeys(key string) ([]string, error) {
+	return s.shards.shardOf(key).HKeys(key)
+}
+
+func (s *shardedStorage) HLen(key string) (int, error) {
+	return s.shards.shardOf(key).HLen(key)
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHashCommands(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	kAdded, err := data.HSet("user", map[string]interface{}{"name": "Bob", "age": float64(30)})
+	if err != nil || kAdded != 2 {
+		t.Fatalf("Subtest 1: HSet: expected 2 added fields, got %d, %v\n", kAdded, err)
+	}
+	if kAdded, _ = data.HSet("user", map[string]interface{}{"name": "Alice", "city": "Paris"}); kAdded != 1 {
+		t.Fatalf("Subtest 1: HSet existing hash: expected 1 added field, got %d\n", kAdded)
+	}
+
+	if val, exists, _ := data.HGet("user", "name"); !exists || val != "Alice" {
+		t.Fatalf("Subtest 2: HGet name: expected %s, got %v\n", "Alice", val)
+	}
+	if _, exists, _ := data.HGet("user", "missing"); exists {
+		t.Fatalf("Subtest 2: HGet missing field: expected nothing\n")
+	}
+	if n, _ := data.HLen("user"); n != 3 {
+		t.Fatalf("Subtest 2: HLen: expected 3, got %d\n", n)
+	}
+	fields, _ := data.HKeys("user")
+	sort.Strings(fields)
+	if len(fields) != 3 || fields[0] != "age" || fields[1] != "city" || fields[2] != "name" {
+		t.Fatalf("Subtest 2: HKeys: expected [age city name], got %v\n", fields)
+	}
+
+	if res, err := data.HIncrBy("user", "age", 1); err != nil || res != 31 {
+		t.Fatalf("Subtest 3: HIncrBy: expected 31, got %d, %v\n", res, err)
+	}
+	if _, err := data.HIncrBy("user", "name", 1); err != ErrNotInteger {
+		t.Fatalf("Subtest 3: HIncrBy of string field: expected %v, got %v\n", ErrNotInteger, err)
+	}
+
+	all, _ := data.HGetAll("user")
+	if len(all) != 3 || all["age"] != int64(31) || all["city"] != "Paris" {
+		t.Fatalf("Subtest 4: HGetAll: unexpected result %v\n", all)
+	}
+	// result is a copy
+	all["name"] = "Eve"
+	if val, _, _ := data.HGet("user", "name"); val != "Alice" {
+		t.Fatalf("Subtest 4: HGetAll result must not share hash, got %v\n", val)
+	}
+
+	if kDeleted, _ := data.HDel("user", "name", "missing"); kDeleted != 1 {
+		t.Fatalf("Subtest 5: HDel: expected 1 deleted field, got %d\n", kDeleted)
+	}
+	data.HDel("user", "age", "city")
+	if typ := data.Type("user"); typ != "none" {
+		t.Fatalf("Subtest 5: hash without fields must be deleted, got type %s\n", typ)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("string", "val", zeroDuration)
+	data.HSet("hash", map[string]interface{}{"field": "val"})
+
+	if _, err := data.HSet("string", map[string]interface{}{"field": "val"}); err != ErrWrongType {
+		t.Fatalf("HSet over string: expected %v, got %v\n", ErrWrongType, err)
+	}
+	if _, _, err := data.HGet("string", "field"); err != ErrWrongType {
+		t.Fatalf("HGet of string: expected %v, got %v\n", ErrWrongType, err)
+	}
+	if _, err := data.IncrBy("hash", 1); err != ErrWrongType {
+		t.Fatalf("IncrBy of hash: expected %v, got %v\n", ErrWrongType, err)
+	}
+
+	val, exists := data.Get("hash")
+	if !exists || TypeOf(val) != "hash" || TypeOf("val") != "string" {
+		t.Fatalf("Get hash: expected value of type hash, got %#v\n", val)
+	}
+	if typ := data.Type("hash"); typ != "hash" {
+		t.Fatalf("Type hash: expected hash, got %s\n", typ)
+	}
+
+	// Set overwrites value of any type
+	data.Set("hash", "val", zeroDuration)
+	if typ := data.Type("hash"); typ != "string" {
+		t.Fatalf("Type after Set: expected string, got %s\n", typ)
+	}
+}
+
+func TestHashMemoryAccounting(t *testing.T) {
+	data := New(0).(*kvStorage)
+	defer data.Close()
+
+	data.HSet("hash", map[string]interface{}{"f1": "val"})
+	small := data.used
+	data.HSet("hash", map[string]interface{}{"f2": "long value of the field"})
+	if data.used <= small {
+		t.Fatalf("Expected memory usage to grow with hash, got %d after %d\n", data.used, small)
+	}
+	data.HDel("hash", "f2")
+	if data.used != small {
+		t.Fatalf("Expected memory usage %d after field deletion, got %d\n", small, data.used)
+	}
+	data.Delete("hash")
+	if data.used != 0 {
+		t.Fatalf("Expected zero memory usage after deletion, got %d\n", data.used)
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	dir := t.TempDir()
+	aof := filepath.Join(dir, "appendonly.taof")
+	snapshot := filepath.Join(dir, "dump.trdb")
+
+	data := New(0, WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0))
+	data.HSet("hash", map[string]interface{}{"f1": "v1", "f2": "v2", "n": float64(1)})
+	data.HDel("hash", "f2")
+	data.HIncrBy("hash", "n", 2)
+	// recreated after expiration, replay must not revive old fields
+	data.HSet("volatile", map[string]interface{}{"old": "val"})
+	data.Expire("volatile", defaultTTL)
+	time.Sleep(defaultSleep)
+	data.HSet("volatile", map[string]interface{}{"new": "val"})
+	data.Save()
+	data.Close()
+
+	for _, opt := range []Option{WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0)} {
+		data = New(0, opt)
+		all, _ := data.HGetAll("hash")
+		if len(all) != 2 || all["f1"] != "v1" || all["n"] != int64(3) {
+			t.Errorf("HGetAll hash after restart: unexpected result %v\n", all)
+		}
+		if all, _ := data.HGetAll("volatile"); len(all) != 1 || all["new"] != "val" {
+			t.Errorf("HGetAll volatile after restart: unexpected result %v\n", all)
+		}
+		if ttl := data.TTL("volatile"); ttl != TTLNoExpire {
+			t.Errorf("TTL volatile after restart: expected %v, got %v\n", TTLNoExpire, ttl)
+		}
+		data.Close()
+	}
+}
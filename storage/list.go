@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"time"
+)
+
+// List is a copy of list value returned by Get, passing it to Set stores a list
+type List []interface{}
+
+// listValue is a deque of plain values kept in a ring buffer
+type listValue struct {
+	items []interface{}
+	head int
+	n int
+	used int64
+}
+
+func newListValue() *listValue {
+	return &listValue{
+		used: 24,
+	}
+}
+
+func listValueOf(l List) *listValue {
+	result := newListValue()
+	for _, value := range l {
+		result.pushRight(value)
+	}
+	return result
+}
+
+func itemSize(value interface{}) int64 {
+	return 16 + sizeOf(value)
+}
+
+// at returns i-th item counting from the head
+func (l *listValue) at(i int) interface{} {
+	return l.items[(l.head + i) % len(l.items)]
+}
+
+func (l *listValue) grow() {
+	if l.n < len(l.items) {
+		return
+	}
+	items := make([]interface{}, 2 * len(l.items) + 4)
+	for i := 0; i < l.n; i += 1 {
+		items[i] = l.at(i)
+	}
+	l.items = items
+	l.head = 0
+}
+
+func (l *listValue) pushLeft(value interface{}) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.items)) % len(l.items)
+	l.items[l.head] = value
+	l.n += 1
+	l.used += itemSize(value)
+}
+
+func (l *listValue) pushRight(value interface{}) {
+	l.grow()
+	l.items[(l.head + l.n) % len(l.items)] = value
+	l.n += 1
+	l.used += itemSize(value)
+}
+
+// popLeft and popRight must not be called on empty list
+func (l *listValue) popLeft() interface{} {
+	value := l.items[l.head]
+	l.items[l.head] = nil
+	l.head = (l.head + 1) % len(l.items)
+	l.n -= 1
+	l.used -= itemSize(value)
+	return value
+}
+
+func (l *listValue) popRight() interface{} {
+	i := (l.head + l.n - 1) % len(l.items)
+	value := l.items[i]
+	l.items[i] = nil
+	l.n -= 1
+	l.used -= itemSize(value)
+	return value
+}
+
+func (l *listValue) typeName() string {
+	return "list"
+}
+
+func (l *listValue) export() interface{} {
+	result := make(List, l.n)
+	for i := range result {
+		result[i] = l.at(i)
+	}
+	return result
+}
+
+func (l *listValue) size() int64 {
+	return l.used
+}
+
+func (l *listValue) len() int {
+	return l.n
+}
+
+// normalizeRange converts inclusive range with negative indices counted from the end,
+// like in redis, to indices within [0, n). Returns false if range is empty
+func normalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// listAt returns list stored at the key, missing key gives nil list unless create is set.
+// Zero now disables expiration check. Must be called with mutex held
+func (s *kvStorage) listAt(key string, now time.Time, create bool) (*listValue, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		if !create {
+			return nil, nil, nil
+		}
+		e = s.create(key, newListValue())
+	}
+
+	l, ok := e.value.(*listValue)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	return l, e, nil
+}
+
+// push, pop and ltrim are shared by commands and append-only file replay, must be called with mutex held
+
+func (s *kvStorage) push(key string, left bool, values []interface{}, now time.Time) (int, error) {
+	l, e, err := s.listAt(key, now, true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		if left {
+			l.pushLeft(value)
+		} else {
+			l.pushRight(value)
+		}
+	}
+	n := l.len()
+	s.resize(key, e)
+	return n, nil
+}
+
+func (s *kvStorage) pop(key string, left bool, now time.Time) (interface{}, bool, error) {
+	l, e, err := s.listAt(key, now, false)
+	if l == nil {
+		return nil, false, err
+	}
+
+	var value interface{}
+	if left {
+		value = l.popLeft()
+	} else {
+		value = l.popRight()
+	}
+	s.resize(key, e)
+	return value, true, nil
+}
+
+func (s *kvStorage) ltrim(key string, start, stop int, now time.Time) error {
+	l, e, err := s.listAt(key, now, false)
+	if l == nil {
+		return err
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.len())
+	if !ok {
+		start, stop = l.len(), l.len() - 1
+	}
+	for i := 0; i < start; i += 1 {
+		l.popLeft()
+	}
+	for i := l.len() - 1; i > stop - start; i -= 1 {
+		l.popRight()
+	}
+	s.resize(key, e)
+	return nil
+}
+
+func pushEvent(left bool) string {
+	if left {
+		return EventLPush
+	}
+	return EventRPush
+}
+
+func popEvent(left bool) string {
+	if left {
+		return EventLPop
+	}
+	return EventRPop
+}
+
+// pushCommand implements LPUSH and RPUSH, returns length of the list after push
+func (s *kvStorage) pushCommand(key string, left bool, values []interface{}) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.pushLocked(key, left, values, time.Now())
+}
+
+// pushLocked must be called with mutex held
+func (s *kvStorage) pushLocked(key string, left bool, values []interface{}, now time.Time) (int, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	n, err := s.push(key, left, values, now)
+	if err != nil {
+		return 0, err
+	}
+	s.dirty += 1
+	s.logPush(key, left, values)
+	s.events.emit(EventsList, pushEvent(left), key)
+
+	s.serveBlocked(key, now)
+	return n, nil
+}
+
+// popCommand implements LPOP and RPOP
+func (s *kvStorage) popCommand(key string, left bool) (interface{}, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.popLocked(key, left, time.Now())
+}
+
+// popLocked must be called with mutex held
+func (s *kvStorage) popLocked(key string, left bool, now time.Time) (interface{}, bool, error) {
+	value, exists, err := s.pop(key, left, now)
+	if exists {
+		s.dirty += 1
+		s.logPop(key, left)
+		s.emitChange(EventsList, popEvent(left), key)
+	}
+	return value, exists, err
+}
+
+func (s *kvStorage) LPush(key string, values ...interface{}) (int, error) {
+	if s.closed() {
+		panic("LPush over closed storage")
+	}
+	return s.pushCommand(key, true, values)
+}
+
+func (s *kvStorage) RPush(key string, values ...interface{}) (int, error) {
+	if s.closed() {
+		panic("RPush over closed storage")
+	}
+	return s.pushCommand(key, false, values)
+}
+
+func (s *kvStorage) LPop(key string) (interface{}, bool, error) {
+	if s.closed() {
+		panic("LPop over closed storage")
+	}
+	return s.popCommand(key, true)
+}
+
+func (s *kvStorage) RPop(key string) (interface{}, bool, error) {
+	if s.closed() {
+		panic("RPop over closed storage")
+	}
+	return s.popCommand(key, false)
+}
+
+// LRange returns items between start and stop inclusive, negative indices count from the end
+func (s *kvStorage) LRange(key string, start, stop int) ([]interface{}, error) {
+	if s.closed() {
+		panic("LRange over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	l, e, err := s.listAt(key, now, false)
+	if l == nil {
+		return []interface{}{}, err
+	}
+	s.touch(e, now)
+
+	start, stop, ok := normalizeRange(start, stop, l.len())
+	if !ok {
+		return []interface{}{}, nil
+	}
+	result := make([]interface{}, 0, stop - start + 1)
+	for i := start; i <= stop; i += 1 {
+		result = append(result, l.at(i))
+	}
+	return result, nil
+}
+
+// LTrim leaves only items between start and stop inclusive, list without items is deleted
+func (s *kvStorage) LTrim(key string, start, stop int) error {
+	if s.closed() {
+		panic("LTrim over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	_, existed := s.lookup(key, now)
+	if err := s.ltrim(key, start, stop, now); err != nil || !existed {
+		// nothing is written to missing key
+		return err
+	}
+	s.dirty += 1
+	s.logLTrim(key, start, stop)
+	s.emitChange(EventsList, EventLTrim, key)
+	return nil
+}
+
+func (s *kvStorage) LLen(key string) (int, error) {
+	if s.closed() {
+		panic("LLen over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	l, _, err := s.listAt(key, time.Now(), false)
+	if l == nil {
+		return 0, err
+	}
+	return l.len(), nil
+}
+
+func (s *shardedStorage) LPush(key string, values ...interface{}) (int, error) {
+	return s.shards.shardOf(key).LPush(key, values...)
+}
+
+func (s *shardedStorage) RPush(key string, values ...interface{}) (int, error) {
+	return s.shards.shardOf(key).RPush(key, values...)
+}
+
+func (s *shardedStorage) LPop(key string) (interface{}, bool, error) {
+	return s.shards.shardOf(key).LPop(key)
+}
+
+func (s *shardedStorage) RPop(key string) (interface{}, bool, error) {
+	return s.shards.shardOf(key).RPop(key)
+}
+
+func (s *shardedStorage) LRange(key string, start, stop int) ([]interface{}, error) {
+	return s.shards.shardOf(key).LRange(key, start, stop)
+}
+
+func (s *shardedStorage) LTrim(key string, start, stop int) error {
+	return s.shards.shardOf(key).LTrim(key, start, stop)
+}
+
+func (s *shardedStorage) LLen(key string) (int, error) {
+	return s.shards.shardOf(key).LLen(key)
+}
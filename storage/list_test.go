@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListCommands(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if n, err := data.RPush("list", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("Subtest 1: RPush: expected length 2, got %d, %v\n", n, err)
+	}
+	// items are pushed one by one, so they appear in reverse order
+	if n, _ := data.LPush("list", "a", "0"); n != 4 {
+		t.Fatalf("Subtest 1: LPush: expected length 4, got %d\n", n)
+	}
+	items, _ := data.LRange("list", 0, -1)
+	if !reflect.DeepEqual(items, []interface{}{"0", "a", "b", "c"}) {
+		t.Fatalf("Subtest 1: LRange: expected [0 a b c], got %v\n", items)
+	}
+
+	cases := []struct{ start, stop int; expected []interface{} }{
+		{1, 2, []interface{}{"a", "b"}},
+		{-2, -1, []interface{}{"b", "c"}},
+		{-100, 0, []interface{}{"0"}},
+		{2, 100, []interface{}{"b", "c"}},
+		{3, 1, []interface{}{}},
+		{5, 10, []interface{}{}},
+	}
+	for _, c := range cases {
+		if items, _ := data.LRange("list", c.start, c.stop); !reflect.DeepEqual(items, c.expected) {
+			t.Errorf("Subtest 2: LRange %d %d: expected %v, got %v\n", c.start, c.stop, c.expected, items)
+		}
+	}
+
+	if val, exists, _ := data.LPop("list"); !exists || val != "0" {
+		t.Fatalf("Subtest 3: LPop: expected %s, got %v\n", "0", val)
+	}
+	if val, exists, _ := data.RPop("list"); !exists || val != "c" {
+		t.Fatalf("Subtest 3: RPop: expected %s, got %v\n", "c", val)
+	}
+	if n, _ := data.LLen("list"); n != 2 {
+		t.Fatalf("Subtest 3: LLen: expected 2, got %d\n", n)
+	}
+
+	data.RPush("list", "c", "d", "e")
+	data.LTrim("list", 1, -2)
+	if items, _ := data.LRange("list", 0, -1); !reflect.DeepEqual(items, []interface{}{"b", "c", "d"}) {
+		t.Fatalf("Subtest 4: LRange after LTrim: expected [b c d], got %v\n", items)
+	}
+	data.LTrim("list", 5, 10)
+	if typ := data.Type("list"); typ != "none" {
+		t.Fatalf("Subtest 4: list without items must be deleted, got type %s\n", typ)
+	}
+	dirty := data.(*kvStorage).dirty
+	if err := data.LTrim("list", 0, 1); err != nil || data.(*kvStorage).dirty != dirty {
+		t.Fatalf("Subtest 4: LTrim of missing key must not be a write, got %v\n", err)
+	}
+
+	data.Set("string", "val", zeroDuration)
+	if _, err := data.LPush("string", "val"); err != ErrWrongType {
+		t.Fatalf("Subtest 5: LPush over string: expected %v, got %v\n", ErrWrongType, err)
+	}
+}
+
+func TestListRingBuffer(t *testing.T) {
+	l := newListValue()
+	expected := []interface{}{}
+	// mix pushes and pops on both ends so that buffer wraps around and grows
+	for i := 0; i < 100; i += 1 {
+		if i % 3 == 0 {
+			l.pushLeft(i)
+			expected = append([]interface{}{i}, expected...)
+		} else {
+			l.pushRight(i)
+			expected = append(expected, i)
+		}
+		if i % 5 == 0 {
+			l.popLeft()
+			expected = expected[1:]
+		}
+	}
+	if result := l.export(); !reflect.DeepEqual(result, List(expected)) {
+		t.Fatalf("Expected %v, got %v\n", expected, result)
+	}
+}
+
+func TestBLPopImmediate(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.RPush("second", "val")
+	key, val, ok, err := data.BLPop(context.Background(), time.Second, "first", "second")
+	if err != nil || !ok || key != "second" || val != "val" {
+		t.Fatalf("BLPop: expected second/val, got %s/%v, %v, %v\n", key, val, ok, err)
+	}
+
+	start := time.Now()
+	if _, _, ok, err := data.BRPop(context.Background(), 50 * time.Millisecond, "first"); ok || err != nil {
+		t.Fatalf("BRPop of empty list: expected timeout, got %v, %v\n", ok, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50 * time.Millisecond {
+		t.Fatalf("BRPop returned before timeout, after %v\n", elapsed)
+	}
+}
+
+func TestBLPopFIFO(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		kWaiters := 5
+		results := make(chan string, kWaiters)
+		for i := 0; i < kWaiters; i += 1 {
+			i := i
+			go func() {
+				_, val, _, _ := data.BLPop(context.Background(), 0, "other", "queue")
+				results <- fmt.Sprintf("%d:%v", i, val)
+			}()
+			// waiters must block in order
+			for {
+				time.Sleep(time.Millisecond)
+				if blockedOn(data, "queue") == i + 1 {
+					break
+				}
+			}
+		}
+
+		for i := 0; i < kWaiters; i += 1 {
+			data.RPush("queue", i)
+			if res, expected := <-results, fmt.Sprintf("%d:%d", i, i); res != expected {
+				t.Fatalf("Expected waiters to be served in FIFO order, expected %s, got %s\n", expected, res)
+			}
+		}
+		if n, _ := data.LLen("queue"); n != 0 {
+			t.Fatalf("Expected all items to be handed to waiters, %d left\n", n)
+		}
+		if blockedOn(data, "other") != 0 {
+			t.Fatalf("Expected served waiters to leave all queues\n")
+		}
+		data.Close()
+	}
+}
+
+func blockedOn(data Storage, key string) int {
+	var shard *kvStorage
+	switch s := data.(type) {
+	case *kvStorage:
+		shard = s
+	case *shardedStorage:
+		shard = s.shards.shardOf(key)
+	}
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	return len(shard.blocked[key])
+}
+
+func TestBLPopRelease(t *testing.T) {
+	data := New(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, _, _, err := data.BLPop(ctx, 0, "queue")
+		errs <- err
+	}()
+	go func() {
+		_, _, _, err := data.BRPop(context.Background(), 0, "queue")
+		errs <- err
+	}()
+
+	for blockedOn(data, "queue") != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("BLPop with cancelled context: expected %v, got %v\n", context.Canceled, err)
+	}
+	data.Close()
+	if err := <-errs; err != ErrClosed {
+		t.Fatalf("BRPop after Close: expected %v, got %v\n", ErrClosed, err)
+	}
+}
+
+func TestListPersistence(t *testing.T) {
+	dir := t.TempDir()
+	aof := filepath.Join(dir, "appendonly.taof")
+	snapshot := filepath.Join(dir, "dump.trdb")
+
+	data := New(0, WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0))
+	data.RPush("list", "a", "b", "c", "d", "e")
+	data.LPush("list", "z")
+	data.LPop("list")
+	data.RPop("list")
+	data.LTrim("list", 1, -1)
+	// item handed to blocked client must be logged as popped
+	done := make(chan struct{})
+	go func() {
+		data.BLPop(context.Background(), 0, "queue")
+		close(done)
+	}()
+	for blockedOn(data, "queue") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	data.RPush("queue", "item")
+	<-done
+	data.Save()
+	data.Close()
+
+	for _, opt := range []Option{WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0)} {
+		data = New(0, opt)
+		if items, _ := data.LRange("list", 0, -1); !reflect.DeepEqual(items, []interface{}{"b", "c", "d"}) {
+			t.Errorf("LRange after restart: expected [b c d], got %v\n", items)
+		}
+		if typ := data.Type("queue"); typ != "none" {
+			t.Errorf("Type of drained queue after restart: expected none, got %s\n", typ)
+		}
+		data.Close()
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy tells which keys are removed when memory limit is reached
+type EvictionPolicy int
+
+const (
+	// NoEviction makes writes fail with ErrOutOfMemory
+	NoEviction EvictionPolicy = iota
+	// AllKeysLRU evicts least recently used keys
+	AllKeysLRU
+	// AllKeysLFU evicts least frequently used keys
+	AllKeysLFU
+	// VolatileLRU evicts least recently used keys among keys with ttl
+	VolatileLRU
+	// VolatileTTL evicts keys with the nearest expiration
+	VolatileTTL
+)
+
+var ErrOutOfMemory = errors.New("OOM command not allowed when used memory > 'maxmemory'")
+
+var (
+	// number of keys examined to choose one to evict,
+	// more samples give better approximation of policy but cost more
+	evictionSamples = 5
+
+	// approximate cost of map entries and entry struct
+	entryOverhead int64 = 64
+
+	// logarithmic frequency counter parameters, same as in redis
+	lfuInitVal uint32 = 5
+	lfuLogFactor = 10.0
+	lfuDecayTime = time.Minute
+)
+
+// entry is a value with bookkeeping used by eviction
+type entry struct {
+	value interface{}
+	// approximate memory used by key and value
+	size int64
+
+	// last access time in unix nanoseconds and logarithmic access counter,
+	// both are updated by readers so must be accessed atomically
+	atime int64
+	freq uint32
+
+	// changed by every write to the key, used by WATCH
+	version uint64
+}
+
+func newEntry(key string, value interface{}) *entry {
+	value = containerOf(value)
+	return &entry{
+		value: value,
+		size: entryOverhead + int64(len(key)) + sizeOf(value),
+		atime: time.Now().UnixNano(),
+		freq: lfuInitVal,
+	}
+}
+
+// sizeOf approximates memory used by value decoded from json
+func sizeOf(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case container:
+		return v.size()
+	case string:
+		return 16 + int64(len(v))
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += 16 + sizeOf(item)
+		}
+		return size
+	case map[string]interface{}:
+		size := int64(48)
+		for key, item := range v {
+			size += 32 + int64(len(key)) + sizeOf(item)
+		}
+		return size
+	}
+	return 16
+}
+
+// touch records access to the entry
+func (s *kvStorage) touch(e *entry, now time.Time) {
+	if s.policy == AllKeysLFU {
+		freq := lfuDecay(atomic.LoadUint32(&e.freq), atomic.LoadInt64(&e.atime), now)
+		atomic.StoreUint32(&e.freq, lfuIncrement(freq))
+	}
+	atomic.StoreInt64(&e.atime, now.UnixNano())
+}
+
+// lfuIncrement increments counter with probability decreasing as counter grows
+func lfuIncrement(freq uint32) uint32 {
+	if freq == math.MaxUint8 {
+		return freq
+	}
+	base := 0.0
+	if freq > lfuInitVal {
+		base = float64(freq - lfuInitVal)
+	}
+	if rand.Float64() < 1 / (base * lfuLogFactor + 1) {
+		freq += 1
+	}
+	return freq
+}
+
+// lfuDecay decrements counter once per lfuDecayTime passed since last access
+func lfuDecay(freq uint32, atime int64, now time.Time) uint32 {
+	periods := uint32(now.Sub(time.Unix(0, atime)) / lfuDecayTime)
+	if periods >= freq {
+		return 0
+	}
+	return freq - periods
+}
+
+// freeMemory evicts keys until memory usage is under the limit,
+// must be called with mutex held
+func (s *kvStorage) freeMemory() error {
+	if s.maxMemory <= 0 {
+		return nil
+	}
+
+	for s.used > s.maxMemory {
+		key, found := s.evictionCandidate()
+		if !found {
+			return ErrOutOfMemory
+		}
+
+		s.unlink(key)
+		s.dirty += 1
+		s.evicted += 1
+		s.logDel(key)
+		s.events.emit(EventsEvicted, EventEvicted, key)
+	}
+	return nil
+}
+
+// evictionCandidate samples few keys and chooses the best one to evict
+func (s *kvStorage) evictionCandidate() (string, bool) {
+	now := time.Now()
+	best := ""
+	bestScore := math.Inf(-1)
+	sampled := 0
+
+	consider := func(key string, score float64) bool {
+		if score > bestScore {
+			best = key
+			bestScore = score
+		}
+		sampled += 1
+		return sampled < evictionSamples
+	}
+
+	switch s.policy {
+	case AllKeysLRU:
+		for key, e := range s.data {
+			idle := now.UnixNano() - atomic.LoadInt64(&e.atime)
+			if !consider(key, float64(idle)) {
+				break
+			}
+		}
+	case AllKeysLFU:
+		for key, e := range s.data {
+			freq := lfuDecay(atomic.LoadUint32(&e.freq), atomic.LoadInt64(&e.atime), now)
+			if !consider(key, -float64(freq)) {
+				break
+			}
+		}
+	case VolatileLRU:
+		for key := range s.expires {
+			e := s.data[key]
+			idle := now.UnixNano() - atomic.LoadInt64(&e.atime)
+			if !consider(key, float64(idle)) {
+				break
+			}
+		}
+	case VolatileTTL:
+		for key, expires := range s.expires {
+			if !consider(key, -float64(expires.UnixNano())) {
+				break
+			}
+		}
+	}
+
+	return best, sampled > 0
+}
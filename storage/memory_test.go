@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	data := New(0).(*kvStorage)
+	defer data.Close()
+
+	data.Set("key1", "val", zeroDuration)
+	data.Set("key2", []interface{}{"a", "b"}, time.Hour)
+	if data.used <= 0 {
+		t.Fatalf("Expected positive memory usage, got %d\n", data.used)
+	}
+	data.Set("key1", "longer value", zeroDuration)
+	data.Delete("key1", "key2")
+	if data.used != 0 {
+		t.Fatalf("Expected zero memory usage after deletion, got %d\n", data.used)
+	}
+}
+
+func TestNoEviction(t *testing.T) {
+	data := New(0, WithMaxMemory(3 * entryOverhead, NoEviction))
+	defer data.Close()
+
+	var err error
+	kSet := 0
+	for ; kSet < 10; kSet += 1 {
+		if err = data.Set("key" + strconv.Itoa(kSet), "val", zeroDuration); err != nil {
+			break
+		}
+	}
+	if err != ErrOutOfMemory {
+		t.Fatalf("Set: expected %v, got %v\n", ErrOutOfMemory, err)
+	}
+
+	// deletion frees memory
+	data.Delete("key0")
+	if err := data.Set("key0", "val", zeroDuration); err != nil {
+		t.Fatalf("Set after Delete: unexpected error %v\n", err)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	kKeys := 100
+	limit := 10 * (entryOverhead + 32)
+
+	for _, policy := range []EvictionPolicy{AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileTTL} {
+		data := New(0, WithMaxMemory(limit, policy)).(*kvStorage)
+
+		for i := 0; i < kKeys; i += 1 {
+			if err := data.Set("key" + strconv.Itoa(i), "val", time.Hour + time.Duration(i) * time.Second); err != nil {
+				t.Fatalf("Policy %d: Set: unexpected error %v\n", policy, err)
+			}
+		}
+		if data.used > limit + entryOverhead + 32 {
+			t.Errorf("Policy %d: memory usage %d exceeds limit %d\n", policy, data.used, limit)
+		}
+		if len(data.data) >= kKeys {
+			t.Errorf("Policy %d: expected some keys to be evicted\n", policy)
+		}
+
+		data.Close()
+	}
+}
+
+func TestVolatileWithoutVolatileKeys(t *testing.T) {
+	data := New(0, WithMaxMemory(entryOverhead, VolatileLRU))
+	defer data.Close()
+
+	data.Set("key1", "val", zeroDuration)
+	if err := data.Set("key2", "val", zeroDuration); err != ErrOutOfMemory {
+		t.Fatalf("Set: expected %v, got %v\n", ErrOutOfMemory, err)
+	}
+}
+
+func TestLRUKeepsRecentlyUsed(t *testing.T) {
+	evictionSamples = 1000
+	defer func() { evictionSamples = 5 }()
+
+	data := New(0, WithMaxMemory(3 * (entryOverhead + 32), AllKeysLRU))
+	defer data.Close()
+
+	data.Set("old", "val", zeroDuration)
+	data.Set("hot", "val", zeroDuration)
+	data.Set("new", "val", zeroDuration)
+	time.Sleep(time.Millisecond)
+	data.Get("hot")
+	data.Set("newest", "val", zeroDuration)
+	data.Set("newest2", "val", zeroDuration)
+
+	if _, exists := data.Get("hot"); !exists {
+		t.Fatalf("Expected recently used key to survive eviction\n")
+	}
+	if _, exists := data.Get("old"); exists {
+		t.Fatalf("Expected least recently used key to be evicted\n")
+	}
+}
+
+func TestOverwriteKeepsLFUCounter(t *testing.T) {
+	data := New(0, WithMaxMemory(1 << 20, AllKeysLFU)).(*kvStorage)
+	defer data.Close()
+
+	data.Set("key", "val", zeroDuration)
+	data.Set("key", "val2", zeroDuration)
+	if freq := data.data["key"].freq; freq <= lfuInitVal {
+		t.Fatalf("Expected overwrite to increment lfu counter above %d, got %d\n", lfuInitVal, freq)
+	}
+}
+
+func TestContainerWriteIsAccess(t *testing.T) {
+	data := New(0, WithMaxMemory(1 << 20, AllKeysLRU)).(*kvStorage)
+	defer data.Close()
+
+	data.RPush("list", "a")
+	atime := data.data["list"].atime
+	time.Sleep(time.Millisecond)
+	data.RPush("list", "b")
+	if data.data["list"].atime <= atime {
+		t.Fatalf("Expected RPush to update access time of existing list\n")
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"time"
+)
+
+// KeyValue is a key with its value and ttl written by MSet, non-positive ttl means no ttl
+type KeyValue struct {
+	Key string
+	Value interface{}
+	TTL time.Duration
+}
+
+// mget and mset lock shards of all keys at once, so they are atomic even for sharded storage
+
+func (p partitions) mget(keys []string) []interface{} {
+	shards := p.involved(keys...)
+	shards.rlock()
+	defer shards.runlock()
+
+	now := time.Now()
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		s := p.shardOf(key)
+		e, exists := s.lookup(key, now)
+		if !exists {
+			continue
+		}
+		// like in redis, keys of aggregate types are reported as missing
+		switch v := e.value.(type) {
+		case *rawString:
+			result[i] = v.export()
+		case container:
+			continue
+		default:
+			result[i] = v
+		}
+		s.touch(e, now)
+	}
+	return result
+}
+
+// mset writes all items or nothing if nx is set and some of the keys exists
+func (p partitions) mset(items []KeyValue, nx bool) (bool, error) {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	shards := p.involved(keys...)
+	shards.lock()
+	defer shards.unlock()
+
+	now := time.Now()
+	if nx {
+		for _, key := range keys {
+			if _, exists := p.shardOf(key).lookup(key, now); exists {
+				return false, nil
+			}
+		}
+	}
+	// memory is freed before any write, so failed command changes nothing
+	for _, s := range shards {
+		if err := s.admitWrite(); err != nil {
+			return false, err
+		}
+	}
+
+	for _, item := range items {
+		var expires time.Time
+		if item.TTL > 0 {
+			expires = now.Add(item.TTL)
+		}
+		s := p.shardOf(item.Key)
+		s.store(item.Key, item.Value, expires)
+		s.dirty += 1
+		s.logSet(item.Key, item.Value, expires)
+		s.events.emit(EventsString, EventSet, item.Key)
+	}
+	return true, nil
+}
+
+// MGet returns values of the keys, nil for missing keys and keys of aggregate types
+func (s *kvStorage) MGet(keys ...string) []interface{} {
+	if s.closed() {
+		panic("MGet over closed storage")
+	}
+	return partitions{s}.mget(keys)
+}
+
+// MSet atomically writes all items, later items override earlier ones with the same key
+func (s *kvStorage) MSet(items ...KeyValue) error {
+	if s.closed() {
+		panic("MSet over closed storage")
+	}
+	_, err := partitions{s}.mset(items, false)
+	return err
+}
+
+// MSetNX writes items only if none of their keys exists, returns whether they were written
+func (s *kvStorage) MSetNX(items ...KeyValue) (bool, error) {
+	if s.closed() {
+		panic("MSetNX over closed storage")
+	}
+	return partitions{s}.mset(items, true)
+}
+
+func (s *shardedStorage) MGet(keys ...string) []interface{} {
+	if s.closed() {
+		panic("MGet over closed storage")
+	}
+	return s.shards.mget(keys)
+}
+
+func (s *shardedStorage) MSet(items ...KeyValue) error {
+	if s.closed() {
+		panic("MSet over closed storage")
+	}
+	_, err := s.shards.mset(items, false)
+	return err
+}
+
+func (s *shardedStorage) MSetNX(items ...KeyValue) (bool, error) {
+	if s.closed() {
+		panic("MSetNX over closed storage")
+	}
+	return s.shards.mset(items, true)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMSetMGet(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		err := data.MSet(
+			KeyValue{Key: "key1", Value: "val1"},
+			KeyValue{Key: "key2", Value: "val2", TTL: time.Hour},
+			KeyValue{Key: "key1", Value: "val3"},
+		)
+		if err != nil {
+			t.Fatalf("Subtest 1: MSet: unexpected error %v\n", err)
+		}
+		data.SAdd("set", "a")
+
+		expected := []interface{}{"val3", "val2", nil, nil}
+		if res := data.MGet("key1", "key2", "missing", "set"); !reflect.DeepEqual(res, expected) {
+			t.Fatalf("Subtest 2: MGet: expected %v, got %v\n", expected, res)
+		}
+		if ttl := data.TTL("key2"); ttl <= 0 || ttl > time.Hour {
+			t.Fatalf("Subtest 3: MSet must set ttl, got %v\n", ttl)
+		}
+		if ttl := data.TTL("key1"); ttl != TTLNoExpire {
+			t.Fatalf("Subtest 3: TTL key1: expected %v, got %v\n", TTLNoExpire, ttl)
+		}
+
+		written, _ := data.MSetNX(KeyValue{Key: "new", Value: "val"}, KeyValue{Key: "key1", Value: "val"})
+		if written {
+			t.Fatalf("Subtest 4: MSetNX with existing key: expected false\n")
+		}
+		if _, exists := data.Get("new"); exists {
+			t.Fatalf("Subtest 4: failed MSetNX must write nothing\n")
+		}
+		written, _ = data.MSetNX(KeyValue{Key: "new", Value: "val"}, KeyValue{Key: "new2", Value: "val"})
+		if !written {
+			t.Fatalf("Subtest 5: MSetNX with new keys: expected true\n")
+		}
+
+		data.Close()
+	}
+}
+
+func TestMSetOutOfMemory(t *testing.T) {
+	data := New(0, WithMaxMemory(2 * entryOverhead, NoEviction))
+	defer data.Close()
+
+	data.Set("key1", "val", zeroDuration)
+	data.Set("key2", "val", zeroDuration)
+	err := data.MSet(KeyValue{Key: "key1", Value: "new"}, KeyValue{Key: "key3", Value: "new"})
+	if err != ErrOutOfMemory {
+		t.Fatalf("MSet: expected %v, got %v\n", ErrOutOfMemory, err)
+	}
+	if val, _ := data.Get("key1"); val != "val" {
+		t.Fatalf("Failed MSet must write nothing, got %v\n", val)
+	}
+}
+
+func TestMSetAtomic(t *testing.T) {
+	data := New(0, WithShards(8))
+	defer data.Close()
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 1000; n += 1 {
+			items := make([]KeyValue, len(keys))
+			for i, key := range keys {
+				items[i] = KeyValue{Key: key, Value: n}
+			}
+			data.MSet(items...)
+		}
+	}()
+
+	for n := 0; n < 1000; n += 1 {
+		values := data.MGet(keys...)
+		for _, val := range values {
+			if val != values[0] {
+				t.Fatalf("MGet observed partial MSet: %v\n", values)
+			}
+		}
+	}
+	wg.Wait()
+}
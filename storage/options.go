@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"time"
+)
+
+// Option configures storage created by New or Open
+type Option func(*config)
+
+type config struct {
+	snapshotPath string
+	snapshotInterval time.Duration
+
+	aofPath string
+	aofPolicy FsyncPolicy
+
+	maxMemory int64
+	policy EvictionPolicy
+
+	shards int
+
+	expiration ExpirationEngine
+
+	events EventClass
+}
+
+// WithSnapshot makes storage load its contents from the snapshot file at path on start
+// and save it back every interval if anything changed, non-positive interval disables periodic saves
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(c *config) {
+		c.snapshotPath = path
+		c.snapshotInterval = interval
+	}
+}
+
+// WithAppendOnly makes storage log every change into the append-only file at path
+// and replay it on start. If the file doesn't exist yet, it is created from snapshot
+func WithAppendOnly(path string, policy FsyncPolicy) Option {
+	return func(c *config) {
+		c.aofPath = path
+		c.aofPolicy = policy
+	}
+}
+
+// WithMaxMemory limits approximate memory used by keys and values to limit bytes,
+// policy tells which keys are evicted when limit is reached
+func WithMaxMemory(limit int64, policy EvictionPolicy) Option {
+	return func(c *config) {
+		c.maxMemory = limit
+		c.policy = policy
+	}
+}
+
+// WithShards partitions keys between n independently locked shards,
+// memory limit is divided between them equally
+func WithShards(n int) Option {
+	return func(c *config) {
+		c.shards = n
+	}
+}
+
+// WithExpiration chooses how expired keys are reclaimed in background
+func WithExpiration(engine ExpirationEngine) Option {
+	return func(c *config) {
+		c.expiration = engine
+	}
+}
+
+// WithNotifications enables keyspace events of classes, which are delivered to subscribers
+// of SubscribeEvents. Events are dropped if nobody is subscribed
+func WithNotifications(classes EventClass) Option {
+	return func(c *config) {
+		c.events = classes
+	}
+}
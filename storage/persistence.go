@@ -0,0 +1,61 @@
+package storage
+
+// persistence saves data of one or several partitions to disk
+type persistence struct {
+	parts partitions
+
+	snapshot *snapshotter
+	aof *aofWriter
+
+	done chan struct{}
+}
+
+// openPersistence restores data of parts from disk and starts background saving
+func openPersistence(parts partitions, cfg *config) (*persistence, error) {
+	p := &persistence{
+		parts: parts,
+		done: make(chan struct{}, 0),
+	}
+
+	if cfg.snapshotPath != "" {
+		p.snapshot = &snapshotter{
+			path: cfg.snapshotPath,
+			interval: cfg.snapshotInterval,
+		}
+	}
+	// append-only file is more up to date than snapshot if both are present
+	if cfg.aofPath != "" {
+		if err := p.openAOF(cfg.aofPath, cfg.aofPolicy); err != nil {
+			return nil, err
+		}
+	} else if p.snapshot != nil {
+		if err := parts.loadSnapshot(p.snapshot.path); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.snapshot != nil && p.snapshot.interval > 0 {
+		go p.snapshotChecker()
+	}
+	if p.aof != nil {
+		go p.aofChecker()
+	}
+	return p, nil
+}
+
+// aofFailure fails saving of snapshot while append-only file misses records:
+// the log is loaded in preference to snapshot, so successful save would promise
+// durability which restart doesn't give
+func (p *persistence) aofFailure() error {
+	if p.aof == nil {
+		return nil
+	}
+	return p.aof.failure()
+}
+
+func (p *persistence) close() {
+	close(p.done)
+	if p.aof != nil {
+		p.aof.close()
+	}
+}
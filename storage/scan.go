@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var (
+	// minimal number of buckets of keyIndex, must be a power of two
+	minIndexSize = 16
+	// Count of ScanOptions used if it isn't specified
+	defaultScanCount = 10
+)
+
+// keyIndex groups keys into power of two number of buckets by hash, so the keyspace
+// can be iterated by bucket while keys are added and removed between calls.
+// Cursor is advanced like in dictScan of redis, which keeps it valid after resizes
+type keyIndex struct {
+	buckets [][]string
+	count int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		buckets: make([][]string, minIndexSize),
+	}
+}
+
+// bucketHash mixes bits of hashKey with finalizer of murmur3, so keys of one shard,
+// which have the same remainder of hashKey, are spread over all buckets
+func bucketHash(key string) uint32 {
+	h := hashKey(key)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func (idx *keyIndex) mask() uint32 {
+	return uint32(len(idx.buckets) - 1)
+}
+
+func (idx *keyIndex) add(key string) {
+	if idx.count >= len(idx.buckets) {
+		idx.resize(2 * len(idx.buckets))
+	}
+	i := bucketHash(key) & idx.mask()
+	idx.buckets[i] = append(idx.buckets[i], key)
+	idx.count += 1
+}
+
+func (idx *keyIndex) remove(key string) {
+	i := bucketHash(key) & idx.mask()
+	bucket := idx.buckets[i]
+	for j := range bucket {
+		if bucket[j] == key {
+			last := len(bucket) - 1
+			bucket[j] = bucket[last]
+			bucket[last] = ""
+			idx.buckets[i] = bucket[:last]
+			idx.count -= 1
+			break
+		}
+	}
+	if len(idx.buckets[i]) == 0 {
+		idx.buckets[i] = nil
+	}
+
+	if len(idx.buckets) > minIndexSize && idx.count < len(idx.buckets) / 8 {
+		idx.resize(len(idx.buckets) / 2)
+	}
+}
+
+func (idx *keyIndex) resize(size int) {
+	buckets := make([][]string, size)
+	mask := uint32(size - 1)
+	for _, bucket := range idx.buckets {
+		for _, key := range bucket {
+			i := bucketHash(key) & mask
+			buckets[i] = append(buckets[i], key)
+		}
+	}
+	idx.buckets = buckets
+}
+
+// scan calls fn for keys of the bucket pointed to by cursor and returns next cursor,
+// zero when all buckets are visited. Reversed cursor is incremented, so buckets
+// visited before growth or shrink of the index are not visited again
+func (idx *keyIndex) scan(cursor uint32, fn func(key string)) uint32 {
+	mask := idx.mask()
+	for _, key := range idx.buckets[cursor & mask] {
+		fn(key)
+	}
+
+	cursor |= ^mask
+	cursor = bits.Reverse32(cursor)
+	cursor += 1
+	return bits.Reverse32(cursor)
+}
+
+// ScanOptions filter keys returned by Scan
+type ScanOptions struct {
+	// hint of number of keys examined by one call, filtered ones included
+	Count int
+	// glob pattern keys must match, empty pattern matches everything
+	Match string
+	// type keys must have as returned by Type, empty means any type
+	Type string
+}
+
+// scan examines about opts.Count keys starting from cursor, expired keys are skipped.
+// Nil pattern matches every key
+func (s *kvStorage) scan(cursor uint32, opts ScanOptions, pattern *Pattern) ([]string, uint32) {
+	count := opts.Count
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	result := make([]string, 0, minInt(count, 1024))
+	examined := 0
+	collect := func(key string) {
+		examined += 1
+		e, exists := s.lookup(key, now)
+		if !exists {
+			return
+		}
+		if pattern != nil && !pattern.Match(key) {
+			return
+		}
+		if opts.Type != "" {
+			typeName := "string"
+			if c, ok := e.value.(container); ok {
+				typeName = c.typeName()
+			}
+			if typeName != opts.Type {
+				return
+			}
+		}
+		result = append(result, key)
+	}
+
+	// empty buckets count too, so sparse index doesn't make the call long
+	for visited := 0; visited < 10 * count; visited += 1 {
+		cursor = s.index.scan(cursor, collect)
+		if cursor == 0 || examined >= count {
+			break
+		}
+	}
+	return result, cursor
+}
+
+// scanPattern compiles opts.Match, empty pattern gives nil
+func scanPattern(opts ScanOptions) (*Pattern, error) {
+	if opts.Match == "" {
+		return nil, nil
+	}
+	return CompilePattern(opts.Match)
+}
+
+func (s *kvStorage) Scan(cursor uint64, opts ScanOptions) ([]string, uint64, error) {
+	if s.closed() {
+		panic("Scan over closed storage")
+	}
+	if cursor > math.MaxUint32 {
+		return nil, 0, ErrInvalidCursor
+	}
+	pattern, err := scanPattern(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, next := s.scan(uint32(cursor), opts, pattern)
+	return keys, uint64(next), nil
+}
+
+// Scan iterates shards one by one, shard index is kept in high half of the cursor
+func (s *shardedStorage) Scan(cursor uint64, opts ScanOptions) ([]string, uint64, error) {
+	if s.closed() {
+		panic("Scan over closed storage")
+	}
+	i := cursor >> 32
+	if i >= uint64(len(s.shards)) {
+		return nil, 0, ErrInvalidCursor
+	}
+	pattern, err := scanPattern(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, next := s.shards[i].scan(uint32(cursor), opts, pattern)
+	if next != 0 {
+		return keys, i << 32 | uint64(next), nil
+	}
+	if i + 1 == uint64(len(s.shards)) {
+		return keys, 0, nil
+	}
+	return keys, (i + 1) << 32, nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// scanAll iterates storage to the end calling between for every call but the first
+func scanAll(t *testing.T, data Storage, opts ScanOptions, between func(call int)) map[string]int {
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	for call := 0; ; call += 1 {
+		if call > 0 && between != nil {
+			between(call)
+		}
+		keys, next, err := data.Scan(cursor, opts)
+		if err != nil {
+			t.Fatalf("Scan: unexpected error %v\n", err)
+		}
+		for _, key := range keys {
+			seen[key] += 1
+		}
+		if next == 0 {
+			return seen
+		}
+		cursor = next
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		kKeys := 1000
+		for i := 0; i < kKeys; i += 1 {
+			data.Set("key" + strconv.Itoa(i), i, zeroDuration)
+		}
+		data.Set("expired", "val", time.Nanosecond)
+		data.HSet("hash", map[string]interface{}{"f": "v"})
+		time.Sleep(time.Millisecond)
+
+		seen := scanAll(t, data, ScanOptions{}, nil)
+		if len(seen) != kKeys + 1 {
+			t.Fatalf("Subtest 1: Scan: expected %d keys, got %d\n", kKeys + 1, len(seen))
+		}
+		if seen["expired"] != 0 {
+			t.Fatalf("Subtest 1: Scan must skip expired keys\n")
+		}
+
+		seen = scanAll(t, data, ScanOptions{Count: 100, Match: "key1?"}, nil)
+		if len(seen) != 10 {
+			t.Fatalf("Subtest 2: Scan with Match: expected 10 keys, got %v\n", seen)
+		}
+		seen = scanAll(t, data, ScanOptions{Type: "hash"}, nil)
+		if len(seen) != 1 || seen["hash"] != 1 {
+			t.Fatalf("Subtest 3: Scan with Type: expected only hash, got %v\n", seen)
+		}
+
+		if _, _, err := data.Scan(1 << 40, ScanOptions{}); err != ErrInvalidCursor {
+			t.Fatalf("Subtest 4: Scan with wrong cursor: expected %v, got %v\n", ErrInvalidCursor, err)
+		}
+		data.Close()
+	}
+}
+
+func TestScanDuringResize(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	kStable := 300
+	for i := 0; i < kStable; i += 1 {
+		data.Set("stable" + strconv.Itoa(i), i, zeroDuration)
+	}
+
+	// index grows and shrinks between calls
+	churn := func(call int) {
+		for i := 0; i < 500; i += 1 {
+			key := "churn" + strconv.Itoa(i)
+			if call % 2 == 1 {
+				data.Set(key, i, zeroDuration)
+			} else {
+				data.Delete(key)
+			}
+		}
+	}
+	seen := scanAll(t, data, ScanOptions{Count: 5}, churn)
+	for i := 0; i < kStable; i += 1 {
+		key := "stable" + strconv.Itoa(i)
+		if seen[key] == 0 {
+			t.Fatalf("Scan missed %s existing during the whole iteration\n", key)
+		}
+	}
+}
+
+func TestKeyIndexShrinks(t *testing.T) {
+	data := New(0).(*kvStorage)
+	defer data.Close()
+
+	for i := 0; i < 10000; i += 1 {
+		data.Set("key" + strconv.Itoa(i), i, zeroDuration)
+	}
+	for i := 0; i < 10000; i += 1 {
+		data.Delete("key" + strconv.Itoa(i))
+	}
+	if data.index.count != 0 || len(data.index.buckets) != minIndexSize {
+		t.Fatalf("Expected empty index of %d buckets, got %d keys in %d buckets\n",
+			minIndexSize, data.index.count, len(data.index.buckets))
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSetOptions = errors.New("NX and XX options are mutually exclusive, KEEPTTL can't be used with ttl")
+
+// SetOptions make SetWithOptions conditional like options of redis SET
+type SetOptions struct {
+	// write only if key doesn't exist
+	NX bool
+	// write only if key exists
+	XX bool
+	// retain ttl of existing key, ttl argument must be non-positive
+	KeepTTL bool
+	// previous value is wanted, so like SET GET of redis the write fails with ErrWrongType
+	// and changes nothing if the key holds hash, list, set or sorted set
+	Get bool
+	// write only if version of the key is the same, otherwise fail with ErrVersionMismatch.
+	// Version 0 means that key must not exist
+	IfVersion *uint64
+}
+
+func (opts SetOptions) validate(ttl time.Duration) error {
+	if (opts.NX && opts.XX) || (opts.KeepTTL && ttl > 0) {
+		return ErrSetOptions
+	}
+	return nil
+}
+
+type SetResult struct {
+	// false if NX or XX condition failed
+	Written bool
+	// value replaced or kept by the write
+	Previous interface{}
+	Existed bool
+	// version of the key after the write
+	Version uint64
+}
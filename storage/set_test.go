@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetNXXX(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	res, _ := data.SetWithOptions("key", "val1", zeroDuration, SetOptions{XX: true})
+	if res.Written || res.Existed {
+		t.Fatalf("Subtest 1: XX over missing key: expected no write, got %+v\n", res)
+	}
+	if _, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 1: Get key: expected nothing\n")
+	}
+
+	res, _ = data.SetWithOptions("key", "val1", zeroDuration, SetOptions{NX: true})
+	if !res.Written {
+		t.Fatalf("Subtest 2: NX over missing key: expected write, got %+v\n", res)
+	}
+
+	res, _ = data.SetWithOptions("key", "val2", zeroDuration, SetOptions{NX: true})
+	if res.Written || res.Previous != "val1" {
+		t.Fatalf("Subtest 3: NX over existing key: expected no write and previous value, got %+v\n", res)
+	}
+
+	res, _ = data.SetWithOptions("key", "val3", zeroDuration, SetOptions{XX: true})
+	if !res.Written || res.Previous != "val1" {
+		t.Fatalf("Subtest 4: XX over existing key: expected write and previous value, got %+v\n", res)
+	}
+	if val, _ := data.Get("key"); val != "val3" {
+		t.Fatalf("Subtest 4: Get key: expected %s, got %v\n", "val3", val)
+	}
+
+	// expired key doesn't exist for NX
+	data.Set("volatile", "val", defaultTTL)
+	time.Sleep(defaultSleep)
+	res, _ = data.SetWithOptions("volatile", "val", zeroDuration, SetOptions{NX: true})
+	if !res.Written || res.Existed {
+		t.Fatalf("Subtest 5: NX over expired key: expected write, got %+v\n", res)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Append("string", "abc")
+	res, err := data.SetWithOptions("string", "val", zeroDuration, SetOptions{Get: true})
+	if err != nil || !res.Written || res.Previous != "abc" {
+		t.Fatalf("Subtest 1: Get over string: expected previous value, got %+v, %v\n", res, err)
+	}
+
+	data.HSet("hash", map[string]interface{}{"f": "v"})
+	if _, err := data.SetWithOptions("hash", "val", zeroDuration, SetOptions{Get: true}); err != ErrWrongType {
+		t.Fatalf("Subtest 2: Get over hash: expected %v, got %v\n", ErrWrongType, err)
+	}
+	if typ := data.Type("hash"); typ != "hash" {
+		t.Fatalf("Subtest 2: failed write must keep hash, got type %s\n", typ)
+	}
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("key", "val1", time.Hour)
+	data.SetWithOptions("key", "val2", zeroDuration, SetOptions{KeepTTL: true})
+	if ttl := data.TTL("key"); ttl <= 0 {
+		t.Fatalf("Subtest 1: TTL after KeepTTL: expected positive, got %d\n", ttl)
+	}
+	data.SetWithOptions("key", "val3", zeroDuration, SetOptions{})
+	if ttl := data.TTL("key"); ttl != TTLNoExpire {
+		t.Fatalf("Subtest 2: TTL after plain set: expected %d, got %d\n", TTLNoExpire, ttl)
+	}
+}
+
+func TestSetOptionsValidation(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if _, err := data.SetWithOptions("key", "val", zeroDuration, SetOptions{NX: true, XX: true}); err != ErrSetOptions {
+		t.Fatalf("NX with XX: expected %v, got %v\n", ErrSetOptions, err)
+	}
+	if _, err := data.SetWithOptions("key", "val", time.Hour, SetOptions{KeepTTL: true}); err != ErrSetOptions {
+		t.Fatalf("KeepTTL with ttl: expected %v, got %v\n", ErrSetOptions, err)
+	}
+}
@@ -0,0 +1,471 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNoKeys is returned by set algebra called without keys
+var ErrNoKeys = errors.New("at least one key must be specified")
+
+// Members is a copy of set value returned by Get, passing it to Set stores a set
+type Members []string
+
+// setValue is a set of strings
+type setValue struct {
+	members map[string]struct{}
+	used int64
+}
+
+func newSetValue() *setValue {
+	return &setValue{
+		members: make(map[string]struct{}),
+		used: 48,
+	}
+}
+
+func setValueOf(m Members) *setValue {
+	result := newSetValue()
+	for _, member := range m {
+		result.add(member)
+	}
+	return result
+}
+
+func memberSize(member string) int64 {
+	return 16 + int64(len(member))
+}
+
+// add returns true if member is new
+func (s *setValue) add(member string) bool {
+	if _, exists := s.members[member]; exists {
+		return false
+	}
+	s.members[member] = struct{}{}
+	s.used += memberSize(member)
+	return true
+}
+
+func (s *setValue) remove(member string) bool {
+	if _, exists := s.members[member]; !exists {
+		return false
+	}
+	delete(s.members, member)
+	s.used -= memberSize(member)
+	return true
+}
+
+func (s *setValue) typeName() string {
+	return "set"
+}
+
+// export sorts members, so that copies are deterministic
+func (s *setValue) export() interface{} {
+	return Members(sortedMembers(s.members))
+}
+
+func (s *setValue) size() int64 {
+	return s.used
+}
+
+func (s *setValue) len() int {
+	return len(s.members)
+}
+
+func sortedMembers(members map[string]struct{}) []string {
+	result := make([]string, 0, len(members))
+	for member := range members {
+		result = append(result, member)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// setAt returns set stored at the key, missing key gives nil set unless create is set.
+// Zero now disables expiration check. Must be called with mutex held
+func (s *kvStorage) setAt(key string, now time.Time, create bool) (*setValue, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		if !create {
+			return nil, nil, nil
+		}
+		e = s.create(key, newSetValue())
+	}
+
+	set, ok := e.value.(*setValue)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	return set, e, nil
+}
+
+// sadd and srem are shared by commands and append-only file replay, must be called with mutex held
+
+func (s *kvStorage) sadd(key string, members []string, now time.Time) (int, error) {
+	set, e, err := s.setAt(key, now, true)
+	if err != nil {
+		return 0, err
+	}
+
+	kAdded := 0
+	for _, member := range members {
+		if set.add(member) {
+			kAdded += 1
+		}
+	}
+	s.resize(key, e)
+	return kAdded, nil
+}
+
+func (s *kvStorage) srem(key string, members []string, now time.Time) (int, error) {
+	set, e, err := s.setAt(key, now, false)
+	if set == nil {
+		return 0, err
+	}
+
+	kRemoved := 0
+	for _, member := range members {
+		if set.remove(member) {
+			kRemoved += 1
+		}
+	}
+	if kRemoved > 0 {
+		s.resize(key, e)
+	}
+	return kRemoved, nil
+}
+
+// SAdd returns number of added members
+func (s *kvStorage) SAdd(key string, members ...string) (int, error) {
+	if s.closed() {
+		panic("SAdd over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.saddLocked(key, members, time.Now())
+}
+
+// saddLocked must be called with mutex held
+func (s *kvStorage) saddLocked(key string, members []string, now time.Time) (int, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	kAdded, err := s.sadd(key, members, now)
+	if err != nil {
+		return 0, err
+	}
+	s.dirty += 1
+	s.logSAdd(key, members)
+	s.events.emit(EventsSet, EventSAdd, key)
+	return kAdded, nil
+}
+
+// SRem returns number of removed members, set without members is deleted
+func (s *kvStorage) SRem(key string, members ...string) (int, error) {
+	if s.closed() {
+		panic("SRem over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sremLocked(key, members, time.Now())
+}
+
+// sremLocked must be called with mutex held
+func (s *kvStorage) sremLocked(key string, members []string, now time.Time) (int, error) {
+	kRemoved, err := s.srem(key, members, now)
+	if kRemoved > 0 {
+		s.dirty += 1
+		s.logSRem(key, members)
+		s.emitChange(EventsSet, EventSRem, key)
+	}
+	return kRemoved, err
+}
+
+// SMembers returns sorted members of the set, empty for missing key
+func (s *kvStorage) SMembers(key string) ([]string, error) {
+	if s.closed() {
+		panic("SMembers over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	set, e, err := s.setAt(key, now, false)
+	if set == nil {
+		return []string{}, err
+	}
+	s.touch(e, now)
+	return sortedMembers(set.members), nil
+}
+
+func (s *kvStorage) SIsMember(key string, member string) (bool, error) {
+	if s.closed() {
+		panic("SIsMember over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	set, _, err := s.setAt(key, time.Now(), false)
+	if set == nil {
+		return false, err
+	}
+	_, exists := set.members[member]
+	return exists, nil
+}
+
+func (s *kvStorage) SCard(key string) (int, error) {
+	if s.closed() {
+		panic("SCard over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	set, _, err := s.setAt(key, time.Now(), false)
+	if set == nil {
+		return 0, err
+	}
+	return set.len(), nil
+}
+
+type setOp int
+
+const (
+	setInter setOp = iota
+	setUnion
+	setDiff
+)
+
+// storeEvents are emitted by STORE variants of set algebra
+var storeEvents = map[setOp]string{
+	setInter: EventSInterStore,
+	setUnion: EventSUnionStore,
+	setDiff: EventSDiffStore,
+}
+
+// combine applies op to sets stored at keys, missing keys are empty sets.
+// Shards of all keys must be locked
+func (p partitions) combine(op setOp, keys []string, now time.Time) (map[string]struct{}, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	sets := make([]*setValue, len(keys))
+	for i, key := range keys {
+		set, _, err := p.shardOf(key).setAt(key, now, false)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	result := make(map[string]struct{})
+	switch op {
+	case setInter:
+		// iterate over the smallest set
+		smallest := sets[0]
+		for _, set := range sets {
+			if set == nil {
+				return result, nil
+			}
+			if set.len() < smallest.len() {
+				smallest = set
+			}
+		}
+		for member := range smallest.members {
+			inAll := true
+			for _, set := range sets {
+				if _, exists := set.members[member]; !exists {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result[member] = struct{}{}
+			}
+		}
+	case setUnion:
+		for _, set := range sets {
+			if set == nil {
+				continue
+			}
+			for member := range set.members {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+		if sets[0] == nil {
+			return result, nil
+		}
+		for member := range sets[0].members {
+			result[member] = struct{}{}
+		}
+		for _, set := range sets[1:] {
+			if set == nil {
+				continue
+			}
+			for member := range set.members {
+				delete(result, member)
+			}
+		}
+	}
+	return result, nil
+}
+
+// algebra returns sorted result of op
+func (p partitions) algebra(op setOp, keys []string) ([]string, error) {
+	shards := p.involved(keys...)
+	shards.rlock()
+	defer shards.runlock()
+
+	result, err := p.combine(op, keys, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(result), nil
+}
+
+// algebraStore atomically replaces dst with result of op, empty result deletes dst.
+// Returns size of the result
+func (p partitions) algebraStore(op setOp, dst string, keys []string) (int, error) {
+	shards := p.involved(append([]string{dst}, keys...)...)
+	shards.lock()
+	defer shards.unlock()
+
+	result, err := p.combine(op, keys, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	s := p.shardOf(dst)
+	if len(result) == 0 {
+		if s.unlink(dst) {
+			s.dirty += 1
+			s.logDel(dst)
+			s.events.emit(EventsGeneric, EventDel, dst)
+		}
+		return 0, nil
+	}
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	members := Members(sortedMembers(result))
+	s.store(dst, members, time.Time{})
+	s.dirty += 1
+	s.logSet(dst, members, time.Time{})
+	s.events.emit(EventsSet, storeEvents[op], dst)
+	return len(members), nil
+}
+
+func (s *kvStorage) SInter(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SInter over closed storage")
+	}
+	return partitions{s}.algebra(setInter, keys)
+}
+
+func (s *kvStorage) SUnion(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SUnion over closed storage")
+	}
+	return partitions{s}.algebra(setUnion, keys)
+}
+
+// SDiff returns members of the first set which are not in the others
+func (s *kvStorage) SDiff(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SDiff over closed storage")
+	}
+	return partitions{s}.algebra(setDiff, keys)
+}
+
+func (s *kvStorage) SInterStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SInterStore over closed storage")
+	}
+	return partitions{s}.algebraStore(setInter, dst, keys)
+}
+
+func (s *kvStorage) SUnionStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SUnionStore over closed storage")
+	}
+	return partitions{s}.algebraStore(setUnion, dst, keys)
+}
+
+func (s *kvStorage) SDiffStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SDiffStore over closed storage")
+	}
+	return partitions{s}.algebraStore(setDiff, dst, keys)
+}
+
+func (s *shardedStorage) SAdd(key string, members ...string) (int, error) {
+	return s.shards.shardOf(key).SAdd(key, members...)
+}
+
+func (s *shardedStorage) SRem(key string, members ...string) (int, error) {
+	return s.shards.shardOf(key).SRem(key, members...)
+}
+
+func (s *shardedStorage) SMembers(key string) ([]string, error) {
+	return s.shards.shardOf(key).SMembers(key)
+}
+
+func (s *shardedStorage) SIsMember(key string, member string) (bool, error) {
+	return s.shards.shardOf(key).SIsMember(key, member)
+}
+
+func (s *shardedStorage) SCard(key string) (int, error) {
+	return s.shards.shardOf(key).SCard(key)
+}
+
+// multi-key commands lock shards of all keys, so they are atomic like in a single storage
+
+func (s *shardedStorage) SInter(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SInter over closed storage")
+	}
+	return s.shards.algebra(setInter, keys)
+}
+
+func (s *shardedStorage) SUnion(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SUnion over closed storage")
+	}
+	return s.shards.algebra(setUnion, keys)
+}
+
+func (s *shardedStorage) SDiff(keys ...string) ([]string, error) {
+	if s.closed() {
+		panic("SDiff over closed storage")
+	}
+	return s.shards.algebra(setDiff, keys)
+}
+
+func (s *shardedStorage) SInterStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SInterStore over closed storage")
+	}
+	return s.shards.algebraStore(setInter, dst, keys)
+}
+
+func (s *shardedStorage) SUnionStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SUnionStore over closed storage")
+	}
+	return s.shards.algebraStore(setUnion, dst, keys)
+}
+
+func (s *shardedStorage) SDiffStore(dst string, keys ...string) (int, error) {
+	if s.closed() {
+		panic("SDiffStore over closed storage")
+	}
+	return s.shards.algebraStore(setDiff, dst, keys)
+}
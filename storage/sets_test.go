@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSetCommands(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if kAdded, err := data.SAdd("tags", "go", "redis", "go"); err != nil || kAdded != 2 {
+		t.Fatalf("Subtest 1: SAdd: expected 2 added members, got %d, %v\n", kAdded, err)
+	}
+	if kAdded, _ := data.SAdd("tags", "cache", "go"); kAdded != 1 {
+		t.Fatalf("Subtest 1: SAdd existing set: expected 1 added member, got %d\n", kAdded)
+	}
+	if members, _ := data.SMembers("tags"); !reflect.DeepEqual(members, []string{"cache", "go", "redis"}) {
+		t.Fatalf("Subtest 2: SMembers: expected [cache go redis], got %v\n", members)
+	}
+	if isMember, _ := data.SIsMember("tags", "go"); !isMember {
+		t.Fatalf("Subtest 2: SIsMember go: expected true\n")
+	}
+	if isMember, _ := data.SIsMember("tags", "java"); isMember {
+		t.Fatalf("Subtest 2: SIsMember java: expected false\n")
+	}
+	if n, _ := data.SCard("tags"); n != 3 {
+		t.Fatalf("Subtest 2: SCard: expected 3, got %d\n", n)
+	}
+
+	if kRemoved, _ := data.SRem("tags", "go", "java"); kRemoved != 1 {
+		t.Fatalf("Subtest 3: SRem: expected 1 removed member, got %d\n", kRemoved)
+	}
+	data.SRem("tags", "cache", "redis")
+	if typ := data.Type("tags"); typ != "none" {
+		t.Fatalf("Subtest 3: set without members must be deleted, got type %s\n", typ)
+	}
+
+	data.Set("string", "val", zeroDuration)
+	if _, err := data.SAdd("string", "val"); err != ErrWrongType {
+		t.Fatalf("Subtest 4: SAdd over string: expected %v, got %v\n", ErrWrongType, err)
+	}
+	if _, err := data.SUnion("missing", "string"); err != ErrWrongType {
+		t.Fatalf("Subtest 4: SUnion with string: expected %v, got %v\n", ErrWrongType, err)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		data.SAdd("a", "1", "2", "3", "4")
+		data.SAdd("b", "2", "3", "5")
+		data.SAdd("c", "3", "4", "5")
+
+		cases := []struct{
+			name string
+			op func(keys ...string) ([]string, error)
+			keys []string
+			expected []string
+		}{
+			{"SInter", data.SInter, []string{"a", "b", "c"}, []string{"3"}},
+			{"SInter with missing", data.SInter, []string{"a", "missing"}, []string{}},
+			{"SUnion", data.SUnion, []string{"a", "b", "missing"}, []string{"1", "2", "3", "4", "5"}},
+			{"SDiff", data.SDiff, []string{"a", "b", "c"}, []string{"1"}},
+			{"SDiff of missing", data.SDiff, []string{"missing", "a"}, []string{}},
+		}
+		for _, c := range cases {
+			if result, err := c.op(c.keys...); err != nil || !reflect.DeepEqual(result, c.expected) {
+				t.Errorf("%s %v: expected %v, got %v, %v\n", c.name, c.keys, c.expected, result, err)
+			}
+		}
+
+		// destination may be one of sources and have different type
+		data.Set("dst", "val", zeroDuration)
+		if n, _ := data.SInterStore("dst", "a", "b"); n != 2 {
+			t.Errorf("SInterStore: expected 2 members, got %d\n", n)
+		}
+		if members, _ := data.SMembers("dst"); !reflect.DeepEqual(members, []string{"2", "3"}) {
+			t.Errorf("SMembers dst: expected [2 3], got %v\n", members)
+		}
+		if n, _ := data.SUnionStore("a", "a", "c"); n != 5 {
+			t.Errorf("SUnionStore into source: expected 5 members, got %d\n", n)
+		}
+		if n, _ := data.SDiffStore("dst", "b", "a"); n != 0 {
+			t.Errorf("SDiffStore: expected 0 members, got %d\n", n)
+		}
+		if typ := data.Type("dst"); typ != "none" {
+			t.Errorf("Empty result must delete destination, got type %s\n", typ)
+		}
+
+		for _, op := range []func(keys ...string) ([]string, error){data.SInter, data.SUnion, data.SDiff} {
+			if _, err := op(); !errors.Is(err, ErrNoKeys) {
+				t.Errorf("Algebra without keys: expected ErrNoKeys, got %v\n", err)
+			}
+		}
+		for _, op := range []func(dst string, keys ...string) (int, error){data.SInterStore, data.SUnionStore, data.SDiffStore} {
+			if _, err := op("dst"); !errors.Is(err, ErrNoKeys) {
+				t.Errorf("Algebra store without keys: expected ErrNoKeys, got %v\n", err)
+			}
+		}
+		data.Close()
+	}
+}
+
+func TestSetAlgebraStoreAtomic(t *testing.T) {
+	data := New(0, WithShards(4))
+	defer data.Close()
+
+	// members are moved between sets while their union is stored,
+	// atomic union always sees every member exactly once
+	data.SAdd("left", "1", "2", "3", "4")
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	stop := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data.SUnionStore("right", "left", "right")
+			data.Delete("left")
+			data.SUnionStore("left", "left", "right")
+			data.Delete("right")
+		}
+	}()
+	for i := 0; i < 1000; i += 1 {
+		if members, _ := data.SUnion("left", "right"); len(members) != 4 {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("SUnion: expected 4 members, got %v\n", members)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestSetPersistence(t *testing.T) {
+	dir := t.TempDir()
+	aof := filepath.Join(dir, "appendonly.taof")
+	snapshot := filepath.Join(dir, "dump.trdb")
+
+	data := New(0, WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0))
+	data.SAdd("a", "1", "2", "3")
+	data.SAdd("b", "2", "3", "4")
+	data.SRem("a", "1")
+	data.SInterStore("inter", "a", "b")
+	data.Save()
+	data.Close()
+
+	for _, opt := range []Option{WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0)} {
+		data = New(0, opt)
+		if members, _ := data.SMembers("a"); !reflect.DeepEqual(members, []string{"2", "3"}) {
+			t.Errorf("SMembers a after restart: expected [2 3], got %v\n", members)
+		}
+		if members, _ := data.SMembers("inter"); !reflect.DeepEqual(members, []string{"2", "3"}) {
+			t.Errorf("SMembers inter after restart: expected [2 3], got %v\n", members)
+		}
+		data.Close()
+	}
+}
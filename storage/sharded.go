@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"time"
+)
+
+// partitions are storages keys are distributed between by hash
+type partitions []*kvStorage
+
+func (p partitions) shardOf(key string) *kvStorage {
+	if len(p) == 1 {
+		return p[0]
+	}
+	return p[hashKey(key) % uint32(len(p))]
+}
+
+// hashKey is 32-bit FNV-1a, inlined to avoid allocations of hash.Hash
+func hashKey(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i += 1 {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// partitions are always locked in the same order to avoid deadlocks
+
+func (p partitions) rlock() {
+	for _, s := range p {
+		s.mutex.RLock()
+	}
+}
+
+func (p partitions) runlock() {
+	for i := len(p) - 1; i >= 0; i -= 1 {
+		p[i].mutex.RUnlock()
+	}
+}
+
+func (p partitions) lock() {
+	for _, s := range p {
+		s.mutex.Lock()
+	}
+}
+
+func (p partitions) unlock() {
+	for i := len(p) - 1; i >= 0; i -= 1 {
+		p[i].mutex.Unlock()
+	}
+}
+
+// involved returns shards holding the keys keeping their order
+func (p partitions) involved(keys ...string) partitions {
+	if len(p) == 1 {
+		return p
+	}
+	used := make([]bool, len(p))
+	for _, key := range keys {
+		used[hashKey(key) % uint32(len(p))] = true
+	}
+	result := make(partitions, 0, len(keys))
+	for i, s := range p {
+		if used[i] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// shardedStorage implements Storage interface by partitioning keys between
+// shards which have their own locks and expiration checkers
+type shardedStorage struct {
+	shards partitions
+	persistence *persistence
+}
+
+func openSharded(res time.Duration, cfg *config) (Storage, error) {
+	shardCfg := *cfg
+	if cfg.maxMemory > 0 {
+		shardCfg.maxMemory = cfg.maxMemory / int64(cfg.shards)
+		if shardCfg.maxMemory == 0 {
+			shardCfg.maxMemory = 1
+		}
+	}
+
+	shards := make(partitions, cfg.shards)
+	for i := range shards {
+		shards[i] = newKVStorage(res, &shardCfg)
+		shards[i].events = shards[0].events
+	}
+	p, err := openPersistence(shards, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, shard := range shards {
+		shard.startExpiration()
+	}
+	return &shardedStorage{
+		shards: shards,
+		persistence: p,
+	}, nil
+}
+
+func (s *shardedStorage) Close() {
+	s.persistence.close()
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+}
+
+func (s *shardedStorage) closed() bool {
+	return s.shards[0].closed()
+}
+
+func (s *shardedStorage) Set(key string, value interface{}, ttl time.Duration) error {
+	return s.shards.shardOf(key).Set(key, value, ttl)
+}
+
+func (s *shardedStorage) SetWithOptions(key string, value interface{}, ttl time.Duration, opts SetOptions) (SetResult, error) {
+	return s.shards.shardOf(key).SetWithOptions(key, value, ttl, opts)
+}
+
+func (s *shardedStorage) Get(key string) (interface{}, bool) {
+	return s.shards.shardOf(key).Get(key)
+}
+
+// Delete is atomic only within every shard
+func (s *shardedStorage) Delete(keys ...string) int {
+	groups := make(map[*kvStorage][]string, len(s.shards))
+	for _, key := range keys {
+		shard := s.shards.shardOf(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	kDeleted := 0
+	for shard, group := range groups {
+		kDeleted += shard.Delete(group...)
+	}
+	return kDeleted
+}
+
+func (s *shardedStorage) Keys(pattern string) ([]string, error) {
+	if s.closed() {
+		panic("Keys over closed storage")
+	}
+
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, shard := range s.shards {
+		result = append(result, shard.keys(p)...)
+	}
+	return result, nil
+}
+
+func (s *shardedStorage) Save() error {
+	if s.closed() {
+		panic("Save over closed storage")
+	}
+	return s.persistence.save()
+}
+
+func (s *shardedStorage) BgSave() error {
+	if s.closed() {
+		panic("BgSave over closed storage")
+	}
+	return s.persistence.bgSave()
+}
+
+func (s *shardedStorage) BgRewriteAOF() error {
+	if s.closed() {
+		panic("BgRewriteAOF over closed storage")
+	}
+	return s.persistence.bgRewriteAOF()
+}
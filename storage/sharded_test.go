@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestShardedStorage(t *testing.T) {
+	data := New(0, WithShards(8))
+	defer data.Close()
+
+	kKeys := 100
+	for i := 0; i < kKeys; i += 1 {
+		data.Set("key" + strconv.Itoa(i), i, zeroDuration)
+	}
+	for i := 0; i < kKeys; i += 1 {
+		key := "key" + strconv.Itoa(i)
+		if val, _ := data.Get(key); val != i {
+			t.Fatalf("Get %s: expected %d, got %v\n", key, i, val)
+		}
+	}
+
+	for _, shard := range data.(*shardedStorage).shards {
+		if len(shard.data) == 0 || len(shard.data) == kKeys {
+			t.Fatalf("Expected keys to be distributed between shards\n")
+		}
+	}
+
+	keys, _ := data.Keys("key?")
+	sort.Strings(keys)
+	expected := []string{"key0", "key1", "key2", "key3", "key4", "key5", "key6", "key7", "key8", "key9"}
+	if len(keys) != len(expected) {
+		t.Fatalf("Keys: expected %v, got %v\n", expected, keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("Keys: expected %v, got %v\n", expected, keys)
+		}
+	}
+
+	deleted := data.Delete(expected...)
+	if deleted != len(expected) {
+		t.Fatalf("Delete: expected %d, got %d\n", len(expected), deleted)
+	}
+}
+
+func TestShardedPersistence(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{
+		WithShards(4),
+		WithSnapshot(filepath.Join(dir, "dump.trdb"), 0),
+		WithAppendOnly(filepath.Join(dir, "appendonly.taof"), FsyncNever),
+	}
+
+	data := New(0, opts...)
+	for i := 0; i < 20; i += 1 {
+		data.Set("key" + strconv.Itoa(i), "val", zeroDuration)
+	}
+	data.Delete("key0")
+	if err := data.Save(); err != nil {
+		t.Fatalf("Save: unexpected error %s\n", err)
+	}
+	data.Close()
+
+	// restored from append-only file and redistributed over different number of shards
+	data = New(0, append(opts, WithShards(3))...)
+	defer data.Close()
+	keys, _ := data.Keys("*")
+	if len(keys) != 19 {
+		t.Fatalf("Expected 19 keys to be restored, got %d\n", len(keys))
+	}
+}
+
+func benchmarkParallel(b *testing.B, data Storage) {
+	kKeys := 1 << 14
+	keys := make([]string, kKeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		data.Set(keys[i], i, zeroDuration)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Int()
+		for pb.Next() {
+			key := keys[i % kKeys]
+			// 10% of writes
+			if i % 10 == 0 {
+				data.Set(key, i, zeroDuration)
+			} else {
+				data.Get(key)
+			}
+			i += 1
+		}
+	})
+}
+
+// go test -run none -bench Parallel -cpu 1,2,4,8 ./storage
+func BenchmarkSingleLockParallel(b *testing.B) {
+	data := New(0)
+	defer data.Close()
+	benchmarkParallel(b, data)
+}
+
+func BenchmarkShardedParallel(b *testing.B) {
+	data := New(0, WithShards(4 * runtime.NumCPU()))
+	defer data.Close()
+	benchmarkParallel(b, data)
+}
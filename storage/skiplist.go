@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// skip list ordered by score and then by member, same as in redis.
+// Spans of links allow to find rank of a node and a node by rank in logarithmic time
+
+const zskiplistMaxLevel = 32
+
+// probability of a node to have the next level
+var zskiplistP = 0.25
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// number of nodes the link skips, counting the node it points to
+	span int
+}
+
+type zskiplistNode struct {
+	member string
+	score float64
+	backward *zskiplistNode
+	level []zskiplistLevel
+}
+
+type zskiplist struct {
+	header *zskiplistNode
+	tail *zskiplistNode
+	length int
+	level int
+}
+
+func newZSkiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{
+			level: make([]zskiplistLevel, zskiplistMaxLevel),
+		},
+		level: 1,
+	}
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level += 1
+	}
+	return level
+}
+
+// zslLess tells whether node is ordered before score and member
+func zslLess(node *zskiplistNode, score float64, member string) bool {
+	return node.score < score || (node.score == score && node.member < member)
+}
+
+// insert adds node, member must not be in the list
+func (zsl *zskiplist) insert(score float64, member string) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	var rank [zskiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		if i < zsl.level - 1 {
+			rank[i] = rank[i + 1]
+		}
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i += 1 {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zskiplistNode{
+		member: member,
+		score: score,
+		level: make([]zskiplistLevel, level),
+	}
+	for i := 0; i < level; i += 1 {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < zsl.level; i += 1 {
+		update[i].level[i].span += 1
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length += 1
+	return x
+}
+
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [zskiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i += 1 {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span -= 1
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level - 1].forward == nil {
+		zsl.level -= 1
+	}
+	zsl.length -= 1
+	return true
+}
+
+// rank returns 1-based position of the node, 0 if there is no such node
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		for x.level[i].forward != nil && (zslLess(x.level[i].forward, score, member) ||
+			(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.score == score && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns node at 1-based position
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		for x.level[i].forward != nil && traversed + x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInRange returns the first node with score within r
+func (zsl *zskiplist) firstInRange(r ScoreRange) *zskiplistNode {
+	if r.empty() {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node with score within r
+func (zsl *zskiplist) lastInRange(r ScoreRange) *zskiplistNode {
+	if r.empty() {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i -= 1 {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	if x == zsl.header || !r.aboveMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+var ErrScoreBound = errors.New("min or max is not a float")
+
+// ScoreBound is a bound of score range, inclusive by default
+type ScoreBound struct {
+	Value float64
+	Exclusive bool
+}
+
+// ParseScoreBound parses bound in redis syntax: number, "-inf", "+inf",
+// and "(" prefix for exclusive bound
+func ParseScoreBound(s string) (ScoreBound, error) {
+	bound := ScoreBound{}
+	if strings.HasPrefix(s, "(") {
+		bound.Exclusive = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return bound, ErrScoreBound
+	}
+	bound.Value = value
+	return bound, nil
+}
+
+type ScoreRange struct {
+	Min ScoreBound
+	Max ScoreBound
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.Min.Exclusive {
+		return score > r.Min.Value
+	}
+	return score >= r.Min.Value
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.Max.Exclusive {
+		return score < r.Max.Value
+	}
+	return score <= r.Max.Value
+}
+
+func (r ScoreRange) empty() bool {
+	return r.Min.Value > r.Max.Value ||
+		(r.Min.Value == r.Max.Value && (r.Min.Exclusive || r.Max.Exclusive))
+}
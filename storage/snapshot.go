@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSnapshotDisabled = errors.New("snapshots are not configured")
+	ErrSaveInProgress = errors.New("background save already in progress")
+)
+
+// Snapshot file layout:
+//   "TRDB" magic, uvarint format version,
+//   entries: opEntry, key, deadline (varint unix seconds,
+//   uvarint nanoseconds plus one or 0 for none), value,
+//   opEOF, big-endian crc32 of all preceding bytes.
+const (
+	snapshotMagic = "TRDB"
+	snapshotVersion = 2
+
+	opEntry byte = 0x01
+	opEOF byte = 0xFF
+)
+
+type snapshotEntry struct {
+	key string
+	value interface{}
+	expires time.Time
+}
+
+type snapshotter struct {
+	path string
+	interval time.Duration
+
+	mutex sync.Mutex
+	inProgress bool
+}
+
+// begin reserves the right to write snapshot, only one save may run at a time
+func (sn *snapshotter) begin() error {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	if sn.inProgress {
+		return ErrSaveInProgress
+	}
+	sn.inProgress = true
+	return nil
+}
+
+func (sn *snapshotter) end() {
+	sn.mutex.Lock()
+	sn.inProgress = false
+	sn.mutex.Unlock()
+}
+
+// writeSnapshot replaces file at path atomically: entries are written into
+// temporary file in the same directory which is then renamed
+func writeSnapshot(path string, entries []snapshotEntry) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path) + ".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	enc := newEncoder(w)
+	enc.write([]byte(snapshotMagic))
+	enc.uvarint(snapshotVersion)
+	for _, e := range entries {
+		enc.byte(opEntry)
+		enc.string(e.key)
+		enc.deadline(e.expires)
+		enc.value(e.value)
+	}
+	enc.byte(opEOF)
+	enc.checksum()
+
+	if enc.err != nil {
+		return enc.err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readSnapshot calls fn for every entry of the snapshot file,
+// missing file is treated as empty snapshot
+func readSnapshot(path string, fn func(e snapshotEntry)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = decodeSnapshot(f, fn)
+	if err != nil {
+		return fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	return nil
+}
+
+func decodeSnapshot(r io.Reader, fn func(e snapshotEntry)) error {
+	dec := newDecoder(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	dec.read(magic)
+	if dec.err == nil && string(magic) != snapshotMagic {
+		return errors.New("not a snapshot file")
+	}
+	version := dec.uvarint()
+	if dec.err == nil && version != snapshotVersion {
+		return fmt.Errorf("unsupported format version %d", version)
+	}
+
+	for dec.err == nil {
+		op := dec.byte()
+		if dec.err != nil || op == opEOF {
+			break
+		}
+		if op != opEntry {
+			return errCorrupted
+		}
+
+		var e snapshotEntry
+		e.key = dec.string()
+		e.expires = dec.deadline()
+		e.value = dec.value()
+		if dec.err == nil {
+			fn(e)
+		}
+	}
+
+	dec.checksum()
+	return dec.err
+}
+
+func (p *persistence) save() error {
+	if p.snapshot == nil {
+		return ErrSnapshotDisabled
+	}
+	if err := p.aofFailure(); err != nil {
+		return err
+	}
+
+	if err := p.snapshot.begin(); err != nil {
+		return err
+	}
+	defer p.snapshot.end()
+
+	entries, dirty, ok := p.parts.dump()
+	if !ok {
+		return nil
+	}
+	return p.persist(entries, dirty)
+}
+
+// bgSave takes the snapshot of data synchronously and writes it to disk in background
+func (p *persistence) bgSave() error {
+	if p.snapshot == nil {
+		return ErrSnapshotDisabled
+	}
+	if err := p.aofFailure(); err != nil {
+		return err
+	}
+
+	if err := p.snapshot.begin(); err != nil {
+		return err
+	}
+
+	entries, dirty, ok := p.parts.dump()
+	if !ok {
+		p.snapshot.end()
+		return nil
+	}
+	go func() {
+		defer p.snapshot.end()
+		p.persist(entries, dirty)
+	}()
+	return nil
+}
+
+// persist writes entries and forgets changes they include
+func (p *persistence) persist(entries []snapshotEntry, dirty []int) error {
+	if err := writeSnapshot(p.snapshot.path, entries); err != nil {
+		return err
+	}
+
+	for i, s := range p.parts {
+		s.mutex.Lock()
+		s.dirty -= dirty[i]
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+func (p *persistence) snapshotChecker() {
+	ticker := time.NewTicker(p.snapshot.interval)
+
+	for {
+		select {
+		case <- ticker.C:
+			if p.parts.dirty() > 0 {
+				p.bgSave()
+			}
+		case _, ok := <- p.done:
+			if !ok {
+				ticker.Stop()
+				return
+			}
+		}
+	}
+}
+
+// dump copies not expired entries of all partitions at once, values are never
+// modified in place so shallow copy is enough. Returns false if storage was closed
+func (p partitions) dump() ([]snapshotEntry, []int, bool) {
+	p.rlock()
+	defer p.runlock()
+
+	entries := []snapshotEntry{}
+	dirty := make([]int, len(p))
+	for i, s := range p {
+		if s.closed() {
+			return nil, nil, false
+		}
+		entries = append(entries, s.entries()...)
+		dirty[i] = s.dirty
+	}
+	return entries, dirty, true
+}
+
+func (p partitions) dirty() int {
+	dirty := 0
+	for _, s := range p {
+		s.mutex.RLock()
+		dirty += s.dirty
+		s.mutex.RUnlock()
+	}
+	return dirty
+}
+
+// entries must be called with mutex held
+func (s *kvStorage) entries() []snapshotEntry {
+	now := time.Now()
+	entries := make([]snapshotEntry, 0, len(s.data))
+	for key, e := range s.data {
+		expires, exists := s.expires[key]
+		if exists && now.After(expires) {
+			continue
+		}
+		value := e.value
+		// containers are modified in place, so snapshot needs a copy
+		if c, ok := value.(container); ok {
+			value = c.export()
+		}
+		entries = append(entries, snapshotEntry{key, value, expires})
+	}
+	return entries
+}
+
+func (p partitions) loadSnapshot(path string) error {
+	now := time.Now()
+
+	return readSnapshot(path, func(e snapshotEntry) {
+		p.shardOf(e.key).restore(e.key, e.value, e.expires, now)
+	})
+}
+
+// restore puts loaded key into storage, keys which expired while
+// server was down are dropped
+func (s *kvStorage) restore(key string, value interface{}, expires time.Time, now time.Time) {
+	if !expires.IsZero() && now.After(expires) {
+		s.unlink(key)
+		return
+	}
+	s.store(key, value, expires)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.trdb")
+
+	data := New(0, WithSnapshot(path, 0))
+	data.Set("string", "val", zeroDuration)
+	data.Set("int", 42, zeroDuration)
+	data.Set("float", 0.5, zeroDuration)
+	data.Set("bool", true, zeroDuration)
+	data.Set("null", nil, zeroDuration)
+	data.Set("slice", []interface{}{"a", 1.0}, zeroDuration)
+	data.Set("volatile", "val", time.Hour)
+	data.Set("expiring", "val", defaultTTL)
+	if err := data.Save(); err != nil {
+		t.Fatalf("Save: unexpected error %s\n", err)
+	}
+	data.Close()
+
+	time.Sleep(defaultSleep)
+	data = New(0, WithSnapshot(path, 0))
+	defer data.Close()
+
+	expected := map[string]interface{}{
+		"string": "val",
+		"int": int64(42),
+		"float": 0.5,
+		"bool": true,
+		"null": nil,
+		"slice": []interface{}{"a", 1.0},
+		"volatile": "val",
+	}
+	for key, value := range expected {
+		val, exists := data.Get(key)
+		if !exists || !reflect.DeepEqual(val, value) {
+			t.Errorf("Get %s: expected %#v, got %#v\n", key, value, val)
+		}
+	}
+	if val, exists := data.Get("expiring"); exists {
+		t.Errorf("Get expiring: expected nothing, got %#v\n", val)
+	}
+
+	kvs := data.(*kvStorage)
+	if _, exists := kvs.expires["volatile"]; !exists {
+		t.Errorf("Expected ttl of volatile key to be restored\n")
+	}
+}
+
+func TestBgSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.trdb")
+
+	data := New(0, WithSnapshot(path, 0))
+	defer data.Close()
+
+	data.Set("key", "val", zeroDuration)
+	if err := data.BgSave(); err != nil {
+		t.Fatalf("BgSave: unexpected error %s\n", err)
+	}
+	for i := 0; i < 100; i += 1 {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	restored := New(0, WithSnapshot(path, 0))
+	defer restored.Close()
+	if val, _ := restored.Get("key"); val != "val" {
+		t.Fatalf("Get key: expected %s, got %v\n", "val", val)
+	}
+}
+
+func TestPeriodicSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.trdb")
+
+	data := New(0, WithSnapshot(path, 10 * time.Millisecond))
+	defer data.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("Expected no snapshot without changes\n")
+	}
+
+	data.Set("key", "val", zeroDuration)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected snapshot after changes, got %s\n", err)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	data := New(0)
+	if err := data.Save(); err != ErrSnapshotDisabled {
+		t.Errorf("Save: expected %v, got %v\n", ErrSnapshotDisabled, err)
+	}
+	data.Close()
+
+	path := filepath.Join(t.TempDir(), "dump.trdb")
+	data = New(0, WithSnapshot(path, 0))
+	data.Set("key", "val", zeroDuration)
+	data.Save()
+	data.Close()
+
+	content, _ := os.ReadFile(path)
+	content[len(content) - 6] ^= 0xFF
+	os.WriteFile(path, content, 0644)
+	if _, err := Open(0, WithSnapshot(path, 0)); err == nil {
+		t.Errorf("Open: expected error on corrupted snapshot\n")
+	}
+
+	os.WriteFile(path, content[:len(content) / 2], 0644)
+	if _, err := Open(0, WithSnapshot(path, 0)); err == nil {
+		t.Errorf("Open: expected error on truncated snapshot\n")
+	}
+}
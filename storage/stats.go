@@ -0,0 +1,60 @@
+package storage
+
+// Stats describes state of the storage
+type Stats struct {
+	Keys int
+	// keys with ttl, some of them may be already expired but not reclaimed yet
+	VolatileKeys int
+	// approximate memory used by keys and values
+	UsedMemory int64
+
+	// keys reclaimed by background expiration checker
+	ExpiredActive int64
+	// keys reclaimed on access after expiration
+	ExpiredLazy int64
+	// keys removed because of memory limit
+	Evicted int64
+
+	// error of writing append-only file, writes adding data fail while it's not empty
+	AOFError string
+}
+
+func (s *kvStorage) Stats() Stats {
+	if s.closed() {
+		panic("Stats over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := Stats{
+		Keys: len(s.data),
+		VolatileKeys: len(s.expires),
+		UsedMemory: s.used,
+		ExpiredActive: s.expiredActive,
+		ExpiredLazy: s.expiredLazy,
+		Evicted: s.evicted,
+	}
+	if s.aof != nil {
+		if err := s.aof.failure(); err != nil {
+			stats.AOFError = err.Error()
+		}
+	}
+	return stats
+}
+
+func (s *shardedStorage) Stats() Stats {
+	stats := Stats{}
+	for _, shard := range s.shards {
+		shardStats := shard.Stats()
+		stats.Keys += shardStats.Keys
+		stats.VolatileKeys += shardStats.VolatileKeys
+		stats.UsedMemory += shardStats.UsedMemory
+		stats.ExpiredActive += shardStats.ExpiredActive
+		stats.ExpiredLazy += shardStats.ExpiredLazy
+		stats.Evicted += shardStats.Evicted
+		// shards share the append-only file
+		stats.AOFError = shardStats.AOFError
+	}
+	return stats
+}
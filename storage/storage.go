@@ -4,14 +4,112 @@ import (
 	_ "fmt"
 	_ "regexp"
 	"sync"
+	"sync/atomic"
+	"context"
 	"time"
 )
 
 type Storage interface {
-	Set(key string, value interface{}, ttl time.Duration)
+	// Set fails with ErrOutOfMemory if memory limit is reached and nothing can be evicted
+	Set(key string, value interface{}, ttl time.Duration) error
+	SetWithOptions(key string, value interface{}, ttl time.Duration, opts SetOptions) (SetResult, error)
+	// Get returns copy of the contents for keys of aggregate types, use TypeOf to tell them apart
 	Get(key string) (interface{}, bool)
+	// GetWithVersion also returns version of the key, which grows with every change of the key.
+	// Versions aren't persisted, but versions given after restart are greater than ones given before it
+	// unless the clock goes back
+	GetWithVersion(key string) (interface{}, uint64, bool)
 	Delete(keys ...string) int
+	// DeleteIfVersion deletes the key only if its version is the same, otherwise fails with ErrVersionMismatch
+	DeleteIfVersion(key string, version uint64) (bool, error)
 	Keys(pattern string) ([]string, error)
+	// Scan returns some keys and cursor to continue from, zero cursor starts and ends iteration.
+	// Keys existing during the whole iteration are returned at least once
+	Scan(cursor uint64, opts ScanOptions) ([]string, uint64, error)
+	// MGet returns nil for missing keys and keys of aggregate types
+	MGet(keys ...string) []interface{}
+	// MSet and MSetNX are atomic, MSetNX writes nothing if any of the keys exists
+	MSet(items ...KeyValue) error
+	MSetNX(items ...KeyValue) (bool, error)
+	// Watch returns versions of the keys, Exec executes commands atomically if versions
+	// of watched keys are the same and fails with ErrTxAborted otherwise
+	Watch(keys ...string) map[string]uint64
+	Exec(watched map[string]uint64, cmds ...Command) ([]CommandResult, error)
+	// SubscribeEvents receives keyspace events of keys matching glob pattern, fails with
+	// ErrNotificationsDisabled unless storage is created with WithNotifications
+	SubscribeEvents(pattern string) (*EventSubscription, error)
+	// Type returns "none", "string", "hash", "list", "set" or "zset"
+	Type(key string) string
+
+	TTL(key string) time.Duration
+	Expire(key string, ttl time.Duration) bool
+	ExpireAt(key string, at time.Time) bool
+	Persist(key string) bool
+
+	// IncrBy and IncrByFloat fail with ErrNotInteger, ErrNotFloat or ErrOverflow
+	IncrBy(key string, delta int64) (int64, error)
+	IncrByFloat(key string, delta float64) (float64, error)
+
+	// string commands fail with ErrNotString if value is neither string nor number,
+	// lengths and offsets are in bytes
+	Append(key string, value string) (int, error)
+	GetRange(key string, start, stop int) (string, error)
+	// SetRange zero-pads the string if offset is past its end
+	SetRange(key string, offset int, value string) (int, error)
+	StrLen(key string) (int, error)
+	GetDel(key string) (interface{}, bool, error)
+	GetEx(key string, opts GetExOptions) (interface{}, bool, error)
+
+	// commands of other types fail with ErrWrongType if key holds value of different type
+	HSet(key string, fields map[string]interface{}) (int, error)
+	HGet(key string, field string) (interface{}, bool, error)
+	HDel(key string, fields ...string) (int, error)
+	HGetAll(key string) (map[string]interface{}, error)
+	HIncrBy(key string, field string, delta int64) (int64, error)
+	HKeys(key string) ([]string, error)
+	HLen(key string) (int, error)
+
+	LPush(key string, values ...interface{}) (int, error)
+	RPush(key string, values ...interface{}) (int, error)
+	LPop(key string) (interface{}, bool, error)
+	RPop(key string) (interface{}, bool, error)
+	LRange(key string, start, stop int) ([]interface{}, error)
+	LTrim(key string, start, stop int) error
+	LLen(key string) (int, error)
+	// BLPop and BRPop return false on timeout, ctx error when it's done and ErrClosed on Close
+	BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error)
+	BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, interface{}, bool, error)
+
+	SAdd(key string, members ...string) (int, error)
+	SRem(key string, members ...string) (int, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key string, member string) (bool, error)
+	SCard(key string) (int, error)
+	// missing keys are treated as empty sets, at least one key is required or ErrNoKeys is returned
+	SInter(keys ...string) ([]string, error)
+	SUnion(keys ...string) ([]string, error)
+	SDiff(keys ...string) ([]string, error)
+	// STORE variants atomically replace dst with the result and return its size
+	SInterStore(dst string, keys ...string) (int, error)
+	SUnionStore(dst string, keys ...string) (int, error)
+	SDiffStore(dst string, keys ...string) (int, error)
+
+	ZAdd(key string, members ...ZMember) (int, error)
+	ZIncrBy(key string, member string, delta float64) (float64, error)
+	ZRem(key string, members ...string) (int, error)
+	ZScore(key string, member string) (float64, bool, error)
+	ZCard(key string) (int, error)
+	ZRank(key string, member string, reverse bool) (int, bool, error)
+	ZRange(key string, start, stop int, reverse bool) ([]ZMember, error)
+	ZRangeByScore(key string, r ScoreRange, opts RangeOptions) ([]ZMember, error)
+
+	// Save writes point-in-time snapshot to disk, BgSave does the same in background
+	Save() error
+	BgSave() error
+	// BgRewriteAOF compacts append-only file in background
+	BgRewriteAOF() error
+
+	Stats() Stats
 
 	Close()
 }
@@ -21,35 +119,115 @@ var (
 	defaultResolution = time.Second
 )
 
-func New(res time.Duration) Storage {
+// New creates storage and panics if it can't be restored from disk
+func New(res time.Duration, opts ...Option) Storage {
+	storage, err := Open(res, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return storage
+}
+
+// Open creates storage which checks expiration of keys every res (or every second
+// if res is non-positive) and restores its contents from disk if configured so
+func Open(res time.Duration, opts ...Option) (Storage, error) {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.shards > 1 {
+		return openSharded(res, &cfg)
+	}
+
+	storage := newKVStorage(res, &cfg)
+	p, err := openPersistence(partitions{storage}, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	storage.persistence = p
+
+	storage.startExpiration()
+	return storage, nil
+}
+
+func newKVStorage(res time.Duration, cfg *config) *kvStorage {
 	storage := &kvStorage{
-		data: make(map[string]interface{}, initialSize),
+		data: make(map[string]*entry, initialSize),
 		expires: make(map[string]time.Time, initialSize),
+		index: newKeyIndex(),
+		blocked: make(map[string][]*waiter),
 		
 		done: make(chan struct{}, 0),
 		resolution: defaultResolution,
+		// versions aren't persisted, counter starting from the clock keeps them growing across restarts
+		// because it's bumped far slower than once a nanosecond
+		version: uint64(time.Now().UnixNano()),
+
+		maxMemory: cfg.maxMemory,
+		policy: cfg.policy,
+
+		events: newEventBus(cfg.events),
 	}
 	if res > 0 {
 		storage.resolution = res
 	}
-
-	go storage.expirationChecker()
+	if cfg.expiration == ExpireByDeadline {
+		storage.deadlines = newDeadlineHeap()
+		storage.wakeup = make(chan struct{}, 1)
+	}
 	return storage
 }
 
 // kvStorage implements Storage interface
 type kvStorage struct {
-	data map[string]interface{}
+	data map[string]*entry
 	expires map[string]time.Time
+	// keys grouped into buckets iterated by Scan
+	index *keyIndex
+	// clients blocked on list keys
+	blocked map[string][]*waiter
 	
 	mutex sync.RWMutex
 	done chan struct{}
 
 	resolution time.Duration
+	// keys ordered by expiration time, nil unless ExpireByDeadline is used
+	deadlines *deadlineHeap
+	// notifies deadlineChecker about new nearest deadline
+	wakeup chan struct{}
+
+	// nil for shards of shardedStorage
+	persistence *persistence
+	// number of changes since last snapshot
+	dirty int
+	// last version given to an entry or to removal of a key
+	version uint64
+	// versions given to the last removals of keys hashed to the slot, watched missing keys get them
+	removals [removalSlots]uint64
+	aof *aofWriter
+
+	// approximate memory used by keys and values
+	used int64
+	// non-positive means no limit
+	maxMemory int64
+	policy EvictionPolicy
+
+	// keyspace notifications, shared by shards of shardedStorage
+	events *eventBus
+
+	// counters reported by Stats
+	expiredActive int64
+	expiredLazy int64
+	evicted int64
 }
 
 func (s *kvStorage) Close() {
 	close(s.done)
+	if s.persistence != nil {
+		s.persistence.close()
+	}
+	s.events.closeAll()
 
 	s.mutex.Lock()
 	s.data = nil
@@ -61,45 +239,185 @@ func (s *kvStorage) closed() bool {
 	return s.data == nil
 }
 
+func (s *kvStorage) Save() error {
+	if s.closed() {
+		panic("Save over closed storage")
+	}
+	return s.persistence.save()
+}
+
+func (s *kvStorage) BgSave() error {
+	if s.closed() {
+		panic("BgSave over closed storage")
+	}
+	return s.persistence.bgSave()
+}
+
+func (s *kvStorage) BgRewriteAOF() error {
+	if s.closed() {
+		panic("BgRewriteAOF over closed storage")
+	}
+	return s.persistence.bgRewriteAOF()
+}
+
 // non-positive ttl treated as no ttl
-func (s *kvStorage) Set(key string, value interface{}, ttl time.Duration) {
+func (s *kvStorage) Set(key string, value interface{}, ttl time.Duration) error {
+	_, err := s.SetWithOptions(key, value, ttl, SetOptions{})
+	return err
+}
+
+func (s *kvStorage) SetWithOptions(key string, value interface{}, ttl time.Duration, opts SetOptions) (SetResult, error) {
 	if s.closed() {
-		panic("Set over closed storage")
+		panic("SetWithOptions over closed storage")
+	}
+	if err := opts.validate(ttl); err != nil {
+		return SetResult{}, err
 	}
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.data[key] = value
+	now := time.Now()
+	result := SetResult{}
+	if e, exists := s.lookup(key, now); exists {
+		result.Previous = e.value
+		if c, ok := e.value.(container); ok {
+			if opts.Get && c.typeName() != "string" {
+				return SetResult{}, ErrWrongType
+			}
+			result.Previous = c.export()
+		}
+		result.Existed = true
+	}
+	if (opts.NX && result.Existed) || (opts.XX && !result.Existed) {
+		return result, nil
+	}
+	if opts.IfVersion != nil && s.versionOf(key, now) != *opts.IfVersion {
+		return result, ErrVersionMismatch
+	}
+
+	var expires time.Time
 	if ttl > 0 {
-		s.expires[key] = time.Now().Add(ttl)
+		expires = now.Add(ttl)
+	} else if opts.KeepTTL && result.Existed {
+		expires = s.expires[key]
+	}
+	if err := s.setLocked(key, value, expires); err != nil {
+		return result, err
+	}
+
+	result.Written = true
+	result.Version = s.data[key].version
+	return result, nil
+}
+
+// setLocked writes value unconditionally, must be called with mutex held
+func (s *kvStorage) setLocked(key string, value interface{}, expires time.Time) error {
+	if err := s.admitWrite(); err != nil {
+		return err
+	}
+	s.store(key, value, expires)
+	s.dirty += 1
+	s.logSet(key, value, expires)
+	s.events.emit(EventsString, EventSet, key)
+	return nil
+}
+
+// store puts value replacing previous one, zero expires means no ttl.
+// Must be called with mutex held
+func (s *kvStorage) store(key string, value interface{}, expires time.Time) {
+	e := newEntry(key, value)
+	if old, exists := s.data[key]; exists {
+		s.used -= old.size
+		// overwrite is an access, so the key keeps its lfu counter like in redis
+		e.atime = atomic.LoadInt64(&old.atime)
+		e.freq = atomic.LoadUint32(&old.freq)
+		s.touch(e, time.Now())
 	} else {
+		s.index.add(key)
+	}
+	s.bump(e)
+	s.data[key] = e
+	s.used += e.size
+	s.setDeadline(key, expires)
+}
+
+// bump gives entry new version after its change, must be called with mutex held
+func (s *kvStorage) bump(e *entry) {
+	s.version += 1
+	e.version = s.version
+}
+
+// setDeadline sets expiration time of the key, zero expires removes ttl.
+// Must be called with mutex held
+func (s *kvStorage) setDeadline(key string, expires time.Time) {
+	if expires.IsZero() {
 		delete(s.expires, key)
+	} else {
+		s.expires[key] = expires
+	}
+	if e, exists := s.data[key]; exists {
+		s.bump(e)
+	}
+
+	if s.deadlines != nil && s.deadlines.set(key, expires) {
+		// nearest deadline changed
+		select {
+		case s.wakeup <- struct{}{}:
+		default:
+		}
 	}
 }
 
+// unlink removes key with its ttl, must be called with mutex held
+func (s *kvStorage) unlink(key string) bool {
+	e, exists := s.data[key]
+	if !exists {
+		return false
+	}
+
+	s.used -= e.size
+	delete(s.data, key)
+	s.index.remove(key)
+	s.setDeadline(key, time.Time{})
+	s.version += 1
+	s.removals[removalSlotOf(key)] = s.version
+	return true
+}
+
 func (s *kvStorage) Delete(keys ...string) int {
 	if s.closed() {
 		panic("Delete over closed storage")
 	}
 	
-	kDeleted := 0
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	
+
+	return s.deleteLocked(keys, time.Now())
+}
+
+// deleteLocked returns number of deleted keys, must be called with mutex held
+func (s *kvStorage) deleteLocked(keys []string, now time.Time) int {
+	kDeleted := 0
+	deleted := make([]string, 0, len(keys))
 	for _, key := range keys {
 		_, exists := s.data[key]
 		if exists {
 
 			// dont consider expired keys
-			if expires, exists := s.expires[key]; !exists || time.Now().Before(expires) {
+			if expires, exists := s.expires[key]; !exists || now.Before(expires) {
 				kDeleted += 1
+				s.events.emit(EventsGeneric, EventDel, key)
+			} else {
+				s.events.emit(EventsExpired, EventExpired, key)
 			}
 			
-			delete(s.data, key)
-			delete(s.expires, key)
+			s.unlink(key)
+			s.dirty += 1
+			deleted = append(deleted, key)
 		}
 	}
+	s.logDel(deleted...)
 
 	return kDeleted
 }
@@ -113,8 +431,8 @@ func (s *kvStorage) cleanup(key string) (deleted bool) {
 	expires, exists := s.expires[key]
 	// must deny write ops after check but before actual deletion
 	if exists && time.Now().After(expires) {
-		delete(s.data, key)
-		delete(s.expires, key)
+		s.reclaim(key)
+		s.expiredLazy += 1
 		deleted = true
 	}
 
@@ -128,61 +446,57 @@ func (s *kvStorage) Get(key string) (interface{}, bool) {
 	
 	s.mutex.RLock()
 
-	value, exists := s.data[key]
+	e, exists := s.data[key]
 	if !exists {
 		s.mutex.RUnlock()
 		return nil, false
 	}
 	expires, exists := s.expires[key]
+	value := e.value
+	if c, ok := value.(container); ok {
+		value = c.export()
+	}
 	
 	s.mutex.RUnlock()
 
-	if exists && time.Now().After(expires) {
+	now := time.Now()
+	if exists && now.After(expires) {
 		go s.cleanup(key)
 		return nil, false
 	}
 
+	s.touch(e, now)
 	return value, true
 }
 
-// now works incorrectly
 func (s *kvStorage) Keys(pattern string) ([]string, error) {
 	if s.closed() {
 		panic("Keys over closed storage")
 	}
 
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys(p), nil
+}
+
+// keys returns not expired keys matching the pattern
+func (s *kvStorage) keys(p *Pattern) []string {
 	result := make([]string, 0)
 
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for key, _ := range s.data {
-		expires, exists := s.expires[key]
-		
-		if !exists || time.Now().Before(expires) { // not expired
-			
-			if Match(key, pattern) {
-				result = append(result, key)
-			} // else skip
-		} else {  // expired
-			// TODO: delete key (?)
+	now := time.Now()
+	for key := range s.data {
+		if _, exists := s.lookup(key, now); exists && p.Match(key) {
+			result = append(result, key)
 		}
 	}
-
-	return result, nil
+	return result
 }
 
-func (s *kvStorage) cleanupAll() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	for key, expires := range s.expires {
-		if time.Now().After(expires) {
-			delete(s.data, key)
-			delete(s.expires, key)
-		}
-	}
-}
 
 func (s *kvStorage) expirationChecker() {
 	ticker := time.NewTicker(s.resolution)
@@ -190,7 +504,7 @@ func (s *kvStorage) expirationChecker() {
 	for {
 		select {
 		case <- ticker.C:
-			s.cleanupAll()
+			s.activeExpireCycle()
 		case _, ok := <- s.done:
 			if !ok {
 				ticker.Stop()
@@ -199,82 +513,3 @@ func (s *kvStorage) expirationChecker() {
 		}
 	}
 }
-
-func Match(str, pattern string) bool {
-	if str == "" {
-		return pattern == "" || pattern == "*"
-	} else if pattern == "" {
-		return false
-	}
-	
-	pPos := 0
-	p := []rune(pattern)
-	for i, r := range str {
-		if pPos == len(p) {
-			return false
-		}
-		switch p[pPos] {
-		case '?':
-			pPos += 1
-		case '*':
-			return Match(str[i:], pattern[pPos + 1:]) || Match(str[i + 1:], pattern[pPos:])
-		case '[':
-			pPos += 1
-			ban := false
-			if p[pPos] == '^' {
-				pPos += 1
-				ban = true
-			}
-			
-			anyMatched := false
-			for p[pPos] != ']' {
-				if pPos >= len(p) {
-					panic("Wrong Pattern: missing closing \"]\"")
-				}
-				if p[pPos] == '\\' {
-					pPos += 1
-					if p[pPos] == r {
-						anyMatched = true
-					}
-				} else {
-					if p[pPos] == '-' {
-						prevRune := p[pPos - 1]
-						nextRune := p[pPos + 1]
-						if nextRune == '\\' {
-							nextRune = p[pPos + 2]
-							pPos += 1
-						}
-						if prevRune <= r && r <= nextRune {
-							anyMatched = true
-						}
-						pPos += 1
-					} else {
-						if p[pPos] == r {
-							anyMatched = true
-						}
-					}
-				}
-
-				pPos += 1
-			
-			}
-			if (!anyMatched && !ban) || (anyMatched && ban) {
-				return false
-			}
-			pPos += 1
-		case '\\':
-			// must simply compare next symbols as is
-			pPos += 1
-			fallthrough
-
-		default:
-			if r != p[pPos] {
-				return false
-			}
-			pPos += 1
-		}
-	}
-
-
-	return Match("", pattern[pPos:])
-}
\ No newline at end of file
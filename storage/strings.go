@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotString = errors.New("value is not a string")
+	ErrOffset = errors.New("offset is out of range")
+	ErrGetExOptions = errors.New("only one of ttl, expiration time and persist can be used, ttl must be nonnegative")
+)
+
+// maxStringSize limits strings grown by SETRANGE and APPEND, same as proto-max-bulk-len of redis
+var maxStringSize = 512 << 20
+
+// rawString is a string modified in place by APPEND and SETRANGE, so appending
+// to a long string doesn't copy it. Plain strings are converted on the first such command
+type rawString struct {
+	buf []byte
+}
+
+func (r *rawString) typeName() string {
+	return "string"
+}
+
+func (r *rawString) export() interface{} {
+	return string(r.buf)
+}
+
+func (r *rawString) size() int64 {
+	return 16 + int64(cap(r.buf))
+}
+
+func (r *rawString) len() int {
+	return len(r.buf)
+}
+
+// textOf returns textual form of scalar value, numbers are formatted like INCRBYFLOAT does
+func textOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return string(v), true
+	}
+	return "", false
+}
+
+// textAt returns string stored at the key, contents of rawString are returned as raw
+// to avoid copying them. Missing key gives empty text. Must be called with mutex held
+func (s *kvStorage) textAt(key string, now time.Time) (text string, raw []byte, err error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		return "", nil, nil
+	}
+
+	switch v := e.value.(type) {
+	case *rawString:
+		return "", v.buf, nil
+	case container:
+		return "", nil, ErrWrongType
+	}
+	text, ok := textOf(e.value)
+	if !ok {
+		return "", nil, ErrNotString
+	}
+	return text, nil, nil
+}
+
+// rawStringAt returns string stored at the key converting it to rawString, missing key
+// gives nil unless create is set. Zero now disables expiration check. Must be called with mutex held
+func (s *kvStorage) rawStringAt(key string, now time.Time, create bool) (*rawString, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		if !create {
+			return nil, nil, nil
+		}
+		e = s.create(key, &rawString{})
+	}
+
+	switch v := e.value.(type) {
+	case *rawString:
+		return v, e, nil
+	case container:
+		return nil, nil, ErrWrongType
+	}
+	text, ok := textOf(e.value)
+	if !ok {
+		return nil, nil, ErrNotString
+	}
+	r := &rawString{buf: []byte(text)}
+	e.value = r
+	s.account(key, e)
+	return r, e, nil
+}
+
+// appendString and setRange are shared by commands and append-only file replay,
+// must be called with mutex held
+
+func (s *kvStorage) appendString(key string, value string, now time.Time) (int, error) {
+	if len(value) > maxStringSize {
+		return 0, ErrOffset
+	}
+	r, e, err := s.rawStringAt(key, now, true)
+	if err != nil {
+		return 0, err
+	}
+	if len(r.buf) + len(value) > maxStringSize {
+		return 0, ErrOffset
+	}
+
+	r.buf = append(r.buf, value...)
+	s.account(key, e)
+	return len(r.buf), nil
+}
+
+func (s *kvStorage) setRange(key string, offset int, value string, now time.Time) (int, error) {
+	if offset < 0 || offset + len(value) > maxStringSize {
+		return 0, ErrOffset
+	}
+	r, e, err := s.rawStringAt(key, now, len(value) > 0)
+	if r == nil || len(value) == 0 {
+		// nothing to write, like in redis missing key isn't created
+		if r == nil {
+			return 0, err
+		}
+		return len(r.buf), nil
+	}
+
+	if end := offset + len(value); end > len(r.buf) {
+		// gap is zero-padded
+		r.buf = append(r.buf, make([]byte, end - len(r.buf))...)
+	}
+	copy(r.buf[offset:], value)
+	s.account(key, e)
+	return len(r.buf), nil
+}
+
+// Append appends value to the string creating it if needed, returns new length in bytes
+func (s *kvStorage) Append(key string, value string) (int, error) {
+	if s.closed() {
+		panic("Append over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.appendLocked(key, value, time.Now())
+}
+
+// appendLocked must be called with mutex held
+func (s *kvStorage) appendLocked(key string, value string, now time.Time) (int, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	length, err := s.appendString(key, value, now)
+	if err != nil {
+		return 0, err
+	}
+	s.dirty += 1
+	s.logAppend(key, value)
+	s.events.emit(EventsString, EventAppend, key)
+	return length, nil
+}
+
+// SetRange overwrites bytes of the string starting at offset, returns new length in bytes
+func (s *kvStorage) SetRange(key string, offset int, value string) (int, error) {
+	if s.closed() {
+		panic("SetRange over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	length, err := s.setRange(key, offset, value, time.Now())
+	if err != nil || len(value) == 0 {
+		return length, err
+	}
+	s.dirty += 1
+	s.logSetRange(key, offset, value)
+	s.events.emit(EventsString, EventSetRange, key)
+	return length, nil
+}
+
+// GetRange returns bytes of the string in the inclusive range, negative offsets count from the end
+func (s *kvStorage) GetRange(key string, start, stop int) (string, error) {
+	if s.closed() {
+		panic("GetRange over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	text, raw, err := s.textAt(key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	start, stop, ok := normalizeRange(start, stop, len(text) + len(raw))
+	if !ok {
+		return "", nil
+	}
+	if raw != nil {
+		return string(raw[start:stop + 1]), nil
+	}
+	return text[start:stop + 1], nil
+}
+
+// StrLen returns length of the string in bytes, 0 for missing key
+func (s *kvStorage) StrLen(key string) (int, error) {
+	if s.closed() {
+		panic("StrLen over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	text, raw, err := s.textAt(key, time.Now())
+	return len(text) + len(raw), err
+}
+
+// plainAt returns value of not expired key which isn't of aggregate type, must be called with mutex held
+func (s *kvStorage) plainAt(key string, now time.Time) (interface{}, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		return nil, nil, nil
+	}
+	switch v := e.value.(type) {
+	case *rawString:
+		return v.export(), e, nil
+	case container:
+		return nil, nil, ErrWrongType
+	}
+	return e.value, e, nil
+}
+
+// GetDel returns value of the key and deletes it
+func (s *kvStorage) GetDel(key string) (interface{}, bool, error) {
+	if s.closed() {
+		panic("GetDel over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, e, err := s.plainAt(key, time.Now())
+	if e == nil {
+		return nil, false, err
+	}
+	s.unlink(key)
+	s.dirty += 1
+	s.logDel(key)
+	s.events.emit(EventsGeneric, EventDel, key)
+	return value, true, nil
+}
+
+// GetExOptions change ttl of the key read by GetEx, at most one of them can be set.
+// Zero options make GetEx same as Get
+type GetExOptions struct {
+	// relative ttl
+	TTL time.Duration
+	// absolute expiration time, time in the past deletes the key
+	At time.Time
+	// remove ttl
+	Persist bool
+}
+
+func (opts GetExOptions) validate() error {
+	set := 0
+	for _, isSet := range []bool{opts.TTL != 0, !opts.At.IsZero(), opts.Persist} {
+		if isSet {
+			set += 1
+		}
+	}
+	if set > 1 || opts.TTL < 0 {
+		return ErrGetExOptions
+	}
+	return nil
+}
+
+// GetEx returns value of the key and changes its ttl in one step
+func (s *kvStorage) GetEx(key string, opts GetExOptions) (interface{}, bool, error) {
+	if s.closed() {
+		panic("GetEx over closed storage")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	value, e, err := s.plainAt(key, now)
+	if e == nil {
+		return nil, false, err
+	}
+	s.touch(e, now)
+
+	at := opts.At
+	if opts.TTL > 0 {
+		at = now.Add(opts.TTL)
+	}
+	switch {
+	case !at.IsZero() && !at.After(now):
+		s.unlink(key)
+		s.dirty += 1
+		s.logDel(key)
+		s.events.emit(EventsGeneric, EventDel, key)
+	case !at.IsZero():
+		s.setDeadline(key, at)
+		s.dirty += 1
+		s.logExpireAt(key, at)
+		s.events.emit(EventsGeneric, EventExpire, key)
+	case opts.Persist:
+		if _, volatile := s.expires[key]; volatile {
+			s.setDeadline(key, time.Time{})
+			s.dirty += 1
+			s.logExpireAt(key, time.Time{})
+			s.events.emit(EventsGeneric, EventPersist, key)
+		}
+	}
+	return value, true, nil
+}
+
+func (s *shardedStorage) Append(key string, value string) (int, error) {
+	return s.shards.shardOf(key).Append(key, value)
+}
+
+func (s *shardedStorage) SetRange(key string, offset int, value string) (int, error) {
+	return s.shards.shardOf(key).SetRange(key, offset, value)
+}
+
+func (s *shardedStorage) GetRange(key string, start, stop int) (string, error) {
+	return s.shards.shardOf(key).GetRange(key, start, stop)
+}
+
+func (s *shardedStorage) StrLen(key string) (int, error) {
+	return s.shards.shardOf(key).StrLen(key)
+}
+
+func (s *shardedStorage) GetDel(key string) (interface{}, bool, error) {
+	return s.shards.shardOf(key).GetDel(key)
+}
+
+func (s *shardedStorage) GetEx(key string, opts GetExOptions) (interface{}, bool, error) {
+	return s.shards.shardOf(key).GetEx(key, opts)
+}
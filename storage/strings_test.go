@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppend(t *testing.T) {
+	data := New(0).(*kvStorage)
+	defer data.Close()
+
+	if res, err := data.Append("log", "line1\n"); err != nil || res != 6 {
+		t.Fatalf("Subtest 1: Append missing key: expected 6, got %d, %v\n", res, err)
+	}
+	if res, _ := data.Append("log", "line2\n"); res != 12 {
+		t.Fatalf("Subtest 2: Append: expected 12, got %d\n", res)
+	}
+	if val, _ := data.Get("log"); val != "line1\nline2\n" {
+		t.Fatalf("Subtest 2: Get: expected %q, got %#v\n", "line1\nline2\n", val)
+	}
+
+	// numbers are appended to as strings
+	data.Set("number", float64(10), zeroDuration)
+	data.Append("number", "5")
+	if res, err := data.IncrBy("number", 1); err != nil || res != 106 {
+		t.Fatalf("Subtest 3: IncrBy after Append: expected 106, got %d, %v\n", res, err)
+	}
+
+	data.Set("object", map[string]interface{}{"a": 1.0}, zeroDuration)
+	if _, err := data.Append("object", "x"); err != ErrNotString {
+		t.Fatalf("Subtest 4: Append to json object: expected %v, got %v\n", ErrNotString, err)
+	}
+	data.HSet("hash", map[string]interface{}{"f": "v"})
+	if _, err := data.Append("hash", "x"); err != ErrWrongType {
+		t.Fatalf("Subtest 5: Append to hash: expected %v, got %v\n", ErrWrongType, err)
+	}
+
+	data.Set("volatile", "a", time.Hour)
+	data.Append("volatile", "b")
+	if ttl := data.TTL("volatile"); ttl <= 0 {
+		t.Fatalf("Subtest 6: Append must keep ttl, got %v\n", ttl)
+	}
+
+	data.Delete("log", "number", "object", "hash", "volatile")
+	if data.used != 0 {
+		t.Fatalf("Subtest 7: expected zero memory usage after deletion, got %d\n", data.used)
+	}
+}
+
+func TestGetRangeSetRange(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("key", "Hello, World", zeroDuration)
+	cases := []struct{
+		start, stop int
+		expected string
+	}{
+		{0, 4, "Hello"},
+		{-5, -1, "World"},
+		{0, -1, "Hello, World"},
+		{5, 100, ", World"},
+		{7, 3, ""},
+		{100, 200, ""},
+	}
+	for i, c := range cases {
+		if res, err := data.GetRange("key", c.start, c.stop); err != nil || res != c.expected {
+			t.Fatalf("Subtest %d: GetRange(%d, %d): expected %q, got %q, %v\n", i + 1, c.start, c.stop, c.expected, res, err)
+		}
+	}
+
+	if res, err := data.SetRange("key", 7, "Redis"); err != nil || res != 12 {
+		t.Fatalf("Subtest 7: SetRange: expected 12, got %d, %v\n", res, err)
+	}
+	if val, _ := data.Get("key"); val != "Hello, Redis" {
+		t.Fatalf("Subtest 7: Get: expected %q, got %#v\n", "Hello, Redis", val)
+	}
+
+	if res, _ := data.SetRange("padded", 3, "x"); res != 4 {
+		t.Fatalf("Subtest 8: SetRange missing key: expected 4, got %d\n", res)
+	}
+	if val, _ := data.Get("padded"); val != "\x00\x00\x00x" {
+		t.Fatalf("Subtest 8: Get: expected zero-padded string, got %q\n", val)
+	}
+
+	if res, _ := data.SetRange("missing", 5, ""); res != 0 || data.Type("missing") != "none" {
+		t.Fatalf("Subtest 9: SetRange with empty value must not create key, got %d\n", res)
+	}
+	if _, err := data.SetRange("key", -1, "x"); err != ErrOffset {
+		t.Fatalf("Subtest 10: SetRange negative offset: expected %v, got %v\n", ErrOffset, err)
+	}
+	if _, err := data.SetRange("key", maxStringSize, "x"); err != ErrOffset {
+		t.Fatalf("Subtest 11: SetRange over max size: expected %v, got %v\n", ErrOffset, err)
+	}
+
+	if res, _ := data.StrLen("key"); res != 12 {
+		t.Fatalf("Subtest 12: StrLen: expected 12, got %d\n", res)
+	}
+	data.Set("unicode", "привет", zeroDuration)
+	if res, _ := data.StrLen("unicode"); res != 12 {
+		t.Fatalf("Subtest 13: StrLen counts bytes: expected 12, got %d\n", res)
+	}
+	if res, _ := data.StrLen("missing"); res != 0 {
+		t.Fatalf("Subtest 14: StrLen missing key: expected 0, got %d\n", res)
+	}
+}
+
+func TestGetDelGetEx(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("key", "val", zeroDuration)
+	if val, exists, err := data.GetDel("key"); err != nil || !exists || val != "val" {
+		t.Fatalf("Subtest 1: GetDel: expected val, got %#v, %v, %v\n", val, exists, err)
+	}
+	if _, exists, _ := data.GetDel("key"); exists {
+		t.Fatalf("Subtest 2: GetDel must delete the key\n")
+	}
+	data.SAdd("set", "a")
+	if _, _, err := data.GetDel("set"); err != ErrWrongType {
+		t.Fatalf("Subtest 3: GetDel of set: expected %v, got %v\n", ErrWrongType, err)
+	}
+
+	data.Set("key", "val", zeroDuration)
+	if val, _, _ := data.GetEx("key", GetExOptions{TTL: time.Hour}); val != "val" {
+		t.Fatalf("Subtest 4: GetEx: expected val, got %#v\n", val)
+	}
+	if ttl := data.TTL("key"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("Subtest 4: GetEx must set ttl, got %v\n", ttl)
+	}
+	data.GetEx("key", GetExOptions{Persist: true})
+	if ttl := data.TTL("key"); ttl != TTLNoExpire {
+		t.Fatalf("Subtest 5: GetEx with Persist: expected %v, got %v\n", TTLNoExpire, ttl)
+	}
+	if val, exists, _ := data.GetEx("key", GetExOptions{At: time.Now().Add(-time.Second)}); !exists || val != "val" {
+		t.Fatalf("Subtest 6: GetEx with past time: expected val, got %#v\n", val)
+	}
+	if _, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 6: GetEx with past time must delete the key\n")
+	}
+	if _, _, err := data.GetEx("key", GetExOptions{TTL: time.Hour, Persist: true}); err != ErrGetExOptions {
+		t.Fatalf("Subtest 7: GetEx with conflicting options: expected %v, got %v\n", ErrGetExOptions, err)
+	}
+}
+
+func TestStringPersistence(t *testing.T) {
+	dir := t.TempDir()
+	aof := filepath.Join(dir, "appendonly.taof")
+	snapshot := filepath.Join(dir, "dump.trdb")
+
+	data := New(0, WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0))
+	data.Append("log", "a")
+	data.Append("log", "b")
+	data.SetRange("log", 4, "z")
+	data.Set("volatile", "val", time.Hour)
+	data.GetEx("volatile", GetExOptions{Persist: true})
+	data.Set("deleted", "val", zeroDuration)
+	data.GetDel("deleted")
+	data.Save()
+	data.Close()
+
+	check := func(subtest int, data Storage) {
+		if val, _ := data.Get("log"); val != "ab\x00\x00z" {
+			t.Fatalf("Subtest %d: Get log: expected %q, got %q\n", subtest, "ab\x00\x00z", val)
+		}
+		if ttl := data.TTL("volatile"); ttl != TTLNoExpire {
+			t.Fatalf("Subtest %d: TTL volatile: expected %v, got %v\n", subtest, TTLNoExpire, ttl)
+		}
+		if _, exists := data.Get("deleted"); exists {
+			t.Fatalf("Subtest %d: Get deleted: expected nothing\n", subtest)
+		}
+	}
+
+	data = New(0, WithAppendOnly(aof, FsyncNever))
+	check(1, data)
+	data.Close()
+
+	data = New(0, WithSnapshot(snapshot, 0))
+	defer data.Close()
+	check(2, data)
+	// restored strings can be appended to
+	if res, _ := data.Append("log", "!"); res != 6 {
+		t.Fatalf("Subtest 3: Append after restart: expected 6, got %d\n", res)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"time"
+)
+
+// special values returned by TTL, same as in redis
+const (
+	TTLNoKey time.Duration = -2
+	TTLNoExpire time.Duration = -1
+)
+
+// lookup returns entry of not expired key, must be called with mutex held
+func (s *kvStorage) lookup(key string, now time.Time) (*entry, bool) {
+	e, exists := s.data[key]
+	if !exists {
+		return nil, false
+	}
+	if expires, exists := s.expires[key]; exists && now.After(expires) {
+		return nil, false
+	}
+	return e, true
+}
+
+// TTL returns remaining time to live of the key,
+// TTLNoKey if key doesn't exist and TTLNoExpire if key has no ttl
+func (s *kvStorage) TTL(key string) time.Duration {
+	if s.closed() {
+		panic("TTL over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	if _, exists := s.lookup(key, now); !exists {
+		return TTLNoKey
+	}
+	expires, exists := s.expires[key]
+	if !exists {
+		return TTLNoExpire
+	}
+	return expires.Sub(now)
+}
+
+// Expire sets ttl of existing key, non-positive ttl deletes the key.
+// Returns false if key doesn't exist
+func (s *kvStorage) Expire(key string, ttl time.Duration) bool {
+	return s.ExpireAt(key, time.Now().Add(ttl))
+}
+
+// ExpireAt sets absolute expiration time of existing key, time in the past deletes the key.
+// Returns false if key doesn't exist
+func (s *kvStorage) ExpireAt(key string, at time.Time) bool {
+	if s.closed() {
+		panic("ExpireAt over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.expireAtLocked(key, at, time.Now())
+}
+
+// expireAtLocked must be called with mutex held
+func (s *kvStorage) expireAtLocked(key string, at time.Time, now time.Time) bool {
+	if _, exists := s.lookup(key, now); !exists {
+		return false
+	}
+
+	s.dirty += 1
+	if !at.After(now) {
+		s.unlink(key)
+		s.logDel(key)
+		s.events.emit(EventsGeneric, EventDel, key)
+		return true
+	}
+	s.setDeadline(key, at)
+	s.logExpireAt(key, at)
+	s.events.emit(EventsGeneric, EventExpire, key)
+	return true
+}
+
+// Persist removes ttl of the key, returns false if key doesn't exist or has no ttl
+func (s *kvStorage) Persist(key string) bool {
+	if s.closed() {
+		panic("Persist over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.persistLocked(key, time.Now())
+}
+
+// persistLocked must be called with mutex held
+func (s *kvStorage) persistLocked(key string, now time.Time) bool {
+	if _, exists := s.lookup(key, now); !exists {
+		return false
+	}
+	if _, exists := s.expires[key]; !exists {
+		return false
+	}
+
+	s.dirty += 1
+	s.setDeadline(key, time.Time{})
+	s.logExpireAt(key, time.Time{})
+	s.events.emit(EventsGeneric, EventPersist, key)
+	return true
+}
+
+func (s *shardedStorage) TTL(key string) time.Duration {
+	return s.shards.shardOf(key).TTL(key)
+}
+
+func (s *shardedStorage) Expire(key string, ttl time.Duration) bool {
+	return s.shards.shardOf(key).Expire(key, ttl)
+}
+
+func (s *shardedStorage) ExpireAt(key string, at time.Time) bool {
+	return s.shards.shardOf(key).ExpireAt(key, at)
+}
+
+func (s *shardedStorage) Persist(key string) bool {
+	return s.shards.shardOf(key).Persist(key)
+}
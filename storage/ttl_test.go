@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if ttl := data.TTL("key"); ttl != TTLNoKey {
+		t.Fatalf("Subtest 1: TTL of missing key: expected %d, got %d\n", TTLNoKey, ttl)
+	}
+
+	data.Set("key", "val", zeroDuration)
+	if ttl := data.TTL("key"); ttl != TTLNoExpire {
+		t.Fatalf("Subtest 2: TTL of key without ttl: expected %d, got %d\n", TTLNoExpire, ttl)
+	}
+
+	data.Set("key", "val", time.Hour)
+	if ttl := data.TTL("key"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("Subtest 3: TTL: expected value in (0, 1h], got %s\n", ttl)
+	}
+
+	data.Set("key", "val", defaultTTL)
+	time.Sleep(defaultSleep)
+	if ttl := data.TTL("key"); ttl != TTLNoKey {
+		t.Fatalf("Subtest 4: TTL of expired key: expected %d, got %d\n", TTLNoKey, ttl)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	if data.Expire("key", time.Hour) {
+		t.Fatalf("Subtest 1: Expire of missing key: expected false\n")
+	}
+
+	data.Set("key", "val", zeroDuration)
+	if !data.Expire("key", defaultTTL) {
+		t.Fatalf("Subtest 2: Expire: expected true\n")
+	}
+	time.Sleep(defaultSleep)
+	if val, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 2: Get key: expected nothing, got %v\n", val)
+	}
+
+	data.Set("key", "val", zeroDuration)
+	if !data.Expire("key", -time.Second) {
+		t.Fatalf("Subtest 3: Expire with negative ttl: expected true\n")
+	}
+	if val, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 3: Get key: expected nothing, got %v\n", val)
+	}
+
+	data.Set("key", "val", zeroDuration)
+	if !data.ExpireAt("key", time.Now().Add(defaultTTL)) {
+		t.Fatalf("Subtest 4: ExpireAt: expected true\n")
+	}
+	time.Sleep(defaultSleep)
+	if val, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 4: Get key: expected nothing, got %v\n", val)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	data.Set("key", "val", zeroDuration)
+	if data.Persist("key") {
+		t.Fatalf("Subtest 1: Persist of key without ttl: expected false\n")
+	}
+
+	data.Set("key", "val", defaultTTL)
+	if !data.Persist("key") {
+		t.Fatalf("Subtest 2: Persist: expected true\n")
+	}
+	time.Sleep(defaultSleep)
+	if val, _ := data.Get("key"); val != "val" {
+		t.Fatalf("Subtest 2: Get key: expected %s, got %v\n", "val", val)
+	}
+}
+
+func TestExpireReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	data.Set("expiring", "val", zeroDuration)
+	data.Expire("expiring", defaultTTL)
+	data.Set("persisted", "val", defaultTTL)
+	data.Persist("persisted")
+	data.Close()
+
+	time.Sleep(defaultSleep)
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	defer data.Close()
+	if val, exists := data.Get("expiring"); exists {
+		t.Fatalf("Get expiring: expected nothing, got %v\n", val)
+	}
+	if ttl := data.TTL("persisted"); ttl != TTLNoExpire {
+		t.Fatalf("TTL persisted: expected %d, got %d\n", TTLNoExpire, ttl)
+	}
+}
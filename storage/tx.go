@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTxAborted is returned by Exec if some of the watched keys was changed
+var ErrTxAborted = errors.New("transaction aborted, watched key was modified")
+
+// Command is a command queued in transaction, it is created by one of XCommand functions
+type Command struct {
+	name string
+	keys []string
+	// run executes command over locked shards holding its keys
+	run func(p partitions, now time.Time) (interface{}, error)
+}
+
+func (c Command) Name() string {
+	return c.name
+}
+
+// CommandResult is a result of a command executed by Exec, like in redis failure
+// of one command doesn't stop the others
+type CommandResult struct {
+	Value interface{}
+	Err error
+}
+
+// commands below have the same results as corresponding methods of Storage,
+// results with several values are returned as []interface{}
+
+func SetCommand(key string, value interface{}, ttl time.Duration) Command {
+	return Command{name: "set", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		var expires time.Time
+		if ttl > 0 {
+			expires = now.Add(ttl)
+		}
+		return nil, p.shardOf(key).setLocked(key, value, expires)
+	}}
+}
+
+// GetCommand returns nil for missing key and fails with ErrWrongType for hashes, lists and sets like GET of redis
+func GetCommand(key string) Command {
+	return Command{name: "get", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		s := p.shardOf(key)
+		value, e, err := s.plainAt(key, now)
+		if e == nil {
+			return nil, err
+		}
+		s.touch(e, now)
+		return value, nil
+	}}
+}
+
+func DelCommand(keys ...string) Command {
+	return Command{name: "del", keys: keys, run: func(p partitions, now time.Time) (interface{}, error) {
+		kDeleted := 0
+		for _, key := range keys {
+			kDeleted += p.shardOf(key).deleteLocked([]string{key}, now)
+		}
+		return kDeleted, nil
+	}}
+}
+
+func ExpireCommand(key string, ttl time.Duration) Command {
+	return Command{name: "expire", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).expireAtLocked(key, now.Add(ttl), now), nil
+	}}
+}
+
+func PersistCommand(key string) Command {
+	return Command{name: "persist", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).persistLocked(key, now), nil
+	}}
+}
+
+func IncrByCommand(key string, delta int64) Command {
+	return Command{name: "incrby", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).incrByLocked(key, delta, now)
+	}}
+}
+
+func IncrByFloatCommand(key string, delta float64) Command {
+	return Command{name: "incrbyfloat", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).incrByFloatLocked(key, delta, now)
+	}}
+}
+
+func AppendCommand(key string, value string) Command {
+	return Command{name: "append", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).appendLocked(key, value, now)
+	}}
+}
+
+func HSetCommand(key string, fields map[string]interface{}) Command {
+	return Command{name: "hset", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).hsetLocked(key, fields, now)
+	}}
+}
+
+// HGetCommand returns nil for missing field
+func HGetCommand(key string, field string) Command {
+	return Command{name: "hget", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		value, _, err := p.shardOf(key).hgetLocked(key, field, now)
+		return value, err
+	}}
+}
+
+func HDelCommand(key string, fields ...string) Command {
+	return Command{name: "hdel", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).hdelLocked(key, fields, now)
+	}}
+}
+
+func HIncrByCommand(key string, field string, delta int64) Command {
+	return Command{name: "hincrby", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).hincrByLocked(key, field, delta, now)
+	}}
+}
+
+func LPushCommand(key string, values ...interface{}) Command {
+	return pushCommand("lpush", key, true, values)
+}
+
+func RPushCommand(key string, values ...interface{}) Command {
+	return pushCommand("rpush", key, false, values)
+}
+
+func pushCommand(name string, key string, left bool, values []interface{}) Command {
+	return Command{name: name, keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).pushLocked(key, left, values, now)
+	}}
+}
+
+// LPopCommand and RPopCommand return nil for empty list
+func LPopCommand(key string) Command {
+	return popCommand("lpop", key, true)
+}
+
+func RPopCommand(key string) Command {
+	return popCommand("rpop", key, false)
+}
+
+func popCommand(name string, key string, left bool) Command {
+	return Command{name: name, keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		value, _, err := p.shardOf(key).popLocked(key, left, now)
+		return value, err
+	}}
+}
+
+func SAddCommand(key string, members ...string) Command {
+	return Command{name: "sadd", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).saddLocked(key, members, now)
+	}}
+}
+
+func SRemCommand(key string, members ...string) Command {
+	return Command{name: "srem", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).sremLocked(key, members, now)
+	}}
+}
+
+func ZAddCommand(key string, members ...ZMember) Command {
+	return Command{name: "zadd", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		for _, m := range members {
+			if !validScore(m.Score) {
+				return 0, ErrNotFloat
+			}
+		}
+		return p.shardOf(key).zaddLocked(key, members, now)
+	}}
+}
+
+func ZIncrByCommand(key string, member string, delta float64) Command {
+	return Command{name: "zincrby", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		if !validScore(delta) {
+			return 0.0, ErrNotFloat
+		}
+		return p.shardOf(key).zincrByLocked(key, member, delta, now)
+	}}
+}
+
+func ZRemCommand(key string, members ...string) Command {
+	return Command{name: "zrem", keys: []string{key}, run: func(p partitions, now time.Time) (interface{}, error) {
+		return p.shardOf(key).zremLocked(key, members, now)
+	}}
+}
+
+func (p partitions) watch(keys []string) map[string]uint64 {
+	shards := p.involved(keys...)
+	shards.rlock()
+	defer shards.runlock()
+
+	now := time.Now()
+	result := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		result[key] = p.shardOf(key).watchVersionOf(key, now)
+	}
+	return result
+}
+
+// exec locks shards of watched keys and keys of commands at once, so nothing can
+// change the keys between the check of versions and the last command
+func (p partitions) exec(watched map[string]uint64, cmds []Command) ([]CommandResult, error) {
+	keys := make([]string, 0, len(watched) + len(cmds))
+	for key := range watched {
+		keys = append(keys, key)
+	}
+	for _, cmd := range cmds {
+		keys = append(keys, cmd.keys...)
+	}
+	shards := p.involved(keys...)
+	shards.lock()
+	defer shards.unlock()
+
+	now := time.Now()
+	for key, version := range watched {
+		if p.shardOf(key).watchVersionOf(key, now) != version {
+			return nil, ErrTxAborted
+		}
+	}
+
+	results := make([]CommandResult, len(cmds))
+	for i, cmd := range cmds {
+		value, err := cmd.run(p, now)
+		results[i] = CommandResult{Value: value, Err: err}
+	}
+	return results, nil
+}
+
+// Watch returns current versions of the keys to be passed to Exec. Version changes on every write
+// to the key, including its deletion and expiration. Removals are tracked in a bounded table hashed by key,
+// so removal of another key rarely aborts Exec watching missing key
+func (s *kvStorage) Watch(keys ...string) map[string]uint64 {
+	if s.closed() {
+		panic("Watch over closed storage")
+	}
+	return partitions{s}.watch(keys)
+}
+
+// Exec atomically executes commands if versions of watched keys are the same, otherwise
+// returns ErrTxAborted and executes nothing
+func (s *kvStorage) Exec(watched map[string]uint64, cmds ...Command) ([]CommandResult, error) {
+	if s.closed() {
+		panic("Exec over closed storage")
+	}
+	return partitions{s}.exec(watched, cmds)
+}
+
+func (s *shardedStorage) Watch(keys ...string) map[string]uint64 {
+	if s.closed() {
+		panic("Watch over closed storage")
+	}
+	return s.shards.watch(keys)
+}
+
+func (s *shardedStorage) Exec(watched map[string]uint64, cmds ...Command) ([]CommandResult, error) {
+	if s.closed() {
+		panic("Exec over closed storage")
+	}
+	return s.shards.exec(watched, cmds)
+}
+
+// Tx collects watched keys and queued commands like WATCH and MULTI of redis do,
+// it isn't safe for concurrent use
+type Tx struct {
+	data Storage
+	watched map[string]uint64
+	queued []Command
+}
+
+func NewTx(data Storage) *Tx {
+	return &Tx{
+		data: data,
+		watched: make(map[string]uint64),
+	}
+}
+
+// Watch remembers versions of the keys, keys watched before keep their first versions
+func (tx *Tx) Watch(keys ...string) {
+	for key, version := range tx.data.Watch(keys...) {
+		if _, exists := tx.watched[key]; !exists {
+			tx.watched[key] = version
+		}
+	}
+}
+
+func (tx *Tx) Queue(cmds ...Command) {
+	tx.queued = append(tx.queued, cmds...)
+}
+
+// Discard forgets queued commands and watched keys
+func (tx *Tx) Discard() {
+	tx.watched = make(map[string]uint64)
+	tx.queued = nil
+}
+
+// Exec executes queued commands, after that Tx can be reused like after Discard
+func (tx *Tx) Exec() ([]CommandResult, error) {
+	defer tx.Discard()
+	return tx.data.Exec(tx.watched, tx.queued...)
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		data.Set("counter", "10", zeroDuration)
+		data.SAdd("set", "a")
+		data.Append("appended", "abc")
+
+		results, err := data.Exec(nil,
+			IncrByCommand("counter", 5),
+			GetCommand("counter"),
+			IncrByCommand("set", 1),
+			GetCommand("set"),
+			GetCommand("appended"),
+			RPushCommand("list", "x", "y"),
+			LPopCommand("list"),
+			DelCommand("counter", "set", "missing"),
+		)
+		if err != nil {
+			t.Fatalf("Subtest 1: Exec: unexpected error %v\n", err)
+		}
+		expected := []CommandResult{
+			{Value: int64(15)},
+			{Value: "15"},
+			{Value: int64(0), Err: ErrWrongType},
+			{Value: nil, Err: ErrWrongType},
+			{Value: "abc"},
+			{Value: 2},
+			{Value: "x"},
+			{Value: 2},
+		}
+		if !reflect.DeepEqual(results, expected) {
+			t.Fatalf("Subtest 1: Exec: expected %v, got %v\n", expected, results)
+		}
+		if res, _ := data.LRange("list", 0, -1); !reflect.DeepEqual(res, []interface{}{"y"}) {
+			t.Fatalf("Subtest 2: failed command must not stop others, got list %v\n", res)
+		}
+
+		data.Close()
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		data.Set("key", "val", zeroDuration)
+		data.HSet("hash", map[string]interface{}{"f": "v"})
+
+		versions := data.Watch("key", "hash", "missing")
+		if versions["key"] == 0 || versions["hash"] == 0 || versions["missing"] != 0 {
+			t.Fatalf("Subtest 1: Watch: unexpected versions %v\n", versions)
+		}
+		if _, err := data.Exec(versions, SetCommand("other", "val", zeroDuration)); err != nil {
+			t.Fatalf("Subtest 2: Exec with unchanged keys: unexpected error %v\n", err)
+		}
+
+		// no-op commands don't change versions
+		data.HDel("hash", "missing")
+		data.Persist("key")
+		if _, err := data.Exec(data.Watch("hash"), HDelCommand("hash", "f")); err != nil {
+			t.Fatalf("Subtest 3: unexpected error %v\n", err)
+		}
+
+		changes := []func(){
+			func() { data.Set("key", "val", zeroDuration) },
+			func() { data.Delete("key") },
+			func() { data.Set("missing", "val", zeroDuration) },
+			func() { data.Expire("key", time.Hour) },
+			func() { data.Append("key", "x") },
+			func() { data.SAdd("missing", "a") },
+			// missing key is created and deleted again
+			func() { data.Set("missing", "val", zeroDuration); data.Delete("missing") },
+			func() { data.SAdd("missing", "a"); data.SRem("missing", "a") },
+		}
+		for i, change := range changes {
+			data.Set("key", "val", zeroDuration)
+			data.Delete("missing")
+			versions := data.Watch("key", "missing")
+			change()
+			results, err := data.Exec(versions, SetCommand("result", i, zeroDuration))
+			if err != ErrTxAborted || results != nil {
+				t.Fatalf("Subtest %d: Exec after change: expected %v, got %v, %v\n", i + 4, ErrTxAborted, results, err)
+			}
+			if _, exists := data.Get("result"); exists {
+				t.Fatalf("Subtest %d: aborted Exec must execute nothing\n", i + 4)
+			}
+		}
+
+		// removal of unrelated key doesn't change version of watched missing key
+		data.Set("other", "val", zeroDuration)
+		versions = data.Watch("missing")
+		data.Delete("other")
+		if _, err := data.Exec(versions, SetCommand("result", "val", zeroDuration)); err != nil {
+			t.Fatalf("Subtest %d: Exec after deletion of unrelated key: unexpected error %v\n", len(changes) + 4, err)
+		}
+
+		data.Close()
+	}
+}
+
+func TestWatchExpired(t *testing.T) {
+	data := New(time.Hour)
+	defer data.Close()
+
+	data.Set("key", "val", 10 * time.Millisecond)
+	versions := data.Watch("key")
+	time.Sleep(20 * time.Millisecond)
+	if _, err := data.Exec(versions); err != ErrTxAborted {
+		t.Fatalf("Exec after expiration: expected %v, got %v\n", ErrTxAborted, err)
+	}
+}
+
+func TestTx(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	tx := NewTx(data)
+	tx.Watch("key")
+	tx.Queue(SetCommand("key", "val", zeroDuration))
+	tx.Discard()
+	if results, err := tx.Exec(); err != nil || len(results) != 0 {
+		t.Fatalf("Subtest 1: Exec after Discard: expected nothing, got %v, %v\n", results, err)
+	}
+	if _, exists := data.Get("key"); exists {
+		t.Fatalf("Subtest 1: discarded command must not be executed\n")
+	}
+
+	tx.Watch("key")
+	data.Set("key", "val", zeroDuration)
+	// key is watched since the first version
+	tx.Watch("key")
+	tx.Queue(SetCommand("key", "new", zeroDuration))
+	if _, err := tx.Exec(); err != ErrTxAborted {
+		t.Fatalf("Subtest 2: Exec: expected %v, got %v\n", ErrTxAborted, err)
+	}
+	if val, _ := data.Get("key"); val != "val" {
+		t.Fatalf("Subtest 2: aborted Exec must execute nothing, got %v\n", val)
+	}
+}
+
+// optimistic increments from several goroutines must not lose updates
+func TestTxConcurrentIncrement(t *testing.T) {
+	data := New(0, WithShards(4))
+	defer data.Close()
+
+	const workers, increments = 4, 100
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := NewTx(data)
+			for n := 0; n < increments; {
+				tx.Watch("counter")
+				val, _ := data.Get("counter")
+				current, _ := strconv.Atoi(toString(val))
+				tx.Queue(SetCommand("counter", strconv.Itoa(current + 1), zeroDuration))
+				if _, err := tx.Exec(); err == nil {
+					n += 1
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, _ := data.Get("counter"); val != strconv.Itoa(workers * increments) {
+		t.Fatalf("expected %d, got %v\n", workers * increments, val)
+	}
+}
+
+func toString(val interface{}) string {
+	s, _ := val.(string)
+	return s
+}
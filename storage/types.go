@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// container is a value of aggregate type (or a string appended to) which is modified in place
+// by its commands. Unlike plain values it is never shared outside the lock, Get returns its exported copy
+type container interface {
+	typeName() string
+	// export copies contents into the exported type (Hash, List, Members, ZSet or string)
+	export() interface{}
+	// approximate memory used by the value, maintained incrementally
+	size() int64
+	len() int
+}
+
+// TypeOf returns redis name of the type of value returned by Get,
+// all values stored with Set are strings
+func TypeOf(value interface{}) string {
+	switch value.(type) {
+	case Hash:
+		return "hash"
+	case List:
+		return "list"
+	case Members:
+		return "set"
+	case ZSet:
+		return "zset"
+	}
+	return "string"
+}
+
+// containerOf converts exported copy back into container, so values restored from disk
+// or passed to Set keep their type. Other values are returned as is
+func containerOf(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Hash:
+		return hashValueOf(v)
+	case List:
+		return listValueOf(v)
+	case Members:
+		return setValueOf(v)
+	case ZSet:
+		return zsetValueOf(v)
+	}
+	return value
+}
+
+// Type returns type of the value stored at the key or "none" if key doesn't exist
+func (s *kvStorage) Type(key string) string {
+	if s.closed() {
+		panic("Type over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	e, exists := s.lookup(key, time.Now())
+	if !exists {
+		return "none"
+	}
+	if c, ok := e.value.(container); ok {
+		return c.typeName()
+	}
+	return "string"
+}
+
+func (s *shardedStorage) Type(key string) string {
+	return s.shards.shardOf(key).Type(key)
+}
+
+// create stores new empty container at missing key, expired key is reclaimed first.
+// Must be called with mutex held
+func (s *kvStorage) create(key string, c container) *entry {
+	if _, stale := s.data[key]; stale {
+		s.reclaim(key)
+		s.expiredLazy += 1
+	}
+	s.store(key, c, time.Time{})
+	return s.data[key]
+}
+
+// resize updates memory accounting after in-place change of container stored at the key
+// and deletes the key if container became empty, like redis does. Must be called with mutex held
+func (s *kvStorage) resize(key string, e *entry) {
+	if e.value.(container).len() == 0 {
+		s.unlink(key)
+		return
+	}
+	s.account(key, e)
+}
+
+// account updates memory accounting and access stats after in-place change of container
+// stored at the key, must be called with mutex held
+func (s *kvStorage) account(key string, e *entry) {
+	size := entryOverhead + int64(len(key)) + e.value.(container).size()
+	s.used += size - e.size
+	e.size = size
+	s.bump(e)
+	s.touch(e, time.Now())
+}
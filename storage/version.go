@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionMismatch is returned by conditional writes if the key was changed since it was read
+var ErrVersionMismatch = errors.New("version of the key doesn't match expected one")
+
+// versionOf returns version of the key, 0 if it doesn't exist. Must be called with mutex held
+func (s *kvStorage) versionOf(key string, now time.Time) uint64 {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		return 0
+	}
+	return e.version
+}
+
+// number of removal versions kept by a shard, removal of another key aborts
+// transaction watching missing key only if they share the slot
+const removalSlots = 1024
+
+// removalSlotOf takes high bits of multiplied hash, because low ones are the same for keys of one shard
+func removalSlotOf(key string) uint32 {
+	return hashKey(key) * 2654435761 >> 22
+}
+
+// watchVersionOf is versionOf used by WATCH. Missing key gets version of the last removal of a key
+// hashed to its slot, so creating and deleting the key after WATCH changes it too.
+// Must be called with mutex held
+func (s *kvStorage) watchVersionOf(key string, now time.Time) uint64 {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		return s.removals[removalSlotOf(key)]
+	}
+	return e.version
+}
+
+func (s *kvStorage) GetWithVersion(key string) (interface{}, uint64, bool) {
+	if s.closed() {
+		panic("GetWithVersion over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	e, exists := s.lookup(key, now)
+	if !exists {
+		return nil, 0, false
+	}
+	s.touch(e, now)
+	if c, ok := e.value.(container); ok {
+		return c.export(), e.version, true
+	}
+	return e.value, e.version, true
+}
+
+// DeleteIfVersion returns false if key doesn't exist and version is 0
+func (s *kvStorage) DeleteIfVersion(key string, version uint64) (bool, error) {
+	if s.closed() {
+		panic("DeleteIfVersion over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if s.versionOf(key, now) != version {
+		return false, ErrVersionMismatch
+	}
+	return s.deleteLocked([]string{key}, now) > 0, nil
+}
+
+func (s *shardedStorage) GetWithVersion(key string) (interface{}, uint64, bool) {
+	return s.shards.shardOf(key).GetWithVersion(key)
+}
+
+func (s *shardedStorage) DeleteIfVersion(key string, version uint64) (bool, error) {
+	return s.shards.shardOf(key).DeleteIfVersion(key, version)
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	for _, data := range []Storage{New(0), New(0, WithShards(4))} {
+		zero := uint64(0)
+		result, err := data.SetWithOptions("key", "v1", zeroDuration, SetOptions{IfVersion: &zero})
+		if err != nil || !result.Written || result.Version == 0 {
+			t.Fatalf("Subtest 1: SET of missing key with version 0: unexpected result %+v, %v\n", result, err)
+		}
+		if _, err := data.SetWithOptions("key", "v2", zeroDuration, SetOptions{IfVersion: &zero}); err != ErrVersionMismatch {
+			t.Fatalf("Subtest 2: SET of existing key with version 0: expected %v, got %v\n", ErrVersionMismatch, err)
+		}
+
+		val, version, exists := data.GetWithVersion("key")
+		if !exists || val != "v1" || version != result.Version {
+			t.Fatalf("Subtest 3: GetWithVersion: expected v1 of version %d, got %v of version %d\n", result.Version, val, version)
+		}
+		next, err := data.SetWithOptions("key", "v2", time.Hour, SetOptions{IfVersion: &version})
+		if err != nil || next.Version <= version {
+			t.Fatalf("Subtest 4: SET with current version: expected greater version, got %+v, %v\n", next, err)
+		}
+		if _, err := data.SetWithOptions("key", "v3", zeroDuration, SetOptions{IfVersion: &version}); err != ErrVersionMismatch {
+			t.Fatalf("Subtest 5: SET with stale version: expected %v, got %v\n", ErrVersionMismatch, err)
+		}
+		if val, _ := data.Get("key"); val != "v2" {
+			t.Fatalf("Subtest 5: failed SET must write nothing, got %v\n", val)
+		}
+
+		if _, err := data.DeleteIfVersion("key", version); err != ErrVersionMismatch {
+			t.Fatalf("Subtest 6: DeleteIfVersion with stale version: expected %v, got %v\n", ErrVersionMismatch, err)
+		}
+		if deleted, err := data.DeleteIfVersion("key", next.Version); err != nil || !deleted {
+			t.Fatalf("Subtest 7: DeleteIfVersion with current version: expected true, got %v, %v\n", deleted, err)
+		}
+		if _, version, exists := data.GetWithVersion("key"); exists || version != 0 {
+			t.Fatalf("Subtest 8: GetWithVersion of deleted key: expected version 0, got %d\n", version)
+		}
+		if deleted, err := data.DeleteIfVersion("key", 0); err != nil || deleted {
+			t.Fatalf("Subtest 9: DeleteIfVersion of missing key: expected false, got %v, %v\n", deleted, err)
+		}
+
+		// recreated key doesn't get any of its old versions
+		recreated, _ := data.SetWithOptions("key", "v1", zeroDuration, SetOptions{})
+		if recreated.Version <= next.Version {
+			t.Fatalf("Subtest 10: version of recreated key must grow, got %d after %d\n", recreated.Version, next.Version)
+		}
+
+		data.Close()
+	}
+}
+
+func TestVersionsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.taof")
+
+	data := New(0, WithAppendOnly(path, FsyncNever))
+	for i := 0; i < 100; i += 1 {
+		data.Set("key", i, zeroDuration)
+	}
+	_, before, _ := data.GetWithVersion("key")
+	data.Close()
+
+	// version held by a client since before restart must not match unrelated newer write
+	data = New(0, WithAppendOnly(path, FsyncNever))
+	defer data.Close()
+	if _, after, _ := data.GetWithVersion("key"); after <= before {
+		t.Fatalf("Version of replayed key must be greater than before restart, got %d after %d\n", after, before)
+	}
+	data.Set("key", "new", zeroDuration)
+	if _, err := data.DeleteIfVersion("key", before); err != ErrVersionMismatch {
+		t.Fatalf("DeleteIfVersion with version from before restart: expected %v, got %v\n", ErrVersionMismatch, err)
+	}
+}
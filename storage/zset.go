@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrScoreNaN is returned by ZIncrBy if adding infinities of opposite signs gives NaN
+var ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// ZMember is a member of sorted set with its score
+type ZMember struct {
+	Member string
+	Score float64
+}
+
+// ZSet is a copy of sorted set value returned by Get ordered by score,
+// passing it to Set stores a sorted set
+type ZSet []ZMember
+
+// RangeOptions are used by ZRangeByScore
+type RangeOptions struct {
+	// order from the highest score to the lowest
+	Reverse bool
+	// number of skipped members and maximum number of returned ones,
+	// non-positive Count means no limit and negative Offset gives no members
+	Offset int
+	Count int
+}
+
+// zsetValue keeps members both in map for lookups by member and in skip list for ranges
+type zsetValue struct {
+	dict map[string]float64
+	zsl *zskiplist
+	used int64
+}
+
+func newZSetValue() *zsetValue {
+	return &zsetValue{
+		dict: make(map[string]float64),
+		zsl: newZSkiplist(),
+		used: 48 + zskiplistMaxLevel * 16,
+	}
+}
+
+func zsetValueOf(z ZSet) *zsetValue {
+	result := newZSetValue()
+	for _, m := range z {
+		result.add(m.Member, m.Score)
+	}
+	return result
+}
+
+// zmemberSize approximates map entry and skip list node of average level
+func zmemberSize(member string) int64 {
+	return 96 + int64(len(member))
+}
+
+// add returns true if member is new
+func (z *zsetValue) add(member string, score float64) bool {
+	old, exists := z.dict[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.zsl.delete(old, member)
+	} else {
+		z.used += zmemberSize(member)
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return !exists
+}
+
+func (z *zsetValue) remove(member string) bool {
+	score, exists := z.dict[member]
+	if !exists {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	z.used -= zmemberSize(member)
+	return true
+}
+
+func (z *zsetValue) typeName() string {
+	return "zset"
+}
+
+func (z *zsetValue) export() interface{} {
+	result := make(ZSet, 0, z.zsl.length)
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		result = append(result, ZMember{x.member, x.score})
+	}
+	return result
+}
+
+func (z *zsetValue) size() int64 {
+	return z.used
+}
+
+func (z *zsetValue) len() int {
+	return len(z.dict)
+}
+
+// zsetAt returns sorted set stored at the key, missing key gives nil set unless create is set.
+// Zero now disables expiration check. Must be called with mutex held
+func (s *kvStorage) zsetAt(key string, now time.Time, create bool) (*zsetValue, *entry, error) {
+	e, exists := s.lookup(key, now)
+	if !exists {
+		if !create {
+			return nil, nil, nil
+		}
+		e = s.create(key, newZSetValue())
+	}
+
+	z, ok := e.value.(*zsetValue)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	return z, e, nil
+}
+
+// zadd and zrem are shared by commands and append-only file replay, must be called with mutex held
+
+func (s *kvStorage) zadd(key string, members []ZMember, now time.Time) (int, error) {
+	z, e, err := s.zsetAt(key, now, true)
+	if err != nil {
+		return 0, err
+	}
+
+	kAdded := 0
+	for _, m := range members {
+		if z.add(m.Member, m.Score) {
+			kAdded += 1
+		}
+	}
+	s.resize(key, e)
+	return kAdded, nil
+}
+
+func (s *kvStorage) zrem(key string, members []string, now time.Time) (int, error) {
+	z, e, err := s.zsetAt(key, now, false)
+	if z == nil {
+		return 0, err
+	}
+
+	kRemoved := 0
+	for _, member := range members {
+		if z.remove(member) {
+			kRemoved += 1
+		}
+	}
+	if kRemoved > 0 {
+		s.resize(key, e)
+	}
+	return kRemoved, nil
+}
+
+// validScore accepts infinities like redis does, only NaN isn't a score
+func validScore(score float64) bool {
+	return !math.IsNaN(score)
+}
+
+// ZAdd adds members or updates their scores, returns number of added members.
+// Scores may be infinite, but NaN score gives ErrNotFloat
+func (s *kvStorage) ZAdd(key string, members ...ZMember) (int, error) {
+	if s.closed() {
+		panic("ZAdd over closed storage")
+	}
+	for _, m := range members {
+		if !validScore(m.Score) {
+			return 0, ErrNotFloat
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.zaddLocked(key, members, time.Now())
+}
+
+// zaddLocked must be called with mutex held and valid scores
+func (s *kvStorage) zaddLocked(key string, members []ZMember, now time.Time) (int, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	kAdded, err := s.zadd(key, members, now)
+	if err != nil {
+		return 0, err
+	}
+	s.dirty += 1
+	s.logZAdd(key, members)
+	s.events.emit(EventsZSet, EventZAdd, key)
+	return kAdded, nil
+}
+
+// ZIncrBy adds delta to score of the member, missing member is added with score delta
+func (s *kvStorage) ZIncrBy(key string, member string, delta float64) (float64, error) {
+	if s.closed() {
+		panic("ZIncrBy over closed storage")
+	}
+	if !validScore(delta) {
+		return 0, ErrNotFloat
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.zincrByLocked(key, member, delta, time.Now())
+}
+
+// zincrByLocked must be called with mutex held and valid delta
+func (s *kvStorage) zincrByLocked(key string, member string, delta float64, now time.Time) (float64, error) {
+	if err := s.admitWrite(); err != nil {
+		return 0, err
+	}
+	z, _, err := s.zsetAt(key, now, false)
+	if err != nil {
+		return 0, err
+	}
+	score := delta
+	if z != nil {
+		score += z.dict[member]
+	}
+	if !validScore(score) {
+		return 0, ErrScoreNaN
+	}
+
+	members := []ZMember{{member, score}}
+	s.zadd(key, members, now)
+	s.dirty += 1
+	s.logZAdd(key, members)
+	s.events.emit(EventsZSet, EventZIncr, key)
+	return score, nil
+}
+
+// ZRem returns number of removed members, sorted set without members is deleted
+func (s *kvStorage) ZRem(key string, members ...string) (int, error) {
+	if s.closed() {
+		panic("ZRem over closed storage")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.zremLocked(key, members, time.Now())
+}
+
+// zremLocked must be called with mutex held
+func (s *kvStorage) zremLocked(key string, members []string, now time.Time) (int, error) {
+	kRemoved, err := s.zrem(key, members, now)
+	if kRemoved > 0 {
+		s.dirty += 1
+		s.logZRem(key, members)
+		s.emitChange(EventsZSet, EventZRem, key)
+	}
+	return kRemoved, err
+}
+
+func (s *kvStorage) ZScore(key string, member string) (float64, bool, error) {
+	if s.closed() {
+		panic("ZScore over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	z, _, err := s.zsetAt(key, time.Now(), false)
+	if z == nil {
+		return 0, false, err
+	}
+	score, exists := z.dict[member]
+	return score, exists, nil
+}
+
+func (s *kvStorage) ZCard(key string) (int, error) {
+	if s.closed() {
+		panic("ZCard over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	z, _, err := s.zsetAt(key, time.Now(), false)
+	if z == nil {
+		return 0, err
+	}
+	return z.len(), nil
+}
+
+// ZRank returns 0-based position of the member ordered by score,
+// reverse counts from the highest score
+func (s *kvStorage) ZRank(key string, member string, reverse bool) (int, bool, error) {
+	if s.closed() {
+		panic("ZRank over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	z, _, err := s.zsetAt(key, time.Now(), false)
+	if z == nil {
+		return 0, false, err
+	}
+	score, exists := z.dict[member]
+	if !exists {
+		return 0, false, nil
+	}
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.len() - rank, true, nil
+	}
+	return rank - 1, true, nil
+}
+
+// ZRange returns members between start and stop ranks inclusive, negative ranks count from the end.
+// With reverse ranks are counted from the highest score
+func (s *kvStorage) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	if s.closed() {
+		panic("ZRange over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	z, e, err := s.zsetAt(key, now, false)
+	if z == nil {
+		return []ZMember{}, err
+	}
+	s.touch(e, now)
+
+	n := z.len()
+	start, stop, ok := normalizeRange(start, stop, n)
+	if !ok {
+		return []ZMember{}, nil
+	}
+	result := make([]ZMember, 0, stop - start + 1)
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.byRank(n - start)
+	} else {
+		x = z.zsl.byRank(start + 1)
+	}
+	for i := start; i <= stop; i += 1 {
+		result = append(result, ZMember{x.member, x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return result, nil
+}
+
+// ZRangeByScore returns members with scores within r
+func (s *kvStorage) ZRangeByScore(key string, r ScoreRange, opts RangeOptions) ([]ZMember, error) {
+	if s.closed() {
+		panic("ZRangeByScore over closed storage")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	z, e, err := s.zsetAt(key, now, false)
+	if z == nil {
+		return []ZMember{}, err
+	}
+	s.touch(e, now)
+
+	result := make([]ZMember, 0)
+	var x *zskiplistNode
+	if opts.Reverse {
+		x = z.zsl.lastInRange(r)
+	} else {
+		x = z.zsl.firstInRange(r)
+	}
+	next := func(x *zskiplistNode) *zskiplistNode {
+		if opts.Reverse {
+			return x.backward
+		}
+		return x.level[0].forward
+	}
+
+	if opts.Offset < 0 {
+		// like LIMIT of redis, negative offset gives nothing
+		return result, nil
+	}
+	for i := 0; i < opts.Offset && x != nil; i += 1 {
+		x = next(x)
+	}
+	for ; x != nil && (opts.Count <= 0 || len(result) < opts.Count); x = next(x) {
+		if (opts.Reverse && !r.aboveMin(x.score)) || (!opts.Reverse && !r.belowMax(x.score)) {
+			break
+		}
+		result = append(result, ZMember{x.member, x.score})
+	}
+	return result, nil
+}
+
+func (s *shardedStorage) ZAdd(key string, members ...ZMember) (int, error) {
+	return s.shards.shardOf(key).ZAdd(key, members...)
+}
+
+func (s *shardedStorage) ZIncrBy(key string, member string, delta float64) (float64, error) {
+	return s.shards.shardOf(key).ZIncrBy(key, member, delta)
+}
+
+func (s *shardedStorage) ZRem(key string, members ...string) (int, error) {
+	return s.shards.shardOf(key).ZRem(key, members...)
+}
+
+func (s *shardedStorage) ZScore(key string, member string) (float64, bool, error) {
+	return s.shards.shardOf(key).ZScore(key, member)
+}
+
+func (s *shardedStorage) ZCard(key string) (int, error) {
+	return s.shards.shardOf(key).ZCard(key)
+}
+
+func (s *shardedStorage) ZRank(key string, member string, reverse bool) (int, bool, error) {
+	return s.shards.shardOf(key).ZRank(key, member, reverse)
+}
+
+func (s *shardedStorage) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	return s.shards.shardOf(key).ZRange(key, start, stop, reverse)
+}
+
+func (s *shardedStorage) ZRangeByScore(key string, r ScoreRange, opts RangeOptions) ([]ZMember, error) {
+	return s.shards.shardOf(key).ZRangeByScore(key, r, opts)
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestZSetCommands(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	kAdded, err := data.ZAdd("board", ZMember{"alice", 10}, ZMember{"bob", 20}, ZMember{"carol", 15})
+	if err != nil || kAdded != 3 {
+		t.Fatalf("Subtest 1: ZAdd: expected 3 added members, got %d, %v\n", kAdded, err)
+	}
+	// score update is not an addition
+	if kAdded, _ = data.ZAdd("board", ZMember{"alice", 30}, ZMember{"dave", 5}); kAdded != 1 {
+		t.Fatalf("Subtest 1: ZAdd existing set: expected 1 added member, got %d\n", kAdded)
+	}
+	if _, err := data.ZAdd("board", ZMember{"eve", math.NaN()}); err != ErrNotFloat {
+		t.Fatalf("Subtest 1: ZAdd NaN score: expected %v, got %v\n", ErrNotFloat, err)
+	}
+
+	expected := []ZMember{{"dave", 5}, {"carol", 15}, {"bob", 20}, {"alice", 30}}
+	if members, _ := data.ZRange("board", 0, -1, false); !reflect.DeepEqual(members, expected) {
+		t.Fatalf("Subtest 2: ZRange: expected %v, got %v\n", expected, members)
+	}
+	if members, _ := data.ZRange("board", 0, 1, true); !reflect.DeepEqual(members, []ZMember{{"alice", 30}, {"bob", 20}}) {
+		t.Fatalf("Subtest 2: ZRange reverse: expected top 2, got %v\n", members)
+	}
+	if rank, exists, _ := data.ZRank("board", "carol", false); !exists || rank != 1 {
+		t.Fatalf("Subtest 2: ZRank carol: expected 1, got %d\n", rank)
+	}
+	if rank, _, _ := data.ZRank("board", "carol", true); rank != 2 {
+		t.Fatalf("Subtest 2: ZRank reverse carol: expected 2, got %d\n", rank)
+	}
+	if _, exists, _ := data.ZRank("board", "missing", false); exists {
+		t.Fatalf("Subtest 2: ZRank of missing member: expected nothing\n")
+	}
+
+	if score, err := data.ZIncrBy("board", "dave", 20); err != nil || score != 25 {
+		t.Fatalf("Subtest 3: ZIncrBy: expected 25, got %v, %v\n", score, err)
+	}
+	if rank, _, _ := data.ZRank("board", "dave", false); rank != 2 {
+		t.Fatalf("Subtest 3: ZRank after ZIncrBy: expected 2, got %d\n", rank)
+	}
+	if score, _ := data.ZIncrBy("board", "frank", 1.5); score != 1.5 {
+		t.Fatalf("Subtest 3: ZIncrBy of missing member: expected 1.5, got %v\n", score)
+	}
+	if score, exists, _ := data.ZScore("board", "frank"); !exists || score != 1.5 {
+		t.Fatalf("Subtest 3: ZScore: expected 1.5, got %v\n", score)
+	}
+
+	if kRemoved, _ := data.ZRem("board", "frank", "missing"); kRemoved != 1 {
+		t.Fatalf("Subtest 4: ZRem: expected 1 removed member, got %d\n", kRemoved)
+	}
+	if n, _ := data.ZCard("board"); n != 4 {
+		t.Fatalf("Subtest 4: ZCard: expected 4, got %d\n", n)
+	}
+	data.ZRem("board", "alice", "bob", "carol", "dave")
+	if typ := data.Type("board"); typ != "none" {
+		t.Fatalf("Subtest 4: sorted set without members must be deleted, got type %s\n", typ)
+	}
+
+	// infinite scores are accepted like in redis
+	if _, err := data.ZAdd("inf", ZMember{"top", math.Inf(1)}, ZMember{"bottom", math.Inf(-1)}); err != nil {
+		t.Fatalf("Subtest 5: ZAdd infinite scores: unexpected error %v\n", err)
+	}
+	max, _ := ParseScoreBound("+inf")
+	r := ScoreRange{max, max}
+	if members, _ := data.ZRangeByScore("inf", r, RangeOptions{}); !reflect.DeepEqual(members, []ZMember{{"top", math.Inf(1)}}) {
+		t.Fatalf("Subtest 5: ZRangeByScore of +inf: got %v\n", members)
+	}
+	if _, err := data.ZIncrBy("inf", "top", math.Inf(-1)); err != ErrScoreNaN {
+		t.Fatalf("Subtest 5: ZIncrBy giving NaN: expected %v, got %v\n", ErrScoreNaN, err)
+	}
+}
+
+func TestZRangeByScore(t *testing.T) {
+	data := New(0)
+	defer data.Close()
+
+	for i := 1; i <= 10; i += 1 {
+		data.ZAdd("z", ZMember{"m" + strconv.Itoa(i), float64(i)})
+	}
+	bound := func(s string) ScoreBound {
+		b, err := ParseScoreBound(s)
+		if err != nil {
+			t.Fatalf("ParseScoreBound %s: unexpected error %v\n", s, err)
+		}
+		return b
+	}
+	scores := func(members []ZMember) []float64 {
+		result := []float64{}
+		for _, m := range members {
+			result = append(result, m.Score)
+		}
+		return result
+	}
+
+	cases := []struct{
+		min, max string
+		opts RangeOptions
+		expected []float64
+	}{
+		{"3", "5", RangeOptions{}, []float64{3, 4, 5}},
+		{"(3", "(5", RangeOptions{}, []float64{4}},
+		{"-inf", "(3", RangeOptions{}, []float64{1, 2}},
+		{"(8", "+inf", RangeOptions{}, []float64{9, 10}},
+		{"3", "5", RangeOptions{Reverse: true}, []float64{5, 4, 3}},
+		{"(3", "+inf", RangeOptions{Reverse: true, Offset: 1, Count: 2}, []float64{9, 8}},
+		{"-inf", "+inf", RangeOptions{Offset: 8}, []float64{9, 10}},
+		{"-inf", "+inf", RangeOptions{Offset: 20}, []float64{}},
+		{"-inf", "+inf", RangeOptions{Offset: -1}, []float64{}},
+		{"5", "(5", RangeOptions{}, []float64{}},
+		{"6", "4", RangeOptions{}, []float64{}},
+		{"10.5", "20", RangeOptions{}, []float64{}},
+	}
+	for _, c := range cases {
+		r := ScoreRange{bound(c.min), bound(c.max)}
+		members, _ := data.ZRangeByScore("z", r, c.opts)
+		if result := scores(members); !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("ZRangeByScore %s %s %+v: expected %v, got %v\n", c.min, c.max, c.opts, c.expected, result)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "(", "nan"} {
+		if _, err := ParseScoreBound(s); err != ErrScoreBound {
+			t.Errorf("ParseScoreBound %q: expected %v, got %v\n", s, ErrScoreBound, err)
+		}
+	}
+}
+
+// TestZSkiplistRandom compares skip list with sorted slice after random operations
+func TestZSkiplistRandom(t *testing.T) {
+	z := newZSetValue()
+	reference := map[string]float64{}
+	for i := 0; i < 5000; i += 1 {
+		member := "m" + strconv.Itoa(rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			z.remove(member)
+			delete(reference, member)
+		} else {
+			// few distinct scores so that ties are ordered by member
+			score := float64(rand.Intn(50))
+			z.add(member, score)
+			reference[member] = score
+		}
+	}
+
+	expected := ZSet{}
+	for member, score := range reference {
+		expected = append(expected, ZMember{member, score})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].Score < expected[j].Score ||
+			(expected[i].Score == expected[j].Score && expected[i].Member < expected[j].Member)
+	})
+	if result := z.export(); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Skip list order differs from sorted members\n")
+	}
+	for i, m := range expected {
+		if rank := z.zsl.rank(m.Score, m.Member); rank != i + 1 {
+			t.Fatalf("rank of %s: expected %d, got %d\n", m.Member, i + 1, rank)
+		}
+		if x := z.zsl.byRank(i + 1); x.member != m.Member {
+			t.Fatalf("byRank %d: expected %s, got %s\n", i + 1, m.Member, x.member)
+		}
+	}
+	// backward links
+	i := len(expected) - 1
+	for x := z.zsl.tail; x != nil; x = x.backward {
+		if x.member != expected[i].Member {
+			t.Fatalf("backward walk at %d: expected %s, got %s\n", i, expected[i].Member, x.member)
+		}
+		i -= 1
+	}
+}
+
+func TestZSetPersistence(t *testing.T) {
+	dir := t.TempDir()
+	aof := filepath.Join(dir, "appendonly.taof")
+	snapshot := filepath.Join(dir, "dump.trdb")
+
+	data := New(0, WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0))
+	data.ZAdd("z", ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3})
+	data.ZIncrBy("z", "a", 10)
+	data.ZRem("z", "b")
+	data.Save()
+	data.Close()
+
+	for _, opt := range []Option{WithAppendOnly(aof, FsyncNever), WithSnapshot(snapshot, 0)} {
+		data = New(0, opt)
+		if members, _ := data.ZRange("z", 0, -1, false); !reflect.DeepEqual(members, []ZMember{{"c", 3}, {"a", 11}}) {
+			t.Errorf("ZRange after restart: expected [{c 3} {a 11}], got %v\n", members)
+		}
+		data.Close()
+	}
+}
+
+// benchmarks share sorted set of zsetBenchSize members, since building it takes a while.
+// Members are only updated, so its cardinality stays the same
+
+var (
+	zsetBenchSize = 1000000
+	zsetBenchOnce sync.Once
+	zsetBenchData Storage
+)
+
+func newBenchZSet(b *testing.B) Storage {
+	zsetBenchOnce.Do(func() {
+		zsetBenchData = New(0)
+		members := make([]ZMember, zsetBenchSize)
+		for i := range members {
+			members[i] = ZMember{"member:" + strconv.Itoa(i), rand.Float64() * float64(zsetBenchSize)}
+		}
+		zsetBenchData.ZAdd("z", members...)
+	})
+	b.ResetTimer()
+	return zsetBenchData
+}
+
+func BenchmarkZAddLarge(b *testing.B) {
+	data := newBenchZSet(b)
+
+	for i := 0; i < b.N; i += 1 {
+		data.ZAdd("z", ZMember{"member:" + strconv.Itoa(rand.Intn(zsetBenchSize)), rand.Float64() * float64(zsetBenchSize)})
+	}
+}
+
+func BenchmarkZRankLarge(b *testing.B) {
+	data := newBenchZSet(b)
+
+	for i := 0; i < b.N; i += 1 {
+		data.ZRank("z", "member:" + strconv.Itoa(rand.Intn(zsetBenchSize)), false)
+	}
+}
+
+func BenchmarkZRangeLarge(b *testing.B) {
+	data := newBenchZSet(b)
+
+	for i := 0; i < b.N; i += 1 {
+		start := rand.Intn(zsetBenchSize - 10)
+		data.ZRange("z", start, start + 9, false)
+	}
+}
+
+func BenchmarkZRangeByScoreLarge(b *testing.B) {
+	data := newBenchZSet(b)
+
+	opts := RangeOptions{Offset: 5, Count: 10}
+	for i := 0; i < b.N; i += 1 {
+		min := rand.Float64() * float64(zsetBenchSize)
+		r := ScoreRange{ScoreBound{Value: min}, ScoreBound{Value: min + 100, Exclusive: true}}
+		data.ZRangeByScore("z", r, opts)
+	}
+}